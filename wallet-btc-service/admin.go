@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/BlockABC/wallet-btc-service/common/config"
+	"github.com/BlockABC/wallet-btc-service/common/log"
+	"github.com/BlockABC/wallet-btc-service/database"
+	"github.com/BlockABC/wallet-btc-service/notify"
+)
+
+// command of wallet-btc-admin, args are what follows the command name
+type command struct {
+	Usage string
+	Args  int
+	Run   func(args []string) error
+}
+
+var allCommand = map[string]command{
+	"status":         {"print indexer status", 0, status},
+	"reindex":        {"<begin> <end>  delete and save again the blocks from height begin to end", 2, reindex},
+	"refetch-block":  {"<hash|height>  delete and save again one block of the node best chain", 1, refetchBlock},
+	"refetch-tx":     {"<txid>  delete and save again one transaction, into redis if unconfirmed", 1, refetchTransaction},
+	"rebuild-state":  {"<begin> <end>  rebuild output state, input from and address balance from height begin to end", 2, rebuildState},
+	"resync-mempool": {"sync the unconfirmed transactions in redis with the node mempool", 0, resyncMempool},
+	"rescan-address": {"<address>  rebuild state, from and balance of the blocks the address is in", 1, rescanAddress},
+}
+
+var commandOrder = []string{"status", "reindex", "refetch-block", "refetch-tx", "rebuild-state", "resync-mempool", "rescan-address"}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+
+	args := flag.Args()
+	if 0 == len(args) {
+		usage()
+		os.Exit(2)
+	}
+	oneCommand, ok := allCommand[args[0]]
+	if !ok || len(args)-1 != oneCommand.Args {
+		usage()
+		os.Exit(2)
+	}
+
+	// initialize database
+	dbOpt := config.Cfg.DbOpt
+	err := database.Initialize(dbOpt.Address, dbOpt.User, dbOpt.Password, dbOpt.DbName, dbOpt.MaxOpenConn, dbOpt.MaxIdleConn, dbOpt.MaxWaitTimeout)
+	if err != nil {
+		panic(err)
+	}
+
+	if err := database.InitRedis(config.Cfg.RedisOpt.RedisAddress, config.Cfg.RedisOpt.RedisDbNum); nil != err {
+		panic(err)
+	}
+
+	// blocks and transactions failed to save are queued for the client to repair
+	if err := notify.InitRepairManager(); nil != err {
+		panic(err)
+	}
+
+	log.Log.Notice("wallet-btc-admin run command: ", args)
+	if err := oneCommand.Run(args[1:]); nil != err {
+		log.Log.Error(err, " wallet-btc-admin command fail: ", args)
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+	log.Log.Notice("wallet-btc-admin command success: ", args)
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: wallet-btc-admin <command> [args]")
+	fmt.Fprintln(os.Stderr, "run next to wallet-btc-service.toml, heights are inclusive")
+	fmt.Fprintln(os.Stderr, "commands:")
+	for _, name := range commandOrder {
+		fmt.Fprintf(os.Stderr, "  %-16s %s\n", name, allCommand[name].Usage)
+	}
+}
+
+// parseRange returns [begin, end + 1) of the inclusive heights
+func parseRange(args []string) (error, int32, int32) {
+	begin, beginErr := strconv.ParseInt(args[0], 10, 32)
+	end, endErr := strconv.ParseInt(args[1], 10, 32)
+	if nil != beginErr || nil != endErr || begin < 0 || end < begin {
+		return errors.New("invalid height range"), 0, 0
+	}
+	return nil, int32(begin), int32(end) + 1
+}
+
+func status(args []string) error {
+	result, err := json.MarshalIndent(notify.GetIndexerStatus(), "", "  ")
+	if nil != err {
+		return err
+	}
+	fmt.Println(string(result))
+	return nil
+}
+
+func reindex(args []string) error {
+	err, begin, end := parseRange(args)
+	if nil != err {
+		return err
+	}
+	return notify.ReindexBlocks(begin, end)
+}
+
+func refetchBlock(args []string) error {
+	hash := args[0]
+	if height, err := strconv.ParseInt(args[0], 10, 32); nil == err {
+		if err, hash = notify.GetBlockHashWithHeight(int32(height)); nil != err {
+			return err
+		}
+	}
+	return notify.RefetchBlock(hash)
+}
+
+func refetchTransaction(args []string) error {
+	return notify.RefetchTransaction(args[0])
+}
+
+func rebuildState(args []string) error {
+	err, begin, end := parseRange(args)
+	if nil != err {
+		return err
+	}
+	return notify.RebuildStateAndFrom(begin, end)
+}
+
+func resyncMempool(args []string) error {
+	return notify.ResyncMempool()
+}
+
+func rescanAddress(args []string) error {
+	return notify.RescanAddress(args[0])
+}
@@ -0,0 +1,237 @@
+package apikey
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BlockABC/wallet-btc-service/common/config"
+	"github.com/BlockABC/wallet-btc-service/common/log"
+	"github.com/BlockABC/wallet-btc-service/database"
+	"github.com/BlockABC/wallet-btc-service/database/tables"
+)
+
+// state of t_api_key_info
+const (
+	KEYACTIVE   = 0
+	KEYDISABLED = 1
+)
+
+const (
+	KEYLEN    = 32
+	PREFIXLEN = 8
+)
+
+var (
+	ErrKeyNotFind = errors.New("api key not find")
+	ErrInvalidKey = errors.New("api key invalid")
+)
+
+// cached key, a missing key is cached as nil
+type cacheEntry struct {
+	info   *tables.TableApiKeyInfo
+	expire int64
+}
+
+var (
+	cacheMutex sync.Mutex
+	keyCache   = make(map[string]cacheEntry)
+
+	// origins of every active key, for cors preflight requests that carry no key
+	allOrigins       map[string]bool
+	allOriginsExpire int64
+)
+
+// HashKey returns the stored hash of an api key
+func HashKey(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(hash[:])
+}
+
+// Create saves a new api key, the key itself is returned only here
+func Create(name string, rateLimit int, maxAddresses int, origins string) (error, string, *tables.TableApiKeyInfo) {
+	random := make([]byte, KEYLEN)
+	if _, err := rand.Read(random); nil != err {
+		log.Log.Error(err, " generate api key fail")
+		return err, "", nil
+	}
+	key := hex.EncodeToString(random)
+
+	now := time.Now().Unix()
+	oneKey := tables.TableApiKeyInfo{
+		Keyhash:      HashKey(key),
+		Prefix:       key[:PREFIXLEN],
+		Name:         name,
+		Ratelimit:    rateLimit,
+		Maxaddresses: maxAddresses,
+		Origins:      normalizeOrigins(origins),
+		State:        KEYACTIVE,
+		Createtime:   now,
+		Updatetime:   now,
+	}
+	if err := database.Db.Create(&oneKey).Error; nil != err {
+		log.Log.Error(err, " insert into t_api_key_info fail, name: ", name)
+		return err, "", nil
+	}
+	resetCache()
+	return nil, key, &oneKey
+}
+
+// GetKey returns the api key of id, ErrKeyNotFind if there is none
+func GetKey(id int64) (error, *tables.TableApiKeyInfo) {
+	var result []tables.TableApiKeyInfo
+	if err := database.Db.Where("id = ?", id).Find(&result).Error; nil != err {
+		log.Log.Error(err, " select * from t_api_key_info fail, id: ", id)
+		return err, nil
+	}
+	if 0 == len(result) {
+		return ErrKeyNotFind, nil
+	}
+	return nil, &result[0]
+}
+
+// GetAllKey returns every api key
+func GetAllKey() (error, []tables.TableApiKeyInfo) {
+	var result []tables.TableApiKeyInfo
+	if err := database.Db.Order("id").Find(&result).Error; nil != err {
+		log.Log.Error(err, " select * from t_api_key_info fail")
+		return err, nil
+	}
+	return nil, result
+}
+
+// Update changes the limits, origins and state of an api key
+func Update(id int64, rateLimit int, maxAddresses int, origins string, state int8) error {
+	if KEYACTIVE != state && KEYDISABLED != state {
+		return ErrInvalidKey
+	}
+	err, _ := GetKey(id)
+	if nil != err {
+		return err
+	}
+
+	updateSql := "update t_api_key_info set ratelimit = ?, maxaddresses = ?, origins = ?, state = ?, updatetime = ? where id = ?;"
+	if err := database.Db.Exec(updateSql, rateLimit, maxAddresses, normalizeOrigins(origins), state, time.Now().Unix(), id).Error; nil != err {
+		log.Log.Error(err, " update t_api_key_info fail, id: ", id)
+		return err
+	}
+	resetCache()
+	return nil
+}
+
+// Delete removes an api key
+func Delete(id int64) error {
+	result := database.Db.Exec("delete from t_api_key_info where id = ?;", id)
+	if err := result.Error; nil != err {
+		log.Log.Error(err, " delete from t_api_key_info fail, id: ", id)
+		return err
+	}
+	if 0 == result.RowsAffected {
+		return ErrKeyNotFind
+	}
+	resetCache()
+	return nil
+}
+
+// Lookup returns the active api key, ErrInvalidKey if it is unknown or disabled. Keys are cached for
+// api.keycachetime seconds, so a change made by another process applies after that.
+func Lookup(key string) (error, *tables.TableApiKeyInfo) {
+	hash := HashKey(key)
+	now := time.Now().Unix()
+
+	cacheMutex.Lock()
+	entry, ok := keyCache[hash]
+	cacheMutex.Unlock()
+	if !ok || entry.expire < now {
+		var result []tables.TableApiKeyInfo
+		if err := database.Db.Where("keyhash = ? AND state = ?", hash, KEYACTIVE).Find(&result).Error; nil != err {
+			log.Log.Error(err, " select * from t_api_key_info fail")
+			return err, nil
+		}
+		entry = cacheEntry{expire: now + int64(config.Cfg.ApiOpt.KeyCacheTime)}
+		if 0 != len(result) {
+			entry.info = &result[0]
+		}
+
+		cacheMutex.Lock()
+		keyCache[hash] = entry
+		cacheMutex.Unlock()
+	}
+
+	if nil == entry.info {
+		return ErrInvalidKey, nil
+	}
+	return nil, entry.info
+}
+
+// resetCache drops the cached keys after a change
+func resetCache() {
+	cacheMutex.Lock()
+	keyCache = make(map[string]cacheEntry)
+	allOriginsExpire = 0
+	cacheMutex.Unlock()
+}
+
+// normalizeOrigins trims the comma separated origins
+func normalizeOrigins(origins string) string {
+	result := make([]string, 0)
+	for _, oneOrigin := range strings.Split(origins, ",") {
+		if oneOrigin = strings.TrimRight(strings.TrimSpace(oneOrigin), "/"); "" != oneOrigin {
+			result = append(result, oneOrigin)
+		}
+	}
+	return strings.Join(result, ",")
+}
+
+// KeyOrigins returns the cors origins of an api key, the configured ones if it has none
+func KeyOrigins(info *tables.TableApiKeyInfo) string {
+	if nil == info || "" == info.Origins {
+		return config.Cfg.ApiOpt.Origins
+	}
+	return info.Origins
+}
+
+// AllowsOrigin reports if the comma separated origins contain the origin, "*" allows any
+func AllowsOrigin(origins string, origin string) bool {
+	for _, oneOrigin := range strings.Split(origins, ",") {
+		oneOrigin = strings.TrimSpace(oneOrigin)
+		if "*" == oneOrigin || strings.EqualFold(strings.TrimRight(oneOrigin, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// AnyAllowsOrigin reports if the configured origins or an active api key allow the origin
+func AnyAllowsOrigin(origin string) bool {
+	if AllowsOrigin(config.Cfg.ApiOpt.Origins, origin) {
+		return true
+	}
+
+	now := time.Now().Unix()
+	cacheMutex.Lock()
+	origins, expire := allOrigins, allOriginsExpire
+	cacheMutex.Unlock()
+	if nil == origins || expire < now {
+		var allKey []tables.TableApiKeyInfo
+		if err := database.Db.Where("state = ? AND origins != ''", KEYACTIVE).Find(&allKey).Error; nil != err {
+			log.Log.Error(err, " select * from t_api_key_info fail")
+			return false
+		}
+		origins = make(map[string]bool)
+		for _, oneKey := range allKey {
+			for _, oneOrigin := range strings.Split(oneKey.Origins, ",") {
+				origins[strings.ToLower(oneOrigin)] = true
+			}
+		}
+
+		cacheMutex.Lock()
+		allOrigins, allOriginsExpire = origins, now+int64(config.Cfg.ApiOpt.KeyCacheTime)
+		cacheMutex.Unlock()
+	}
+	return origins["*"] || origins[strings.ToLower(strings.TrimRight(origin, "/"))]
+}
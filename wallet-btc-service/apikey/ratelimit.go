@@ -0,0 +1,122 @@
+package apikey
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BlockABC/wallet-btc-service/common/config"
+	"github.com/BlockABC/wallet-btc-service/common/log"
+	"github.com/BlockABC/wallet-btc-service/database"
+)
+
+const (
+	REDISRATELIMITKEY = "RateLimit_" // request count of a bucket in a window
+	RATEWINDOW        = 60           // seconds
+)
+
+// state of a rate limit bucket in the current window, Reset is the unix time the window ends
+type Window struct {
+	Limit     int
+	Remaining int
+	Reset     int64
+}
+
+var (
+	endpointOnce   sync.Once
+	endpointLimits map[string]int
+)
+
+// Allow counts a request in the current window of the bucket, it is allowed while the count is within the
+// limit. A redis error allows the request, the api does not go down with redis.
+func Allow(bucket string, limit int) (error, bool, Window) {
+	now := time.Now().Unix()
+	start := now - now%RATEWINDOW
+	window := Window{Limit: limit, Remaining: limit, Reset: start + RATEWINDOW}
+
+	key := fmt.Sprintf("%s%s_%d", REDISRATELIMITKEY, bucket, start)
+	pipe := database.RedisDb.TxPipeline()
+	incr := pipe.Incr(key)
+	pipe.Expire(key, 2*RATEWINDOW*time.Second)
+	if _, err := pipe.Exec(); nil != err {
+		log.Log.Error(err, " count rate limit fail, bucket: ", bucket)
+		return err, true, window
+	}
+
+	count := int(incr.Val())
+	if count < limit {
+		window.Remaining = limit - count
+	} else {
+		window.Remaining = 0
+	}
+	return nil, count <= limit, window
+}
+
+// ParseEndpointLimits parses "path:requests per minute" separated by comma
+func ParseEndpointLimits(limits string) (error, map[string]int) {
+	result := make(map[string]int)
+	for _, oneLimit := range strings.Split(limits, ",") {
+		if oneLimit = strings.TrimSpace(oneLimit); "" == oneLimit {
+			continue
+		}
+		index := strings.LastIndex(oneLimit, ":")
+		if index <= 0 {
+			return fmt.Errorf("invalid endpoint limit: %s", oneLimit), nil
+		}
+		value, err := strconv.Atoi(strings.TrimSpace(oneLimit[index+1:]))
+		if nil != err || value <= 0 {
+			return fmt.Errorf("invalid endpoint limit: %s", oneLimit), nil
+		}
+		result[strings.TrimSpace(oneLimit[:index])] = value
+	}
+	return nil, result
+}
+
+// EndpointLimit returns the requests per minute of the path in api.endpointlimits, 0 if it has none
+func EndpointLimit(path string) int {
+	endpointOnce.Do(func() {
+		err, limits := ParseEndpointLimits(config.Cfg.ApiOpt.EndpointLimits)
+		if nil != err {
+			log.Log.Error(err, " parse api.endpointlimits fail")
+			limits = make(map[string]int)
+		}
+		endpointLimits = limits
+	})
+	return endpointLimits[path]
+}
+
+// CountAddresses returns the addresses in a json request body, the strings of a top level array or of the
+// top level fields named like address
+func CountAddresses(body []byte) int {
+	var request interface{}
+	if err := json.Unmarshal(body, &request); nil != err {
+		return 0
+	}
+
+	count := 0
+	switch value := request.(type) {
+	case []interface{}:
+		count += countString(value)
+	case map[string]interface{}:
+		for name, field := range value {
+			if allField, ok := field.([]interface{}); ok && strings.Contains(strings.ToLower(name), "address") {
+				count += countString(allField)
+			}
+		}
+	}
+	return count
+}
+
+// countString returns the strings in a json array
+func countString(values []interface{}) int {
+	count := 0
+	for _, oneValue := range values {
+		if _, ok := oneValue.(string); ok {
+			count++
+		}
+	}
+	return count
+}
@@ -5,6 +5,7 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/BlockABC/wallet-btc-service/common/config"
 	"github.com/BlockABC/wallet-btc-service/common/log"
@@ -13,11 +14,12 @@ import (
 	"github.com/BlockABC/wallet-btc-service/notify"
 	"github.com/BlockABC/wallet-btc-service/omni"
 	"github.com/BlockABC/wallet-btc-service/timer"
+	"github.com/BlockABC/wallet-btc-service/webhook"
 )
 
 func main() {
 	log.Log.Notice("start bitcoin client database process...")
-	ctx := context.Background()
+	ctx, cancel := context.WithCancel(context.Background())
 
 	// initialize database
 	dbOpt := config.Cfg.DbOpt
@@ -31,7 +33,22 @@ func main() {
 	}
 
 	// initialize repair
-	notify.InitRepairManager()
+	if err := notify.InitRepairManager(); nil != err {
+		panic(err)
+	}
+
+	// metrics computed on scrape
+	notify.RegisterMetrics()
+
+	// index unconfirmed transaction by address
+	if err := notify.RebuildRedisAddressIndex(); nil != err {
+		panic(err)
+	}
+
+	// build address balance of the stored blocks before new blocks are ingested
+	if err := notify.InitAddressBalance(); nil != err {
+		panic(err)
+	}
 
 	// set block repair begin
 	if err, height := filestore.RepairStoreInstance.GetBlockBegin(); nil == err {
@@ -44,12 +61,46 @@ func main() {
 	}
 
 	// start timer task
-	go timer.StartTimer()
+	go timer.StartTimer(ctx)
+
+	// deliver webhook events
+	go webhook.Start(ctx)
 
 	// start listen notification
-	go notify.StartHttpServer(config.Cfg, ctx)
+	serverDone := make(chan struct{})
+	go func() {
+		defer close(serverDone)
+		if err := notify.StartHttpServer(config.Cfg, ctx); nil != err {
+			log.Log.Error(err, " notify http server fail")
+		}
+	}()
+
+	// start ingest source, http push is always served by the notify server
+	switch config.Cfg.BtcOpt.IngestSource {
+	case "poll":
+		// blocks are pulled from the node instead of pushed
+		go notify.StartFollower(ctx)
+	case "zmq":
+		go notify.StartZmqSubscriber(ctx)
+	}
 
 	wait()
+	shutdown(cancel, serverDone)
+}
+
+// shutdown stops accepting notifications and lets the requests being served, the blocks being saved and the
+// timer tasks finish within btc.shutdowntimeout, the blocks not saved by then are stored for repair
+func shutdown(cancel context.CancelFunc, serverDone <-chan struct{}) {
+	deadline := time.Now().Add(time.Duration(config.Cfg.BtcOpt.ShutdownTimeout) * time.Second)
+
+	notify.Stop()
+	cancel()
+	<-serverDone
+
+	notify.Drain(time.Until(deadline))
+	timer.Wait(time.Until(deadline))
+	notify.FlushRepair()
+	log.Log.Notice("wallet-btc-client stopped")
 }
 
 //capture single
@@ -0,0 +1,28 @@
+package address
+
+import (
+	"github.com/BlockABC/wallet-btc-service/common/chaincfg"
+)
+
+func EncodePubKeyHash(hash []byte, params *chaincfg.Params) string {
+	return Base58CheckEncode(params.PubKeyHashAddrID, hash)
+}
+
+func EncodeScriptHash(hash []byte, params *chaincfg.Params) string {
+	return Base58CheckEncode(params.ScriptHashAddrID, hash)
+}
+
+// EncodeSegwit encodes a witness program, version 0 uses bech32 and later versions bech32m
+func EncodeSegwit(version byte, program []byte, params *chaincfg.Params) (string, error) {
+	data, err := ConvertBits(program, 8, 5, true)
+	if nil != err {
+		return "", err
+	}
+
+	constant := uint32(Bech32Const)
+	if 0 != version {
+		constant = Bech32mConst
+	}
+
+	return Bech32Encode(params.Bech32HRPSegwit, append([]byte{version}, data...), constant), nil
+}
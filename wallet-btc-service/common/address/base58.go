@@ -0,0 +1,97 @@
+package address
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+
+	"github.com/BlockABC/wallet-btc-service/common/crypto"
+)
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+var (
+	ErrInvalidBase58Char = errors.New("invalid base58 character")
+	ErrBase58Checksum    = errors.New("invalid base58 checksum")
+	ErrBase58TooShort    = errors.New("base58 data too short")
+
+	base58Index [256]int
+	bigRadix    = big.NewInt(58)
+)
+
+func init() {
+	for i := range base58Index {
+		base58Index[i] = -1
+	}
+	for i := 0; i < len(base58Alphabet); i++ {
+		base58Index[base58Alphabet[i]] = i
+	}
+}
+
+func Base58Encode(data []byte) string {
+	x := new(big.Int).SetBytes(data)
+	mod := new(big.Int)
+	result := make([]byte, 0, len(data)*138/100+1)
+	for x.Sign() > 0 {
+		x.DivMod(x, bigRadix, mod)
+		result = append(result, base58Alphabet[mod.Int64()])
+	}
+
+	// leading zero bytes
+	for _, one := range data {
+		if 0 != one {
+			break
+		}
+		result = append(result, base58Alphabet[0])
+	}
+
+	for i, j := 0, len(result)-1; i < j; i, j = i+1, j-1 {
+		result[i], result[j] = result[j], result[i]
+	}
+	return string(result)
+}
+
+func Base58Decode(str string) ([]byte, error) {
+	x := new(big.Int)
+	for i := 0; i < len(str); i++ {
+		index := base58Index[str[i]]
+		if index < 0 {
+			return nil, ErrInvalidBase58Char
+		}
+		x.Mul(x, bigRadix)
+		x.Add(x, big.NewInt(int64(index)))
+	}
+
+	zeros := 0
+	for zeros < len(str) && base58Alphabet[0] == str[zeros] {
+		zeros++
+	}
+
+	return append(make([]byte, zeros), x.Bytes()...), nil
+}
+
+// Base58CheckEncode encodes version, payload and a four byte checksum
+func Base58CheckEncode(version byte, payload []byte) string {
+	data := make([]byte, 0, 1+len(payload)+4)
+	data = append(data, version)
+	data = append(data, payload...)
+	data = append(data, crypto.DoubleSha256(data)[:4]...)
+	return Base58Encode(data)
+}
+
+func Base58CheckDecode(str string) (byte, []byte, error) {
+	data, err := Base58Decode(str)
+	if nil != err {
+		return 0, nil, err
+	}
+	if len(data) < 5 {
+		return 0, nil, ErrBase58TooShort
+	}
+
+	checksum := crypto.DoubleSha256(data[:len(data)-4])[:4]
+	if !bytes.Equal(checksum, data[len(data)-4:]) {
+		return 0, nil, ErrBase58Checksum
+	}
+
+	return data[0], data[1 : len(data)-4], nil
+}
@@ -0,0 +1,134 @@
+package address
+
+import (
+	"errors"
+	"strings"
+)
+
+const bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+// checksum constants of BIP173 and BIP350
+const (
+	Bech32Const  = 1
+	Bech32mConst = 0x2bc830a3
+)
+
+var (
+	ErrBech32Length   = errors.New("invalid bech32 length")
+	ErrBech32Case     = errors.New("mixed case bech32 string")
+	ErrBech32Char     = errors.New("invalid bech32 character")
+	ErrBech32Checksum = errors.New("invalid bech32 checksum")
+	ErrBech32Padding  = errors.New("invalid bech32 padding")
+)
+
+func bech32Polymod(values []byte) uint32 {
+	generator := [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+	chk := uint32(1)
+	for _, value := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(value)
+		for i := 0; i < 5; i++ {
+			if 0 != (top>>uint(i))&1 {
+				chk ^= generator[i]
+			}
+		}
+	}
+	return chk
+}
+
+func bech32HrpExpand(hrp string) []byte {
+	result := make([]byte, 0, len(hrp)*2+1)
+	for i := 0; i < len(hrp); i++ {
+		result = append(result, hrp[i]>>5)
+	}
+	result = append(result, 0)
+	for i := 0; i < len(hrp); i++ {
+		result = append(result, hrp[i]&31)
+	}
+	return result
+}
+
+// Bech32Encode encodes 5 bit data with the checksum constant of bech32 or bech32m
+func Bech32Encode(hrp string, data []byte, constant uint32) string {
+	values := append(bech32HrpExpand(hrp), data...)
+	polymod := bech32Polymod(append(values, 0, 0, 0, 0, 0, 0)) ^ constant
+
+	var result strings.Builder
+	result.WriteString(hrp)
+	result.WriteByte('1')
+	for _, one := range data {
+		result.WriteByte(bech32Charset[one])
+	}
+	for i := 0; i < 6; i++ {
+		result.WriteByte(bech32Charset[(polymod>>uint(5*(5-i)))&31])
+	}
+	return result.String()
+}
+
+// Bech32Decode returns hrp, 5 bit data and the checksum constant the string was encoded with
+func Bech32Decode(str string) (string, []byte, uint32, error) {
+	if len(str) < 8 || len(str) > 90 {
+		return "", nil, 0, ErrBech32Length
+	}
+	if strings.ToLower(str) != str && strings.ToUpper(str) != str {
+		return "", nil, 0, ErrBech32Case
+	}
+	str = strings.ToLower(str)
+
+	pos := strings.LastIndexByte(str, '1')
+	if pos < 1 || pos+7 > len(str) {
+		return "", nil, 0, ErrBech32Length
+	}
+
+	hrp := str[:pos]
+	for i := 0; i < len(hrp); i++ {
+		if hrp[i] < 33 || hrp[i] > 126 {
+			return "", nil, 0, ErrBech32Char
+		}
+	}
+
+	data := make([]byte, 0, len(str)-pos-1)
+	for i := pos + 1; i < len(str); i++ {
+		index := strings.IndexByte(bech32Charset, str[i])
+		if index < 0 {
+			return "", nil, 0, ErrBech32Char
+		}
+		data = append(data, byte(index))
+	}
+
+	constant := bech32Polymod(append(bech32HrpExpand(hrp), data...))
+	if Bech32Const != constant && Bech32mConst != constant {
+		return "", nil, 0, ErrBech32Checksum
+	}
+
+	return hrp, data[:len(data)-6], constant, nil
+}
+
+// ConvertBits regroups data from fromBits to toBits per element
+func ConvertBits(data []byte, fromBits, toBits uint, pad bool) ([]byte, error) {
+	acc := uint32(0)
+	bits := uint(0)
+	maxv := uint32(1)<<toBits - 1
+	result := make([]byte, 0, len(data)*int(fromBits)/int(toBits)+1)
+	for _, value := range data {
+		if uint32(value)>>fromBits != 0 {
+			return nil, ErrBech32Char
+		}
+		acc = acc<<fromBits | uint32(value)
+		bits += fromBits
+		for bits >= toBits {
+			bits -= toBits
+			result = append(result, byte(acc>>bits&maxv))
+		}
+	}
+
+	if pad {
+		if bits > 0 {
+			result = append(result, byte(acc<<(toBits-bits)&maxv))
+		}
+	} else if bits >= fromBits || 0 != acc<<(toBits-bits)&maxv {
+		return nil, ErrBech32Padding
+	}
+
+	return result, nil
+}
@@ -0,0 +1,140 @@
+package address
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/BlockABC/wallet-btc-service/common/chaincfg"
+)
+
+// address type, same names as the script types
+const (
+	PubKeyHashTy          = "pubkeyhash"
+	ScriptHashTy          = "scripthash"
+	WitnessV0PubKeyHashTy = "witness_v0_keyhash"
+	WitnessV0ScriptHashTy = "witness_v0_scripthash"
+	WitnessV1TaprootTy    = "witness_v1_taproot"
+	WitnessUnknownTy      = "witness_unknown"
+)
+
+var (
+	ErrEmptyAddress         = errors.New("empty address")
+	ErrUnknownFormat        = errors.New("unknown address format")
+	ErrHashLength           = errors.New("invalid address hash length")
+	ErrWitnessVersion       = errors.New("invalid witness version")
+	ErrWitnessProgramLength = errors.New("invalid witness program length")
+	ErrBech32Variant        = errors.New("witness version 0 requires bech32, later versions require bech32m")
+	ErrWrongNetworkPrefix   = errors.New("address version byte belongs to another network")
+	ErrWrongNetworkHrp      = errors.New("address human readable part belongs to another network")
+	ErrUnknownVersionByte   = errors.New("unknown address version byte")
+	ErrUnknownHumanReadPart = errors.New("unknown address human readable part")
+)
+
+var allNetParams = []*chaincfg.Params{&chaincfg.MainNetParams, &chaincfg.TestNet3Params, &chaincfg.RegressionNetParams, &chaincfg.SigNetParams}
+
+// Address is a decoded address, Hash is the key or script hash, or the witness program
+type Address struct {
+	Type           string
+	WitnessVersion byte
+	Hash           []byte
+}
+
+// DecodeAddress decodes a base58check or segwit address and checks it belongs to params
+func DecodeAddress(addr string, params *chaincfg.Params) (*Address, error) {
+	if 0 == len(addr) {
+		return nil, ErrEmptyAddress
+	}
+
+	// segwit, hrp is case insensitive
+	lower := strings.ToLower(addr)
+	for _, one := range allNetParams {
+		if strings.HasPrefix(lower, one.Bech32HRPSegwit+"1") {
+			return decodeSegwit(addr, params)
+		}
+	}
+
+	// bech32 string with an unknown hrp
+	if hrp, _, _, err := Bech32Decode(addr); nil == err {
+		return nil, fmt.Errorf("%v: %s", ErrUnknownHumanReadPart, hrp)
+	}
+
+	return decodeBase58(addr, params)
+}
+
+func decodeBase58(addr string, params *chaincfg.Params) (*Address, error) {
+	version, hash, err := Base58CheckDecode(addr)
+	if nil != err {
+		if ErrInvalidBase58Char == err {
+			return nil, ErrUnknownFormat
+		}
+		return nil, err
+	}
+	if 20 != len(hash) {
+		return nil, ErrHashLength
+	}
+
+	switch version {
+	case params.PubKeyHashAddrID:
+		return &Address{Type: PubKeyHashTy, Hash: hash}, nil
+	case params.ScriptHashAddrID:
+		return &Address{Type: ScriptHashTy, Hash: hash}, nil
+	}
+
+	for _, one := range allNetParams {
+		if version == one.PubKeyHashAddrID || version == one.ScriptHashAddrID {
+			return nil, fmt.Errorf("%v: %s", ErrWrongNetworkPrefix, one.Name)
+		}
+	}
+
+	return nil, fmt.Errorf("%v: 0x%02x", ErrUnknownVersionByte, version)
+}
+
+func decodeSegwit(addr string, params *chaincfg.Params) (*Address, error) {
+	hrp, data, constant, err := Bech32Decode(addr)
+	if nil != err {
+		return nil, err
+	}
+	if hrp != params.Bech32HRPSegwit {
+		return nil, fmt.Errorf("%v: %s", ErrWrongNetworkHrp, hrp)
+	}
+	if 0 == len(data) {
+		return nil, ErrWitnessProgramLength
+	}
+
+	version := data[0]
+	if version > 16 {
+		return nil, ErrWitnessVersion
+	}
+	if (0 == version && Bech32Const != constant) || (0 != version && Bech32mConst != constant) {
+		return nil, ErrBech32Variant
+	}
+
+	program, err := ConvertBits(data[1:], 5, 8, false)
+	if nil != err {
+		return nil, err
+	}
+	if len(program) < 2 || len(program) > 40 {
+		return nil, ErrWitnessProgramLength
+	}
+
+	result := &Address{Type: WitnessUnknownTy, WitnessVersion: version, Hash: program}
+	switch {
+	case 0 == version && 20 == len(program):
+		result.Type = WitnessV0PubKeyHashTy
+	case 0 == version && 32 == len(program):
+		result.Type = WitnessV0ScriptHashTy
+	case 0 == version:
+		return nil, ErrWitnessProgramLength
+	case 1 == version && 32 == len(program):
+		result.Type = WitnessV1TaprootTy
+	}
+
+	return result, nil
+}
+
+// ValidateAddress returns why addr is not a valid address of params, nil when it is
+func ValidateAddress(addr string, params *chaincfg.Params) error {
+	_, err := DecodeAddress(addr, params)
+	return err
+}
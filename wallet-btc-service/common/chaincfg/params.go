@@ -0,0 +1,73 @@
+package chaincfg
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Params defines the address encoding and the defaults of a bitcoin network
+type Params struct {
+	Name             string
+	PubKeyHashAddrID byte
+	ScriptHashAddrID byte
+	Bech32HRPSegwit  string
+
+	DefaultRpcPort     int
+	DefaultOmniRpcPort int    // omni core next to bitcoind on mainnet, the bitcoind port elsewhere
+	UsdtPropertyID     uint64 // 0 when the network has no well known usdt property
+}
+
+var (
+	MainNetParams = Params{
+		Name:               "mainnet",
+		PubKeyHashAddrID:   0x00,
+		ScriptHashAddrID:   0x05,
+		Bech32HRPSegwit:    "bc",
+		DefaultRpcPort:     8332,
+		DefaultOmniRpcPort: 8335,
+		UsdtPropertyID:     31,
+	}
+
+	TestNet3Params = Params{
+		Name:               "testnet",
+		PubKeyHashAddrID:   0x6f,
+		ScriptHashAddrID:   0xc4,
+		Bech32HRPSegwit:    "tb",
+		DefaultRpcPort:     18332,
+		DefaultOmniRpcPort: 18332,
+	}
+
+	RegressionNetParams = Params{
+		Name:               "regtest",
+		PubKeyHashAddrID:   0x6f,
+		ScriptHashAddrID:   0xc4,
+		Bech32HRPSegwit:    "bcrt",
+		DefaultRpcPort:     18443,
+		DefaultOmniRpcPort: 18443,
+	}
+
+	SigNetParams = Params{
+		Name:               "signet",
+		PubKeyHashAddrID:   0x6f,
+		ScriptHashAddrID:   0xc4,
+		Bech32HRPSegwit:    "tb",
+		DefaultRpcPort:     38332,
+		DefaultOmniRpcPort: 38332,
+	}
+)
+
+// ParamsByName returns the params of a network, bitcoind chain names are accepted too
+func ParamsByName(name string) (*Params, error) {
+	switch strings.ToLower(name) {
+	case "", "mainnet", "main":
+		return &MainNetParams, nil
+	case "testnet", "testnet3", "test":
+		return &TestNet3Params, nil
+	case "signet":
+		return &SigNetParams, nil
+	case "regtest":
+		return &RegressionNetParams, nil
+	}
+
+	return nil, fmt.Errorf("unknown network: %s", name)
+}
@@ -7,6 +7,7 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/BlockABC/wallet-btc-service/common/chaincfg"
 	"github.com/BlockABC/wallet-btc-service/common/log"
 	"github.com/spf13/viper"
 )
@@ -43,13 +44,78 @@ type BtcOpt struct {
 	TrxGoroutineNum   int
 	BlockGoroutineNum int
 	MaxGoroutine      int
+
+	// ingest
+	IngestSource string
+	PollInterval int
+	ZmqRawBlock  string
+	ZmqRawTx     string
+	ZmqSequence  string
+
+	// extended public key
+	XpubGapLimit   int
+	XpubMaxAddress int
+
+	// seconds to finish the work being done on shutdown
+	ShutdownTimeout int
 }
 
 type OmniOpt struct {
-	RpcUser     string
-	RpcPassword string
-	RpcPort     int
-	RpcAddress  string
+	RpcUser        string
+	RpcPassword    string
+	RpcPort        int
+	RpcAddress     string
+	UsdtPropertyId uint64
+}
+
+type PriceOpt struct {
+	Providers       string
+	RefreshInterval int
+	StaleAge        int
+	File            string
+	Timeout         int
+}
+
+type FeeOpt struct {
+	Targets      string
+	LevelTargets string
+	RecentBlocks int
+	CacheTime    int
+}
+
+type WebhookOpt struct {
+	Interval         int
+	BatchSize        int
+	Concurrency      int
+	MaxAttempts      int
+	BaseBackoff      int
+	MaxBackoff       int
+	Timeout          int
+	AllowPrivateHost bool
+}
+
+type ApiOpt struct {
+	AuthRequired   bool
+	AdminKey       string
+	RateLimit      int
+	MaxAddresses   int
+	EndpointLimits string
+	Origins        string
+	MaxBodySize    int64
+	KeyCacheTime   int
+}
+
+type RepairOpt struct {
+	BatchSize   int
+	MaxAttempts int
+	BaseBackoff int
+	MaxBackoff  int
+	Lease       int
+}
+
+type HealthOpt struct {
+	MaxLag  int
+	Timeout int
 }
 
 type DbOpt struct {
@@ -75,11 +141,21 @@ type RedisOpt struct {
 }
 
 type Config struct {
-	BtcOpt   BtcOpt   `json:"btc_opt"`
-	OmniOpt  OmniOpt  `json:"omni_opt"`
-	DbOpt    DbOpt    `json:"db_opt"`
-	RedisOpt RedisOpt `json:"redis_opt"`
-	Number   Number   `json:"number"`
+	Network    string     `json:"network"`
+	BtcOpt     BtcOpt     `json:"btc_opt"`
+	OmniOpt    OmniOpt    `json:"omni_opt"`
+	PriceOpt   PriceOpt   `json:"price_opt"`
+	FeeOpt     FeeOpt     `json:"fee_opt"`
+	WebhookOpt WebhookOpt `json:"webhook_opt"`
+	ApiOpt     ApiOpt     `json:"api_opt"`
+	RepairOpt  RepairOpt  `json:"repair_opt"`
+	HealthOpt  HealthOpt  `json:"health_opt"`
+	DbOpt      DbOpt      `json:"db_opt"`
+	RedisOpt   RedisOpt   `json:"redis_opt"`
+	Number     Number     `json:"number"`
+
+	// chain params of Network
+	ChainParams *chaincfg.Params `json:"-"`
 }
 
 func init() {
@@ -109,6 +185,9 @@ func Initialize() (*Config, error) {
 		return nil, err
 	}
 	Cfg.readFileConfig()
+	if err := Cfg.resolveNetwork(); err != nil {
+		return nil, err
+	}
 	log.Log.Debug("Initialize config module success:", Cfg)
 	return Cfg, nil
 }
@@ -139,10 +218,13 @@ func (c *Config) ReadConfigFile(file string) error {
 
 //此处设置默认配置，如果没有在此处设置，当读不到值时，会使用零值
 func (c *Config) initDefaultConfig() {
-	// bitcoin node info
+	// network: mainnet, testnet, signet or regtest
+	viper.SetDefault("network", "mainnet")
+
+	// bitcoin node info, port 0 uses the network default
 	viper.SetDefault("btc.rpcuser", "btc")
 	viper.SetDefault("btc.rpcpassword", "blockchain")
-	viper.SetDefault("btc.rpcport", 8332)
+	viper.SetDefault("btc.rpcport", 0)
 	viper.SetDefault("btc.rpcaddress", "39.108.13.219")
 
 	// notify and http server
@@ -170,11 +252,79 @@ func (c *Config) initDefaultConfig() {
 	viper.SetDefault("btc.blockgoroutinenum", 20)
 	viper.SetDefault("btc.maxgoroutine", 2000)
 
-	// omni node info
+	// ingest source: http(bitcoind push), poll(built-in follower) or zmq(bitcoind zmqpub*), poll interval in seconds
+	viper.SetDefault("btc.ingestsource", "http")
+	viper.SetDefault("btc.pollinterval", 5)
+	viper.SetDefault("btc.zmqrawblock", "tcp://127.0.0.1:28332")
+	viper.SetDefault("btc.zmqrawtx", "tcp://127.0.0.1:28332")
+	viper.SetDefault("btc.zmqsequence", "tcp://127.0.0.1:28332")
+
+	// extended public key: unused addresses in a row that end a chain, addresses scanned per chain at most
+	viper.SetDefault("btc.xpubgaplimit", 20)
+	viper.SetDefault("btc.xpubmaxaddress", 1000)
+
+	// shutdown: seconds the http servers, the blocks being saved and the timer tasks get to finish, blocks
+	// not saved by then are stored for repair
+	viper.SetDefault("btc.shutdowntimeout", 60)
+
+	// omni node info, port 0 uses the network default (8335 on mainnet), usdt property id 0 uses the network one
 	viper.SetDefault("omni.rpcuser", "omni")
 	viper.SetDefault("omni.rpcpassword", "blockchain")
-	viper.SetDefault("omni.rpcport", 8335)
+	viper.SetDefault("omni.rpcport", 0)
 	viper.SetDefault("omni.rpcaddress", "47.106.178.52")
+	viper.SetDefault("omni.usdtpropertyid", 0)
+
+	// price providers tried in order: coingecko, coincap or file(json of coin id to usd price),
+	// refresh interval, age a price is stale after and request timeout in seconds
+	viper.SetDefault("price.providers", "coingecko,coincap")
+	viper.SetDefault("price.refreshinterval", 60)
+	viper.SetDefault("price.staleage", 600)
+	viper.SetDefault("price.file", "")
+	viper.SetDefault("price.timeout", 10)
+
+	// fee estimate: confirmation targets in blocks, targets of the fee levels 1 to 4, at most how many recent
+	// blocks are looked at and seconds an estimate is cached
+	viper.SetDefault("fee.targets", "1,2,3,6,12,24,144")
+	viper.SetDefault("fee.leveltargets", "144,6,3,1")
+	viper.SetDefault("fee.recentblocks", 144)
+	viper.SetDefault("fee.cachetime", 30)
+
+	// webhook delivery: seconds between delivery runs, deliveries per run and at the same time, attempts before
+	// a delivery is dead, first and longest retry delay and request timeout in seconds. webhook urls of loopback,
+	// link local and private hosts are refused unless allowprivatehost
+	viper.SetDefault("webhook.interval", 5)
+	viper.SetDefault("webhook.batchsize", 100)
+	viper.SetDefault("webhook.concurrency", 8)
+	viper.SetDefault("webhook.maxattempts", 10)
+	viper.SetDefault("webhook.basebackoff", 10)
+	viper.SetDefault("webhook.maxbackoff", 3600)
+	viper.SetDefault("webhook.timeout", 10)
+	viper.SetDefault("webhook.allowprivatehost", false)
+
+	// public api: api key required (requests without a key are limited by client ip if not), admin key of the key management endpoints (empty disables them), requests
+	// per minute and addresses per request of a key without its own, stricter requests per minute of endpoints,
+	// cors origins of a key without its own ("*" any), largest request body and seconds a key is cached
+	viper.SetDefault("api.authrequired", false)
+	viper.SetDefault("api.adminkey", "")
+	viper.SetDefault("api.ratelimit", 300)
+	viper.SetDefault("api.maxaddresses", 100)
+	viper.SetDefault("api.endpointlimits", "/send_raw_transaction:10,/psbt/broadcast:10,/transaction/build:60")
+	viper.SetDefault("api.origins", "*")
+	viper.SetDefault("api.maxbodysize", 1048576)
+	viper.SetDefault("api.keycachetime", 60)
+
+	// repair job queue: jobs a repair run takes of a type, attempts before a job is dead, first and longest retry
+	// delay and seconds a taken job waits before it is taken again if its run did not finish
+	viper.SetDefault("repair.batchsize", 1000)
+	viper.SetDefault("repair.maxattempts", 20)
+	viper.SetDefault("repair.basebackoff", 60)
+	viper.SetDefault("repair.maxbackoff", 21600)
+	viper.SetDefault("repair.lease", 1800)
+
+	// health check: blocks the index may be behind the node before the service is not ready, seconds a
+	// dependency check may take
+	viper.SetDefault("health.maxlag", 3)
+	viper.SetDefault("health.timeout", 3)
 
 	// database
 	viper.SetDefault("db.address", "39.108.13.219:3306")
@@ -199,6 +349,7 @@ func (c *Config) initDefaultConfig() {
 
 //如果文件中配置被更改，此处读取会覆盖默认配置参数
 func (c *Config) readFileConfig() {
+	c.Network = viper.GetString("network")
 	c.BtcOpt.RpcUser = viper.GetString("btc.rpcuser")
 	c.BtcOpt.RpcPassword = viper.GetString("btc.rpcpassword")
 	c.BtcOpt.RpcPort = viper.GetInt("btc.rpcport")
@@ -218,12 +369,65 @@ func (c *Config) readFileConfig() {
 	c.BtcOpt.TrxGoroutineNum = viper.GetInt("btc.trxgoroutinenum")
 	c.BtcOpt.BlockGoroutineNum = viper.GetInt("btc.blockgoroutinenum")
 	c.BtcOpt.MaxGoroutine = viper.GetInt("btc.maxgoroutine")
+	c.BtcOpt.IngestSource = viper.GetString("btc.ingestsource")
+	c.BtcOpt.PollInterval = viper.GetInt("btc.pollinterval")
+	c.BtcOpt.ZmqRawBlock = viper.GetString("btc.zmqrawblock")
+	c.BtcOpt.ZmqRawTx = viper.GetString("btc.zmqrawtx")
+	c.BtcOpt.ZmqSequence = viper.GetString("btc.zmqsequence")
+	c.BtcOpt.XpubGapLimit = viper.GetInt("btc.xpubgaplimit")
+	c.BtcOpt.XpubMaxAddress = viper.GetInt("btc.xpubmaxaddress")
+	c.BtcOpt.ShutdownTimeout = viper.GetInt("btc.shutdowntimeout")
 
 	// omni
 	c.OmniOpt.RpcUser = viper.GetString("omni.rpcuser")
 	c.OmniOpt.RpcPassword = viper.GetString("omni.rpcpassword")
 	c.OmniOpt.RpcPort = viper.GetInt("omni.rpcport")
 	c.OmniOpt.RpcAddress = viper.GetString("omni.rpcaddress")
+	c.OmniOpt.UsdtPropertyId = uint64(viper.GetInt64("omni.usdtpropertyid"))
+
+	// price
+	c.PriceOpt.Providers = viper.GetString("price.providers")
+	c.PriceOpt.RefreshInterval = viper.GetInt("price.refreshinterval")
+	c.PriceOpt.StaleAge = viper.GetInt("price.staleage")
+	c.PriceOpt.File = viper.GetString("price.file")
+	c.PriceOpt.Timeout = viper.GetInt("price.timeout")
+
+	// fee
+	c.FeeOpt.Targets = viper.GetString("fee.targets")
+	c.FeeOpt.LevelTargets = viper.GetString("fee.leveltargets")
+	c.FeeOpt.RecentBlocks = viper.GetInt("fee.recentblocks")
+	c.FeeOpt.CacheTime = viper.GetInt("fee.cachetime")
+
+	// webhook
+	c.WebhookOpt.Interval = viper.GetInt("webhook.interval")
+	c.WebhookOpt.BatchSize = viper.GetInt("webhook.batchsize")
+	c.WebhookOpt.Concurrency = viper.GetInt("webhook.concurrency")
+	c.WebhookOpt.MaxAttempts = viper.GetInt("webhook.maxattempts")
+	c.WebhookOpt.BaseBackoff = viper.GetInt("webhook.basebackoff")
+	c.WebhookOpt.MaxBackoff = viper.GetInt("webhook.maxbackoff")
+	c.WebhookOpt.Timeout = viper.GetInt("webhook.timeout")
+	c.WebhookOpt.AllowPrivateHost = viper.GetBool("webhook.allowprivatehost")
+
+	// api
+	c.ApiOpt.AuthRequired = viper.GetBool("api.authrequired")
+	c.ApiOpt.AdminKey = viper.GetString("api.adminkey")
+	c.ApiOpt.RateLimit = viper.GetInt("api.ratelimit")
+	c.ApiOpt.MaxAddresses = viper.GetInt("api.maxaddresses")
+	c.ApiOpt.EndpointLimits = viper.GetString("api.endpointlimits")
+	c.ApiOpt.Origins = viper.GetString("api.origins")
+	c.ApiOpt.MaxBodySize = viper.GetInt64("api.maxbodysize")
+	c.ApiOpt.KeyCacheTime = viper.GetInt("api.keycachetime")
+
+	// repair
+	c.RepairOpt.BatchSize = viper.GetInt("repair.batchsize")
+	c.RepairOpt.MaxAttempts = viper.GetInt("repair.maxattempts")
+	c.RepairOpt.BaseBackoff = viper.GetInt("repair.basebackoff")
+	c.RepairOpt.MaxBackoff = viper.GetInt("repair.maxbackoff")
+	c.RepairOpt.Lease = viper.GetInt("repair.lease")
+
+	// health
+	c.HealthOpt.MaxLag = viper.GetInt("health.maxlag")
+	c.HealthOpt.Timeout = viper.GetInt("health.timeout")
 
 	// database
 	c.DbOpt.Address = viper.GetString("db.address")
@@ -244,3 +448,28 @@ func (c *Config) readFileConfig() {
 	c.Number.Priority = viper.GetFloat64("number.priority")
 	c.Number.Quick = viper.GetFloat64("number.quick")
 }
+
+// resolveNetwork fills the chain params and the settings left to the network default
+func (c *Config) resolveNetwork() error {
+	params, err := chaincfg.ParamsByName(c.Network)
+	if err != nil {
+		return err
+	}
+	c.Network = params.Name
+	c.ChainParams = params
+
+	if 0 == c.BtcOpt.RpcPort {
+		c.BtcOpt.RpcPort = params.DefaultRpcPort
+	}
+	if 0 == c.OmniOpt.RpcPort {
+		c.OmniOpt.RpcPort = params.DefaultOmniRpcPort
+	}
+	if 0 == c.OmniOpt.UsdtPropertyId {
+		c.OmniOpt.UsdtPropertyId = params.UsdtPropertyID
+	}
+	if 0 == c.OmniOpt.UsdtPropertyId {
+		log.Log.Notice("no usdt property id on ", c.Network, ", set omni.usdtpropertyid")
+	}
+
+	return nil
+}
@@ -0,0 +1,40 @@
+package crypto
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// DoubleSha256 is sha256(sha256(data)), used for txid, block hash and checksums
+func DoubleSha256(data []byte) []byte {
+	first := sha256.Sum256(data)
+	second := sha256.Sum256(first[:])
+	return second[:]
+}
+
+// Hash160 is ripemd160(sha256(data)), used for public key and script hashes
+func Hash160(data []byte) []byte {
+	first := sha256.Sum256(data)
+	return Ripemd160(first[:])
+}
+
+// HashToString returns the hash in rpc byte order (reversed)
+func HashToString(hash []byte) string {
+	reverse := make([]byte, len(hash))
+	for index, one := range hash {
+		reverse[len(hash)-1-index] = one
+	}
+	return hex.EncodeToString(reverse)
+}
+
+// StringToHash parses a hash in rpc byte order
+func StringToHash(str string) ([]byte, error) {
+	hash, err := hex.DecodeString(str)
+	if nil != err {
+		return nil, err
+	}
+	for i, j := 0, len(hash)-1; i < j; i, j = i+1, j-1 {
+		hash[i], hash[j] = hash[j], hash[i]
+	}
+	return hash, nil
+}
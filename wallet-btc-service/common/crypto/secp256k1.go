@@ -0,0 +1,271 @@
+package crypto
+
+import (
+	"crypto/sha256"
+	"errors"
+	"math/big"
+)
+
+// secp256k1 public key arithmetic, only public data is handled so it is not constant time
+
+var (
+	ErrPubKeyLength     = errors.New("invalid public key length")
+	ErrPubKeyFormat     = errors.New("invalid public key format")
+	ErrPubKeyNotOnCurve = errors.New("public key is not on the curve")
+	ErrPointInfinity    = errors.New("point at infinity")
+)
+
+var (
+	curveP, _  = new(big.Int).SetString("fffffffffffffffffffffffffffffffffffffffffffffffffffffffefffffc2f", 16)
+	CurveN, _  = new(big.Int).SetString("fffffffffffffffffffffffffffffffebaaedce6af48a03bbfd25e8cd0364141", 16)
+	curveGx, _ = new(big.Int).SetString("79be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798", 16)
+	curveGy, _ = new(big.Int).SetString("483ada7726a3c4655da4fbfc0e1108a8fd17b448a68554199c47d08ffb10d4b8", 16)
+	curveB     = big.NewInt(7)
+
+	// (p+1)/4, p = 3 mod 4 so a square root is a power
+	curveSqrtExp = new(big.Int).Rsh(new(big.Int).Add(curveP, big.NewInt(1)), 2)
+)
+
+// PublicKey is an affine curve point
+type PublicKey struct {
+	X *big.Int
+	Y *big.Int
+}
+
+// jacobian point, infinity when z is 0
+type jacobianPoint struct {
+	x, y, z *big.Int
+}
+
+func fieldMod(a *big.Int) *big.Int {
+	return a.Mod(a, curveP)
+}
+
+func (p *jacobianPoint) isInfinity() bool {
+	return 0 == p.z.Sign()
+}
+
+func toJacobian(pub *PublicKey) *jacobianPoint {
+	return &jacobianPoint{new(big.Int).Set(pub.X), new(big.Int).Set(pub.Y), big.NewInt(1)}
+}
+
+func (p *jacobianPoint) toAffine() *PublicKey {
+	zInv := new(big.Int).ModInverse(p.z, curveP)
+	zInv2 := fieldMod(new(big.Int).Mul(zInv, zInv))
+	x := fieldMod(new(big.Int).Mul(p.x, zInv2))
+	y := fieldMod(new(big.Int).Mul(p.y, fieldMod(new(big.Int).Mul(zInv2, zInv))))
+	return &PublicKey{x, y}
+}
+
+// double, a = 0
+func (p *jacobianPoint) double() *jacobianPoint {
+	if p.isInfinity() || 0 == p.y.Sign() {
+		return &jacobianPoint{new(big.Int), new(big.Int), new(big.Int)}
+	}
+
+	a := fieldMod(new(big.Int).Mul(p.x, p.x))
+	b := fieldMod(new(big.Int).Mul(p.y, p.y))
+	c := fieldMod(new(big.Int).Mul(b, b))
+	d := new(big.Int).Add(p.x, b)
+	d = fieldMod(d.Mul(d, d))
+	d.Sub(d, a).Sub(d, c).Lsh(d, 1)
+	fieldMod(d)
+	e := fieldMod(new(big.Int).Mul(a, big.NewInt(3)))
+	f := fieldMod(new(big.Int).Mul(e, e))
+
+	x3 := fieldMod(new(big.Int).Sub(f, new(big.Int).Lsh(d, 1)))
+	y3 := new(big.Int).Sub(d, x3)
+	y3.Mul(y3, e).Sub(y3, new(big.Int).Lsh(c, 3))
+	fieldMod(y3)
+	z3 := fieldMod(new(big.Int).Lsh(new(big.Int).Mul(p.y, p.z), 1))
+
+	return &jacobianPoint{x3, y3, z3}
+}
+
+func (p *jacobianPoint) add(q *jacobianPoint) *jacobianPoint {
+	if p.isInfinity() {
+		return q
+	}
+	if q.isInfinity() {
+		return p
+	}
+
+	z1z1 := fieldMod(new(big.Int).Mul(p.z, p.z))
+	z2z2 := fieldMod(new(big.Int).Mul(q.z, q.z))
+	u1 := fieldMod(new(big.Int).Mul(p.x, z2z2))
+	u2 := fieldMod(new(big.Int).Mul(q.x, z1z1))
+	s1 := fieldMod(new(big.Int).Mul(p.y, fieldMod(new(big.Int).Mul(q.z, z2z2))))
+	s2 := fieldMod(new(big.Int).Mul(q.y, fieldMod(new(big.Int).Mul(p.z, z1z1))))
+
+	if 0 == u1.Cmp(u2) {
+		if 0 == s1.Cmp(s2) {
+			return p.double()
+		}
+		return &jacobianPoint{new(big.Int), new(big.Int), new(big.Int)}
+	}
+
+	h := fieldMod(new(big.Int).Sub(u2, u1))
+	r := fieldMod(new(big.Int).Sub(s2, s1))
+	h2 := fieldMod(new(big.Int).Mul(h, h))
+	h3 := fieldMod(new(big.Int).Mul(h2, h))
+	u1h2 := fieldMod(new(big.Int).Mul(u1, h2))
+
+	x3 := new(big.Int).Mul(r, r)
+	x3.Sub(x3, h3).Sub(x3, new(big.Int).Lsh(u1h2, 1))
+	fieldMod(x3)
+	y3 := new(big.Int).Sub(u1h2, x3)
+	y3.Mul(y3, r).Sub(y3, new(big.Int).Mul(s1, h3))
+	fieldMod(y3)
+	z3 := fieldMod(new(big.Int).Mul(h, fieldMod(new(big.Int).Mul(p.z, q.z))))
+
+	return &jacobianPoint{x3, y3, z3}
+}
+
+func scalarMult(base *jacobianPoint, k *big.Int) *jacobianPoint {
+	result := &jacobianPoint{new(big.Int), new(big.Int), new(big.Int)}
+	for i := k.BitLen() - 1; i >= 0; i-- {
+		result = result.double()
+		if 1 == k.Bit(i) {
+			result = result.add(base)
+		}
+	}
+	return result
+}
+
+// ScalarBaseMult returns k*G
+func ScalarBaseMult(k []byte) (*PublicKey, error) {
+	point := scalarMult(&jacobianPoint{curveGx, curveGy, big.NewInt(1)}, new(big.Int).SetBytes(k))
+	if point.isInfinity() {
+		return nil, ErrPointInfinity
+	}
+	return point.toAffine(), nil
+}
+
+// Add returns pub+other
+func (pub *PublicKey) Add(other *PublicKey) (*PublicKey, error) {
+	point := toJacobian(pub).add(toJacobian(other))
+	if point.isInfinity() {
+		return nil, ErrPointInfinity
+	}
+	return point.toAffine(), nil
+}
+
+func (pub *PublicKey) IsOnCurve() bool {
+	if pub.X.Sign() < 0 || pub.X.Cmp(curveP) >= 0 || pub.Y.Sign() < 0 || pub.Y.Cmp(curveP) >= 0 {
+		return false
+	}
+	left := fieldMod(new(big.Int).Mul(pub.Y, pub.Y))
+	right := new(big.Int).Mul(pub.X, pub.X)
+	right.Mul(right, pub.X).Add(right, curveB)
+	return 0 == left.Cmp(fieldMod(right))
+}
+
+// SerializeCompressed returns the 33 byte compressed encoding
+func (pub *PublicKey) SerializeCompressed() []byte {
+	return append([]byte{0x02 + byte(pub.Y.Bit(0))}, pub.SerializeXOnly()...)
+}
+
+// SerializeXOnly returns the 32 byte x coordinate used by taproot
+func (pub *PublicKey) SerializeXOnly() []byte {
+	x := pub.X.Bytes()
+	result := make([]byte, 32-len(x), 32)
+	return append(result, x...)
+}
+
+// ParsePubKey parses a compressed or uncompressed public key
+func ParsePubKey(data []byte) (*PublicKey, error) {
+	var pub *PublicKey
+	switch {
+	case 33 == len(data) && (0x02 == data[0] || 0x03 == data[0]):
+		x := new(big.Int).SetBytes(data[1:])
+		y, err := liftX(x)
+		if nil != err {
+			return nil, err
+		}
+		if y.Bit(0) != uint(data[0]&1) {
+			y.Sub(curveP, y)
+		}
+		pub = &PublicKey{x, y}
+	case 65 == len(data) && 0x04 == data[0]:
+		pub = &PublicKey{new(big.Int).SetBytes(data[1:33]), new(big.Int).SetBytes(data[33:])}
+	case 33 == len(data) || 65 == len(data):
+		return nil, ErrPubKeyFormat
+	default:
+		return nil, ErrPubKeyLength
+	}
+
+	if !pub.IsOnCurve() {
+		return nil, ErrPubKeyNotOnCurve
+	}
+	return pub, nil
+}
+
+// liftX returns the even y of x
+func liftX(x *big.Int) (*big.Int, error) {
+	if x.Cmp(curveP) >= 0 {
+		return nil, ErrPubKeyNotOnCurve
+	}
+	c := new(big.Int).Mul(x, x)
+	c.Mul(c, x).Add(c, curveB)
+	fieldMod(c)
+	y := new(big.Int).Exp(c, curveSqrtExp, curveP)
+	if 0 != fieldMod(new(big.Int).Mul(y, y)).Cmp(c) {
+		return nil, ErrPubKeyNotOnCurve
+	}
+	if 1 == y.Bit(0) {
+		y.Sub(curveP, y)
+	}
+	return y, nil
+}
+
+// TaggedHash is the BIP340 sha256(sha256(tag) || sha256(tag) || data)
+func TaggedHash(tag string, data ...[]byte) []byte {
+	tagHash := sha256.Sum256([]byte(tag))
+	h := sha256.New()
+	h.Write(tagHash[:])
+	h.Write(tagHash[:])
+	for _, one := range data {
+		h.Write(one)
+	}
+	return h.Sum(nil)
+}
+
+// TaprootOutputKey returns the BIP86 output key of an internal key without script tree
+func TaprootOutputKey(internal *PublicKey) ([]byte, error) {
+	return TaprootTweakKey(internal, nil)
+}
+
+// TaprootTweakKey returns the BIP341 output key of an internal key and script tree merkle root, root may be nil
+func TaprootTweakKey(internal *PublicKey, merkleRoot []byte) ([]byte, error) {
+	even := internal
+	if 1 == internal.Y.Bit(0) {
+		even = &PublicKey{internal.X, new(big.Int).Sub(curveP, internal.Y)}
+	}
+
+	tweak := TaggedHash("TapTweak", even.SerializeXOnly(), merkleRoot)
+	if new(big.Int).SetBytes(tweak).Cmp(CurveN) >= 0 {
+		return nil, ErrPointInfinity
+	}
+	tweakPoint, err := ScalarBaseMult(tweak)
+	if nil != err {
+		return nil, err
+	}
+	output, err := even.Add(tweakPoint)
+	if nil != err {
+		return nil, err
+	}
+	return output.SerializeXOnly(), nil
+}
+
+// ParseXOnlyPubKey parses a 32 byte BIP340 public key, y is even
+func ParseXOnlyPubKey(data []byte) (*PublicKey, error) {
+	if 32 != len(data) {
+		return nil, ErrPubKeyLength
+	}
+	x := new(big.Int).SetBytes(data)
+	y, err := liftX(x)
+	if nil != err {
+		return nil, err
+	}
+	return &PublicKey{x, y}, nil
+}
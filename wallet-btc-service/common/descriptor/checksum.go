@@ -0,0 +1,92 @@
+package descriptor
+
+import (
+	"errors"
+	"strings"
+)
+
+// BIP380 descriptor checksum
+
+const (
+	inputCharset    = "0123456789()[],'/*abcdefgh@:$%{}IJKLMNOPQRSTUVWXYZ&+-.;<=>?!^_|~ijklmnopqrstuvwxyzABCDEFGH`#\"\\ "
+	checksumCharset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+	checksumLength  = 8
+)
+
+var (
+	ErrInvalidCharacter = errors.New("invalid character in descriptor")
+	ErrChecksumLength   = errors.New("descriptor checksum must be 8 characters")
+	ErrChecksumMismatch = errors.New("descriptor checksum mismatch")
+)
+
+var checksumGenerator = []uint64{0xf5dee51989, 0xa9fdca3312, 0x1bab10e32d, 0x3706b1677a, 0x644d626ffd}
+
+func checksumPolymod(symbols []uint64) uint64 {
+	chk := uint64(1)
+	for _, value := range symbols {
+		top := chk >> 35
+		chk = (chk&0x7ffffffff)<<5 ^ value
+		for i := uint(0); i < 5; i++ {
+			if 1 == (top>>i)&1 {
+				chk ^= checksumGenerator[i]
+			}
+		}
+	}
+	return chk
+}
+
+// Checksum returns the 8 character checksum of a descriptor without checksum
+func Checksum(desc string) (string, error) {
+	symbols := make([]uint64, 0, len(desc)+len(desc)/3+checksumLength+1)
+	groups := make([]uint64, 0, 3)
+	for _, c := range desc {
+		position := strings.IndexRune(inputCharset, c)
+		if position < 0 {
+			return "", ErrInvalidCharacter
+		}
+		symbols = append(symbols, uint64(position&31))
+		groups = append(groups, uint64(position>>5))
+		if 3 == len(groups) {
+			symbols = append(symbols, groups[0]*9+groups[1]*3+groups[2])
+			groups = groups[:0]
+		}
+	}
+	switch len(groups) {
+	case 1:
+		symbols = append(symbols, groups[0])
+	case 2:
+		symbols = append(symbols, groups[0]*3+groups[1])
+	}
+	symbols = append(symbols, make([]uint64, checksumLength)...)
+
+	value := checksumPolymod(symbols) ^ 1
+	result := make([]byte, checksumLength)
+	for i := 0; i < checksumLength; i++ {
+		result[i] = checksumCharset[(value>>(5*uint(checksumLength-1-i)))&31]
+	}
+	return string(result), nil
+}
+
+// splitChecksum splits "desc#checksum" and verifies the checksum when present
+func splitChecksum(desc string) (string, error) {
+	position := strings.LastIndex(desc, "#")
+	if position < 0 {
+		if _, err := Checksum(desc); nil != err {
+			return "", err
+		}
+		return desc, nil
+	}
+
+	body, checksum := desc[:position], desc[position+1:]
+	if checksumLength != len(checksum) {
+		return "", ErrChecksumLength
+	}
+	expected, err := Checksum(body)
+	if nil != err {
+		return "", err
+	}
+	if expected != checksum {
+		return "", ErrChecksumMismatch
+	}
+	return body, nil
+}
@@ -0,0 +1,481 @@
+package descriptor
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BlockABC/wallet-btc-service/common/chaincfg"
+	"github.com/BlockABC/wallet-btc-service/common/crypto"
+	"github.com/BlockABC/wallet-btc-service/common/txscript"
+	"github.com/BlockABC/wallet-btc-service/common/wire"
+)
+
+// output script descriptors of BIP380-386 and BIP389 multipath, only public keys are accepted
+
+var (
+	ErrSyntax             = errors.New("descriptor syntax error")
+	ErrUnknownFunction    = errors.New("unknown descriptor function")
+	ErrContext            = errors.New("descriptor function is not allowed here")
+	ErrArgumentCount      = errors.New("wrong number of descriptor arguments")
+	ErrThreshold          = errors.New("invalid multisig threshold")
+	ErrTooManyKeys        = errors.New("too many keys in multisig")
+	ErrBranchMismatch     = errors.New("multipath keys have different numbers of branches")
+	ErrBranchOutOfRange   = errors.New("descriptor branch out of range")
+	ErrNoAddress          = errors.New("descriptor script has no single address")
+	ErrTapTreeDepth       = errors.New("taproot tree is too deep")
+	ErrTapLeafFunction    = errors.New("taproot leaves must be pk, multi_a or sortedmulti_a")
+	ErrNestedWitness      = errors.New("wsh can not contain wpkh, sh, wsh or tr")
+	ErrInvalidRawScript   = errors.New("invalid raw script hex")
+	ErrNotRangeDescriptor = errors.New("descriptor is not ranged")
+)
+
+// where a script expression is
+const (
+	contextTop = iota
+	contextSh
+	contextWsh
+	contextTr
+)
+
+// multisig key limits of bare, p2sh, p2wsh and tapscript
+var maxMultisigKeys = map[int]int{contextTop: 3, contextSh: 15, contextWsh: 20, contextTr: 999}
+
+const (
+	tapLeafVersion  = 0xc0
+	maxTapTreeDepth = 128
+)
+
+// node of a descriptor expression
+type node struct {
+	name      string
+	keys      []*keyExpression
+	threshold int
+	sub       *node
+	tree      *tapTree
+	script    []byte
+}
+
+// taproot script tree, a leaf or two branches
+type tapTree struct {
+	leaf        *node
+	left, right *tapTree
+}
+
+// Descriptor is a parsed output descriptor
+type Descriptor struct {
+	body     string
+	Checksum string
+	root     *node
+	ranged   bool
+	branches int
+	params   *chaincfg.Params
+}
+
+// Parse parses desc for the network, the checksum is verified when present
+func Parse(desc string, params *chaincfg.Params) (*Descriptor, error) {
+	body, err := splitChecksum(strings.TrimSpace(desc))
+	if nil != err {
+		return nil, err
+	}
+	checksum, err := Checksum(body)
+	if nil != err {
+		return nil, err
+	}
+
+	result := &Descriptor{body: body, Checksum: checksum, branches: 1, params: params}
+	if result.root, err = result.parse(body, contextTop); nil != err {
+		return nil, err
+	}
+	return result, nil
+}
+
+// String returns the descriptor with its checksum
+func (d *Descriptor) String() string {
+	return d.body + "#" + d.Checksum
+}
+
+// IsRange reports whether the descriptor derives a script per index
+func (d *Descriptor) IsRange() bool {
+	return d.ranged
+}
+
+// Branches is the number of multipath branches, usually receive and change
+func (d *Descriptor) Branches() int {
+	return d.branches
+}
+
+// Script returns the scriptPubKey of branch at index, index is ignored when the descriptor is not ranged
+func (d *Descriptor) Script(branch int, index uint32) ([]byte, error) {
+	if branch < 0 || branch >= d.branches {
+		return nil, ErrBranchOutOfRange
+	}
+	return d.root.build(branch, index, contextTop)
+}
+
+// Address returns the address of branch at index, it is the address the indexer records for the script
+func (d *Descriptor) Address(branch int, index uint32) (string, error) {
+	script, err := d.Script(branch, index)
+	if nil != err {
+		return "", err
+	}
+	scriptType, _, addresses := txscript.ExtractPkScriptAddrs(script, d.params)
+	if txscript.MultiSigTy == scriptType || 1 != len(addresses) {
+		return "", ErrNoAddress
+	}
+	return addresses[0], nil
+}
+
+// Addresses returns count addresses of branch from index begin
+func (d *Descriptor) Addresses(branch int, begin uint32, count uint32) ([]string, error) {
+	if !d.ranged && (0 != begin || count > 1) {
+		return nil, ErrNotRangeDescriptor
+	}
+	result := make([]string, 0, count)
+	for index := begin; index < begin+count; index++ {
+		oneAddress, err := d.Address(branch, index)
+		if nil != err {
+			return nil, err
+		}
+		result = append(result, oneAddress)
+	}
+	return result, nil
+}
+
+// splitArgs splits the top level comma separated arguments
+func splitArgs(args string) ([]string, error) {
+	result := make([]string, 0, 2)
+	depth := 0
+	begin := 0
+	for position, c := range args {
+		switch c {
+		case '(', '{', '[', '<':
+			depth++
+		case ')', '}', ']', '>':
+			depth--
+			if depth < 0 {
+				return nil, ErrSyntax
+			}
+		case ',':
+			if 0 == depth {
+				result = append(result, args[begin:position])
+				begin = position + 1
+			}
+		}
+	}
+	if 0 != depth {
+		return nil, ErrSyntax
+	}
+	return append(result, args[begin:]), nil
+}
+
+// splitFunction splits name(args)
+func splitFunction(expr string) (string, []string, error) {
+	open := strings.Index(expr, "(")
+	if open <= 0 || !strings.HasSuffix(expr, ")") {
+		return "", nil, ErrSyntax
+	}
+	args, err := splitArgs(expr[open+1 : len(expr)-1])
+	if nil != err {
+		return "", nil, err
+	}
+	return expr[:open], args, nil
+}
+
+func (d *Descriptor) parseKey(expr string, ctx int) (*keyExpression, error) {
+	key, err := parseKey(expr, contextTr == ctx, d.params)
+	if nil != err {
+		return nil, fmt.Errorf("%v: %s", err, expr)
+	}
+	if !key.compressed && (contextWsh == ctx || contextTr == ctx) {
+		return nil, ErrUncompressedKey
+	}
+
+	if key.ranged {
+		d.ranged = true
+	}
+	if branches := key.branches(); branches > 1 {
+		if d.branches > 1 && d.branches != branches {
+			return nil, ErrBranchMismatch
+		}
+		d.branches = branches
+	}
+	return key, nil
+}
+
+func (d *Descriptor) parse(expr string, ctx int) (*node, error) {
+	name, args, err := splitFunction(expr)
+	if nil != err {
+		return nil, err
+	}
+	result := &node{name: name}
+
+	switch name {
+	case "pk", "pkh", "wpkh":
+		if 1 != len(args) {
+			return nil, ErrArgumentCount
+		}
+		if ("wpkh" == name && contextTop != ctx && contextSh != ctx) || ("pkh" == name && contextTr == ctx) {
+			return nil, fmt.Errorf("%v: %s", ErrContext, name)
+		}
+		keyCtx := ctx
+		if "wpkh" == name {
+			keyCtx = contextWsh
+		}
+		key, err := d.parseKey(args[0], keyCtx)
+		if nil != err {
+			return nil, err
+		}
+		result.keys = []*keyExpression{key}
+
+	case "sh", "wsh":
+		if 1 != len(args) {
+			return nil, ErrArgumentCount
+		}
+		if ("sh" == name && contextTop != ctx) || ("wsh" == name && contextTop != ctx && contextSh != ctx) {
+			return nil, fmt.Errorf("%v: %s", ErrContext, name)
+		}
+		subCtx := contextSh
+		if "wsh" == name {
+			subCtx = contextWsh
+		}
+		if result.sub, err = d.parse(args[0], subCtx); nil != err {
+			return nil, err
+		}
+		if "wsh" == name && ("sh" == result.sub.name || "wsh" == result.sub.name || "tr" == result.sub.name) {
+			return nil, ErrNestedWitness
+		}
+
+	case "multi", "sortedmulti", "multi_a", "sortedmulti_a":
+		tapscript := strings.HasSuffix(name, "_a")
+		if tapscript != (contextTr == ctx) {
+			return nil, fmt.Errorf("%v: %s", ErrContext, name)
+		}
+		if len(args) < 2 {
+			return nil, ErrArgumentCount
+		}
+		if len(args)-1 > maxMultisigKeys[ctx] {
+			return nil, ErrTooManyKeys
+		}
+		if result.threshold, err = strconv.Atoi(args[0]); nil != err || result.threshold < 1 || result.threshold > len(args)-1 {
+			return nil, ErrThreshold
+		}
+		for _, oneArg := range args[1:] {
+			key, err := d.parseKey(oneArg, ctx)
+			if nil != err {
+				return nil, err
+			}
+			result.keys = append(result.keys, key)
+		}
+
+	case "tr":
+		if contextTop != ctx {
+			return nil, fmt.Errorf("%v: %s", ErrContext, name)
+		}
+		if len(args) < 1 || len(args) > 2 {
+			return nil, ErrArgumentCount
+		}
+		key, err := d.parseKey(args[0], contextTr)
+		if nil != err {
+			return nil, err
+		}
+		result.keys = []*keyExpression{key}
+		if 2 == len(args) {
+			if result.tree, err = d.parseTree(args[1], 0); nil != err {
+				return nil, err
+			}
+		}
+
+	case "addr", "raw":
+		if contextTop != ctx {
+			return nil, fmt.Errorf("%v: %s", ErrContext, name)
+		}
+		if 1 != len(args) {
+			return nil, ErrArgumentCount
+		}
+		if "addr" == name {
+			if result.script, err = txscript.PayToAddrScript(args[0], d.params); nil != err {
+				return nil, err
+			}
+		} else if result.script, err = hex.DecodeString(args[0]); nil != err {
+			return nil, ErrInvalidRawScript
+		}
+
+	default:
+		return nil, fmt.Errorf("%v: %s", ErrUnknownFunction, name)
+	}
+
+	return result, nil
+}
+
+func (d *Descriptor) parseTree(expr string, depth int) (*tapTree, error) {
+	if depth > maxTapTreeDepth {
+		return nil, ErrTapTreeDepth
+	}
+
+	if strings.HasPrefix(expr, "{") {
+		if !strings.HasSuffix(expr, "}") {
+			return nil, ErrSyntax
+		}
+		args, err := splitArgs(expr[1 : len(expr)-1])
+		if nil != err {
+			return nil, err
+		}
+		if 2 != len(args) {
+			return nil, ErrArgumentCount
+		}
+		left, err := d.parseTree(args[0], depth+1)
+		if nil != err {
+			return nil, err
+		}
+		right, err := d.parseTree(args[1], depth+1)
+		if nil != err {
+			return nil, err
+		}
+		return &tapTree{left: left, right: right}, nil
+	}
+
+	leaf, err := d.parse(expr, contextTr)
+	if nil != err {
+		return nil, err
+	}
+	if "pk" != leaf.name && "multi_a" != leaf.name && "sortedmulti_a" != leaf.name {
+		return nil, ErrTapLeafFunction
+	}
+	return &tapTree{leaf: leaf}, nil
+}
+
+// serializeKeys derives the keys in the serialization of ctx
+func (n *node) serializeKeys(branch int, index uint32, ctx int) ([][]byte, error) {
+	result := make([][]byte, 0, len(n.keys))
+	for _, key := range n.keys {
+		pubKey, err := key.derive(branch, index)
+		if nil != err {
+			return nil, err
+		}
+		switch {
+		case contextTr == ctx:
+			result = append(result, pubKey.SerializeXOnly())
+		case key.compressed:
+			result = append(result, pubKey.SerializeCompressed())
+		default:
+			result = append(result, append([]byte{0x04}, append(pubKey.SerializeXOnly(), padY(pubKey)...)...))
+		}
+	}
+	if strings.HasPrefix(n.name, "sorted") {
+		sort.Slice(result, func(i, j int) bool {
+			return bytes.Compare(result[i], result[j]) < 0
+		})
+	}
+	return result, nil
+}
+
+func padY(pubKey *crypto.PublicKey) []byte {
+	y := pubKey.Y.Bytes()
+	return append(make([]byte, 32-len(y)), y...)
+}
+
+// build returns the script of the node in ctx
+func (n *node) build(branch int, index uint32, ctx int) ([]byte, error) {
+	switch n.name {
+	case "addr", "raw":
+		return n.script, nil
+	case "sh", "wsh":
+		subCtx := contextSh
+		if "wsh" == n.name {
+			subCtx = contextWsh
+		}
+		subScript, err := n.sub.build(branch, index, subCtx)
+		if nil != err {
+			return nil, err
+		}
+		if "sh" == n.name {
+			return txscript.NewScriptBuilder().AddOp(txscript.OP_HASH160).AddData(crypto.Hash160(subScript)).AddOp(txscript.OP_EQUAL).Script(), nil
+		}
+		hash := sha256.Sum256(subScript)
+		return txscript.NewScriptBuilder().AddOp(txscript.OP_0).AddData(hash[:]).Script(), nil
+	case "tr":
+		return n.buildTaproot(branch, index)
+	}
+
+	keys, err := n.serializeKeys(branch, index, ctx)
+	if nil != err {
+		return nil, err
+	}
+
+	builder := txscript.NewScriptBuilder()
+	switch n.name {
+	case "pk":
+		builder.AddData(keys[0]).AddOp(txscript.OP_CHECKSIG)
+	case "pkh":
+		builder.AddOp(txscript.OP_DUP).AddOp(txscript.OP_HASH160).AddData(crypto.Hash160(keys[0])).AddOp(txscript.OP_EQUALVERIFY).AddOp(txscript.OP_CHECKSIG)
+	case "wpkh":
+		builder.AddOp(txscript.OP_0).AddData(crypto.Hash160(keys[0]))
+	case "multi", "sortedmulti":
+		builder.AddInt64(int64(n.threshold))
+		for _, key := range keys {
+			builder.AddData(key)
+		}
+		builder.AddInt64(int64(len(keys))).AddOp(txscript.OP_CHECKMULTISIG)
+	case "multi_a", "sortedmulti_a":
+		for position, key := range keys {
+			builder.AddData(key)
+			if 0 == position {
+				builder.AddOp(txscript.OP_CHECKSIG)
+			} else {
+				builder.AddOp(txscript.OP_CHECKSIGADD)
+			}
+		}
+		builder.AddInt64(int64(n.threshold)).AddOp(txscript.OP_NUMEQUAL)
+	}
+	return builder.Script(), nil
+}
+
+func (n *node) buildTaproot(branch int, index uint32) ([]byte, error) {
+	internal, err := n.keys[0].derive(branch, index)
+	if nil != err {
+		return nil, err
+	}
+
+	var merkleRoot []byte
+	if nil != n.tree {
+		if merkleRoot, err = n.tree.hash(branch, index); nil != err {
+			return nil, err
+		}
+	}
+
+	outputKey, err := crypto.TaprootTweakKey(internal, merkleRoot)
+	if nil != err {
+		return nil, err
+	}
+	return txscript.NewScriptBuilder().AddOp(txscript.OP_1).AddData(outputKey).Script(), nil
+}
+
+// hash is the BIP341 tap leaf or tap branch hash
+func (t *tapTree) hash(branch int, index uint32) ([]byte, error) {
+	if nil != t.leaf {
+		script, err := t.leaf.build(branch, index, contextTr)
+		if nil != err {
+			return nil, err
+		}
+		return crypto.TaggedHash("TapLeaf", []byte{tapLeafVersion}, wire.AppendCompactSize(nil, uint64(len(script))), script), nil
+	}
+
+	left, err := t.left.hash(branch, index)
+	if nil != err {
+		return nil, err
+	}
+	right, err := t.right.hash(branch, index)
+	if nil != err {
+		return nil, err
+	}
+	if bytes.Compare(left, right) > 0 {
+		left, right = right, left
+	}
+	return crypto.TaggedHash("TapBranch", left, right), nil
+}
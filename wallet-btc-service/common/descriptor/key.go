@@ -0,0 +1,201 @@
+package descriptor
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/BlockABC/wallet-btc-service/common/chaincfg"
+	"github.com/BlockABC/wallet-btc-service/common/crypto"
+	"github.com/BlockABC/wallet-btc-service/common/hdkeychain"
+)
+
+var (
+	ErrInvalidKey         = errors.New("invalid key expression, use a hex public key or an xpub")
+	ErrKeyOrigin          = errors.New("invalid key origin")
+	ErrHardenedDerivation = errors.New("hardened derivation after an extended public key is not possible")
+	ErrDerivationPath     = errors.New("invalid derivation path")
+	ErrMultipath          = errors.New("invalid multipath derivation")
+	ErrUncompressedKey    = errors.New("uncompressed keys are not allowed in segwit descriptors")
+	ErrXOnlyKey           = errors.New("x-only keys are only allowed in tr descriptors")
+)
+
+// extended public key versions of descriptors, ypub and zpub are not used
+var (
+	xpubVersion = []byte{0x04, 0x88, 0xb2, 0x1e}
+	tpubVersion = []byte{0x04, 0x35, 0x87, 0xcf}
+)
+
+// key expression: [origin]KEY or [origin]xpub/path, path may have one <a;b> step and end with *
+type keyExpression struct {
+	pubKey       *crypto.PublicKey
+	compressed   bool
+	extendedKey  *hdkeychain.ExtendedKey
+	path         []uint32
+	multipath    []uint32
+	multipathPos int
+	ranged       bool
+
+	// key before the ranged step of every branch
+	branchKey map[int]*hdkeychain.ExtendedKey
+}
+
+// parseKey parses a key expression, xonly allows 32 byte hex keys
+func parseKey(expr string, xonly bool, params *chaincfg.Params) (*keyExpression, error) {
+	if strings.HasPrefix(expr, "[") {
+		end := strings.Index(expr, "]")
+		if end < 0 {
+			return nil, ErrKeyOrigin
+		}
+		if err := checkOrigin(expr[1:end]); nil != err {
+			return nil, err
+		}
+		expr = expr[end+1:]
+	}
+
+	steps := strings.Split(expr, "/")
+	result := &keyExpression{compressed: true, multipathPos: -1}
+
+	// hex public key
+	if data, err := hex.DecodeString(steps[0]); nil == err {
+		if 1 != len(steps) {
+			return nil, ErrDerivationPath
+		}
+		switch len(data) {
+		case 32:
+			if !xonly {
+				return nil, ErrXOnlyKey
+			}
+			result.pubKey, err = crypto.ParseXOnlyPubKey(data)
+		case 65:
+			result.compressed = false
+			result.pubKey, err = crypto.ParsePubKey(data)
+		default:
+			result.pubKey, err = crypto.ParsePubKey(data)
+		}
+		if nil != err {
+			return nil, fmt.Errorf("%v: %v", ErrInvalidKey, err)
+		}
+		return result, nil
+	}
+
+	// extended public key
+	extendedKey, err := hdkeychain.ParseExtendedKey(steps[0])
+	if nil != err {
+		if hdkeychain.ErrPrivateKey == err {
+			return nil, err
+		}
+		return nil, ErrInvalidKey
+	}
+	expected := xpubVersion
+	if chaincfg.MainNetParams.Name != params.Name {
+		expected = tpubVersion
+	}
+	if !extendedKey.IsVersion(expected) {
+		return nil, hdkeychain.ErrWrongNetwork
+	}
+	result.extendedKey = extendedKey
+	result.branchKey = make(map[int]*hdkeychain.ExtendedKey)
+
+	for position, step := range steps[1:] {
+		switch {
+		case "*" == step:
+			if position != len(steps)-2 {
+				return nil, ErrDerivationPath
+			}
+			result.ranged = true
+		case "*'" == step || "*h" == step:
+			return nil, ErrHardenedDerivation
+		case strings.HasPrefix(step, "<") && strings.HasSuffix(step, ">"):
+			if -1 != result.multipathPos {
+				return nil, ErrMultipath
+			}
+			for _, oneValue := range strings.Split(step[1:len(step)-1], ";") {
+				index, err := parseStep(oneValue)
+				if nil != err {
+					return nil, err
+				}
+				result.multipath = append(result.multipath, index)
+			}
+			if len(result.multipath) < 2 {
+				return nil, ErrMultipath
+			}
+			result.multipathPos = len(result.path)
+		default:
+			index, err := parseStep(step)
+			if nil != err {
+				return nil, err
+			}
+			result.path = append(result.path, index)
+		}
+	}
+
+	return result, nil
+}
+
+// parseStep parses a non hardened path step
+func parseStep(step string) (uint32, error) {
+	if strings.HasSuffix(step, "'") || strings.HasSuffix(step, "h") || strings.HasSuffix(step, "H") {
+		return 0, ErrHardenedDerivation
+	}
+	index, err := strconv.ParseUint(step, 10, 32)
+	if nil != err || index >= hdkeychain.HardenedKeyStart {
+		return 0, ErrDerivationPath
+	}
+	return uint32(index), nil
+}
+
+// checkOrigin checks fingerprint/path of a key origin, hardened steps are allowed
+func checkOrigin(origin string) error {
+	steps := strings.Split(origin, "/")
+	if data, err := hex.DecodeString(steps[0]); nil != err || 4 != len(data) {
+		return ErrKeyOrigin
+	}
+	for _, step := range steps[1:] {
+		step = strings.TrimRight(step, "'hH")
+		if index, err := strconv.ParseUint(step, 10, 32); nil != err || index >= hdkeychain.HardenedKeyStart {
+			return ErrKeyOrigin
+		}
+	}
+	return nil
+}
+
+// branches is the number of multipath alternatives, 1 without multipath
+func (k *keyExpression) branches() int {
+	if -1 == k.multipathPos {
+		return 1
+	}
+	return len(k.multipath)
+}
+
+// derive returns the public key of the branch at index
+func (k *keyExpression) derive(branch int, index uint32) (*crypto.PublicKey, error) {
+	if nil == k.extendedKey {
+		return k.pubKey, nil
+	}
+
+	key, ok := k.branchKey[branch]
+	if !ok {
+		path := make([]uint32, 0, len(k.path)+1)
+		path = append(path, k.path...)
+		if -1 != k.multipathPos {
+			path = append(path[:k.multipathPos], append([]uint32{k.multipath[branch]}, k.path[k.multipathPos:]...)...)
+		}
+		var err error
+		if key, err = k.extendedKey.Derive(path...); nil != err {
+			return nil, err
+		}
+		k.branchKey[branch] = key
+	}
+
+	if !k.ranged {
+		return key.PubKey, nil
+	}
+	child, err := key.Child(index)
+	if nil != err {
+		return nil, err
+	}
+	return child.PubKey, nil
+}
@@ -0,0 +1,157 @@
+package hdkeychain
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/BlockABC/wallet-btc-service/common/address"
+	"github.com/BlockABC/wallet-btc-service/common/chaincfg"
+	"github.com/BlockABC/wallet-btc-service/common/crypto"
+)
+
+// derivation type of an account extended public key
+const (
+	BIP44 = "bip44" // p2pkh
+	BIP49 = "bip49" // p2sh-p2wpkh
+	BIP84 = "bip84" // p2wpkh
+	BIP86 = "bip86" // p2tr
+)
+
+// chain of an account
+const (
+	ExternalChain = 0
+	InternalChain = 1
+)
+
+var (
+	ErrUnknownDerivation = errors.New("unknown derivation type, use bip44, bip49, bip84 or bip86")
+	ErrWrongNetwork      = errors.New("extended key version belongs to another network")
+)
+
+type keyVersion struct {
+	version    []byte
+	mainnet    bool
+	derivation string
+}
+
+var allKeyVersion = []keyVersion{
+	{[]byte{0x04, 0x88, 0xb2, 0x1e}, true, BIP44},  // xpub
+	{[]byte{0x04, 0x9d, 0x7c, 0xb2}, true, BIP49},  // ypub
+	{[]byte{0x04, 0xb2, 0x47, 0x46}, true, BIP84},  // zpub
+	{[]byte{0x04, 0x35, 0x87, 0xcf}, false, BIP44}, // tpub
+	{[]byte{0x04, 0x4a, 0x52, 0x62}, false, BIP49}, // upub
+	{[]byte{0x04, 0x5f, 0x1c, 0xf6}, false, BIP84}, // vpub
+}
+
+// Account is an account level extended public key (m/purpose'/coin'/account') and its address type
+type Account struct {
+	Key        *ExtendedKey
+	Derivation string
+	params     *chaincfg.Params
+	chains     map[uint32]*ExtendedKey
+}
+
+// NewAccount parses key for the network, an empty derivation is taken from the key version
+func NewAccount(key string, derivation string, params *chaincfg.Params) (*Account, error) {
+	extendedKey, err := ParseExtendedKey(key)
+	if nil != err {
+		return nil, err
+	}
+
+	var version *keyVersion
+	for index := range allKeyVersion {
+		if extendedKey.IsVersion(allKeyVersion[index].version) {
+			version = &allKeyVersion[index]
+			break
+		}
+	}
+	if nil == version {
+		return nil, ErrUnknownVersion
+	}
+	if version.mainnet != (chaincfg.MainNetParams.Name == params.Name) {
+		return nil, ErrWrongNetwork
+	}
+
+	derivation = strings.ToLower(derivation)
+	switch derivation {
+	case "":
+		derivation = version.derivation
+	case BIP44, BIP49, BIP84, BIP86:
+	default:
+		return nil, ErrUnknownDerivation
+	}
+
+	return &Account{
+		Key:        extendedKey,
+		Derivation: derivation,
+		params:     params,
+		chains:     make(map[uint32]*ExtendedKey),
+	}, nil
+}
+
+// child returns the key at chain/index, the chain keys are kept
+func (a *Account) child(chain uint32, index uint32) (*ExtendedKey, error) {
+	chainKey, ok := a.chains[chain]
+	if !ok {
+		var err error
+		if chainKey, err = a.Key.Child(chain); nil != err {
+			return nil, err
+		}
+		a.chains[chain] = chainKey
+	}
+	return chainKey.Child(index)
+}
+
+// RedeemScript returns the p2sh redeem script of the address at chain/index, the p2wpkh program of bip49. It is
+// nil for the other derivations.
+func (a *Account) RedeemScript(chain uint32, index uint32) ([]byte, error) {
+	if BIP49 != a.Derivation {
+		return nil, nil
+	}
+	child, err := a.child(chain, index)
+	if nil != err {
+		return nil, err
+	}
+	return append([]byte{0x00, 0x14}, crypto.Hash160(child.PubKey.SerializeCompressed())...), nil
+}
+
+// Address returns the address at chain/index
+func (a *Account) Address(chain uint32, index uint32) (string, error) {
+	child, err := a.child(chain, index)
+	if nil != err {
+		return "", err
+	}
+	pubKey := child.PubKey.SerializeCompressed()
+
+	switch a.Derivation {
+	case BIP44:
+		return address.EncodePubKeyHash(crypto.Hash160(pubKey), a.params), nil
+	case BIP49:
+		redeemScript := append([]byte{0x00, 0x14}, crypto.Hash160(pubKey)...)
+		return address.EncodeScriptHash(crypto.Hash160(redeemScript), a.params), nil
+	case BIP84:
+		return address.EncodeSegwit(0, crypto.Hash160(pubKey), a.params)
+	case BIP86:
+		outputKey, err := crypto.TaprootOutputKey(child.PubKey)
+		if nil != err {
+			return "", err
+		}
+		return address.EncodeSegwit(1, outputKey, a.params)
+	}
+
+	return "", fmt.Errorf("%v: %s", ErrUnknownDerivation, a.Derivation)
+}
+
+// Addresses returns count addresses of chain from index begin
+func (a *Account) Addresses(chain uint32, begin uint32, count uint32) ([]string, error) {
+	result := make([]string, 0, count)
+	for index := begin; index < begin+count; index++ {
+		oneAddress, err := a.Address(chain, index)
+		if nil != err {
+			return nil, err
+		}
+		result = append(result, oneAddress)
+	}
+	return result, nil
+}
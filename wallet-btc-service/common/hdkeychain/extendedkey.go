@@ -0,0 +1,141 @@
+package hdkeychain
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"math/big"
+
+	"github.com/BlockABC/wallet-btc-service/common/address"
+	"github.com/BlockABC/wallet-btc-service/common/crypto"
+)
+
+// BIP32 public derivation of extended public keys
+
+const (
+	HardenedKeyStart = 0x80000000
+	serializedKeyLen = 78
+)
+
+var (
+	ErrInvalidKeyLen    = errors.New("the provided serialized extended key length is invalid")
+	ErrPrivateKey       = errors.New("extended private keys are not accepted, send the extended public key")
+	ErrUnknownVersion   = errors.New("unknown extended key version")
+	ErrDeriveHardened   = errors.New("cannot derive a hardened key from a public key")
+	ErrInvalidChild     = errors.New("the extended key at this index is invalid")
+	ErrInvalidPublicKey = errors.New("invalid extended key public key")
+)
+
+// ExtendedKey is an extended public key
+type ExtendedKey struct {
+	Version   [4]byte
+	Depth     uint8
+	ParentFP  [4]byte
+	ChildNum  uint32
+	ChainCode []byte
+	PubKey    *crypto.PublicKey
+}
+
+// ParseExtendedKey decodes a base58check extended public key, the version is checked by the caller
+func ParseExtendedKey(key string) (*ExtendedKey, error) {
+	version, payload, err := address.Base58CheckDecode(key)
+	if nil != err {
+		return nil, err
+	}
+	data := append([]byte{version}, payload...)
+	if serializedKeyLen != len(data) {
+		return nil, ErrInvalidKeyLen
+	}
+
+	result := &ExtendedKey{
+		Depth:     data[4],
+		ChildNum:  binary.BigEndian.Uint32(data[9:13]),
+		ChainCode: data[13:45],
+	}
+	copy(result.Version[:], data[:4])
+	copy(result.ParentFP[:], data[5:9])
+
+	// private key serialization starts with 0x00
+	if 0x00 == data[45] {
+		return nil, ErrPrivateKey
+	}
+	if result.PubKey, err = crypto.ParsePubKey(data[45:]); nil != err {
+		return nil, ErrInvalidPublicKey
+	}
+
+	return result, nil
+}
+
+// String returns the base58check serialization
+func (k *ExtendedKey) String() string {
+	data := make([]byte, 0, serializedKeyLen)
+	data = append(data, k.Version[:]...)
+	data = append(data, k.Depth)
+	data = append(data, k.ParentFP[:]...)
+	var childNum [4]byte
+	binary.BigEndian.PutUint32(childNum[:], k.ChildNum)
+	data = append(data, childNum[:]...)
+	data = append(data, k.ChainCode...)
+	data = append(data, k.PubKey.SerializeCompressed()...)
+	return address.Base58CheckEncode(data[0], data[1:])
+}
+
+// Child derives the non hardened child at index
+func (k *ExtendedKey) Child(index uint32) (*ExtendedKey, error) {
+	if index >= HardenedKeyStart {
+		return nil, ErrDeriveHardened
+	}
+
+	pubKey := k.PubKey.SerializeCompressed()
+	var indexBytes [4]byte
+	binary.BigEndian.PutUint32(indexBytes[:], index)
+
+	mac := hmac.New(sha512.New, k.ChainCode)
+	mac.Write(pubKey)
+	mac.Write(indexBytes[:])
+	ilr := mac.Sum(nil)
+
+	il := ilr[:32]
+	if new(big.Int).SetBytes(il).Cmp(crypto.CurveN) >= 0 {
+		return nil, ErrInvalidChild
+	}
+	ilPoint, err := crypto.ScalarBaseMult(il)
+	if nil != err {
+		return nil, ErrInvalidChild
+	}
+	childKey, err := ilPoint.Add(k.PubKey)
+	if nil != err {
+		return nil, ErrInvalidChild
+	}
+
+	result := &ExtendedKey{
+		Version:   k.Version,
+		Depth:     k.Depth + 1,
+		ChildNum:  index,
+		ChainCode: ilr[32:],
+		PubKey:    childKey,
+	}
+	copy(result.ParentFP[:], crypto.Hash160(pubKey)[:4])
+
+	return result, nil
+}
+
+// Derive follows a path of non hardened indexes
+func (k *ExtendedKey) Derive(path ...uint32) (*ExtendedKey, error) {
+	result := k
+	for _, index := range path {
+		child, err := result.Child(index)
+		if nil != err {
+			return nil, err
+		}
+		result = child
+	}
+	return result, nil
+}
+
+// IsVersion reports whether the key has the 4 byte version
+func (k *ExtendedKey) IsVersion(version []byte) bool {
+	return bytes.Equal(k.Version[:], version)
+}
@@ -0,0 +1,240 @@
+// Package prometheus is a minimal metrics registry served in the prometheus text format 0.0.4: counters,
+// gauges and histograms with labels, and gauges computed when they are scraped.
+package prometheus
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	COUNTER   = "counter"
+	GAUGE     = "gauge"
+	HISTOGRAM = "histogram"
+
+	CONTENTTYPE = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+// DefaultBuckets of a histogram in seconds
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// one label combination of a metric
+type series struct {
+	labelValues []string
+	value       float64
+	counts      []uint64 // histogram, per bucket, not cumulative
+	count       uint64
+	sum         float64
+}
+
+// metric family
+type metric struct {
+	name       string
+	help       string
+	metricType string
+	labelNames []string
+	buckets    []float64
+	compute    func() float64
+
+	mutex  sync.Mutex
+	series map[string]*series
+}
+
+type Counter struct{ m *metric }
+type Gauge struct{ m *metric }
+type Histogram struct{ m *metric }
+
+var (
+	registryMutex sync.Mutex
+	registry      = make(map[string]*metric)
+)
+
+// register adds a metric, a name registered twice panics as it is a programming error
+func register(m *metric) *metric {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	if _, ok := registry[m.name]; ok {
+		panic("prometheus: metric registered twice: " + m.name)
+	}
+	m.series = make(map[string]*series)
+	registry[m.name] = m
+	return m
+}
+
+// NewCounter registers a counter with the label names
+func NewCounter(name string, help string, labelNames ...string) *Counter {
+	return &Counter{register(&metric{name: name, help: help, metricType: COUNTER, labelNames: labelNames})}
+}
+
+// NewGauge registers a gauge with the label names
+func NewGauge(name string, help string, labelNames ...string) *Gauge {
+	return &Gauge{register(&metric{name: name, help: help, metricType: GAUGE, labelNames: labelNames})}
+}
+
+// NewGaugeFunc registers a gauge without labels whose value is computed on every scrape
+func NewGaugeFunc(name string, help string, compute func() float64) {
+	register(&metric{name: name, help: help, metricType: GAUGE, compute: compute})
+}
+
+// NewHistogram registers a histogram with the upper bounds of its buckets, sorted, and the label names
+func NewHistogram(name string, help string, buckets []float64, labelNames ...string) *Histogram {
+	return &Histogram{register(&metric{name: name, help: help, metricType: HISTOGRAM, labelNames: labelNames, buckets: buckets})}
+}
+
+// get returns the series of the label values, created on first use
+func (m *metric) get(labelValues []string) *series {
+	if len(labelValues) != len(m.labelNames) {
+		panic(fmt.Sprintf("prometheus: %s wants %d label values, got %d", m.name, len(m.labelNames), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	s, ok := m.series[key]
+	if !ok {
+		s = &series{labelValues: append([]string(nil), labelValues...)}
+		if HISTOGRAM == m.metricType {
+			s.counts = make([]uint64, len(m.buckets))
+		}
+		m.series[key] = s
+	}
+	return s
+}
+
+// Add adds a non negative value to the counter of the label values
+func (c *Counter) Add(value float64, labelValues ...string) {
+	if value < 0 {
+		return
+	}
+	c.m.mutex.Lock()
+	c.m.get(labelValues).value += value
+	c.m.mutex.Unlock()
+}
+
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Set sets the gauge of the label values
+func (g *Gauge) Set(value float64, labelValues ...string) {
+	g.m.mutex.Lock()
+	g.m.get(labelValues).value = value
+	g.m.mutex.Unlock()
+}
+
+// Observe records a value in the histogram of the label values
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+	h.m.mutex.Lock()
+	defer h.m.mutex.Unlock()
+	s := h.m.get(labelValues)
+	for index, bound := range h.m.buckets {
+		if value <= bound {
+			s.counts[index]++
+			break
+		}
+	}
+	s.count++
+	s.sum += value
+}
+
+// Write writes every registered metric sorted by name
+func Write(w io.Writer) error {
+	registryMutex.Lock()
+	allMetric := make([]*metric, 0, len(registry))
+	for _, m := range registry {
+		allMetric = append(allMetric, m)
+	}
+	registryMutex.Unlock()
+	sort.Slice(allMetric, func(i, j int) bool {
+		return allMetric[i].name < allMetric[j].name
+	})
+
+	buf := bytes.NewBuffer(nil)
+	for _, m := range allMetric {
+		m.write(buf)
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func (m *metric) write(buf *bytes.Buffer) {
+	fmt.Fprintf(buf, "# HELP %s %s\n", m.name, escapeHelp(m.help))
+	fmt.Fprintf(buf, "# TYPE %s %s\n", m.name, m.metricType)
+
+	if nil != m.compute {
+		fmt.Fprintf(buf, "%s %s\n", m.name, formatValue(m.compute()))
+		return
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	keys := make([]string, 0, len(m.series))
+	for key := range m.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		s := m.series[key]
+		if HISTOGRAM != m.metricType {
+			fmt.Fprintf(buf, "%s%s %s\n", m.name, formatLabels(m.labelNames, s.labelValues, "", ""), formatValue(s.value))
+			continue
+		}
+
+		cumulative := uint64(0)
+		for index, bound := range m.buckets {
+			cumulative += s.counts[index]
+			fmt.Fprintf(buf, "%s_bucket%s %d\n", m.name, formatLabels(m.labelNames, s.labelValues, "le", formatValue(bound)), cumulative)
+		}
+		fmt.Fprintf(buf, "%s_bucket%s %d\n", m.name, formatLabels(m.labelNames, s.labelValues, "le", "+Inf"), s.count)
+		fmt.Fprintf(buf, "%s_sum%s %s\n", m.name, formatLabels(m.labelNames, s.labelValues, "", ""), formatValue(s.sum))
+		fmt.Fprintf(buf, "%s_count%s %d\n", m.name, formatLabels(m.labelNames, s.labelValues, "", ""), s.count)
+	}
+}
+
+// formatLabels returns {name="value",...} with an extra label when extraName is set
+func formatLabels(names []string, values []string, extraName string, extraValue string) string {
+	if 0 == len(names) && "" == extraName {
+		return ""
+	}
+	parts := make([]string, 0, len(names)+1)
+	for index, name := range names {
+		parts = append(parts, fmt.Sprintf(`%s="%s"`, name, escapeLabel(values[index])))
+	}
+	if "" != extraName {
+		parts = append(parts, fmt.Sprintf(`%s="%s"`, extraName, extraValue))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func escapeHelp(help string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+}
+
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`).Replace(value)
+}
+
+// Handler serves the registered metrics
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", CONTENTTYPE)
+		Write(w)
+	})
+}
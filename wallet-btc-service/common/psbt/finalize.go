@@ -0,0 +1,486 @@
+package psbt
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+
+	"github.com/BlockABC/wallet-btc-service/common/crypto"
+	"github.com/BlockABC/wallet-btc-service/common/txscript"
+	"github.com/BlockABC/wallet-btc-service/common/wire"
+)
+
+// the finalizer supports single key p2pkh, p2wpkh, p2sh-p2wpkh, taproot key path and m-of-n multisig in bare, p2sh,
+// p2wsh and p2sh-p2wsh scripts. Signatures are not verified, the node checks them when the transaction is sent.
+
+var (
+	ErrMissingUtxo       = errors.New("psbt input has no utxo")
+	ErrMissingScript     = errors.New("psbt input has no matching redeem or witness script")
+	ErrUnsupportedScript = errors.New("psbt input script is not supported")
+	ErrMissingSignature  = errors.New("psbt input is missing signatures")
+	ErrNotFinalized      = errors.New("psbt has inputs not finalized")
+	ErrTxMismatch        = errors.New("psbts have different unsigned transactions")
+)
+
+// how an input is spent
+type spend struct {
+	redeemScript  []byte   // p2sh redeem script
+	witnessScript []byte   // p2wsh witness script
+	witness       bool     // spent with witness
+	keyHash       []byte   // single key hash of p2pkh and p2wpkh
+	pubKeys       [][]byte // multisig keys
+	required      int
+	taproot       bool
+}
+
+// PrevOut returns the output spent by input index from the utxo of the input, nil when there is none
+func (p *Packet) PrevOut(index int) *wire.TxOut {
+	in := p.Inputs[index]
+	if nil != in.WitnessUtxo {
+		return in.WitnessUtxo
+	}
+	if nil != in.NonWitnessUtxo {
+		return in.NonWitnessUtxo.TxOut[p.UnsignedTx.TxIn[index].PreviousOutPoint.Index]
+	}
+	return nil
+}
+
+func (in *Input) IsFinalized() bool {
+	return nil != in.FinalScriptSig || nil != in.FinalScriptWitness
+}
+
+// signature returns the partial signature of pubKey
+func (in *Input) signature(pubKey []byte) []byte {
+	for _, sig := range in.PartialSigs {
+		if bytes.Equal(sig.PubKey, pubKey) {
+			return sig.Signature
+		}
+	}
+	return nil
+}
+
+// keyHashSignature returns the public key and signature whose key hash is keyHash
+func (in *Input) keyHashSignature(keyHash []byte) ([]byte, []byte) {
+	for _, sig := range in.PartialSigs {
+		if bytes.Equal(crypto.Hash160(sig.PubKey), keyHash) {
+			return sig.PubKey, sig.Signature
+		}
+	}
+	return nil, nil
+}
+
+func (in *Input) analyze(pkScript []byte) (*spend, error) {
+	result := &spend{required: 1}
+	script := pkScript
+
+	if txscript.IsPayToScriptHash(pkScript) {
+		redeemScript := in.RedeemScript
+		if nil == redeemScript && 1 == len(in.PartialSigs) {
+			// p2sh-p2wpkh redeem script comes from the key
+			redeemScript = append([]byte{txscript.OP_0, txscript.OP_DATA_20}, crypto.Hash160(in.PartialSigs[0].PubKey)...)
+		}
+		if nil == redeemScript || !bytes.Equal(crypto.Hash160(redeemScript), pkScript[2:22]) {
+			return nil, ErrMissingScript
+		}
+		result.redeemScript = redeemScript
+		script = redeemScript
+	}
+
+	if txscript.IsPayToPubKeyHash(script) {
+		result.keyHash = script[3:23]
+		return result, nil
+	}
+
+	isWitness, version, program := txscript.ExtractWitnessProgram(script)
+	switch {
+	case isWitness && 0 == version && 20 == len(program):
+		result.witness = true
+		result.keyHash = program
+		return result, nil
+	case isWitness && 0 == version && 32 == len(program):
+		hash := sha256.Sum256(in.WitnessScript)
+		if nil == in.WitnessScript || !bytes.Equal(hash[:], program) {
+			return nil, ErrMissingScript
+		}
+		result.witness = true
+		result.witnessScript = in.WitnessScript
+		script = in.WitnessScript
+	case isWitness && 1 == version && 32 == len(program) && nil == result.redeemScript:
+		result.witness = true
+		result.taproot = true
+		return result, nil
+	case isWitness:
+		return nil, ErrUnsupportedScript
+	}
+
+	isMultisig, required, pubKeys := txscript.ExtractMultisig(script)
+	if !isMultisig {
+		return nil, ErrUnsupportedScript
+	}
+	result.required = required
+	result.pubKeys = pubKeys
+	return result, nil
+}
+
+// SignStatus returns how many signatures the input needs, how many it has and the multisig keys not signed yet
+func (in *Input) SignStatus(pkScript []byte) (int, int, [][]byte, error) {
+	if in.IsFinalized() {
+		return 0, 0, nil, nil
+	}
+
+	result, err := in.analyze(pkScript)
+	if nil != err {
+		return 0, 0, nil, err
+	}
+
+	switch {
+	case result.taproot:
+		if nil != in.TapKeySig {
+			return 1, 1, nil, nil
+		}
+		return 1, 0, nil, nil
+	case nil != result.keyHash:
+		if _, sig := in.keyHashSignature(result.keyHash); nil != sig {
+			return 1, 1, nil, nil
+		}
+		return 1, 0, nil, nil
+	}
+
+	signed := 0
+	missing := make([][]byte, 0)
+	for _, pubKey := range result.pubKeys {
+		if nil != in.signature(pubKey) {
+			signed++
+		} else {
+			missing = append(missing, pubKey)
+		}
+	}
+	return result.required, signed, missing, nil
+}
+
+// signatures returns the items of the final script sig or witness, with dummy set missing signatures are 72
+// bytes of zero so the size can be estimated
+func (in *Input) signatures(result *spend, dummy bool) ([][]byte, error) {
+	dummySig := make([]byte, 72)
+
+	switch {
+	case result.taproot:
+		if nil != in.TapKeySig {
+			return [][]byte{in.TapKeySig}, nil
+		}
+		if dummy {
+			return [][]byte{dummySig[:64]}, nil
+		}
+		return nil, ErrMissingSignature
+	case nil != result.keyHash:
+		pubKey, sig := in.keyHashSignature(result.keyHash)
+		if nil != sig {
+			return [][]byte{sig, pubKey}, nil
+		}
+		if dummy {
+			return [][]byte{dummySig, make([]byte, 33)}, nil
+		}
+		return nil, ErrMissingSignature
+	}
+
+	// signatures in key order, the empty item is consumed by the CHECKMULTISIG bug
+	pushes := [][]byte{{}}
+	for _, pubKey := range result.pubKeys {
+		if len(pushes)-1 == result.required {
+			break
+		}
+		if sig := in.signature(pubKey); nil != sig {
+			pushes = append(pushes, sig)
+		}
+	}
+	for dummy && len(pushes)-1 < result.required {
+		pushes = append(pushes, dummySig)
+	}
+	if len(pushes)-1 < result.required {
+		return nil, ErrMissingSignature
+	}
+	if nil != result.witnessScript {
+		pushes = append(pushes, result.witnessScript)
+	}
+	return pushes, nil
+}
+
+// finalScripts returns the final script sig and witness of the items
+func finalScripts(result *spend, pushes [][]byte) ([]byte, []byte) {
+	var witness []byte
+	builder := txscript.NewScriptBuilder()
+	if result.witness {
+		witness = serializeWitness(pushes)
+	} else {
+		for _, push := range pushes {
+			builder.AddData(push)
+		}
+	}
+	if nil != result.redeemScript {
+		builder.AddData(result.redeemScript)
+	}
+
+	scriptSig := builder.Script()
+	if 0 == len(scriptSig) {
+		scriptSig = nil
+	}
+	return scriptSig, witness
+}
+
+// FinalizeInput builds the final script sig and witness of input index spending pkScript and clears the
+// other fields like the BIP174 finalizer
+func (p *Packet) FinalizeInput(index int, pkScript []byte) error {
+	in := p.Inputs[index]
+	if in.IsFinalized() {
+		return nil
+	}
+
+	result, err := in.analyze(pkScript)
+	if nil != err {
+		return err
+	}
+	pushes, err := in.signatures(result, false)
+	if nil != err {
+		return err
+	}
+	in.FinalScriptSig, in.FinalScriptWitness = finalScripts(result, pushes)
+
+	in.PartialSigs = nil
+	in.SighashType = 0
+	in.RedeemScript = nil
+	in.WitnessScript = nil
+	in.Bip32Derivation = nil
+	in.TapKeySig = nil
+	return nil
+}
+
+// EstimateVsize returns the virtual size of the transaction once finalized, pkScripts are the spent scripts of
+// the inputs. Missing signatures are taken as 72 bytes, it is 0 when an input can not be estimated.
+func (p *Packet) EstimateVsize(pkScripts [][]byte) int64 {
+	tx := p.UnsignedTx
+	weight := int64(4+4+wire.CompactSizeLen(uint64(len(tx.TxIn)))+wire.CompactSizeLen(uint64(len(tx.TxOut)))) * wire.WITNESS_SCALE_FACTOR
+	for _, out := range tx.TxOut {
+		weight += int64(8+wire.CompactSizeLen(uint64(len(out.PkScript)))+len(out.PkScript)) * wire.WITNESS_SCALE_FACTOR
+	}
+
+	var witnessWeight int64
+	hasWitness := false
+	for index, in := range p.Inputs {
+		scriptSig, witness := in.FinalScriptSig, in.FinalScriptWitness
+		if !in.IsFinalized() {
+			if index >= len(pkScripts) || nil == pkScripts[index] {
+				return 0
+			}
+			result, err := in.analyze(pkScripts[index])
+			if nil != err {
+				return 0
+			}
+			pushes, err := in.signatures(result, true)
+			if nil != err {
+				return 0
+			}
+			scriptSig, witness = finalScripts(result, pushes)
+		}
+
+		weight += int64(32+4+wire.CompactSizeLen(uint64(len(scriptSig)))+len(scriptSig)+4) * wire.WITNESS_SCALE_FACTOR
+		if nil != witness {
+			hasWitness = true
+			witnessWeight += int64(len(witness))
+		} else {
+			witnessWeight++
+		}
+	}
+	if hasWitness {
+		weight += 2 + witnessWeight
+	}
+
+	return (weight + wire.WITNESS_SCALE_FACTOR - 1) / wire.WITNESS_SCALE_FACTOR
+}
+
+// Finalize finalizes the inputs whose utxo is known, it returns the first error and finalizes the others anyway
+func (p *Packet) Finalize() error {
+	var firstErr error
+	for index := range p.Inputs {
+		prevOut := p.PrevOut(index)
+		err := ErrMissingUtxo
+		if nil != prevOut {
+			err = p.FinalizeInput(index, prevOut.PkScript)
+		}
+		if nil != err && nil == firstErr {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// IsComplete reports if every input is finalized
+func (p *Packet) IsComplete() bool {
+	for _, in := range p.Inputs {
+		if !in.IsFinalized() {
+			return false
+		}
+	}
+	return true
+}
+
+// Extract returns the signed transaction of a finalized packet
+func (p *Packet) Extract() (*wire.MsgTx, error) {
+	if !p.IsComplete() {
+		return nil, ErrNotFinalized
+	}
+
+	tx := &wire.MsgTx{Version: p.UnsignedTx.Version, LockTime: p.UnsignedTx.LockTime}
+	for index, unsignedIn := range p.UnsignedTx.TxIn {
+		in := &wire.TxIn{PreviousOutPoint: unsignedIn.PreviousOutPoint, Sequence: unsignedIn.Sequence}
+		in.SignatureScript = p.Inputs[index].FinalScriptSig
+		if nil != p.Inputs[index].FinalScriptWitness {
+			witness, err := parseWitness(p.Inputs[index].FinalScriptWitness)
+			if nil != err {
+				return nil, err
+			}
+			in.Witness = witness
+		}
+		tx.TxIn = append(tx.TxIn, in)
+	}
+	tx.TxOut = p.UnsignedTx.TxOut
+
+	// decode again so the hashes and sizes are computed
+	return wire.DeserializeTx(tx.Serialize())
+}
+
+func serializeWitness(items [][]byte) []byte {
+	buf := wire.AppendCompactSize(nil, uint64(len(items)))
+	for _, item := range items {
+		buf = wire.AppendCompactSize(buf, uint64(len(item)))
+		buf = append(buf, item...)
+	}
+	return buf
+}
+
+func parseWitness(data []byte) ([][]byte, error) {
+	count, length, err := wire.ReadCompactSize(data)
+	if nil != err {
+		return nil, err
+	}
+	r := &reader{buf: data, pos: length}
+
+	// an item takes at least one byte, the untrusted count does not preallocate more than the data
+	capacity := count
+	if remain := uint64(len(data) - length); capacity > remain {
+		capacity = remain
+	}
+	items := make([][]byte, 0, capacity)
+	for i := uint64(0); i < count; i++ {
+		item, err := r.readVarBytes()
+		if nil != err {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	if r.pos != len(data) {
+		return nil, ErrInvalidValue
+	}
+	return items, nil
+}
+
+// Combine merges the packets of the same unsigned transaction, for a key present in several packets the first
+// value is kept
+func Combine(packets []*Packet) (*Packet, error) {
+	if 0 == len(packets) {
+		return nil, ErrNoUnsignedTx
+	}
+
+	result, err := Parse(packets[0].Serialize())
+	if nil != err {
+		return nil, err
+	}
+	for _, other := range packets[1:] {
+		if other.UnsignedTx.TxHash() != result.UnsignedTx.TxHash() {
+			return nil, ErrTxMismatch
+		}
+
+		result.Unknowns = combineUnknown(result.Unknowns, other.Unknowns)
+		for index, in := range result.Inputs {
+			combineInput(in, other.Inputs[index])
+		}
+		for index, out := range result.Outputs {
+			otherOut := other.Outputs[index]
+			if nil == out.RedeemScript {
+				out.RedeemScript = otherOut.RedeemScript
+			}
+			if nil == out.WitnessScript {
+				out.WitnessScript = otherOut.WitnessScript
+			}
+			out.Bip32Derivation = combineDerivation(out.Bip32Derivation, otherOut.Bip32Derivation)
+			out.Unknowns = combineUnknown(out.Unknowns, otherOut.Unknowns)
+		}
+	}
+
+	return result, nil
+}
+
+func combineInput(in *Input, other *Input) {
+	if nil == in.NonWitnessUtxo {
+		in.NonWitnessUtxo = other.NonWitnessUtxo
+	}
+	if nil == in.WitnessUtxo {
+		in.WitnessUtxo = other.WitnessUtxo
+	}
+	for _, sig := range other.PartialSigs {
+		if nil == in.signature(sig.PubKey) {
+			in.PartialSigs = append(in.PartialSigs, sig)
+		}
+	}
+	if 0 == in.SighashType {
+		in.SighashType = other.SighashType
+	}
+	if nil == in.RedeemScript {
+		in.RedeemScript = other.RedeemScript
+	}
+	if nil == in.WitnessScript {
+		in.WitnessScript = other.WitnessScript
+	}
+	in.Bip32Derivation = combineDerivation(in.Bip32Derivation, other.Bip32Derivation)
+	if nil == in.FinalScriptSig {
+		in.FinalScriptSig = other.FinalScriptSig
+	}
+	if nil == in.FinalScriptWitness {
+		in.FinalScriptWitness = other.FinalScriptWitness
+	}
+	if nil == in.TapKeySig {
+		in.TapKeySig = other.TapKeySig
+	}
+	in.Unknowns = combineUnknown(in.Unknowns, other.Unknowns)
+}
+
+func combineDerivation(allDerivation []*Bip32Derivation, other []*Bip32Derivation) []*Bip32Derivation {
+	for _, one := range other {
+		exist := false
+		for _, mine := range allDerivation {
+			if bytes.Equal(mine.PubKey, one.PubKey) {
+				exist = true
+				break
+			}
+		}
+		if !exist {
+			allDerivation = append(allDerivation, one)
+		}
+	}
+	return allDerivation
+}
+
+func combineUnknown(allUnknown []*Unknown, other []*Unknown) []*Unknown {
+	for _, one := range other {
+		exist := false
+		for _, mine := range allUnknown {
+			if bytes.Equal(mine.Key, one.Key) {
+				exist = true
+				break
+			}
+		}
+		if !exist {
+			allUnknown = append(allUnknown, one)
+		}
+	}
+	return allUnknown
+}
@@ -0,0 +1,469 @@
+package psbt
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+
+	"github.com/BlockABC/wallet-btc-service/common/wire"
+)
+
+// partially signed bitcoin transactions of BIP174 version 0, unknown keys are kept as they are
+
+var (
+	ErrInvalidMagic       = errors.New("invalid psbt magic bytes")
+	ErrInvalidKey         = errors.New("invalid psbt key")
+	ErrInvalidValue       = errors.New("invalid psbt value")
+	ErrDuplicateKey       = errors.New("duplicate psbt key")
+	ErrNoUnsignedTx       = errors.New("psbt has no unsigned transaction")
+	ErrSignedTx           = errors.New("psbt unsigned transaction has script sig or witness")
+	ErrMapCount           = errors.New("psbt maps do not match the unsigned transaction")
+	ErrUnsupportedVersion = errors.New("unsupported psbt version")
+	ErrUtxoMismatch       = errors.New("psbt non witness utxo does not match the input")
+	ErrTrailingData       = errors.New("trailing data after psbt")
+)
+
+var magic = []byte{0x70, 0x73, 0x62, 0x74, 0xff}
+
+// global key types
+const (
+	GlobalUnsignedTx = 0x00
+	GlobalVersion    = 0xfb
+)
+
+// input key types
+const (
+	InNonWitnessUtxo     = 0x00
+	InWitnessUtxo        = 0x01
+	InPartialSig         = 0x02
+	InSighashType        = 0x03
+	InRedeemScript       = 0x04
+	InWitnessScript      = 0x05
+	InBip32Derivation    = 0x06
+	InFinalScriptSig     = 0x07
+	InFinalScriptWitness = 0x08
+	InTapKeySig          = 0x13
+)
+
+// output key types
+const (
+	OutRedeemScript    = 0x00
+	OutWitnessScript   = 0x01
+	OutBip32Derivation = 0x02
+)
+
+// key value pair this package does not handle
+type Unknown struct {
+	Key   []byte
+	Value []byte
+}
+
+type PartialSig struct {
+	PubKey    []byte
+	Signature []byte
+}
+
+// Bip32Derivation is the master key fingerprint and the path of a public key
+type Bip32Derivation struct {
+	PubKey      []byte
+	Fingerprint uint32
+	Path        []uint32
+}
+
+type Input struct {
+	NonWitnessUtxo     *wire.MsgTx
+	WitnessUtxo        *wire.TxOut
+	PartialSigs        []*PartialSig
+	SighashType        uint32 // 0 when not set
+	RedeemScript       []byte
+	WitnessScript      []byte
+	Bip32Derivation    []*Bip32Derivation
+	FinalScriptSig     []byte
+	FinalScriptWitness []byte // serialized witness stack
+	TapKeySig          []byte
+	Unknowns           []*Unknown
+}
+
+type Output struct {
+	RedeemScript    []byte
+	WitnessScript   []byte
+	Bip32Derivation []*Bip32Derivation
+	Unknowns        []*Unknown
+}
+
+// Packet is a psbt, there is one input and output map for every input and output of the unsigned transaction
+type Packet struct {
+	UnsignedTx *wire.MsgTx
+	Unknowns   []*Unknown
+	Inputs     []*Input
+	Outputs    []*Output
+}
+
+// New returns a packet with empty input and output maps for tx, tx must not be signed
+func New(tx *wire.MsgTx) (*Packet, error) {
+	for _, in := range tx.TxIn {
+		if 0 != len(in.SignatureScript) || 0 != len(in.Witness) {
+			return nil, ErrSignedTx
+		}
+	}
+
+	packet := &Packet{UnsignedTx: tx}
+	for range tx.TxIn {
+		packet.Inputs = append(packet.Inputs, &Input{})
+	}
+	for range tx.TxOut {
+		packet.Outputs = append(packet.Outputs, &Output{})
+	}
+	return packet, nil
+}
+
+type reader struct {
+	buf []byte
+	pos int
+}
+
+func (r *reader) readVarBytes() ([]byte, error) {
+	size, length, err := wire.ReadCompactSize(r.buf[r.pos:])
+	if nil != err {
+		return nil, err
+	}
+	r.pos += length
+	if uint64(len(r.buf)-r.pos) < size {
+		return nil, wire.ErrUnexpectedEOF
+	}
+	result := r.buf[r.pos : r.pos+int(size)]
+	r.pos += int(size)
+	return result, nil
+}
+
+// readMap reads key value pairs until the separator, keys are checked unique
+func (r *reader) readMap() ([][2][]byte, error) {
+	result := make([][2][]byte, 0)
+	exist := make(map[string]bool)
+	for {
+		key, err := r.readVarBytes()
+		if nil != err {
+			return nil, err
+		}
+		if 0 == len(key) {
+			return result, nil
+		}
+		if exist[string(key)] {
+			return nil, ErrDuplicateKey
+		}
+		exist[string(key)] = true
+
+		value, err := r.readVarBytes()
+		if nil != err {
+			return nil, err
+		}
+		result = append(result, [2][]byte{key, value})
+	}
+}
+
+func parseBip32Derivation(pubKey []byte, value []byte) (*Bip32Derivation, error) {
+	if 33 != len(pubKey) || 0 == len(value) || 0 != len(value)%4 {
+		return nil, ErrInvalidValue
+	}
+	derivation := &Bip32Derivation{PubKey: pubKey, Fingerprint: binary.LittleEndian.Uint32(value)}
+	for index := 4; index < len(value); index += 4 {
+		derivation.Path = append(derivation.Path, binary.LittleEndian.Uint32(value[index:]))
+	}
+	return derivation, nil
+}
+
+func parseInput(pairs [][2][]byte, prevOut wire.OutPoint) (*Input, error) {
+	in := &Input{}
+	for _, pair := range pairs {
+		key, value := pair[0], pair[1]
+		keyData := key[1:]
+		switch key[0] {
+		case InNonWitnessUtxo:
+			if 0 != len(keyData) {
+				return nil, ErrInvalidKey
+			}
+			tx, err := wire.DeserializeTx(value)
+			if nil != err {
+				return nil, err
+			}
+			if tx.TxHash() != prevOut.HashString() || int(prevOut.Index) >= len(tx.TxOut) {
+				return nil, ErrUtxoMismatch
+			}
+			in.NonWitnessUtxo = tx
+		case InWitnessUtxo:
+			if 0 != len(keyData) || len(value) < 9 {
+				return nil, ErrInvalidValue
+			}
+			r := &reader{buf: value, pos: 8}
+			script, err := r.readVarBytes()
+			if nil != err || r.pos != len(value) {
+				return nil, ErrInvalidValue
+			}
+			in.WitnessUtxo = &wire.TxOut{Value: int64(binary.LittleEndian.Uint64(value)), PkScript: script}
+		case InPartialSig:
+			if 33 != len(keyData) && 65 != len(keyData) {
+				return nil, ErrInvalidKey
+			}
+			in.PartialSigs = append(in.PartialSigs, &PartialSig{keyData, value})
+		case InSighashType:
+			if 0 != len(keyData) || 4 != len(value) {
+				return nil, ErrInvalidValue
+			}
+			in.SighashType = binary.LittleEndian.Uint32(value)
+		case InRedeemScript:
+			if 0 != len(keyData) {
+				return nil, ErrInvalidKey
+			}
+			in.RedeemScript = value
+		case InWitnessScript:
+			if 0 != len(keyData) {
+				return nil, ErrInvalidKey
+			}
+			in.WitnessScript = value
+		case InBip32Derivation:
+			derivation, err := parseBip32Derivation(keyData, value)
+			if nil != err {
+				return nil, err
+			}
+			in.Bip32Derivation = append(in.Bip32Derivation, derivation)
+		case InFinalScriptSig:
+			if 0 != len(keyData) {
+				return nil, ErrInvalidKey
+			}
+			in.FinalScriptSig = value
+		case InFinalScriptWitness:
+			if 0 != len(keyData) {
+				return nil, ErrInvalidKey
+			}
+			in.FinalScriptWitness = value
+		case InTapKeySig:
+			if 0 != len(keyData) || (64 != len(value) && 65 != len(value)) {
+				return nil, ErrInvalidValue
+			}
+			in.TapKeySig = value
+		default:
+			in.Unknowns = append(in.Unknowns, &Unknown{key, value})
+		}
+	}
+	return in, nil
+}
+
+func parseOutput(pairs [][2][]byte) (*Output, error) {
+	out := &Output{}
+	for _, pair := range pairs {
+		key, value := pair[0], pair[1]
+		keyData := key[1:]
+		switch key[0] {
+		case OutRedeemScript:
+			if 0 != len(keyData) {
+				return nil, ErrInvalidKey
+			}
+			out.RedeemScript = value
+		case OutWitnessScript:
+			if 0 != len(keyData) {
+				return nil, ErrInvalidKey
+			}
+			out.WitnessScript = value
+		case OutBip32Derivation:
+			derivation, err := parseBip32Derivation(keyData, value)
+			if nil != err {
+				return nil, err
+			}
+			out.Bip32Derivation = append(out.Bip32Derivation, derivation)
+		default:
+			out.Unknowns = append(out.Unknowns, &Unknown{key, value})
+		}
+	}
+	return out, nil
+}
+
+// Parse decodes a serialized psbt
+func Parse(data []byte) (*Packet, error) {
+	if !bytes.HasPrefix(data, magic) {
+		return nil, ErrInvalidMagic
+	}
+	r := &reader{buf: data, pos: len(magic)}
+
+	pairs, err := r.readMap()
+	if nil != err {
+		return nil, err
+	}
+	packet := &Packet{}
+	for _, pair := range pairs {
+		key, value := pair[0], pair[1]
+		switch key[0] {
+		case GlobalUnsignedTx:
+			if 1 != len(key) {
+				return nil, ErrInvalidKey
+			}
+			tx, err := wire.DeserializeTx(value)
+			if nil != err {
+				return nil, err
+			}
+			packet.UnsignedTx = tx
+		case GlobalVersion:
+			if 1 != len(key) || 4 != len(value) {
+				return nil, ErrInvalidValue
+			}
+			if 0 != binary.LittleEndian.Uint32(value) {
+				return nil, ErrUnsupportedVersion
+			}
+			packet.Unknowns = append(packet.Unknowns, &Unknown{key, value})
+		default:
+			packet.Unknowns = append(packet.Unknowns, &Unknown{key, value})
+		}
+	}
+	if nil == packet.UnsignedTx {
+		return nil, ErrNoUnsignedTx
+	}
+	for _, in := range packet.UnsignedTx.TxIn {
+		if 0 != len(in.SignatureScript) || 0 != len(in.Witness) {
+			return nil, ErrSignedTx
+		}
+	}
+
+	for _, txIn := range packet.UnsignedTx.TxIn {
+		if r.pos >= len(data) {
+			return nil, ErrMapCount
+		}
+		pairs, err := r.readMap()
+		if nil != err {
+			return nil, err
+		}
+		in, err := parseInput(pairs, txIn.PreviousOutPoint)
+		if nil != err {
+			return nil, err
+		}
+		packet.Inputs = append(packet.Inputs, in)
+	}
+
+	for range packet.UnsignedTx.TxOut {
+		if r.pos >= len(data) {
+			return nil, ErrMapCount
+		}
+		pairs, err := r.readMap()
+		if nil != err {
+			return nil, err
+		}
+		out, err := parseOutput(pairs)
+		if nil != err {
+			return nil, err
+		}
+		packet.Outputs = append(packet.Outputs, out)
+	}
+
+	if r.pos != len(data) {
+		return nil, ErrTrailingData
+	}
+	return packet, nil
+}
+
+// ParseBase64 decodes a base64 psbt
+func ParseBase64(str string) (*Packet, error) {
+	data, err := base64.StdEncoding.DecodeString(str)
+	if nil != err {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+func appendPair(buf []byte, keyType byte, keyData []byte, value []byte) []byte {
+	buf = wire.AppendCompactSize(buf, uint64(1+len(keyData)))
+	buf = append(buf, keyType)
+	buf = append(buf, keyData...)
+	buf = wire.AppendCompactSize(buf, uint64(len(value)))
+	return append(buf, value...)
+}
+
+func appendUnknown(buf []byte, allUnknown []*Unknown) []byte {
+	for _, one := range allUnknown {
+		buf = wire.AppendCompactSize(buf, uint64(len(one.Key)))
+		buf = append(buf, one.Key...)
+		buf = wire.AppendCompactSize(buf, uint64(len(one.Value)))
+		buf = append(buf, one.Value...)
+	}
+	return buf
+}
+
+func appendBip32Derivation(buf []byte, keyType byte, allDerivation []*Bip32Derivation) []byte {
+	for _, one := range allDerivation {
+		value := make([]byte, 4+4*len(one.Path))
+		binary.LittleEndian.PutUint32(value, one.Fingerprint)
+		for index, step := range one.Path {
+			binary.LittleEndian.PutUint32(value[4+4*index:], step)
+		}
+		buf = appendPair(buf, keyType, one.PubKey, value)
+	}
+	return buf
+}
+
+// Serialize encodes the packet
+func (p *Packet) Serialize() []byte {
+	buf := append([]byte{}, magic...)
+	buf = appendPair(buf, GlobalUnsignedTx, nil, p.UnsignedTx.SerializeNoWitness())
+	buf = appendUnknown(buf, p.Unknowns)
+	buf = append(buf, 0x00)
+
+	for _, in := range p.Inputs {
+		if nil != in.NonWitnessUtxo {
+			raw := in.NonWitnessUtxo.Raw()
+			if nil == raw {
+				raw = in.NonWitnessUtxo.Serialize()
+			}
+			buf = appendPair(buf, InNonWitnessUtxo, nil, raw)
+		}
+		if nil != in.WitnessUtxo {
+			value := make([]byte, 8, 8+9+len(in.WitnessUtxo.PkScript))
+			binary.LittleEndian.PutUint64(value, uint64(in.WitnessUtxo.Value))
+			value = wire.AppendCompactSize(value, uint64(len(in.WitnessUtxo.PkScript)))
+			value = append(value, in.WitnessUtxo.PkScript...)
+			buf = appendPair(buf, InWitnessUtxo, nil, value)
+		}
+		for _, sig := range in.PartialSigs {
+			buf = appendPair(buf, InPartialSig, sig.PubKey, sig.Signature)
+		}
+		if 0 != in.SighashType {
+			value := make([]byte, 4)
+			binary.LittleEndian.PutUint32(value, in.SighashType)
+			buf = appendPair(buf, InSighashType, nil, value)
+		}
+		if nil != in.RedeemScript {
+			buf = appendPair(buf, InRedeemScript, nil, in.RedeemScript)
+		}
+		if nil != in.WitnessScript {
+			buf = appendPair(buf, InWitnessScript, nil, in.WitnessScript)
+		}
+		buf = appendBip32Derivation(buf, InBip32Derivation, in.Bip32Derivation)
+		if nil != in.FinalScriptSig {
+			buf = appendPair(buf, InFinalScriptSig, nil, in.FinalScriptSig)
+		}
+		if nil != in.FinalScriptWitness {
+			buf = appendPair(buf, InFinalScriptWitness, nil, in.FinalScriptWitness)
+		}
+		if nil != in.TapKeySig {
+			buf = appendPair(buf, InTapKeySig, nil, in.TapKeySig)
+		}
+		buf = appendUnknown(buf, in.Unknowns)
+		buf = append(buf, 0x00)
+	}
+
+	for _, out := range p.Outputs {
+		if nil != out.RedeemScript {
+			buf = appendPair(buf, OutRedeemScript, nil, out.RedeemScript)
+		}
+		if nil != out.WitnessScript {
+			buf = appendPair(buf, OutWitnessScript, nil, out.WitnessScript)
+		}
+		buf = appendBip32Derivation(buf, OutBip32Derivation, out.Bip32Derivation)
+		buf = appendUnknown(buf, out.Unknowns)
+		buf = append(buf, 0x00)
+	}
+
+	return buf
+}
+
+// B64Encode returns the base64 encoding of the packet
+func (p *Packet) B64Encode() string {
+	return base64.StdEncoding.EncodeToString(p.Serialize())
+}
@@ -0,0 +1,109 @@
+package txscript
+
+import (
+	"encoding/binary"
+
+	"github.com/BlockABC/wallet-btc-service/common/address"
+	"github.com/BlockABC/wallet-btc-service/common/chaincfg"
+)
+
+// ScriptBuilder appends opcodes and minimal pushes to a script
+type ScriptBuilder struct {
+	script []byte
+}
+
+func NewScriptBuilder() *ScriptBuilder {
+	return &ScriptBuilder{script: make([]byte, 0, 64)}
+}
+
+func (b *ScriptBuilder) AddOp(opcode byte) *ScriptBuilder {
+	b.script = append(b.script, opcode)
+	return b
+}
+
+// AddData pushes data with the smallest push opcode
+func (b *ScriptBuilder) AddData(data []byte) *ScriptBuilder {
+	size := len(data)
+	switch {
+	case 0 == size:
+		return b.AddOp(OP_0)
+	case 1 == size && data[0] >= 1 && data[0] <= 16:
+		return b.AddOp(OP_1 + data[0] - 1)
+	case 1 == size && 0x81 == data[0]:
+		return b.AddOp(OP_1NEGATE)
+	case size < OP_PUSHDATA1:
+		b.script = append(b.script, byte(size))
+	case size <= 0xff:
+		b.script = append(b.script, OP_PUSHDATA1, byte(size))
+	case size <= 0xffff:
+		var buf [2]byte
+		binary.LittleEndian.PutUint16(buf[:], uint16(size))
+		b.script = append(append(b.script, OP_PUSHDATA2), buf[:]...)
+	default:
+		var buf [4]byte
+		binary.LittleEndian.PutUint32(buf[:], uint32(size))
+		b.script = append(append(b.script, OP_PUSHDATA4), buf[:]...)
+	}
+	b.script = append(b.script, data...)
+	return b
+}
+
+// AddInt64 pushes a script number
+func (b *ScriptBuilder) AddInt64(n int64) *ScriptBuilder {
+	switch {
+	case 0 == n:
+		return b.AddOp(OP_0)
+	case -1 == n:
+		return b.AddOp(OP_1NEGATE)
+	case n >= 1 && n <= 16:
+		return b.AddOp(byte(OP_1 + n - 1))
+	}
+
+	negative := n < 0
+	if negative {
+		n = -n
+	}
+	var data []byte
+	for n > 0 {
+		data = append(data, byte(n&0xff))
+		n >>= 8
+	}
+	// the sign is the high bit of the last byte
+	if 0 != data[len(data)-1]&0x80 {
+		if negative {
+			data = append(data, 0x80)
+		} else {
+			data = append(data, 0x00)
+		}
+	} else if negative {
+		data[len(data)-1] |= 0x80
+	}
+
+	b.script = append(append(b.script, byte(len(data))), data...)
+	return b
+}
+
+func (b *ScriptBuilder) Script() []byte {
+	return b.script
+}
+
+// PayToAddrScript returns the scriptPubKey paying to addr
+func PayToAddrScript(addr string, params *chaincfg.Params) ([]byte, error) {
+	decoded, err := address.DecodeAddress(addr, params)
+	if nil != err {
+		return nil, err
+	}
+
+	switch decoded.Type {
+	case address.PubKeyHashTy:
+		return NewScriptBuilder().AddOp(OP_DUP).AddOp(OP_HASH160).AddData(decoded.Hash).AddOp(OP_EQUALVERIFY).AddOp(OP_CHECKSIG).Script(), nil
+	case address.ScriptHashTy:
+		return NewScriptBuilder().AddOp(OP_HASH160).AddData(decoded.Hash).AddOp(OP_EQUAL).Script(), nil
+	}
+
+	version := OP_0
+	if 0 != decoded.WitnessVersion {
+		version = OP_1 + int(decoded.WitnessVersion) - 1
+	}
+	return NewScriptBuilder().AddOp(byte(version)).AddData(decoded.Hash).Script(), nil
+}
@@ -0,0 +1,115 @@
+package txscript
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+var sigHashTypes = map[byte]string{
+	0x01: "ALL",
+	0x81: "ALL|ANYONECANPAY",
+	0x02: "NONE",
+	0x82: "NONE|ANYONECANPAY",
+	0x03: "SINGLE",
+	0x83: "SINGLE|ANYONECANPAY",
+}
+
+// DisasmString returns the same asm as bitcoind, pushes up to four bytes are printed as numbers.
+// With sigHashDecode, used for scriptSig, signatures get their sighash type appended
+func DisasmString(script []byte, sigHashDecode bool) string {
+	var result strings.Builder
+	for pos := 0; pos < len(script); {
+		if 0 != result.Len() {
+			result.WriteByte(' ')
+		}
+
+		op, next, err := nextOp(script, pos)
+		if nil != err {
+			result.WriteString("[error]")
+			break
+		}
+		pos = next
+
+		if op.Opcode > OP_PUSHDATA4 {
+			result.WriteString(GetOpName(op.Opcode))
+			continue
+		}
+
+		if len(op.Data) <= 4 {
+			result.WriteString(fmt.Sprintf("%d", scriptNum(op.Data)))
+			continue
+		}
+
+		if sigHashDecode && !isUnspendable(script) && isValidSignatureEncoding(op.Data) {
+			if name, ok := sigHashTypes[op.Data[len(op.Data)-1]]; ok {
+				result.WriteString(hex.EncodeToString(op.Data[:len(op.Data)-1]))
+				result.WriteString("[" + name + "]")
+				continue
+			}
+		}
+		result.WriteString(hex.EncodeToString(op.Data))
+	}
+
+	return result.String()
+}
+
+// scriptNum decodes a little endian sign magnitude number, not required minimal
+func scriptNum(data []byte) int64 {
+	if 0 == len(data) {
+		return 0
+	}
+
+	var result int64
+	for index, one := range data {
+		result |= int64(one) << uint(8*index)
+	}
+
+	last := data[len(data)-1]
+	if 0 != last&0x80 {
+		return -(result & ^(int64(0x80) << uint(8*(len(data)-1))))
+	}
+	return result
+}
+
+func isUnspendable(script []byte) bool {
+	return (len(script) > 0 && OP_RETURN == script[0]) || len(script) > MAX_SCRIPT_SIZE
+}
+
+// isValidSignatureEncoding is the strict DER check of BIP66, sig includes the sighash byte
+func isValidSignatureEncoding(sig []byte) bool {
+	size := len(sig)
+	if size < 9 || size > 73 {
+		return false
+	}
+	if 0x30 != sig[0] || int(sig[1]) != size-3 {
+		return false
+	}
+
+	lenR := int(sig[3])
+	if 5+lenR >= size {
+		return false
+	}
+	lenS := int(sig[5+lenR])
+	if lenR+lenS+7 != size {
+		return false
+	}
+
+	if 0x02 != sig[2] || 0 == lenR || 0 != sig[4]&0x80 {
+		return false
+	}
+	if lenR > 1 && 0x00 == sig[4] && 0 == sig[5]&0x80 {
+		return false
+	}
+
+	if 0x02 != sig[lenR+4] || 0 == lenS || 0 != sig[lenR+6]&0x80 {
+		return false
+	}
+	if lenS > 1 && 0x00 == sig[lenR+6] && 0 == sig[lenR+7]&0x80 {
+		return false
+	}
+
+	// STRICTENC defined hash type
+	hashType := sig[size-1] &^ 0x80
+	return hashType >= 0x01 && hashType <= 0x03
+}
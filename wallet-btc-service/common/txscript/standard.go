@@ -0,0 +1,152 @@
+package txscript
+
+import (
+	"github.com/BlockABC/wallet-btc-service/common/address"
+	"github.com/BlockABC/wallet-btc-service/common/chaincfg"
+	"github.com/BlockABC/wallet-btc-service/common/crypto"
+)
+
+// script types, named as scriptPubKey.type of bitcoind
+const (
+	NonStandardTy         = "nonstandard"
+	PubKeyTy              = "pubkey"
+	PubKeyHashTy          = "pubkeyhash"
+	ScriptHashTy          = "scripthash"
+	MultiSigTy            = "multisig"
+	NullDataTy            = "nulldata"
+	WitnessV0PubKeyHashTy = "witness_v0_keyhash"
+	WitnessV0ScriptHashTy = "witness_v0_scripthash"
+	WitnessV1TaprootTy    = "witness_v1_taproot"
+	WitnessUnknownTy      = "witness_unknown"
+)
+
+func IsPayToScriptHash(script []byte) bool {
+	return 23 == len(script) && OP_HASH160 == script[0] && OP_DATA_20 == script[1] && OP_EQUAL == script[22]
+}
+
+func IsPayToPubKeyHash(script []byte) bool {
+	return 25 == len(script) && OP_DUP == script[0] && OP_HASH160 == script[1] && OP_DATA_20 == script[2] &&
+		OP_EQUALVERIFY == script[23] && OP_CHECKSIG == script[24]
+}
+
+// ExtractWitnessProgram returns version and program of a segwit scriptPubKey
+func ExtractWitnessProgram(script []byte) (bool, int, []byte) {
+	if len(script) < 4 || len(script) > 42 {
+		return false, 0, nil
+	}
+	if OP_0 != script[0] && !IsSmallInteger(script[0]) {
+		return false, 0, nil
+	}
+	if int(script[1])+2 != len(script) {
+		return false, 0, nil
+	}
+	return true, DecodeSmallInteger(script[0]), script[2:]
+}
+
+// isValidPubKeySize checks the public key length matches its header byte
+func isValidPubKeySize(pubKey []byte) bool {
+	if 0 == len(pubKey) {
+		return false
+	}
+	switch pubKey[0] {
+	case 0x02, 0x03:
+		return 33 == len(pubKey)
+	case 0x04, 0x06, 0x07:
+		return 65 == len(pubKey)
+	}
+	return false
+}
+
+func matchPayToPubKey(script []byte) []byte {
+	if 35 == len(script) && OP_DATA_33 == script[0] && OP_CHECKSIG == script[34] && isValidPubKeySize(script[1:34]) {
+		return script[1:34]
+	}
+	if 67 == len(script) && OP_DATA_65 == script[0] && OP_CHECKSIG == script[66] && isValidPubKeySize(script[1:66]) {
+		return script[1:66]
+	}
+	return nil
+}
+
+func matchMultisig(script []byte) (bool, int, [][]byte) {
+	if len(script) < 1 || OP_CHECKMULTISIG != script[len(script)-1] {
+		return false, 0, nil
+	}
+
+	op, pos, err := nextOp(script, 0)
+	if nil != err || !IsSmallInteger(op.Opcode) {
+		return false, 0, nil
+	}
+	required := DecodeSmallInteger(op.Opcode)
+
+	pubKeys := make([][]byte, 0)
+	for {
+		op, pos, err = nextOp(script, pos)
+		if nil != err || !isValidPubKeySize(op.Data) {
+			break
+		}
+		pubKeys = append(pubKeys, op.Data)
+	}
+	if nil != err || !IsSmallInteger(op.Opcode) {
+		return false, 0, nil
+	}
+	if DecodeSmallInteger(op.Opcode) != len(pubKeys) || len(pubKeys) < required {
+		return false, 0, nil
+	}
+
+	return pos+1 == len(script), required, pubKeys
+}
+
+// ExtractMultisig returns the required signatures and the public keys of a multisig script
+func ExtractMultisig(script []byte) (bool, int, [][]byte) {
+	return matchMultisig(script)
+}
+
+// ExtractPkScriptAddrs classifies a scriptPubKey like bitcoind and returns type, reqSigs and addresses,
+// reqSigs is 0 and addresses nil when the script has no address
+func ExtractPkScriptAddrs(script []byte, params *chaincfg.Params) (string, int32, []string) {
+	if IsPayToScriptHash(script) {
+		return ScriptHashTy, 1, []string{address.EncodeScriptHash(script[2:22], params)}
+	}
+
+	if ok, version, program := ExtractWitnessProgram(script); ok {
+		scriptType := WitnessUnknownTy
+		switch {
+		case 0 == version && 20 == len(program):
+			scriptType = WitnessV0PubKeyHashTy
+		case 0 == version && 32 == len(program):
+			scriptType = WitnessV0ScriptHashTy
+		case 0 == version:
+			return NonStandardTy, 0, nil
+		case 1 == version && 32 == len(program):
+			scriptType = WitnessV1TaprootTy
+		}
+
+		segwitAddress, err := address.EncodeSegwit(byte(version), program, params)
+		if nil != err {
+			return scriptType, 0, nil
+		}
+		return scriptType, 1, []string{segwitAddress}
+	}
+
+	if len(script) >= 1 && OP_RETURN == script[0] && IsPushOnly(script[1:]) {
+		return NullDataTy, 0, nil
+	}
+
+	if pubKey := matchPayToPubKey(script); nil != pubKey {
+		return PubKeyTy, 1, []string{address.EncodePubKeyHash(crypto.Hash160(pubKey), params)}
+	}
+
+	if IsPayToPubKeyHash(script) {
+		return PubKeyHashTy, 1, []string{address.EncodePubKeyHash(script[3:23], params)}
+	}
+
+	if ok, required, pubKeys := matchMultisig(script); ok {
+		addresses := make([]string, 0, len(pubKeys))
+		for _, pubKey := range pubKeys {
+			addresses = append(addresses, address.EncodePubKeyHash(crypto.Hash160(pubKey), params))
+		}
+		return MultiSigTy, int32(required), addresses
+	}
+
+	return NonStandardTy, 0, nil
+}
@@ -1,7 +1,10 @@
 package utility
 
 import (
+	"context"
+	"net/http"
 	"os"
+	"time"
 )
 
 // is file exist
@@ -9,3 +12,24 @@ func IsFileExist(filename string) bool {
 	_, err := os.Stat(filename)
 	return err == nil || os.IsExist(err)
 }
+
+// ListenAndServe serves the handler until ctx is done, then shuts the server down waiting up to timeout for
+// the requests being served
+func ListenAndServe(ctx context.Context, address string, handler http.Handler, timeout time.Duration) error {
+	server := &http.Server{Addr: address, Handler: handler}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return server.Shutdown(shutdownCtx)
+}
@@ -0,0 +1,244 @@
+// Package websocket is a minimal RFC 6455 server connection, enough to push text messages to browsers
+// and read their small control messages. Extensions and subprotocols are not negotiated.
+package websocket
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// opcodes
+const (
+	ContinuationMessage = 0
+	TextMessage         = 1
+	BinaryMessage       = 2
+	CloseMessage        = 8
+	PingMessage         = 9
+	PongMessage         = 10
+)
+
+const (
+	acceptGuid        = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	maxControlPayload = 125
+
+	DEFAULTMAXMESSAGESIZE = 64 * 1024
+)
+
+var (
+	ErrBadHandshake    = errors.New("websocket: bad handshake")
+	ErrNotHijacker     = errors.New("websocket: response does not implement http.Hijacker")
+	ErrUnmaskedFrame   = errors.New("websocket: client frame not masked")
+	ErrBadFrame        = errors.New("websocket: bad frame")
+	ErrMessageTooLarge = errors.New("websocket: message too large")
+)
+
+type Conn struct {
+	conn       net.Conn
+	reader     *bufio.Reader
+	writeMutex sync.Mutex
+
+	// messages larger than it are refused
+	MaxMessageSize int64
+
+	// time allowed to wait for every frame, pongs included, 0 waits forever
+	ReadTimeout time.Duration
+}
+
+// IsUpgrade reports if the request asks for a websocket connection
+func IsUpgrade(r *http.Request) bool {
+	return headerContains(r.Header, "Connection", "upgrade") && headerContains(r.Header, "Upgrade", "websocket")
+}
+
+// headerContains reports if a comma separated header has the token, case insensitive
+func headerContains(header http.Header, name string, token string) bool {
+	for _, value := range header[name] {
+		for _, one := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(one), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Upgrade answers the opening handshake and takes over the connection of the request
+func Upgrade(w http.ResponseWriter, r *http.Request) (*Conn, error) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if "GET" != r.Method || !IsUpgrade(r) || "13" != r.Header.Get("Sec-WebSocket-Version") || "" == key {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return nil, ErrBadHandshake
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return nil, ErrNotHijacker
+	}
+	conn, rw, err := hijacker.Hijack()
+	if nil != err {
+		return nil, err
+	}
+
+	response := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + AcceptKey(key) + "\r\n\r\n"
+	conn.SetDeadline(time.Time{})
+	if _, err := conn.Write([]byte(response)); nil != err {
+		conn.Close()
+		return nil, err
+	}
+
+	return &Conn{conn: conn, reader: rw.Reader, MaxMessageSize: DEFAULTMAXMESSAGESIZE}, nil
+}
+
+// AcceptKey returns the Sec-WebSocket-Accept of a Sec-WebSocket-Key
+func AcceptKey(key string) string {
+	hash := sha1.Sum([]byte(key + acceptGuid))
+	return base64.StdEncoding.EncodeToString(hash[:])
+}
+
+// ReadMessage blocks until the next text or binary message arrives, pings are answered while waiting.
+// A close from the peer is answered and returned as io.EOF.
+func (c *Conn) ReadMessage() (int, []byte, error) {
+	messageType := 0
+	message := make([]byte, 0)
+	for {
+		fin, opcode, payload, err := c.readFrame()
+		if nil != err {
+			return 0, nil, err
+		}
+
+		switch opcode {
+		case PingMessage:
+			if err := c.WriteMessage(PongMessage, payload); nil != err {
+				return 0, nil, err
+			}
+			continue
+		case PongMessage:
+			continue
+		case CloseMessage:
+			c.WriteMessage(CloseMessage, payload)
+			return 0, nil, io.EOF
+		case TextMessage, BinaryMessage:
+			if 0 != messageType {
+				return 0, nil, ErrBadFrame
+			}
+			messageType = opcode
+		case ContinuationMessage:
+			if 0 == messageType {
+				return 0, nil, ErrBadFrame
+			}
+		default:
+			return 0, nil, ErrBadFrame
+		}
+
+		if c.MaxMessageSize > 0 && int64(len(message)+len(payload)) > c.MaxMessageSize {
+			return 0, nil, ErrMessageTooLarge
+		}
+		message = append(message, payload...)
+		if fin {
+			return messageType, message, nil
+		}
+	}
+}
+
+// readFrame reads and unmasks one frame
+func (c *Conn) readFrame() (bool, int, []byte, error) {
+	if c.ReadTimeout > 0 {
+		c.conn.SetReadDeadline(time.Now().Add(c.ReadTimeout))
+	}
+
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(c.reader, header); nil != err {
+		return false, 0, nil, err
+	}
+	fin := 0 != header[0]&0x80
+	opcode := int(header[0] & 0x0f)
+	if 0 != header[0]&0x70 {
+		return false, 0, nil, ErrBadFrame
+	}
+	if 0 == header[1]&0x80 {
+		return false, 0, nil, ErrUnmaskedFrame
+	}
+
+	length := uint64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		extended := make([]byte, 2)
+		if _, err := io.ReadFull(c.reader, extended); nil != err {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(extended))
+	case 127:
+		extended := make([]byte, 8)
+		if _, err := io.ReadFull(c.reader, extended); nil != err {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(extended)
+	}
+
+	// control frames are small and never fragmented
+	if opcode >= CloseMessage && (!fin || length > maxControlPayload) {
+		return false, 0, nil, ErrBadFrame
+	}
+	if c.MaxMessageSize > 0 && length > uint64(c.MaxMessageSize) {
+		return false, 0, nil, ErrMessageTooLarge
+	}
+
+	mask := make([]byte, 4)
+	if _, err := io.ReadFull(c.reader, mask); nil != err {
+		return false, 0, nil, err
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.reader, payload); nil != err {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, opcode, payload, nil
+}
+
+// WriteMessage sends one unfragmented frame, it is safe to call from several goroutines
+func (c *Conn) WriteMessage(opcode int, data []byte) error {
+	frame := make([]byte, 0, len(data)+10)
+	frame = append(frame, 0x80|byte(opcode))
+	switch {
+	case len(data) < 126:
+		frame = append(frame, byte(len(data)))
+	case len(data) <= 0xffff:
+		frame = append(frame, 126, 0, 0)
+		binary.BigEndian.PutUint16(frame[2:], uint16(len(data)))
+	default:
+		frame = append(frame, 127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(frame[2:], uint64(len(data)))
+	}
+	frame = append(frame, data...)
+
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	_, err := c.conn.Write(frame)
+	return err
+}
+
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	return c.conn.SetWriteDeadline(t)
+}
+
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
@@ -0,0 +1,163 @@
+package wire
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+const (
+	MAX_SIZE = 0x02000000 // max serialized size of a vector, same as bitcoind
+
+	// least serialized size of an element
+	MIN_TXIN_SIZE    = 32 + 4 + 1 + 4 // outpoint, empty script and sequence
+	MIN_TXOUT_SIZE   = 8 + 1          // value and empty script
+	MIN_WITNESS_SIZE = 1              // empty item
+	MIN_TX_SIZE      = 4 + 1 + 1 + 4  // version, no input, no output and locktime
+)
+
+var (
+	ErrUnexpectedEOF = errors.New("unexpected end of data")
+	ErrSizeTooLarge  = errors.New("size too large")
+	ErrNonCanonical  = errors.New("non-canonical compact size")
+)
+
+type reader struct {
+	buf []byte
+	pos int
+}
+
+func (r *reader) remain() int {
+	return len(r.buf) - r.pos
+}
+
+// capacity returns count bounded by the elements of at least minSize bytes the remaining data can hold, so
+// an untrusted count does not preallocate more than the data
+func (r *reader) capacity(count uint64, minSize int) int {
+	if max := uint64(r.remain() / minSize); count > max {
+		return int(max)
+	}
+	return int(count)
+}
+
+func (r *reader) readBytes(size int) ([]byte, error) {
+	if size < 0 || r.remain() < size {
+		return nil, ErrUnexpectedEOF
+	}
+	result := r.buf[r.pos : r.pos+size]
+	r.pos += size
+	return result, nil
+}
+
+func (r *reader) readUint8() (uint8, error) {
+	data, err := r.readBytes(1)
+	if nil != err {
+		return 0, err
+	}
+	return data[0], nil
+}
+
+func (r *reader) readUint32() (uint32, error) {
+	data, err := r.readBytes(4)
+	if nil != err {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint32(data), nil
+}
+
+func (r *reader) readUint64() (uint64, error) {
+	data, err := r.readBytes(8)
+	if nil != err {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint64(data), nil
+}
+
+// readCompactSize reads a canonical var int
+func (r *reader) readCompactSize() (uint64, error) {
+	first, err := r.readUint8()
+	if nil != err {
+		return 0, err
+	}
+
+	var size uint64
+	switch first {
+	case 0xfd:
+		data, err := r.readBytes(2)
+		if nil != err {
+			return 0, err
+		}
+		size = uint64(binary.LittleEndian.Uint16(data))
+		if size < 0xfd {
+			return 0, ErrNonCanonical
+		}
+	case 0xfe:
+		value, err := r.readUint32()
+		if nil != err {
+			return 0, err
+		}
+		size = uint64(value)
+		if size < 0x10000 {
+			return 0, ErrNonCanonical
+		}
+	case 0xff:
+		value, err := r.readUint64()
+		if nil != err {
+			return 0, err
+		}
+		size = value
+		if size < 0x100000000 {
+			return 0, ErrNonCanonical
+		}
+	default:
+		size = uint64(first)
+	}
+
+	if size > MAX_SIZE {
+		return 0, ErrSizeTooLarge
+	}
+	return size, nil
+}
+
+func (r *reader) readVarBytes() ([]byte, error) {
+	size, err := r.readCompactSize()
+	if nil != err {
+		return nil, err
+	}
+	return r.readBytes(int(size))
+}
+
+// ReadCompactSize reads the compact size at the start of buf, it returns the size and the bytes read
+func ReadCompactSize(buf []byte) (uint64, int, error) {
+	r := &reader{buf: buf}
+	size, err := r.readCompactSize()
+	if nil != err {
+		return 0, 0, err
+	}
+	return size, r.pos, nil
+}
+
+func CompactSizeLen(size uint64) int {
+	switch {
+	case size < 0xfd:
+		return 1
+	case size <= 0xffff:
+		return 3
+	case size <= 0xffffffff:
+		return 5
+	}
+	return 9
+}
+
+func AppendCompactSize(buf []byte, size uint64) []byte {
+	switch {
+	case size < 0xfd:
+		return append(buf, byte(size))
+	case size <= 0xffff:
+		return append(buf, 0xfd, byte(size), byte(size>>8))
+	case size <= 0xffffffff:
+		return append(buf, 0xfe, byte(size), byte(size>>8), byte(size>>16), byte(size>>24))
+	}
+	var data [8]byte
+	binary.LittleEndian.PutUint64(data[:], size)
+	return append(append(buf, 0xff), data[:]...)
+}
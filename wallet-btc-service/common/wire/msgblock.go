@@ -0,0 +1,116 @@
+package wire
+
+import (
+	"fmt"
+
+	"github.com/BlockABC/wallet-btc-service/common/crypto"
+)
+
+const (
+	BLOCK_HEADER_SIZE = 80
+)
+
+type BlockHeader struct {
+	Version    int32
+	PrevBlock  []byte // internal byte order
+	MerkleRoot []byte // internal byte order
+	Timestamp  uint32
+	Bits       uint32
+	Nonce      uint32
+
+	hash []byte
+}
+
+// BlockHash in rpc byte order
+func (h *BlockHeader) BlockHash() string {
+	return crypto.HashToString(h.hash)
+}
+
+func (h *BlockHeader) PrevBlockHash() string {
+	return crypto.HashToString(h.PrevBlock)
+}
+
+func (h *BlockHeader) MerkleRootHash() string {
+	return crypto.HashToString(h.MerkleRoot)
+}
+
+// BitsString is the compact target as bitcoind prints it
+func (h *BlockHeader) BitsString() string {
+	return fmt.Sprintf("%08x", h.Bits)
+}
+
+type MsgBlock struct {
+	Header       BlockHeader
+	Transactions []*MsgTx
+
+	size         int
+	strippedSize int
+}
+
+func (b *MsgBlock) SerializeSize() int {
+	return b.size
+}
+
+func (b *MsgBlock) SerializeSizeStripped() int {
+	return b.strippedSize
+}
+
+func (b *MsgBlock) Weight() int64 {
+	return int64(b.strippedSize*(WITNESS_SCALE_FACTOR-1) + b.size)
+}
+
+func DeserializeBlockHeader(raw []byte) (*BlockHeader, error) {
+	r := &reader{buf: raw}
+	return readBlockHeader(r)
+}
+
+func readBlockHeader(r *reader) (*BlockHeader, error) {
+	data, err := r.readBytes(BLOCK_HEADER_SIZE)
+	if nil != err {
+		return nil, err
+	}
+
+	h := &BlockHeader{}
+	hr := &reader{buf: data}
+	version, _ := hr.readUint32()
+	h.Version = int32(version)
+	h.PrevBlock, _ = hr.readBytes(32)
+	h.MerkleRoot, _ = hr.readBytes(32)
+	h.Timestamp, _ = hr.readUint32()
+	h.Bits, _ = hr.readUint32()
+	h.Nonce, _ = hr.readUint32()
+	h.hash = crypto.DoubleSha256(data)
+
+	return h, nil
+}
+
+func DeserializeBlock(raw []byte) (*MsgBlock, error) {
+	r := &reader{buf: raw}
+	header, err := readBlockHeader(r)
+	if nil != err {
+		return nil, err
+	}
+
+	count, err := r.readCompactSize()
+	if nil != err {
+		return nil, err
+	}
+
+	block := &MsgBlock{Header: *header, Transactions: make([]*MsgTx, 0, r.capacity(count, MIN_TX_SIZE))}
+	block.strippedSize = BLOCK_HEADER_SIZE + CompactSizeLen(count)
+	for i := uint64(0); i < count; i++ {
+		tx, err := readTx(r)
+		if nil != err {
+			return nil, fmt.Errorf("transaction %d: %v", i, err)
+		}
+		block.Transactions = append(block.Transactions, tx)
+		block.strippedSize += tx.SerializeSizeStripped()
+	}
+
+	if 0 != r.remain() {
+		return nil, ErrTrailingData
+	}
+	block.size = len(raw)
+
+	return block, nil
+}
@@ -0,0 +1,298 @@
+package wire
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+
+	"github.com/BlockABC/wallet-btc-service/common/crypto"
+)
+
+const (
+	WITNESS_SCALE_FACTOR = 4
+)
+
+var (
+	ErrUnknownOptionalData = errors.New("unknown transaction optional data")
+	ErrSuperfluousWitness  = errors.New("superfluous witness record")
+	ErrTrailingData        = errors.New("trailing data after transaction")
+)
+
+type OutPoint struct {
+	Hash  []byte // internal byte order
+	Index uint32
+}
+
+// HashString is the previous txid in rpc byte order
+func (o OutPoint) HashString() string {
+	return crypto.HashToString(o.Hash)
+}
+
+type TxIn struct {
+	PreviousOutPoint OutPoint
+	SignatureScript  []byte
+	Witness          [][]byte
+	Sequence         uint32
+}
+
+type TxOut struct {
+	Value    int64
+	PkScript []byte
+}
+
+// MsgTx is a decoded transaction, hashes and sizes are computed while decoding
+type MsgTx struct {
+	Version  int32
+	TxIn     []*TxIn
+	TxOut    []*TxOut
+	LockTime uint32
+
+	txid     []byte
+	wtxid    []byte
+	size     int
+	baseSize int
+	raw      []byte
+}
+
+func (tx *MsgTx) IsCoinBase() bool {
+	if 1 != len(tx.TxIn) {
+		return false
+	}
+	prev := tx.TxIn[0].PreviousOutPoint
+	if 0xffffffff != prev.Index {
+		return false
+	}
+	for _, one := range prev.Hash {
+		if 0 != one {
+			return false
+		}
+	}
+	return true
+}
+
+func (tx *MsgTx) HasWitness() bool {
+	for _, in := range tx.TxIn {
+		if 0 != len(in.Witness) {
+			return true
+		}
+	}
+	return false
+}
+
+// TxHash is the txid in rpc byte order
+func (tx *MsgTx) TxHash() string {
+	return crypto.HashToString(tx.txid)
+}
+
+// WitnessHash is the wtxid in rpc byte order, equal to txid without witness
+func (tx *MsgTx) WitnessHash() string {
+	return crypto.HashToString(tx.wtxid)
+}
+
+// SerializeSize is the size with witness data
+func (tx *MsgTx) SerializeSize() int {
+	return tx.size
+}
+
+// SerializeSizeStripped is the size without witness data
+func (tx *MsgTx) SerializeSizeStripped() int {
+	return tx.baseSize
+}
+
+func (tx *MsgTx) Weight() int64 {
+	return int64(tx.baseSize*(WITNESS_SCALE_FACTOR-1) + tx.size)
+}
+
+func (tx *MsgTx) VSize() int64 {
+	return (tx.Weight() + WITNESS_SCALE_FACTOR - 1) / WITNESS_SCALE_FACTOR
+}
+
+// Raw returns the serialized transaction the MsgTx was decoded from
+func (tx *MsgTx) Raw() []byte {
+	return tx.raw
+}
+
+func DeserializeTx(raw []byte) (*MsgTx, error) {
+	r := &reader{buf: raw}
+	tx, err := readTx(r)
+	if nil != err {
+		return nil, err
+	}
+	if 0 != r.remain() {
+		return nil, ErrTrailingData
+	}
+	return tx, nil
+}
+
+func readTx(r *reader) (*MsgTx, error) {
+	tx := &MsgTx{}
+	start := r.pos
+
+	version, err := r.readUint32()
+	if nil != err {
+		return nil, err
+	}
+	tx.Version = int32(version)
+
+	// BIP144 marker and flag
+	bodyStart := r.pos
+	var flags uint8
+	count, err := r.readCompactSize()
+	if nil != err {
+		return nil, err
+	}
+	if 0 == count {
+		if flags, err = r.readUint8(); nil != err {
+			return nil, err
+		}
+		if 0 != flags {
+			bodyStart = r.pos
+			if count, err = r.readCompactSize(); nil != err {
+				return nil, err
+			}
+		}
+	}
+
+	tx.TxIn = make([]*TxIn, 0, r.capacity(count, MIN_TXIN_SIZE))
+	for i := uint64(0); i < count; i++ {
+		in := &TxIn{}
+		if in.PreviousOutPoint.Hash, err = r.readBytes(32); nil != err {
+			return nil, err
+		}
+		if in.PreviousOutPoint.Index, err = r.readUint32(); nil != err {
+			return nil, err
+		}
+		if in.SignatureScript, err = r.readVarBytes(); nil != err {
+			return nil, err
+		}
+		if in.Sequence, err = r.readUint32(); nil != err {
+			return nil, err
+		}
+		tx.TxIn = append(tx.TxIn, in)
+	}
+
+	// a transaction without input has no output either
+	if 0 != len(tx.TxIn) || 0 != flags {
+		if count, err = r.readCompactSize(); nil != err {
+			return nil, err
+		}
+		tx.TxOut = make([]*TxOut, 0, r.capacity(count, MIN_TXOUT_SIZE))
+		for i := uint64(0); i < count; i++ {
+			out := &TxOut{}
+			value, err := r.readUint64()
+			if nil != err {
+				return nil, err
+			}
+			out.Value = int64(value)
+			if out.PkScript, err = r.readVarBytes(); nil != err {
+				return nil, err
+			}
+			tx.TxOut = append(tx.TxOut, out)
+		}
+	}
+	bodyEnd := r.pos
+
+	if 0 != flags&1 {
+		flags ^= 1
+		for _, in := range tx.TxIn {
+			items, err := r.readCompactSize()
+			if nil != err {
+				return nil, err
+			}
+			in.Witness = make([][]byte, 0, r.capacity(items, MIN_WITNESS_SIZE))
+			for j := uint64(0); j < items; j++ {
+				item, err := r.readVarBytes()
+				if nil != err {
+					return nil, err
+				}
+				in.Witness = append(in.Witness, item)
+			}
+		}
+		if !tx.HasWitness() {
+			return nil, ErrSuperfluousWitness
+		}
+	}
+	if 0 != flags {
+		return nil, ErrUnknownOptionalData
+	}
+	witnessEnd := r.pos
+
+	if tx.LockTime, err = r.readUint32(); nil != err {
+		return nil, err
+	}
+
+	tx.raw = r.buf[start:r.pos]
+	tx.size = len(tx.raw)
+	tx.baseSize = tx.size - (witnessEnd - bodyEnd) - (bodyStart - start - 4)
+
+	// txid hashes the serialization without witness
+	first := sha256.New()
+	first.Write(tx.raw[:4])
+	first.Write(r.buf[bodyStart:bodyEnd])
+	var lockTime [4]byte
+	binary.LittleEndian.PutUint32(lockTime[:], tx.LockTime)
+	first.Write(lockTime[:])
+	second := sha256.Sum256(first.Sum(nil))
+	tx.txid = second[:]
+
+	if tx.HasWitness() {
+		tx.wtxid = crypto.DoubleSha256(tx.raw)
+	} else {
+		tx.wtxid = tx.txid
+	}
+
+	return tx, nil
+}
+
+// Serialize returns the serialization with witness data when the transaction has any
+func (tx *MsgTx) Serialize() []byte {
+	return tx.serialize(tx.HasWitness())
+}
+
+// SerializeNoWitness returns the serialization without witness data, as hashed by the txid
+func (tx *MsgTx) SerializeNoWitness() []byte {
+	return tx.serialize(false)
+}
+
+func (tx *MsgTx) serialize(witness bool) []byte {
+	var data [8]byte
+	buf := make([]byte, 0, 256)
+
+	binary.LittleEndian.PutUint32(data[:4], uint32(tx.Version))
+	buf = append(buf, data[:4]...)
+	if witness {
+		buf = append(buf, 0x00, 0x01)
+	}
+
+	buf = AppendCompactSize(buf, uint64(len(tx.TxIn)))
+	for _, in := range tx.TxIn {
+		buf = append(buf, in.PreviousOutPoint.Hash...)
+		binary.LittleEndian.PutUint32(data[:4], in.PreviousOutPoint.Index)
+		buf = append(buf, data[:4]...)
+		buf = AppendCompactSize(buf, uint64(len(in.SignatureScript)))
+		buf = append(buf, in.SignatureScript...)
+		binary.LittleEndian.PutUint32(data[:4], in.Sequence)
+		buf = append(buf, data[:4]...)
+	}
+
+	buf = AppendCompactSize(buf, uint64(len(tx.TxOut)))
+	for _, out := range tx.TxOut {
+		binary.LittleEndian.PutUint64(data[:], uint64(out.Value))
+		buf = append(buf, data[:]...)
+		buf = AppendCompactSize(buf, uint64(len(out.PkScript)))
+		buf = append(buf, out.PkScript...)
+	}
+
+	if witness {
+		for _, in := range tx.TxIn {
+			buf = AppendCompactSize(buf, uint64(len(in.Witness)))
+			for _, item := range in.Witness {
+				buf = AppendCompactSize(buf, uint64(len(item)))
+				buf = append(buf, item...)
+			}
+		}
+	}
+
+	binary.LittleEndian.PutUint32(data[:4], tx.LockTime)
+	return append(buf, data[:4]...)
+}
@@ -0,0 +1,226 @@
+// Package zmq is a minimal ZMTP 3.0 SUB socket, enough to subscribe to the bitcoind
+// zmqpub* publishers (NULL security mechanism over tcp).
+package zmq
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	flagMore    = 0x01
+	flagLong    = 0x02
+	flagCommand = 0x04
+
+	greetingLen  = 64
+	maxFrameSize = 64 * 1024 * 1024
+)
+
+var (
+	ErrBadGreeting  = errors.New("zmq: bad greeting")
+	ErrBadMechanism = errors.New("zmq: unsupported security mechanism")
+	ErrBadHandshake = errors.New("zmq: bad handshake")
+	ErrFrameTooLong = errors.New("zmq: frame too long")
+)
+
+type Subscriber struct {
+	address string
+	conn    net.Conn
+	reader  *bufio.Reader
+	mutex   sync.Mutex
+}
+
+// Subscribe connects to a zmq publisher, e.g. tcp://127.0.0.1:28332, and subscribes to topics
+func Subscribe(address string, topics []string, timeout time.Duration) (*Subscriber, error) {
+	endpoint := strings.TrimPrefix(address, "tcp://")
+	conn, err := net.DialTimeout("tcp", endpoint, timeout)
+	if nil != err {
+		return nil, err
+	}
+
+	sub := &Subscriber{address: address, conn: conn, reader: bufio.NewReader(conn)}
+
+	if timeout > 0 {
+		conn.SetDeadline(time.Now().Add(timeout))
+	}
+	if err := sub.handshake(); nil != err {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+
+	for _, topic := range topics {
+		if err := sub.writeFrame(0, append([]byte{1}, topic...)); nil != err {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	return sub, nil
+}
+
+func (s *Subscriber) handshake() error {
+	// greeting: signature, version 3.0, NULL mechanism, as-server 0
+	greeting := make([]byte, greetingLen)
+	greeting[0] = 0xff
+	greeting[9] = 0x7f
+	greeting[10] = 3
+	greeting[11] = 0
+	copy(greeting[12:32], "NULL")
+	if _, err := s.conn.Write(greeting); nil != err {
+		return err
+	}
+
+	peer := make([]byte, greetingLen)
+	if _, err := io.ReadFull(s.reader, peer); nil != err {
+		return err
+	}
+	if 0xff != peer[0] || 0 == peer[9]&0x01 || peer[10] < 3 {
+		return ErrBadGreeting
+	}
+	if "NULL" != string(bytes.TrimRight(peer[12:32], "\x00")) {
+		return ErrBadMechanism
+	}
+
+	// READY command with our socket type
+	ready := bytes.NewBuffer(nil)
+	ready.WriteByte(5)
+	ready.WriteString("READY")
+	writeProperty(ready, "Socket-Type", "SUB")
+	if err := s.writeFrame(flagCommand, ready.Bytes()); nil != err {
+		return err
+	}
+
+	flag, body, err := s.readFrame()
+	if nil != err {
+		return err
+	}
+	if 0 == flag&flagCommand || len(body) < 6 || 5 != body[0] || "READY" != string(body[1:6]) {
+		return ErrBadHandshake
+	}
+	socketType := readProperty(body[6:], "Socket-Type")
+	if "PUB" != socketType && "XPUB" != socketType {
+		return fmt.Errorf("zmq: peer socket type %s is not a publisher", socketType)
+	}
+
+	return nil
+}
+
+// Receive blocks until the next multipart message arrives
+func (s *Subscriber) Receive() ([][]byte, error) {
+	message := make([][]byte, 0, 3)
+	for {
+		flag, body, err := s.readFrame()
+		if nil != err {
+			return nil, err
+		}
+
+		// ignore commands after the handshake
+		if 0 != flag&flagCommand {
+			continue
+		}
+
+		message = append(message, body)
+		if 0 == flag&flagMore {
+			return message, nil
+		}
+	}
+}
+
+func (s *Subscriber) Address() string {
+	return s.address
+}
+
+func (s *Subscriber) Close() error {
+	return s.conn.Close()
+}
+
+func (s *Subscriber) readFrame() (byte, []byte, error) {
+	flag, err := s.reader.ReadByte()
+	if nil != err {
+		return 0, nil, err
+	}
+
+	var size uint64
+	if 0 != flag&flagLong {
+		var long [8]byte
+		if _, err := io.ReadFull(s.reader, long[:]); nil != err {
+			return 0, nil, err
+		}
+		size = binary.BigEndian.Uint64(long[:])
+	} else {
+		short, err := s.reader.ReadByte()
+		if nil != err {
+			return 0, nil, err
+		}
+		size = uint64(short)
+	}
+	if size > maxFrameSize {
+		return 0, nil, ErrFrameTooLong
+	}
+
+	body := make([]byte, size)
+	if _, err := io.ReadFull(s.reader, body); nil != err {
+		return 0, nil, err
+	}
+
+	return flag, body, nil
+}
+
+func (s *Subscriber) writeFrame(flag byte, body []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	frame := bytes.NewBuffer(nil)
+	if len(body) > 255 {
+		var long [8]byte
+		binary.BigEndian.PutUint64(long[:], uint64(len(body)))
+		frame.WriteByte(flag | flagLong)
+		frame.Write(long[:])
+	} else {
+		frame.WriteByte(flag)
+		frame.WriteByte(byte(len(body)))
+	}
+	frame.Write(body)
+
+	_, err := s.conn.Write(frame.Bytes())
+	return err
+}
+
+func writeProperty(buf *bytes.Buffer, name, value string) {
+	var size [4]byte
+	binary.BigEndian.PutUint32(size[:], uint32(len(value)))
+	buf.WriteByte(byte(len(name)))
+	buf.WriteString(name)
+	buf.Write(size[:])
+	buf.WriteString(value)
+}
+
+func readProperty(metadata []byte, name string) string {
+	for len(metadata) > 0 {
+		nameLen := int(metadata[0])
+		if len(metadata) < 1+nameLen+4 {
+			return ""
+		}
+		key := string(metadata[1 : 1+nameLen])
+		valueLen := int(binary.BigEndian.Uint32(metadata[1+nameLen:]))
+		metadata = metadata[1+nameLen+4:]
+		if len(metadata) < valueLen {
+			return ""
+		}
+		if strings.EqualFold(key, name) {
+			return string(metadata[:valueLen])
+		}
+		metadata = metadata[valueLen:]
+	}
+
+	return ""
+}
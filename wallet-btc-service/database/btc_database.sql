@@ -30,6 +30,7 @@ CREATE TABLE IF NOT EXISTS btc_database.t_transaction_info (
     `id`                BIGINT UNSIGNED     NOT NULL AUTO_INCREMENT COMMENT '自增主键',
     `blockhash`         CHAR(64)            NOT NULL DEFAULT ''     COMMENT '当前交易所在区块的哈希',
     `blockheight`       INT                 NOT NULL DEFAULT 0      COMMENT '区块高度',
+    `position`          INT                 NOT NULL DEFAULT 0      COMMENT '在区块中的位置',
     `time`              BIGINT              NOT NULL DEFAULT 0      COMMENT '区块打包时间',
     `isfork`            TINYINT             NOT NULL DEFAULT 0      COMMENT '是否为分叉链，0表示为主链，1表示为分叉链',
     `txid`              CHAR(64)            NOT NULL DEFAULT ''     COMMENT '交易哈希',
@@ -118,6 +119,8 @@ CREATE TABLE IF NOT EXISTS btc_database.t_transaction_input_output_address_info
     `id`                BIGINT UNSIGNED     NOT NULL AUTO_INCREMENT     COMMENT '自增主键',
     `blockhash`         CHAR(64)            NOT NULL DEFAULT ''         COMMENT '当前交易所在区块的哈希',
     `time`              BIGINT              NOT NULL DEFAULT 0          COMMENT '区块打包时间',
+    `height`            INT                 NOT NULL DEFAULT 0          COMMENT '区块高度',
+    `position`          INT                 NOT NULL DEFAULT 0          COMMENT '交易在区块中的位置',
     `txid`              CHAR(64)            NOT NULL DEFAULT ''         COMMENT '所在交易哈希',
     `address`           VARCHAR(64)         NOT NULL DEFAULT ''         COMMENT '转出账户地址',
     `isfrom`            TINYINT             NOT NULL DEFAULT 0          COMMENT '是否为input，0表示output，1表示为input',
@@ -126,18 +129,63 @@ CREATE TABLE IF NOT EXISTS btc_database.t_transaction_input_output_address_info
     KEY `idx_txid`(`txid`),
     KEY `idx_address`(`address`),
     key `idx_address_time`(`address`, `time`),
+    KEY `idx_address_height`(`address`, `height`, `position`),
     UNIQUE KEY `uniq_address_index_isfrom`(`txid`, `address`, `isfrom`)
     FOREIGN KEY `fr_transaction_hash`(txid) REFERENCES t_transaction_info(txid) ON DELETE CASCADE ON UPDATE CASCADE
 )ENGINE=INNODB DEFAULT CHARSET=utf8mb4;
 
 
-# create VIEW
-CREATE VIEW btc_database.v_transaction_info(blockhash, blockheight, time, transactionhash, iscoinbase, fromhash, fromindex, fromvalue, fromaddress, coinbase, toindex, tovalue, toaddress, totype, toasm, state) 
+# 同步游标
+CREATE TABLE IF NOT EXISTS btc_database.t_sync_cursor (
+    `id`                BIGINT UNSIGNED     NOT NULL AUTO_INCREMENT     COMMENT '自增主键',
+    `name`              VARCHAR(64)         NOT NULL DEFAULT ''         COMMENT '游标名称',
+    `height`            INT                 NOT NULL DEFAULT 0          COMMENT '已处理的区块高度',
+    `hash`              CHAR(64)            NOT NULL DEFAULT ''         COMMENT '已处理的区块哈希',
+    `updatetime`        BIGINT              NOT NULL DEFAULT 0          COMMENT '更新时间',
+
+    PRIMARY KEY (`id`),
+    UNIQUE KEY `uniq_name`(`name`)
+)ENGINE=INNODB DEFAULT CHARSET=utf8mb4;
+
+# 地址余额统计，由区块增量维护
+CREATE TABLE IF NOT EXISTS btc_database.t_address_balance_info (
+    `id`                BIGINT UNSIGNED     NOT NULL AUTO_INCREMENT     COMMENT '自增主键',
+    `address`           VARCHAR(64)         NOT NULL DEFAULT ''         COMMENT '地址',
+    `balance`           BIGINT              NOT NULL DEFAULT 0          COMMENT '已确认余额',
+    `received`          BIGINT              NOT NULL DEFAULT 0          COMMENT '已确认收入总额',
+    `sent`              BIGINT              NOT NULL DEFAULT 0          COMMENT '已确认支出总额',
+    `txcount`           BIGINT              NOT NULL DEFAULT 0          COMMENT '已确认交易个数',
+    `firstheight`       INT                 NOT NULL DEFAULT 0          COMMENT '首次出现的区块高度',
+    `lastheight`        INT                 NOT NULL DEFAULT 0          COMMENT '最后出现的区块高度',
+
+    PRIMARY KEY (`id`),
+    UNIQUE KEY `uniq_address`(`address`)
+)ENGINE=INNODB DEFAULT CHARSET=utf8mb4;
+
+# 每个区块对地址余额的增量，用于回滚
+CREATE TABLE IF NOT EXISTS btc_database.t_address_balance_block (
+    `id`                BIGINT UNSIGNED     NOT NULL AUTO_INCREMENT     COMMENT '自增主键',
+    `blockhash`         CHAR(64)            NOT NULL DEFAULT ''         COMMENT '区块哈希',
+    `height`            INT                 NOT NULL DEFAULT 0          COMMENT '区块高度',
+    `address`           VARCHAR(64)         NOT NULL DEFAULT ''         COMMENT '地址',
+    `received`          BIGINT              NOT NULL DEFAULT 0          COMMENT '该区块中的收入',
+    `sent`              BIGINT              NOT NULL DEFAULT 0          COMMENT '该区块中的支出',
+    `txcount`           BIGINT              NOT NULL DEFAULT 0          COMMENT '该区块中的交易个数',
+
+    PRIMARY KEY (`id`),
+    UNIQUE KEY `uniq_blockhash_address`(`blockhash`, `address`),
+    KEY `idx_address_height`(`address`, `height`)
+)ENGINE=INNODB DEFAULT CHARSET=utf8mb4;
+
+
+# create VIEW, forked transactions are excluded
+CREATE OR REPLACE VIEW btc_database.v_transaction_info(blockhash, blockheight, time, transactionhash, iscoinbase, fromhash, fromindex, fromvalue, fromaddress, coinbase, toindex, tovalue, toaddress, totype, toasm, state) 
 AS SELECT t1.blockhash, t1.blockheight, t1.time, t1.txid, t1.iscoinbase, 
 t2.txid, t2.vout, t2.value, t2.from, t2.coinbase, 
 t3.n, t3.value, t3.to, t3.type, t3.asm, t3.state FROM btc_database.t_transaction_info t1 
-INNER JOIN btc_database.t_input_info t2 ON t1.txid=t2.hash 
-INNER JOIN btc_database.t_output_info t3 ON t1.txid=t3.hash;
+INNER JOIN btc_database.t_input_info t2 ON t1.txid=t2.hash AND t1.blockhash=t2.blockhash 
+INNER JOIN btc_database.t_output_info t3 ON t1.txid=t3.hash AND t1.blockhash=t3.blockhash 
+WHERE t1.isfork=0;
 
 # omni transaction
 CREATE TABLE IF NOT EXISTS btc_database.t_omni_transaction_info (
@@ -276,6 +324,154 @@ CREATE TABLE IF NOT EXISTS btc_database.t_omni_cancel_info (
     FOREIGN KEY `fr_cancel_omni_transaction_hash`(hash) REFERENCES `t_omni_transaction_info`(txid) ON DELETE CASCADE ON UPDATE CASCADE
 )ENGINE=INNODB DEFAULT CHARSET=utf8mb4;
 
+# 区块费率统计，费率单位 sat/vB
+CREATE TABLE IF NOT EXISTS btc_database.t_block_fee_info (
+    `id`                BIGINT UNSIGNED     NOT NULL AUTO_INCREMENT     COMMENT '自增主键',
+    `blockhash`         CHAR(64)            NOT NULL DEFAULT ''         COMMENT '区块哈希',
+    `height`            INT                 NOT NULL DEFAULT 0          COMMENT '区块高度',
+    `txcount`           BIGINT              NOT NULL DEFAULT 0          COMMENT '非coinbase交易个数',
+    `vsize`             BIGINT              NOT NULL DEFAULT 0          COMMENT '非coinbase交易加权大小',
+    `minrate`           DOUBLE              NOT NULL DEFAULT 0          COMMENT '最低费率',
+    `p10`               DOUBLE              NOT NULL DEFAULT 0          COMMENT '10分位费率',
+    `p25`               DOUBLE              NOT NULL DEFAULT 0          COMMENT '25分位费率',
+    `p50`               DOUBLE              NOT NULL DEFAULT 0          COMMENT '50分位费率',
+    `p75`               DOUBLE              NOT NULL DEFAULT 0          COMMENT '75分位费率',
+    `p90`               DOUBLE              NOT NULL DEFAULT 0          COMMENT '90分位费率',
+    `maxrate`           DOUBLE              NOT NULL DEFAULT 0          COMMENT '最高费率',
+
+    PRIMARY KEY (`id`),
+    UNIQUE KEY `uniq_blockhash`(`blockhash`),
+    KEY `idx_height`(`height`)
+)ENGINE=INNODB DEFAULT CHARSET=utf8mb4;
+
+# 币价历史
+CREATE TABLE IF NOT EXISTS btc_database.t_price_history (
+    `id`                BIGINT UNSIGNED     NOT NULL AUTO_INCREMENT     COMMENT '自增主键',
+    `coin`              VARCHAR(64)         NOT NULL DEFAULT ''         COMMENT '币种id',
+    `price`             DOUBLE              NOT NULL DEFAULT 0          COMMENT '美元价格',
+    `provider`          VARCHAR(64)         NOT NULL DEFAULT ''         COMMENT '价格来源',
+    `time`              BIGINT              NOT NULL DEFAULT 0          COMMENT '获取时间',
+    `bucket`            BIGINT              NOT NULL DEFAULT 0          COMMENT '时间段，获取时间除以刷新间隔，同一币种每段一条',
+
+    PRIMARY KEY (`id`),
+    KEY `idx_coin_time`(`coin`, `time`),
+    UNIQUE KEY `uniq_coin_bucket`(`coin`, `bucket`)
+)ENGINE=INNODB DEFAULT CHARSET=utf8mb4;
+
+# webhook
+CREATE TABLE IF NOT EXISTS btc_database.t_webhook_info (
+    `id`                BIGINT UNSIGNED     NOT NULL AUTO_INCREMENT     COMMENT '自增主键',
+    `url`               VARCHAR(512)        NOT NULL DEFAULT ''         COMMENT '回调地址',
+    `secret`            CHAR(64)            NOT NULL DEFAULT ''         COMMENT '签名密钥',
+    `events`            VARCHAR(128)        NOT NULL DEFAULT ''         COMMENT '订阅的事件，逗号分隔，为空表示全部',
+    `apikeyid`          BIGINT UNSIGNED     NOT NULL DEFAULT 0          COMMENT '注册该webhook的api key',
+    `createtime`        BIGINT              NOT NULL DEFAULT 0          COMMENT '创建时间',
+
+    PRIMARY KEY (`id`),
+    KEY `idx_apikeyid`(`apikeyid`)
+)ENGINE=INNODB DEFAULT CHARSET=utf8mb4;
+
+# webhook监听的地址
+CREATE TABLE IF NOT EXISTS btc_database.t_webhook_address_info (
+    `id`                BIGINT UNSIGNED     NOT NULL AUTO_INCREMENT     COMMENT '自增主键',
+    `webhookid`         BIGINT              NOT NULL DEFAULT 0          COMMENT '所属webhook',
+    `address`           VARCHAR(64)         NOT NULL DEFAULT ''         COMMENT '监听的地址',
+    `xpubid`            BIGINT              NOT NULL DEFAULT 0          COMMENT '派生该地址的扩展公钥，0表示直接添加',
+    `chain`             INT                 NOT NULL DEFAULT 0          COMMENT '扩展公钥的链',
+    `idx`               INT                 NOT NULL DEFAULT 0          COMMENT '扩展公钥的地址索引',
+
+    PRIMARY KEY (`id`),
+    UNIQUE KEY `uniq_webhookid_address`(`webhookid`, `address`),
+    KEY `idx_address`(`address`)
+)ENGINE=INNODB DEFAULT CHARSET=utf8mb4;
+
+# webhook监听的扩展公钥
+CREATE TABLE IF NOT EXISTS btc_database.t_webhook_xpub_info (
+    `id`                BIGINT UNSIGNED     NOT NULL AUTO_INCREMENT     COMMENT '自增主键',
+    `webhookid`         BIGINT              NOT NULL DEFAULT 0          COMMENT '所属webhook',
+    `xpub`              VARCHAR(128)        NOT NULL DEFAULT ''         COMMENT '扩展公钥',
+    `type`              VARCHAR(32)         NOT NULL DEFAULT ''         COMMENT '派生地址类型',
+    `receivecount`      INT                 NOT NULL DEFAULT 0          COMMENT '已派生的收款地址个数',
+    `changecount`       INT                 NOT NULL DEFAULT 0          COMMENT '已派生的找零地址个数',
+
+    PRIMARY KEY (`id`),
+    UNIQUE KEY `uniq_webhookid_xpub`(`webhookid`, `xpub`)
+)ENGINE=INNODB DEFAULT CHARSET=utf8mb4;
+
+# webhook推送
+CREATE TABLE IF NOT EXISTS btc_database.t_webhook_delivery_info (
+    `id`                BIGINT UNSIGNED     NOT NULL AUTO_INCREMENT     COMMENT '自增主键',
+    `webhookid`         BIGINT              NOT NULL DEFAULT 0          COMMENT '所属webhook',
+    `eventid`           VARCHAR(200)        NOT NULL DEFAULT ''         COMMENT '事件id',
+    `event`             VARCHAR(32)         NOT NULL DEFAULT ''         COMMENT '事件类型',
+    `payload`           TEXT                                            COMMENT '推送内容',
+    `state`             TINYINT             NOT NULL DEFAULT 0          COMMENT '推送状态，0待推送，1已推送，2失败',
+    `attempts`          INT                 NOT NULL DEFAULT 0          COMMENT '已尝试次数',
+    `nextattempt`       BIGINT              NOT NULL DEFAULT 0          COMMENT '下次推送时间',
+    `lasterror`         VARCHAR(512)        NOT NULL DEFAULT ''         COMMENT '最后一次失败原因',
+    `createtime`        BIGINT              NOT NULL DEFAULT 0          COMMENT '创建时间',
+    `updatetime`        BIGINT              NOT NULL DEFAULT 0          COMMENT '更新时间',
+
+    PRIMARY KEY (`id`),
+    UNIQUE KEY `uniq_webhookid_eventid`(`webhookid`, `eventid`),
+    KEY `idx_state_nextattempt`(`state`, `nextattempt`)
+)ENGINE=INNODB DEFAULT CHARSET=utf8mb4;
+
+# 确认数跟踪
+CREATE TABLE IF NOT EXISTS btc_database.t_confirmation_info (
+    `id`                BIGINT UNSIGNED     NOT NULL AUTO_INCREMENT     COMMENT '自增主键',
+    `txid`              CHAR(64)            NOT NULL DEFAULT ''         COMMENT '交易哈希',
+    `address`           VARCHAR(64)         NOT NULL DEFAULT ''         COMMENT '收款地址',
+    `token`             VARCHAR(16)         NOT NULL DEFAULT ''         COMMENT '币种',
+    `amount`            VARCHAR(64)         NOT NULL DEFAULT ''         COMMENT '收款金额',
+    `propertyid`        BIGINT UNSIGNED     NOT NULL DEFAULT 0          COMMENT 'omni代币id',
+    `blockhash`         CHAR(64)            NOT NULL DEFAULT ''         COMMENT '所在区块哈希',
+    `height`            INT                 NOT NULL DEFAULT 0          COMMENT '所在区块高度',
+    `notified`          INT                 NOT NULL DEFAULT 0          COMMENT '已通知的确认数',
+    `state`             TINYINT             NOT NULL DEFAULT 0          COMMENT '跟踪状态，0跟踪中，1已完成，2已回滚',
+    `createtime`        BIGINT              NOT NULL DEFAULT 0          COMMENT '创建时间',
+    `updatetime`        BIGINT              NOT NULL DEFAULT 0          COMMENT '更新时间',
+
+    PRIMARY KEY (`id`),
+    UNIQUE KEY `uniq_txid_address_token_blockhash`(`txid`, `address`, `token`, `blockhash`),
+    KEY `idx_state`(`state`),
+    KEY `idx_blockhash`(`blockhash`)
+)ENGINE=INNODB DEFAULT CHARSET=utf8mb4;
+
+# api key
+CREATE TABLE IF NOT EXISTS btc_database.t_api_key_info (
+    `id`                BIGINT UNSIGNED     NOT NULL AUTO_INCREMENT     COMMENT '自增主键',
+    `keyhash`           CHAR(64)            NOT NULL DEFAULT ''         COMMENT 'api key的sha256哈希',
+    `prefix`            VARCHAR(16)         NOT NULL DEFAULT ''         COMMENT 'api key前缀，用于识别',
+    `name`              VARCHAR(128)        NOT NULL DEFAULT ''         COMMENT '名称',
+    `ratelimit`         INT                 NOT NULL DEFAULT 0          COMMENT '每分钟请求数，0表示使用默认配置',
+    `maxaddresses`      INT                 NOT NULL DEFAULT 0          COMMENT '每个请求的地址数，0表示使用默认配置',
+    `origins`           VARCHAR(1024)       NOT NULL DEFAULT ''         COMMENT '允许的跨域来源，逗号分隔，为空表示使用默认配置',
+    `state`             TINYINT             NOT NULL DEFAULT 0          COMMENT '状态，0可用，1已停用',
+    `createtime`        BIGINT              NOT NULL DEFAULT 0          COMMENT '创建时间',
+    `updatetime`        BIGINT              NOT NULL DEFAULT 0          COMMENT '更新时间',
+
+    PRIMARY KEY (`id`),
+    UNIQUE KEY `uniq_keyhash`(`keyhash`)
+)ENGINE=INNODB DEFAULT CHARSET=utf8mb4;
+
+# 修复任务队列
+CREATE TABLE IF NOT EXISTS btc_database.t_repair_job_info (
+    `id`                BIGINT UNSIGNED     NOT NULL AUTO_INCREMENT     COMMENT '自增主键',
+    `jobtype`           VARCHAR(16)         NOT NULL DEFAULT ''         COMMENT '任务类型，block、transaction、omniblock、omnitransaction',
+    `jobkey`            VARCHAR(128)        NOT NULL DEFAULT ''         COMMENT '任务键，区块哈希、高度_交易哈希、区块高度或交易哈希',
+    `state`             TINYINT             NOT NULL DEFAULT 0          COMMENT '任务状态，0待修复，1失败',
+    `attempts`          INT                 NOT NULL DEFAULT 0          COMMENT '已尝试次数',
+    `nextrun`           BIGINT              NOT NULL DEFAULT 0          COMMENT '下次运行时间',
+    `lasterror`         VARCHAR(512)        NOT NULL DEFAULT ''         COMMENT '最后一次失败原因',
+    `createtime`        BIGINT              NOT NULL DEFAULT 0          COMMENT '创建时间',
+    `updatetime`        BIGINT              NOT NULL DEFAULT 0          COMMENT '更新时间',
+
+    PRIMARY KEY (`id`),
+    UNIQUE KEY `uniq_jobtype_jobkey`(`jobtype`, `jobkey`),
+    KEY `idx_jobtype_state_nextrun`(`jobtype`, `state`, `nextrun`)
+)ENGINE=INNODB DEFAULT CHARSET=utf8mb4;
+
 # create user btc
 DROP USER 'btc'@'%';
 CREATE USER 'btc'@'%' IDENTIFIED BY '#Bitcoin_2019';
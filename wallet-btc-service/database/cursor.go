@@ -0,0 +1,27 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/BlockABC/wallet-btc-service/database/tables"
+)
+
+func GetSyncCursor(name string) (error, bool, *tables.TableSyncCursor) {
+	var result []tables.TableSyncCursor
+	if err := Db.Where("name = ?", name).Find(&result).Error; nil != err {
+		return err, false, nil
+	}
+
+	if 0 == len(result) {
+		return nil, false, nil
+	}
+
+	return nil, true, &result[0]
+}
+
+func SaveSyncCursor(name string, height int32, hash string) error {
+	saveSql := fmt.Sprintf("insert into t_sync_cursor(name, height, hash, updatetime) values ('%s', %d, '%s', %d) on duplicate key update height=values(height), hash=values(hash), updatetime=values(updatetime);",
+		name, height, hash, time.Now().Unix())
+	return Db.Exec(saveSql).Error
+}
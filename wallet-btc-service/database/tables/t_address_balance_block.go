@@ -0,0 +1,15 @@
+package tables
+
+type TableAddressBalanceBlock struct {
+	Id        int64  `json:"id"        gorm:"column:id;primary_key;AUTO_INCREMENT"` //自增主键
+	Blockhash string `json:"blockhash" gorm:"column:blockhash;type:char(64)"`       //区块哈希
+	Height    int32  `json:"height"    gorm:"column:height"`                        //区块高度
+	Address   string `json:"address"   gorm:"column:address;type:varchar(64)"`      //地址
+	Received  int64  `json:"received"  gorm:"column:received"`                      //该区块中的收入
+	Sent      int64  `json:"sent"      gorm:"column:sent"`                          //该区块中的支出
+	Txcount   int64  `json:"txcount"   gorm:"column:txcount"`                       //该区块中的交易个数
+}
+
+func (t *TableAddressBalanceBlock) TableName() string {
+	return "t_address_balance_block"
+}
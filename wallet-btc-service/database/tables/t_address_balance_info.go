@@ -0,0 +1,16 @@
+package tables
+
+type TableAddressBalanceInfo struct {
+	Id          int64  `json:"id"          gorm:"column:id;primary_key;AUTO_INCREMENT"`   //自增主键
+	Address     string `json:"address"     gorm:"column:address;type:varchar(64);unique"` //地址
+	Balance     int64  `json:"balance"     gorm:"column:balance"`                         //已确认余额
+	Received    int64  `json:"received"    gorm:"column:received"`                        //已确认收入总额
+	Sent        int64  `json:"sent"        gorm:"column:sent"`                            //已确认支出总额
+	Txcount     int64  `json:"txcount"     gorm:"column:txcount"`                         //已确认交易个数
+	Firstheight int32  `json:"firstheight" gorm:"column:firstheight"`                     //首次出现的区块高度
+	Lastheight  int32  `json:"lastheight"  gorm:"column:lastheight"`                      //最后出现的区块高度
+}
+
+func (t *TableAddressBalanceInfo) TableName() string {
+	return "t_address_balance_info"
+}
@@ -0,0 +1,18 @@
+package tables
+
+type TableApiKeyInfo struct {
+	Id           int64  `json:"id"           gorm:"column:id;primary_key;AUTO_INCREMENT"` //自增主键
+	Keyhash      string `json:"-"            gorm:"column:keyhash;type:char(64)"`         //api key的sha256哈希
+	Prefix       string `json:"prefix"       gorm:"column:prefix;type:varchar(16)"`       //api key前缀，用于识别
+	Name         string `json:"name"         gorm:"column:name;type:varchar(128)"`        //名称
+	Ratelimit    int    `json:"ratelimit"    gorm:"column:ratelimit"`                     //每分钟请求数，0表示使用默认配置
+	Maxaddresses int    `json:"maxaddresses" gorm:"column:maxaddresses"`                  //每个请求的地址数，0表示使用默认配置
+	Origins      string `json:"origins"      gorm:"column:origins;type:varchar(1024)"`    //允许的跨域来源，逗号分隔，为空表示使用默认配置
+	State        int8   `json:"state"        gorm:"column:state"`                         //状态，0可用，1已停用
+	Createtime   int64  `json:"createtime"   gorm:"column:createtime"`                    //创建时间
+	Updatetime   int64  `json:"updatetime"   gorm:"column:updatetime"`                    //更新时间
+}
+
+func (t *TableApiKeyInfo) TableName() string {
+	return "t_api_key_info"
+}
@@ -0,0 +1,20 @@
+package tables
+
+type TableBlockFeeInfo struct {
+	Id        int64   `json:"id"        gorm:"column:id;primary_key;AUTO_INCREMENT"` //自增主键
+	Blockhash string  `json:"blockhash" gorm:"column:blockhash;type:char(64)"`       //区块哈希
+	Height    int32   `json:"height"    gorm:"column:height"`                        //区块高度
+	Txcount   int64   `json:"txcount"   gorm:"column:txcount"`                       //非coinbase交易个数
+	Vsize     int64   `json:"vsize"     gorm:"column:vsize"`                         //非coinbase交易加权大小
+	Minrate   float64 `json:"minrate"   gorm:"column:minrate"`                       //最低费率 sat/vB
+	P10       float64 `json:"p10"       gorm:"column:p10"`                           //按大小加权的10分位费率
+	P25       float64 `json:"p25"       gorm:"column:p25"`                           //按大小加权的25分位费率
+	P50       float64 `json:"p50"       gorm:"column:p50"`                           //按大小加权的50分位费率
+	P75       float64 `json:"p75"       gorm:"column:p75"`                           //按大小加权的75分位费率
+	P90       float64 `json:"p90"       gorm:"column:p90"`                           //按大小加权的90分位费率
+	Maxrate   float64 `json:"maxrate"   gorm:"column:maxrate"`                       //最高费率 sat/vB
+}
+
+func (t *TableBlockFeeInfo) TableName() string {
+	return "t_block_fee_info"
+}
@@ -0,0 +1,20 @@
+package tables
+
+type TableConfirmationInfo struct {
+	Id         int64  `json:"id"         gorm:"column:id;primary_key;AUTO_INCREMENT"` //自增主键
+	Txid       string `json:"txid"       gorm:"column:txid;type:char(64)"`            //交易哈希
+	Address    string `json:"address"    gorm:"column:address;type:varchar(64)"`      //收款地址
+	Token      string `json:"token"      gorm:"column:token;type:varchar(16)"`        //币种，BTC或omni代币
+	Amount     string `json:"amount"     gorm:"column:amount;type:varchar(64)"`       //收款金额，BTC单位为聪
+	Propertyid uint64 `json:"propertyid" gorm:"column:propertyid"`                    //omni代币id
+	Blockhash  string `json:"blockhash"  gorm:"column:blockhash;type:char(64)"`       //所在区块哈希
+	Height     int32  `json:"height"     gorm:"column:height"`                        //所在区块高度
+	Notified   int32  `json:"notified"   gorm:"column:notified"`                      //已通知的确认数
+	State      int8   `json:"state"      gorm:"column:state"`                         //跟踪状态，0跟踪中，1已完成，2已回滚
+	Createtime int64  `json:"createtime" gorm:"column:createtime"`                    //创建时间
+	Updatetime int64  `json:"updatetime" gorm:"column:updatetime"`                    //更新时间
+}
+
+func (t *TableConfirmationInfo) TableName() string {
+	return "t_confirmation_info"
+}
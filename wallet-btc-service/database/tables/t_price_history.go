@@ -0,0 +1,14 @@
+package tables
+
+type TablePriceHistory struct {
+	Id       int64   `json:"id"       gorm:"column:id;primary_key;AUTO_INCREMENT"` //自增主键
+	Coin     string  `json:"coin"     gorm:"column:coin;type:varchar(64)"`         //币种id
+	Price    float64 `json:"price"    gorm:"column:price"`                         //美元价格
+	Provider string  `json:"provider" gorm:"column:provider;type:varchar(64)"`     //价格来源
+	Time     int64   `json:"time"     gorm:"column:time"`                          //获取时间
+	Bucket   int64   `json:"-"        gorm:"column:bucket"`                        //时间段，获取时间除以刷新间隔，同一币种每段一条
+}
+
+func (t *TablePriceHistory) TableName() string {
+	return "t_price_history"
+}
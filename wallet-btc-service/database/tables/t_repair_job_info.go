@@ -0,0 +1,17 @@
+package tables
+
+type TableRepairJobInfo struct {
+	Id         int64  `json:"id"         gorm:"column:id;primary_key;AUTO_INCREMENT"` //自增主键
+	Jobtype    string `json:"jobtype"    gorm:"column:jobtype;type:varchar(16)"`      //任务类型
+	Jobkey     string `json:"jobkey"     gorm:"column:jobkey;type:varchar(128)"`      //任务键，同一类型唯一
+	State      int8   `json:"state"      gorm:"column:state"`                         //任务状态，0待修复，1失败
+	Attempts   int32  `json:"attempts"   gorm:"column:attempts"`                      //已尝试次数
+	Nextrun    int64  `json:"nextrun"    gorm:"column:nextrun"`                       //下次运行时间
+	Lasterror  string `json:"lasterror"  gorm:"column:lasterror;type:varchar(512)"`   //最后一次失败原因
+	Createtime int64  `json:"createtime" gorm:"column:createtime"`                    //创建时间
+	Updatetime int64  `json:"updatetime" gorm:"column:updatetime"`                    //更新时间
+}
+
+func (t *TableRepairJobInfo) TableName() string {
+	return "t_repair_job_info"
+}
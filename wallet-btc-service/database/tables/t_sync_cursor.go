@@ -0,0 +1,13 @@
+package tables
+
+type TableSyncCursor struct {
+	Id         int64  `json:"id"         gorm:"column:id;primary_key;AUTO_INCREMENT"` //自增主键
+	Name       string `json:"name"       gorm:"column:name;type:varchar(64);unique"`  //游标名称
+	Height     int32  `json:"height"     gorm:"column:height"`                        //已处理的区块高度
+	Hash       string `json:"hash"       gorm:"column:hash;type:char(64)"`            //已处理的区块哈希
+	Updatetime int64  `json:"updatetime" gorm:"column:updatetime"`                    //更新时间
+}
+
+func (t *TableSyncCursor) TableName() string {
+	return "t_sync_cursor"
+}
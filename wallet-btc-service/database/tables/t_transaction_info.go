@@ -4,6 +4,7 @@ type TableTransactionInfo struct {
 	Id          int64  `json:"id"                	gorm:"column:id;primary_key;AUTO_INCREMENT"` //自增主键
 	Blockhash   string `json:"blockhash"         	gorm:"column:blockhash;type:char(64)"`       //当前交易所在区块的哈希
 	Blockheight int32  `json:"blockheight"           gorm:"column:blockheight"`                //区块高度
+	Position    int32  `json:"position"              gorm:"column:position"`                   //在区块中的位置
 	Time        int64  `json:"time"      			gorm:"column:time"`                                //区块打包时间
 	Isfork      int8   `json:"isfork"        		gorm:"column:isfork"`                           //是否为分叉链，0表示为主链，1表示为分叉链
 	Txid        string `json:"txid"              	gorm:"column:txid;type:char(64)"`            //交易哈希
@@ -4,6 +4,8 @@ type TableTransactionInputOutputAddressInfo struct {
 	Id        int64  `json:"id"                	gorm:"column:id;primary_key;AUTO_INCREMENT"` //自增主键
 	Blockhash string `json:"blockhash"         	gorm:"column:blockhash;type:char(64)"`       //当前交易所在区块的哈希
 	Time      int64  `json:"time"      			gorm:"column:time"`                                //区块打包时间
+	Height    int32  `json:"height"      		gorm:"column:height"`                             //区块高度
+	Position  int32  `json:"position"      		gorm:"column:position"`                         //交易在区块中的位置
 	Txid      string `json:"txid"         		gorm:"column:txid;type:char(64)"`                //所在交易哈希
 	Index     int64  `json:"index"          	gorm:"column:index"`                            //索引号
 	Address   string `json:"address"         	gorm:"column:address;type:varchar(64)"`        //地址
@@ -0,0 +1,14 @@
+package tables
+
+type TableWebhookAddressInfo struct {
+	Id        int64  `json:"id"        gorm:"column:id;primary_key;AUTO_INCREMENT"` //自增主键
+	Webhookid int64  `json:"webhookid" gorm:"column:webhookid"`                     //所属webhook
+	Address   string `json:"address"   gorm:"column:address;type:varchar(64)"`      //监听的地址
+	Xpubid    int64  `json:"xpubid"    gorm:"column:xpubid"`                        //派生该地址的扩展公钥，0表示直接添加
+	Chain     int32  `json:"chain"     gorm:"column:chain"`                         //扩展公钥的链，0为收款，1为找零
+	Idx       int32  `json:"idx"       gorm:"column:idx"`                           //扩展公钥的地址索引
+}
+
+func (t *TableWebhookAddressInfo) TableName() string {
+	return "t_webhook_address_info"
+}
@@ -0,0 +1,19 @@
+package tables
+
+type TableWebhookDeliveryInfo struct {
+	Id          int64  `json:"id"          gorm:"column:id;primary_key;AUTO_INCREMENT"` //自增主键
+	Webhookid   int64  `json:"webhookid"   gorm:"column:webhookid"`                     //所属webhook
+	Eventid     string `json:"eventid"     gorm:"column:eventid;type:varchar(200)"`     //事件id，同一webhook唯一
+	Event       string `json:"event"       gorm:"column:event;type:varchar(32)"`        //事件类型
+	Payload     string `json:"payload"     gorm:"column:payload;type:text"`             //推送内容
+	State       int8   `json:"state"       gorm:"column:state"`                         //推送状态，0待推送，1已推送，2失败
+	Attempts    int32  `json:"attempts"    gorm:"column:attempts"`                      //已尝试次数
+	Nextattempt int64  `json:"nextattempt" gorm:"column:nextattempt"`                   //下次推送时间
+	Lasterror   string `json:"lasterror"   gorm:"column:lasterror;type:varchar(512)"`   //最后一次失败原因
+	Createtime  int64  `json:"createtime"  gorm:"column:createtime"`                    //创建时间
+	Updatetime  int64  `json:"updatetime"  gorm:"column:updatetime"`                    //更新时间
+}
+
+func (t *TableWebhookDeliveryInfo) TableName() string {
+	return "t_webhook_delivery_info"
+}
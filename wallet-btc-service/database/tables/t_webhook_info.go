@@ -0,0 +1,14 @@
+package tables
+
+type TableWebhookInfo struct {
+	Id         int64  `json:"id"         gorm:"column:id;primary_key;AUTO_INCREMENT"` //自增主键
+	Url        string `json:"url"        gorm:"column:url;type:varchar(512)"`         //回调地址
+	Secret     string `json:"-"          gorm:"column:secret;type:char(64)"`          //签名密钥
+	Events     string `json:"events"     gorm:"column:events;type:varchar(128)"`      //订阅的事件，逗号分隔，为空表示全部
+	Apikeyid   int64  `json:"apikeyid"   gorm:"column:apikeyid"`                      //注册该webhook的api key
+	Createtime int64  `json:"createtime" gorm:"column:createtime"`                    //创建时间
+}
+
+func (t *TableWebhookInfo) TableName() string {
+	return "t_webhook_info"
+}
@@ -0,0 +1,14 @@
+package tables
+
+type TableWebhookXpubInfo struct {
+	Id           int64  `json:"id"           gorm:"column:id;primary_key;AUTO_INCREMENT"` //自增主键
+	Webhookid    int64  `json:"webhookid"    gorm:"column:webhookid"`                     //所属webhook
+	Xpub         string `json:"xpub"         gorm:"column:xpub;type:varchar(128)"`        //扩展公钥
+	Type         string `json:"type"         gorm:"column:type;type:varchar(32)"`         //派生地址类型
+	Receivecount int32  `json:"receivecount" gorm:"column:receivecount"`                  //已派生的收款地址个数
+	Changecount  int32  `json:"changecount"  gorm:"column:changecount"`                   //已派生的找零地址个数
+}
+
+func (t *TableWebhookXpubInfo) TableName() string {
+	return "t_webhook_xpub_info"
+}
@@ -0,0 +1,7 @@
+# upgrade database created before the price history time bucket, run once on such a database, btc_database.sql
+# creates this column for a new database. the bucket of the saved prices uses the default refresh interval of
+# 60 seconds, change it to price.refreshinterval if set, prices saved twice in a bucket are removed
+ALTER TABLE btc_database.t_price_history ADD COLUMN `bucket` BIGINT NOT NULL DEFAULT 0 COMMENT '时间段，获取时间除以刷新间隔，同一币种每段一条' AFTER `time`;
+UPDATE btc_database.t_price_history SET bucket = time DIV 60;
+DELETE t1 FROM btc_database.t_price_history t1, btc_database.t_price_history t2 WHERE t1.coin=t2.coin AND t1.bucket=t2.bucket AND t1.id > t2.id;
+ALTER TABLE btc_database.t_price_history ADD UNIQUE KEY `uniq_coin_bucket`(`coin`, `bucket`);
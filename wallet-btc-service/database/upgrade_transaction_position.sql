@@ -0,0 +1,9 @@
+# upgrade database created before transaction position, run once on such a database, btc_database.sql
+# creates these columns for a new database. The position of a legacy transaction is only known from its block,
+# legacy rows keep position 0 and are ordered by txid inside a block until `wallet-btc-admin reindex <begin> <end>`
+# saves the legacy heights again
+ALTER TABLE btc_database.t_transaction_info ADD COLUMN `position` INT NOT NULL DEFAULT 0 COMMENT '在区块中的位置' AFTER `blockheight`;
+ALTER TABLE btc_database.t_transaction_input_output_address_info ADD COLUMN `height` INT NOT NULL DEFAULT 0 COMMENT '区块高度' AFTER `time`,
+    ADD COLUMN `position` INT NOT NULL DEFAULT 0 COMMENT '交易在区块中的位置' AFTER `height`,
+    ADD KEY `idx_address_height`(`address`, `height`, `position`);
+UPDATE btc_database.t_transaction_input_output_address_info t1, btc_database.t_transaction_info t2 SET t1.height=t2.blockheight WHERE t1.txid=t2.txid AND t2.isfork=0;
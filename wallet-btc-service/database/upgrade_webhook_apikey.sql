@@ -0,0 +1,5 @@
+# upgrade database created before webhooks belong to an api key, run once on such a database, btc_database.sql
+# creates this column for a new database. webhooks registered before have no api key and are listed by none,
+# set apikeyid of each to the key of its owner
+ALTER TABLE btc_database.t_webhook_info ADD COLUMN `apikeyid` BIGINT UNSIGNED NOT NULL DEFAULT 0 COMMENT '注册该webhook的api key' AFTER `events`,
+    ADD KEY `idx_apikeyid`(`apikeyid`);
@@ -0,0 +1,227 @@
+package fee
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BlockABC/wallet-btc-service/common/config"
+	"github.com/BlockABC/wallet-btc-service/common/log"
+	"github.com/BlockABC/wallet-btc-service/database/tables"
+	"github.com/BlockABC/wallet-btc-service/jsonrpc"
+	"github.com/BlockABC/wallet-btc-service/notify"
+)
+
+const (
+	MAXBLOCKVSIZE   = 1000000 // virtual size of a projected block
+	MINFEERATE      = 1.0     // sat/vB, default min relay fee
+	MINRECENTBLOCKS = 3       // recent blocks looked at for the shortest targets
+
+	SOURCEMEMPOOL          = "mempool"
+	SOURCEBLOCKS           = "blocks"
+	SOURCEESTIMATESMARTFEE = "estimatesmartfee"
+)
+
+var ErrNoEstimate = errors.New("no fee estimate from the node")
+
+// fee rate in sat/vB to be confirmed within Blocks blocks
+type Estimate struct {
+	Blocks  int     `json:"blocks"`
+	Feerate float64 `json:"feerate"`
+	Source  string  `json:"source"`
+}
+
+var (
+	estimateMutex sync.Mutex
+	estimateTime  int64
+	allEstimate   = map[int]Estimate{}
+)
+
+// ParseTargets parses comma separated confirmation targets
+func ParseTargets(str string) (error, []int) {
+	result := make([]int, 0)
+	for _, oneTarget := range strings.Split(str, ",") {
+		oneTarget = strings.TrimSpace(oneTarget)
+		if "" == oneTarget {
+			continue
+		}
+		blocks, err := strconv.Atoi(oneTarget)
+		if nil != err {
+			return err, nil
+		}
+		if blocks <= 0 {
+			return errors.New("confirmation target must be positive: " + oneTarget), nil
+		}
+		result = append(result, blocks)
+	}
+	if 0 == len(result) {
+		return errors.New("no confirmation target"), nil
+	}
+	return nil, result
+}
+
+// ProjectFeeRate fills blocks projected blocks with the highest paying transactions and returns the rate of the
+// first transaction left out, 0 when all of them fit. allRate must be sorted from low to high.
+func ProjectFeeRate(allRate []notify.FeeRate, blocks int) float64 {
+	limit := int64(blocks) * MAXBLOCKVSIZE
+	var sum int64
+	for i := len(allRate) - 1; i >= 0; i-- {
+		sum += allRate[i].Vsize
+		if sum > limit {
+			return allRate[i].Rate
+		}
+	}
+	return 0
+}
+
+// RecentFeeRate returns the median 25th percentile rate of the last blocks, at least MINRECENTBLOCKS of them,
+// allBlockFee is highest first. Empty blocks are left out.
+func RecentFeeRate(allBlockFee []tables.TableBlockFeeInfo, blocks int) float64 {
+	if blocks < MINRECENTBLOCKS {
+		blocks = MINRECENTBLOCKS
+	}
+	if blocks > len(allBlockFee) {
+		blocks = len(allBlockFee)
+	}
+
+	allRate := make([]float64, 0, blocks)
+	for _, oneBlockFee := range allBlockFee[:blocks] {
+		if 0 != oneBlockFee.Txcount {
+			allRate = append(allRate, oneBlockFee.P25)
+		}
+	}
+	if 0 == len(allRate) {
+		return 0
+	}
+
+	sort.Float64s(allRate)
+	return allRate[len(allRate)/2]
+}
+
+// estimateSmartFee asks the node for the fee rate in sat/vB
+func estimateSmartFee(blocks int) (error, float64) {
+	result, err := jsonrpc.Call(1, "estimatesmartfee", []interface{}{blocks})
+	if nil != err {
+		log.Log.Error(err, " call estimatesmartfee fail, blocks: ", blocks)
+		return err, 0
+	}
+
+	type blockFee struct {
+		Feerate float64
+		Blocks  int
+	}
+	var oneBlockFee blockFee
+	if err := json.Unmarshal(result, &oneBlockFee); nil != err {
+		log.Log.Error(err, " Unmarshal estimatesmartfee result fail")
+		return err, 0
+	}
+	if oneBlockFee.Feerate <= 0 {
+		return ErrNoEstimate, 0
+	}
+
+	// BTC/kB to sat/vB
+	return nil, oneBlockFee.Feerate * float64(notify.COIN) / 1000
+}
+
+// estimate computes the fee rate of the targets from the unconfirmed transactions and the recent blocks,
+// the node is asked only when both are unknown
+func estimate(targets []int) (error, map[int]Estimate) {
+	err, allRate := notify.GetMempoolFeeRate()
+	if nil != err {
+		return err, nil
+	}
+	notify.SortFeeRate(allRate)
+
+	err, allBlockFee := notify.GetRecentBlockFee(config.Cfg.FeeOpt.RecentBlocks)
+	if nil != err {
+		return err, nil
+	}
+
+	sort.Ints(targets)
+	result := make(map[int]Estimate)
+	var lastRate float64
+	for index, blocks := range targets {
+		oneEstimate := Estimate{Blocks: blocks}
+		projected := ProjectFeeRate(allRate, blocks)
+		recent := RecentFeeRate(allBlockFee, blocks)
+		if 0 == len(allRate) && 0 == recent {
+			err, rate := estimateSmartFee(blocks)
+			if nil != err {
+				return err, nil
+			}
+			oneEstimate.Feerate = rate
+			oneEstimate.Source = SOURCEESTIMATESMARTFEE
+		} else if projected >= recent {
+			oneEstimate.Feerate = projected
+			oneEstimate.Source = SOURCEMEMPOOL
+		} else {
+			oneEstimate.Feerate = recent
+			oneEstimate.Source = SOURCEBLOCKS
+		}
+
+		oneEstimate.Feerate = math.Max(math.Ceil(oneEstimate.Feerate*100)/100, MINFEERATE)
+
+		// a longer target never pays more
+		if 0 != index && oneEstimate.Feerate > lastRate {
+			oneEstimate.Feerate = lastRate
+		}
+		lastRate = oneEstimate.Feerate
+		result[blocks] = oneEstimate
+	}
+
+	return nil, result
+}
+
+// EstimateFee returns the fee rate estimate of the targets in the given order, estimates are cached for the
+// configured seconds
+func EstimateFee(targets []int) (error, []Estimate) {
+	estimateMutex.Lock()
+	defer estimateMutex.Unlock()
+
+	now := time.Now().Unix()
+	if now-estimateTime >= int64(config.Cfg.FeeOpt.CacheTime) {
+		allEstimate = map[int]Estimate{}
+	}
+
+	missing := false
+	for _, blocks := range targets {
+		if _, ok := allEstimate[blocks]; !ok {
+			missing = true
+			break
+		}
+	}
+
+	if missing {
+		// estimate the cached targets again so they stay consistent
+		allTarget := make([]int, 0, len(allEstimate)+len(targets))
+		exist := make(map[int]bool)
+		for blocks := range allEstimate {
+			exist[blocks] = true
+			allTarget = append(allTarget, blocks)
+		}
+		for _, blocks := range targets {
+			if !exist[blocks] {
+				exist[blocks] = true
+				allTarget = append(allTarget, blocks)
+			}
+		}
+
+		err, result := estimate(allTarget)
+		if nil != err {
+			return err, nil
+		}
+		allEstimate = result
+		estimateTime = now
+	}
+
+	result := make([]Estimate, 0, len(targets))
+	for _, blocks := range targets {
+		result = append(result, allEstimate[blocks])
+	}
+	return nil, result
+}
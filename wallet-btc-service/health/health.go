@@ -0,0 +1,229 @@
+// Package health serves /healthz and /readyz of the client and the server. Both check mysql, redis, the
+// bitcoind and omnicore rpc and the lag of the index behind the node, and reply the result of every check.
+// /healthz fails only when mysql or redis fail, the process can not work without them, /readyz fails when any
+// check fails, a lagging node is taken out of rotation. The client is the one catching up the index, its
+// /readyz reports the lag without failing on it.
+package health
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/BlockABC/wallet-btc-service/common/config"
+	"github.com/BlockABC/wallet-btc-service/common/log"
+	"github.com/BlockABC/wallet-btc-service/database"
+	"github.com/BlockABC/wallet-btc-service/jsonrpc"
+	"github.com/BlockABC/wallet-btc-service/omni"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	HEALTHPATH = "/healthz"
+	READYPATH  = "/readyz"
+)
+
+// check names
+const (
+	CHECKMYSQL    = "mysql"
+	CHECKREDIS    = "redis"
+	CHECKBITCOIND = "bitcoind"
+	CHECKOMNICORE = "omnicore"
+	CHECKINDEXER  = "indexer"
+)
+
+const (
+	STATUSOK   = "ok"
+	STATUSFAIL = "fail"
+)
+
+var ErrTimeout = errors.New("check timeout")
+
+// checks /healthz depends on
+var LIVENESSCHECK = map[string]bool{CHECKMYSQL: true, CHECKREDIS: true}
+
+// checks the /readyz of the client reports without failing
+var CLIENTREPORTONLY = map[string]bool{CHECKINDEXER: true}
+
+// result of one check, Height and NodeHeight are set by the rpc and indexer checks
+type Check struct {
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+	Latency    int64  `json:"latency"` // milliseconds
+	Height     int32  `json:"height,omitempty"`
+	NodeHeight int32  `json:"nodeheight,omitempty"`
+	Lag        int32  `json:"lag,omitempty"`
+}
+
+type Report struct {
+	Status string           `json:"status"`
+	Checks map[string]Check `json:"checks"`
+}
+
+// Healthz replies 503 if mysql or redis fail
+func Healthz(c *gin.Context) {
+	reply(c, false, nil)
+}
+
+// Readyz replies 503 if any dependency fails or the index lags behind the node
+func Readyz(c *gin.Context) {
+	reply(c, true, nil)
+}
+
+// ClientReadyz replies 503 if any dependency fails, the lag of the index is only reported
+func ClientReadyz(c *gin.Context) {
+	reply(c, true, CLIENTREPORTONLY)
+}
+
+func reply(c *gin.Context, ready bool, reportOnly map[string]bool) {
+	report := Run(ready, reportOnly)
+	status := http.StatusOK
+	if STATUSOK != report.Status {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, report)
+}
+
+// Run runs every check at the same time, the report fails if a check of readiness, or of liveness only when
+// ready is false, fails. The checks in reportOnly never fail the report
+func Run(ready bool, reportOnly map[string]bool) Report {
+	allCheck := map[string]func(*Check) error{
+		CHECKMYSQL:    checkMysql,
+		CHECKREDIS:    checkRedis,
+		CHECKBITCOIND: checkBitcoind,
+		CHECKOMNICORE: checkOmnicore,
+		CHECKINDEXER:  checkIndexer,
+	}
+
+	report := Report{Status: STATUSOK, Checks: make(map[string]Check)}
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	for name, oneCheck := range allCheck {
+		wg.Add(1)
+		go func(name string, oneCheck func(*Check) error) {
+			defer wg.Done()
+			result := runCheck(oneCheck)
+			if STATUSOK != result.Status {
+				log.Log.Error("health check fail, check: ", name, ", error: ", result.Error)
+			}
+
+			mutex.Lock()
+			report.Checks[name] = result
+			if STATUSOK != result.Status && (ready || LIVENESSCHECK[name]) && !reportOnly[name] {
+				report.Status = STATUSFAIL
+			}
+			mutex.Unlock()
+		}(name, oneCheck)
+	}
+	wg.Wait()
+	return report
+}
+
+// runCheck runs a check with the timeout of health.timeout, a check that takes longer is left to finish
+// in the background
+func runCheck(oneCheck func(*Check) error) Check {
+	timeout := time.Duration(config.Cfg.HealthOpt.Timeout) * time.Second
+	if timeout <= 0 {
+		timeout = 3 * time.Second
+	}
+
+	begin := time.Now()
+	done := make(chan Check, 1)
+	go func() {
+		var result Check
+		if err := oneCheck(&result); nil != err {
+			result.Status = STATUSFAIL
+			result.Error = err.Error()
+		} else {
+			result.Status = STATUSOK
+		}
+		done <- result
+	}()
+
+	var result Check
+	select {
+	case result = <-done:
+	case <-time.After(timeout):
+		result = Check{Status: STATUSFAIL, Error: ErrTimeout.Error()}
+	}
+	result.Latency = time.Since(begin).Nanoseconds() / int64(time.Millisecond)
+	return result
+}
+
+func checkMysql(result *Check) error {
+	return database.Db.DB().Ping()
+}
+
+func checkRedis(result *Check) error {
+	return database.RedisDb.Ping().Err()
+}
+
+func checkBitcoind(result *Check) error {
+	err, height := nodeHeight()
+	result.Height = height
+	return err
+}
+
+func checkOmnicore(result *Check) error {
+	err, height := omni.GetOmniBlockHeight()
+	result.Height = height
+	return err
+}
+
+// checkIndexer fails when the main chain in mysql is more than health.maxlag blocks behind bitcoind
+func checkIndexer(result *Check) error {
+	err, dbHeight := indexHeight()
+	if nil != err {
+		return err
+	}
+	err, height := nodeHeight()
+	if nil != err {
+		return err
+	}
+
+	result.Height = dbHeight
+	result.NodeHeight = height
+	result.Lag = height - dbHeight
+	if int(result.Lag) > config.Cfg.HealthOpt.MaxLag {
+		return fmt.Errorf("index is %d blocks behind the node, at most %d", result.Lag, config.Cfg.HealthOpt.MaxLag)
+	}
+	return nil
+}
+
+// IndexLagging tells whether the index is more blocks behind the node than health.maxlag, a lag failed to get
+// counts as lagging
+func IndexLagging() bool {
+	var result Check
+	return nil != checkIndexer(&result)
+}
+
+// indexHeight returns the height of the main chain in the index, an empty index is at height 0
+func indexHeight() (error, int32) {
+	type maxHeight struct {
+		Height int32
+	}
+
+	var dbHeight maxHeight
+	selectSql := "select coalesce(max(height), 0) as height from t_block_info where isfork = 0;"
+	if err := database.Db.Raw(selectSql).Scan(&dbHeight).Error; nil != err {
+		return err, 0
+	}
+	return nil, dbHeight.Height
+}
+
+// nodeHeight returns the block count of bitcoind
+func nodeHeight() (error, int32) {
+	result, err := jsonrpc.Call(1, "getblockcount", []interface{}{})
+	if nil != err {
+		return err, 0
+	}
+
+	var height int32
+	if err := json.Unmarshal(result, &height); nil != err {
+		return err, 0
+	}
+	return nil, height
+}
@@ -0,0 +1,324 @@
+package httpserver
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/BlockABC/wallet-btc-service/apikey"
+	"github.com/BlockABC/wallet-btc-service/common/config"
+	"github.com/BlockABC/wallet-btc-service/database/tables"
+	"github.com/BlockABC/wallet-btc-service/health"
+	"github.com/BlockABC/wallet-btc-service/innererror"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	APIKEYHEADER   = "X-Api-Key"
+	APIKEYQUERY    = "api_key" // for server sent event clients of STREAMPATH that can not set headers
+	ADMINKEYHEADER = "X-Admin-Key"
+	ADMINPATH      = "/admin/"
+	METRICSPATH    = "/metrics"
+	STREAMPATH     = "/stream"
+	WEBHOOKPATH    = "/webhook/" // webhooks belong to the api key registering them, a key is required
+	APIKEYCONTEXT  = "apikey"    // context key of the api key info of a request
+)
+
+// paths served without api key, for monitoring and load balancers
+var PUBLICPATH = map[string]bool{METRICSPATH: true, health.HEALTHPATH: true, health.READYPATH: true}
+
+// rate limit headers of every response
+const (
+	RATELIMITLIMIT     = "X-RateLimit-Limit"
+	RATELIMITREMAINING = "X-RateLimit-Remaining"
+	RATELIMITRESET     = "X-RateLimit-Reset"
+)
+
+// error reply of a request refused before its handler
+type authMsg struct {
+	Errno  int    `json:"errno"`
+	Errmsg string `json:"errmsg"`
+}
+
+// abortRequest refuses the request with the error code
+func abortRequest(c *gin.Context, status int, errorCode innererror.ErrCode, detail string) {
+	errmsg := errorCode.ErrorInfo()
+	if "" != detail {
+		errmsg += ": " + detail
+	}
+	c.AbortWithStatusJSON(status, authMsg{Errno: errorCode.Value(), Errmsg: errmsg})
+}
+
+// auth checks the api key of a request, its origin, the requests per minute of the key and of the endpoint
+// and the addresses in the request. Without a key the request is limited by client ip if keys are not required.
+func auth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if "OPTIONS" == c.Request.Method || strings.HasPrefix(c.Request.URL.Path, ADMINPATH) || PUBLICPATH[c.Request.URL.Path] {
+			c.Next()
+			return
+		}
+
+		// a key in the query string ends up in logs, it is taken only where headers can not be set
+		key := c.GetHeader(APIKEYHEADER)
+		if "" == key && STREAMPATH == c.Request.URL.Path {
+			key = c.Query(APIKEYQUERY)
+		}
+
+		var info *tables.TableApiKeyInfo
+		bucket := "ip_" + c.ClientIP()
+		if "" != key {
+			err, oneKey := apikey.Lookup(key)
+			if apikey.ErrInvalidKey == err {
+				abortRequest(c, http.StatusUnauthorized, innererror.ErrApiKeyInvalid, "")
+				return
+			}
+			if nil != err {
+				abortRequest(c, http.StatusInternalServerError, innererror.ErrSQLError, "")
+				return
+			}
+			info = oneKey
+			bucket = fmt.Sprintf("key_%d", info.Id)
+		} else if config.Cfg.ApiOpt.AuthRequired || strings.HasPrefix(c.Request.URL.Path, WEBHOOKPATH) {
+			abortRequest(c, http.StatusUnauthorized, innererror.ErrApiKeyMissing, "")
+			return
+		}
+		if nil != info {
+			c.Set(APIKEYCONTEXT, info)
+		}
+
+		if origin := c.GetHeader("Origin"); "" != origin && !apikey.AllowsOrigin(apikey.KeyOrigins(info), origin) {
+			abortRequest(c, http.StatusForbidden, innererror.ErrOriginNotAllowed, origin)
+			return
+		}
+
+		rateLimit := config.Cfg.ApiOpt.RateLimit
+		maxAddresses := config.Cfg.ApiOpt.MaxAddresses
+		if nil != info && info.Ratelimit > 0 {
+			rateLimit = info.Ratelimit
+		}
+		if nil != info && info.Maxaddresses > 0 {
+			maxAddresses = info.Maxaddresses
+		}
+
+		// requests per minute of the key, then the stricter limit of the endpoint
+		path := c.Request.URL.Path
+		if rateLimit > 0 && !checkRateLimit(c, bucket, rateLimit) {
+			return
+		}
+		if endpointLimit := apikey.EndpointLimit(path); endpointLimit > 0 && !checkRateLimit(c, bucket+"_"+path, endpointLimit) {
+			return
+		}
+
+		// addresses per request, the body is read once and given back to the handler
+		count := 0
+		if "" != c.Query("addresses") {
+			count += len(strings.Split(c.Query("addresses"), ","))
+		}
+		if nil != c.Request.Body && http.MethodGet != c.Request.Method {
+			c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, config.Cfg.ApiOpt.MaxBodySize)
+			body, err := ioutil.ReadAll(c.Request.Body)
+			if nil != err {
+				abortRequest(c, http.StatusRequestEntityTooLarge, innererror.ErrDecodeError, err.Error())
+				return
+			}
+			c.Request.Body = ioutil.NopCloser(bytes.NewReader(body))
+			count += apikey.CountAddresses(body)
+		}
+		if maxAddresses > 0 && count > maxAddresses {
+			abortRequest(c, http.StatusOK, innererror.ErrTooManyAddress, fmt.Sprintf("%d addresses, at most %d", count, maxAddresses))
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// apiKeyId returns the id of the api key of the request, 0 without a key
+func apiKeyId(c *gin.Context) int64 {
+	if value, ok := c.Get(APIKEYCONTEXT); ok {
+		return value.(*tables.TableApiKeyInfo).Id
+	}
+	return 0
+}
+
+// checkRateLimit counts the request in the bucket and sets the rate limit headers, a request over the limit
+// is refused with 429
+func checkRateLimit(c *gin.Context, bucket string, limit int) bool {
+	_, allowed, window := apikey.Allow(bucket, limit)
+	c.Header(RATELIMITLIMIT, fmt.Sprintf("%d", window.Limit))
+	c.Header(RATELIMITREMAINING, fmt.Sprintf("%d", window.Remaining))
+	c.Header(RATELIMITRESET, fmt.Sprintf("%d", window.Reset))
+	if !allowed {
+		c.Header("Retry-After", fmt.Sprintf("%d", window.Reset-time.Now().Unix()))
+		abortRequest(c, http.StatusTooManyRequests, innererror.ErrRateLimited, "")
+		return false
+	}
+	return true
+}
+
+// adminAuth allows the admin endpoints only with the configured admin key
+func adminAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		adminKey := config.Cfg.ApiOpt.AdminKey
+		if "" == adminKey || 1 != subtle.ConstantTimeCompare([]byte(adminKey), []byte(c.GetHeader(ADMINKEYHEADER))) {
+			abortRequest(c, http.StatusForbidden, innererror.ErrAdminForbidden, "")
+			return
+		}
+		c.Next()
+	}
+}
+
+// limits and origins of an api key
+type apiKeyRequest struct {
+	Id           int64  `json:"id"`
+	Name         string `json:"name"`
+	Ratelimit    int    `json:"ratelimit"`
+	Maxaddresses int    `json:"maxaddresses"`
+	Origins      string `json:"origins"`
+	State        int8   `json:"state"`
+}
+
+func createApiKey(c *gin.Context) {
+	type data struct {
+		Key  string                  `json:"key"`
+		Info *tables.TableApiKeyInfo `json:"info"`
+	}
+
+	type msg struct {
+		Errno  int    `json:"errno"`
+		Errmsg string `json:"errmsg"`
+		Data   data   `json:"data"`
+	}
+
+	var noError innererror.ErrCode = innererror.ErrNoError
+	resultMsg := msg{
+		Errno:  noError.Value(),
+		Errmsg: noError.ErrorInfo(),
+	}
+
+	var oneRequest apiKeyRequest
+	if err := c.BindJSON(&oneRequest); nil != err {
+		var errorCode innererror.ErrCode = innererror.ErrDecodeError
+		resultMsg.Errno = errorCode.Value()
+		resultMsg.Errmsg = errorCode.ErrorInfo()
+		c.JSON(http.StatusOK, resultMsg)
+		return
+	}
+	if oneRequest.Ratelimit < 0 || oneRequest.Maxaddresses < 0 {
+		var errorCode innererror.ErrCode = innererror.ErrInvalidParaError
+		resultMsg.Errno = errorCode.Value()
+		resultMsg.Errmsg = errorCode.ErrorInfo()
+		c.JSON(http.StatusOK, resultMsg)
+		return
+	}
+
+	err, key, info := apikey.Create(oneRequest.Name, oneRequest.Ratelimit, oneRequest.Maxaddresses, oneRequest.Origins)
+	if nil != err {
+		var errorCode innererror.ErrCode = innererror.ErrSQLError
+		resultMsg.Errno = errorCode.Value()
+		resultMsg.Errmsg = errorCode.ErrorInfo()
+		c.JSON(http.StatusOK, resultMsg)
+		return
+	}
+
+	resultMsg.Data = data{Key: key, Info: info}
+	c.JSON(http.StatusOK, resultMsg)
+}
+
+func getApiKeys(c *gin.Context) {
+	type msg struct {
+		Errno  int                      `json:"errno"`
+		Errmsg string                   `json:"errmsg"`
+		Data   []tables.TableApiKeyInfo `json:"data"`
+	}
+
+	var noError innererror.ErrCode = innererror.ErrNoError
+	resultMsg := msg{
+		Errno:  noError.Value(),
+		Errmsg: noError.ErrorInfo(),
+		Data:   []tables.TableApiKeyInfo{},
+	}
+
+	err, allKey := apikey.GetAllKey()
+	if nil != err {
+		var errorCode innererror.ErrCode = innererror.ErrSQLError
+		resultMsg.Errno = errorCode.Value()
+		resultMsg.Errmsg = errorCode.ErrorInfo()
+		c.JSON(http.StatusOK, resultMsg)
+		return
+	}
+
+	resultMsg.Data = allKey
+	c.JSON(http.StatusOK, resultMsg)
+}
+
+func updateApiKey(c *gin.Context) {
+	var noError innererror.ErrCode = innererror.ErrNoError
+	resultMsg := authMsg{
+		Errno:  noError.Value(),
+		Errmsg: noError.ErrorInfo(),
+	}
+
+	var oneRequest apiKeyRequest
+	if err := c.BindJSON(&oneRequest); nil != err {
+		var errorCode innererror.ErrCode = innererror.ErrDecodeError
+		resultMsg.Errno = errorCode.Value()
+		resultMsg.Errmsg = errorCode.ErrorInfo()
+		c.JSON(http.StatusOK, resultMsg)
+		return
+	}
+	if oneRequest.Ratelimit < 0 || oneRequest.Maxaddresses < 0 {
+		var errorCode innererror.ErrCode = innererror.ErrInvalidParaError
+		resultMsg.Errno = errorCode.Value()
+		resultMsg.Errmsg = errorCode.ErrorInfo()
+		c.JSON(http.StatusOK, resultMsg)
+		return
+	}
+
+	if err := apikey.Update(oneRequest.Id, oneRequest.Ratelimit, oneRequest.Maxaddresses, oneRequest.Origins, oneRequest.State); nil != err {
+		var errorCode innererror.ErrCode = innererror.ErrSQLError
+		if apikey.ErrKeyNotFind == err || apikey.ErrInvalidKey == err {
+			errorCode = innererror.ErrInvalidParaError
+		}
+		resultMsg.Errno = errorCode.Value()
+		resultMsg.Errmsg = errorCode.ErrorInfo() + ": " + err.Error()
+		c.JSON(http.StatusOK, resultMsg)
+		return
+	}
+
+	c.JSON(http.StatusOK, resultMsg)
+}
+
+func deleteApiKey(c *gin.Context) {
+	var noError innererror.ErrCode = innererror.ErrNoError
+	resultMsg := authMsg{
+		Errno:  noError.Value(),
+		Errmsg: noError.ErrorInfo(),
+	}
+
+	var oneRequest apiKeyRequest
+	if err := c.BindJSON(&oneRequest); nil != err {
+		var errorCode innererror.ErrCode = innererror.ErrDecodeError
+		resultMsg.Errno = errorCode.Value()
+		resultMsg.Errmsg = errorCode.ErrorInfo()
+		c.JSON(http.StatusOK, resultMsg)
+		return
+	}
+
+	if err := apikey.Delete(oneRequest.Id); nil != err {
+		var errorCode innererror.ErrCode = innererror.ErrSQLError
+		if apikey.ErrKeyNotFind == err {
+			errorCode = innererror.ErrInvalidParaError
+		}
+		resultMsg.Errno = errorCode.Value()
+		resultMsg.Errmsg = errorCode.ErrorInfo() + ": " + err.Error()
+		c.JSON(http.StatusOK, resultMsg)
+		return
+	}
+
+	c.JSON(http.StatusOK, resultMsg)
+}
@@ -0,0 +1,252 @@
+package httpserver
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/BlockABC/wallet-btc-service/common/log"
+	"github.com/BlockABC/wallet-btc-service/common/wire"
+	"github.com/BlockABC/wallet-btc-service/database"
+	"github.com/BlockABC/wallet-btc-service/health"
+	"github.com/BlockABC/wallet-btc-service/innererror"
+	"github.com/BlockABC/wallet-btc-service/jsonrpc"
+	"github.com/BlockABC/wallet-btc-service/notify"
+)
+
+// state of t_output_info
+const (
+	OUTPUTUNSPENT = 0
+	OUTPUTSPENT   = 1
+)
+
+// reject reasons of the node, matched by prefix
+var rejectReasons = []struct {
+	Prefix string
+	Code   innererror.ErrCode
+}{
+	{"txn-mempool-conflict", innererror.ErrTxAlreadySpent},
+	{"bad-txns-inputs-spent", innererror.ErrTxAlreadySpent},
+	{"transaction already in block chain", innererror.ErrTxAlreadySpent},
+	{"transaction outputs already in utxo set", innererror.ErrTxAlreadySpent},
+	{"missing-inputs", innererror.ErrTxMissingInputs},
+	{"bad-txns-inputs-missingorspent", innererror.ErrTxMissingInputs},
+	{"min relay fee not met", innererror.ErrTxFeeTooLow},
+	{"mempool min fee not met", innererror.ErrTxFeeTooLow},
+	{"insufficient fee", innererror.ErrTxFeeTooLow},
+	{"mempool full", innererror.ErrTxFeeTooLow},
+	{"too-long-mempool-chain", innererror.ErrTxMempoolChain},
+	{"version", innererror.ErrTxNonStandard},
+	{"tx-size", innererror.ErrTxNonStandard},
+	{"scriptsig-size", innererror.ErrTxNonStandard},
+	{"scriptsig-not-pushonly", innererror.ErrTxNonStandard},
+	{"scriptpubkey", innererror.ErrTxNonStandard},
+	{"bare-multisig", innererror.ErrTxNonStandard},
+	{"dust", innererror.ErrTxNonStandard},
+	{"multi-op-return", innererror.ErrTxNonStandard},
+	{"non-final", innererror.ErrTxNonStandard},
+	{"non-bip68-final", innererror.ErrTxNonStandard},
+	{"bad-txns-nonstandard-inputs", innererror.ErrTxNonStandard},
+	{"bad-witness-nonstandard", innererror.ErrTxNonStandard},
+	{"bad-txns-too-many-sigops", innererror.ErrTxNonStandard},
+	{"non-mandatory-script-verify-flag", innererror.ErrTxNonStandard},
+}
+
+// reasons of testmempoolaccept meaning the transaction is in the mempool already
+var alreadyInMempool = []string{"txn-already-in-mempool", "txn-already-known", "txn-same-nonwitness-data-in-mempool"}
+
+// rejectReasonCode returns the error code of a reject reason of the node, old nodes put the reject code
+// before the reason like "66: min relay fee not met"
+func rejectReasonCode(reason string) innererror.ErrCode {
+	reason = strings.ToLower(strings.TrimSpace(reason))
+	if index := strings.Index(reason, ": "); index > 0 && strings.Trim(reason[:index], "0123456789") == "" {
+		reason = reason[index+2:]
+	}
+
+	for _, oneReason := range rejectReasons {
+		if strings.HasPrefix(reason, oneReason.Prefix) {
+			return oneReason.Code
+		}
+	}
+	return innererror.ErrTxRejected
+}
+
+// rpcErrorMessage returns the message of a node error, the body of the failed call is in err
+func rpcErrorMessage(err error) string {
+	type resultErr struct {
+		Code    int
+		Message string
+	}
+	type resultRpcErr struct {
+		Error resultErr
+	}
+
+	var resultInfo resultRpcErr
+	if err := json.Unmarshal([]byte(err.Error()), &resultInfo); nil != err || "" == resultInfo.Error.Message {
+		return ""
+	}
+	return resultInfo.Error.Message
+}
+
+// checkTransactionInputs checks the inputs exist and are not spent by a confirmed transaction in our index.
+// Inputs spent by unconfirmed transactions are left to the node, the transaction may replace them. Inputs the
+// index does not know are left to testmempoolaccept too when the index lags the node, it may know them before us.
+func checkTransactionInputs(tx *wire.MsgTx) (innererror.ErrCode, string) {
+	txids := make([]string, 0, len(tx.TxIn))
+	for _, in := range tx.TxIn {
+		txids = append(txids, in.PreviousOutPoint.HashString())
+	}
+
+	type outputState struct {
+		Hash  string
+		N     int64
+		State int8
+	}
+	allState := make(map[string]int8)
+	for begin := 0; begin < len(txids); begin += database.MAX_WITh_IN {
+		end := begin + database.MAX_WITh_IN
+		if end > len(txids) {
+			end = len(txids)
+		}
+
+		var result []outputState
+		selectSql := fmt.Sprintf("select hash, n, state from t_output_info where hash in (%s) and isfork = 0;", joinSqlString(txids[begin:end]))
+		if err := database.Db.Raw(selectSql).Scan(&result).Error; nil != err {
+			log.Log.Error(err, " exec sql fail: ", selectSql)
+			return innererror.ErrSQLError, innererror.ErrSQLError.ErrorInfo()
+		}
+		for _, oneState := range result {
+			allState[fmt.Sprintf("%s:%d", oneState.Hash, oneState.N)] = oneState.State
+		}
+	}
+
+	lagging := false
+	checkedLag := false
+	for index, in := range tx.TxIn {
+		txid, vout := txids[index], in.PreviousOutPoint.Index
+		outpoint := fmt.Sprintf("%s:%d", txid, vout)
+
+		// confirmed
+		if state, ok := allState[outpoint]; ok {
+			if OUTPUTSPENT == state {
+				return innererror.ErrTxAlreadySpent, innererror.ErrTxAlreadySpent.ErrorInfo() + ": " + outpoint
+			}
+			continue
+		}
+
+		// unconfirmed
+		err, exist, oneRedisTransaction := notify.GetRedisUnconfirmedTransactionByTxid(txid)
+		if nil != err {
+			return innererror.ErrUnknown, innererror.ErrUnknown.ErrorInfo()
+		}
+		found := false
+		if exist {
+			for _, oneOutput := range oneRedisTransaction.Vout {
+				if int64(vout) == oneOutput.N {
+					found = true
+					break
+				}
+			}
+		}
+		if found {
+			continue
+		}
+
+		// missing, unless the index is behind the node
+		if !checkedLag {
+			lagging = health.IndexLagging()
+			checkedLag = true
+		}
+		if !lagging {
+			return innererror.ErrTxMissingInputs, innererror.ErrTxMissingInputs.ErrorInfo() + ": " + outpoint
+		}
+	}
+
+	return innererror.ErrNoError, ""
+}
+
+// testMempoolAccept asks the node if it would accept the transaction, the transaction is not relayed
+func testMempoolAccept(rawHex string) (innererror.ErrCode, string) {
+	result, err := jsonrpc.Call(1, "testmempoolaccept", []interface{}{[]string{rawHex}})
+	if nil != err {
+		log.Log.Error(err, " testmempoolaccept fail")
+		if message := rpcErrorMessage(err); "" != message {
+			return innererror.ErrRPCCallError, innererror.ErrRPCCallError.ErrorInfo() + ": " + message
+		}
+		return innererror.ErrRPCCallError, innererror.ErrRPCCallError.ErrorInfo()
+	}
+
+	type acceptResult struct {
+		Txid          string `json:"txid"`
+		Allowed       bool   `json:"allowed"`
+		Reject_reason string `json:"reject-reason"`
+	}
+	var allResult []acceptResult
+	if err := json.Unmarshal(result, &allResult); nil != err || 1 != len(allResult) {
+		log.Log.Error(err, " Unmarshal testmempoolaccept result fail: ", string(result))
+		return innererror.ErrRPCCallError, innererror.ErrRPCCallError.ErrorInfo()
+	}
+
+	if allResult[0].Allowed {
+		return innererror.ErrNoError, ""
+	}
+	for _, reason := range alreadyInMempool {
+		if reason == allResult[0].Reject_reason {
+			return innererror.ErrNoError, ""
+		}
+	}
+	errorCode := rejectReasonCode(allResult[0].Reject_reason)
+	return errorCode, errorCode.ErrorInfo() + ": " + allResult[0].Reject_reason
+}
+
+// broadcastRawTransaction decodes the transaction, checks its inputs in our index and with testmempoolaccept,
+// then sends it to the node and saves it as unconfirmed. It returns errno and errmsg, the txid and the receive time.
+func broadcastRawTransaction(rawHex string) (int, string, string, int64) {
+	raw, err := hex.DecodeString(rawHex)
+	if nil != err {
+		return innererror.ErrTxDecodeError.Value(), innererror.ErrTxDecodeError.ErrorInfo() + ": " + err.Error(), "", 0
+	}
+	tx, err := wire.DeserializeTx(raw)
+	if nil != err {
+		return innererror.ErrTxDecodeError.Value(), innererror.ErrTxDecodeError.ErrorInfo() + ": " + err.Error(), "", 0
+	}
+	if 0 == len(tx.TxIn) || 0 == len(tx.TxOut) {
+		return innererror.ErrTxDecodeError.Value(), innererror.ErrTxDecodeError.ErrorInfo() + ": no input or output", "", 0
+	}
+
+	if errorCode, errmsg := checkTransactionInputs(tx); innererror.ErrNoError != errorCode {
+		log.Log.Info("broadcastRawTransaction reject transaction:", tx.TxHash(), ", reason:", errmsg)
+		return errorCode.Value(), errmsg, "", 0
+	}
+	if errorCode, errmsg := testMempoolAccept(rawHex); innererror.ErrNoError != errorCode {
+		log.Log.Info("broadcastRawTransaction reject transaction:", tx.TxHash(), ", reason:", errmsg)
+		return errorCode.Value(), errmsg, "", 0
+	}
+
+	result, err := jsonrpc.Call(1, "sendrawtransaction", []interface{}{rawHex})
+	if nil != err {
+		log.Log.Error(err, " sendrawtransaction fail")
+		message := rpcErrorMessage(err)
+		if "" == message {
+			return innererror.ErrRPCCallError.Value(), innererror.ErrRPCCallError.ErrorInfo(), "", 0
+		}
+		errorCode := rejectReasonCode(message)
+		return errorCode.Value(), errorCode.ErrorInfo() + ": " + message, "", 0
+	}
+
+	var txid string
+	if err := json.Unmarshal(result, &txid); nil != err {
+		var errorCode innererror.ErrCode = innererror.ErrRPCCallError
+		return errorCode.Value(), errorCode.ErrorInfo(), "", 0
+	}
+
+	pushErr, receiveTime := notify.HandlePushTransaction(txid)
+	if nil != pushErr {
+		var errorCode innererror.ErrCode = innererror.ErrRPCCallError
+		return errorCode.Value(), errorCode.ErrorInfo(), txid, 0
+	}
+
+	var noError innererror.ErrCode = innererror.ErrNoError
+	return noError.Value(), noError.ErrorInfo(), txid, receiveTime
+}
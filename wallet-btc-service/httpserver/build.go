@@ -0,0 +1,351 @@
+package httpserver
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/BlockABC/wallet-btc-service/common/config"
+	"github.com/BlockABC/wallet-btc-service/common/hdkeychain"
+	"github.com/BlockABC/wallet-btc-service/common/log"
+	"github.com/BlockABC/wallet-btc-service/common/txscript"
+	"github.com/BlockABC/wallet-btc-service/common/wire"
+	"github.com/BlockABC/wallet-btc-service/database"
+	"github.com/BlockABC/wallet-btc-service/fee"
+	"github.com/BlockABC/wallet-btc-service/innererror"
+	"github.com/BlockABC/wallet-btc-service/jsonrpc"
+	"github.com/BlockABC/wallet-btc-service/notify"
+	"github.com/BlockABC/wallet-btc-service/txbuilder"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	DEFAULTFEELEVEL = 2 // normal
+)
+
+// queryBuildUtxos returns the unspent outputs of the addresses with their scriptPubKey, confirmed ones are taken
+// from t_output_info and unconfirmed ones from their address
+func queryBuildUtxos(addresses []string, allPath map[string]string) (innererror.ErrCode, []txbuilder.Utxo) {
+	errorCode, allUnspent := queryAddressUnspents(addresses)
+	if innererror.ErrNoError != errorCode {
+		return errorCode, nil
+	}
+
+	txids := make([]string, 0, len(allUnspent))
+	for _, oneUnspent := range allUnspent {
+		txids = append(txids, oneUnspent.Txid)
+	}
+
+	type outputScript struct {
+		Hash      string
+		N         int64
+		Hex       string
+		Blockhash string
+	}
+	allScript := make(map[string]outputScript)
+	for begin := 0; begin < len(txids); begin += database.MAX_WITh_IN {
+		end := begin + database.MAX_WITh_IN
+		if end > len(txids) {
+			end = len(txids)
+		}
+
+		var result []outputScript
+		selectSql := fmt.Sprintf("select hash, n, hex, blockhash from t_output_info where hash in (%s) and isfork = 0;", joinSqlString(txids[begin:end]))
+		if err := database.Db.Raw(selectSql).Scan(&result).Error; nil != err {
+			log.Log.Error(err, " exec sql fail: ", selectSql)
+			return innererror.ErrSQLError, nil
+		}
+		for _, oneScript := range result {
+			allScript[fmt.Sprintf("%s:%d", oneScript.Hash, oneScript.N)] = oneScript
+		}
+	}
+
+	result := make([]txbuilder.Utxo, 0, len(allUnspent))
+	for _, oneUnspent := range allUnspent {
+		value, _ := strconv.ParseInt(oneUnspent.Value, 10, 64)
+		oneUtxo := txbuilder.Utxo{
+			Txid:    oneUnspent.Txid,
+			Vout:    uint32(oneUnspent.Vout_index),
+			Value:   value,
+			Address: oneUnspent.Address,
+			Path:    allPath[oneUnspent.Address],
+		}
+
+		if oneScript, ok := allScript[fmt.Sprintf("%s:%d", oneUnspent.Txid, oneUnspent.Vout_index)]; ok {
+			pkScript, err := hex.DecodeString(oneScript.Hex)
+			if nil != err {
+				log.Log.Error(err, " decode output script fail, txid: ", oneUnspent.Txid, ", vout: ", oneUnspent.Vout_index)
+				continue
+			}
+			oneUtxo.PkScript = pkScript
+			oneUtxo.Blockhash = oneScript.Blockhash
+		} else {
+			pkScript, err := txscript.PayToAddrScript(oneUnspent.Address, notify.ChainParams)
+			if nil != err {
+				log.Log.Error(err, " get output script fail, address: ", oneUnspent.Address)
+				continue
+			}
+			oneUtxo.PkScript = pkScript
+		}
+		result = append(result, oneUtxo)
+	}
+
+	return innererror.ErrNoError, result
+}
+
+// queryRawTransaction returns the transaction from the node, blockhash is empty for unconfirmed transactions
+func queryRawTransaction(txid string, blockhash string) (error, *wire.MsgTx) {
+	params := []interface{}{txid, false}
+	if "" != blockhash {
+		params = append(params, blockhash)
+	}
+	result, err := jsonrpc.Call(1, "getrawtransaction", params)
+	if nil != err {
+		log.Log.Error(err, " call getrawtransaction fail, txid: ", txid)
+		return err, nil
+	}
+
+	var rawHex string
+	if err := json.Unmarshal(result, &rawHex); nil != err {
+		log.Log.Error(err, " Unmarshal getrawtransaction result fail, txid: ", txid)
+		return err, nil
+	}
+	raw, err := hex.DecodeString(rawHex)
+	if nil != err {
+		return err, nil
+	}
+	tx, err := wire.DeserializeTx(raw)
+	if nil != err {
+		return err, nil
+	}
+	return nil, tx
+}
+
+// queryFeeRate returns feeRate when it is set, otherwise the estimate of the fee level in sat/vB
+func queryFeeRate(feeRate float64, level int) (innererror.ErrCode, float64) {
+	if 0 != feeRate {
+		return innererror.ErrNoError, feeRate
+	}
+
+	err, levelTargets := fee.ParseTargets(config.Cfg.FeeOpt.LevelTargets)
+	if nil != err {
+		log.Log.Error(err, " parse fee level targets fail")
+		return innererror.ErrInvalidParaError, 0
+	}
+	if 0 == level {
+		level = DEFAULTFEELEVEL
+	}
+	if level < 1 || level > len(levelTargets) {
+		return innererror.ErrOutOfRangeError, 0
+	}
+
+	err, allEstimate := fee.EstimateFee([]int{levelTargets[level-1]})
+	if nil != err {
+		return innererror.ErrRPCCallError, 0
+	}
+	return innererror.ErrNoError, allEstimate[0].Feerate
+}
+
+func buildTransaction(c *gin.Context) {
+	type buildInput struct {
+		Address    string `json:"address"`
+		Txid       string `json:"txid"`
+		Vout_index int64  `json:"vout_index"`
+		Value      string `json:"value"`
+		Path       string `json:"path,omitempty"`
+	}
+
+	type buildOutput struct {
+		Address string `json:"address"`
+		Value   string `json:"value"`
+		Change  bool   `json:"change"`
+	}
+
+	type data struct {
+		Psbt      string        `json:"psbt"`
+		Fee       string        `json:"fee"`
+		Fee_rate  float64       `json:"fee_rate"`
+		Vsize     int64         `json:"vsize"`
+		Algorithm string        `json:"algorithm"`
+		Inputs    []buildInput  `json:"inputs"`
+		Outputs   []buildOutput `json:"outputs"`
+	}
+
+	type msg struct {
+		Errno   int              `json:"errno"`
+		Errmsg  string           `json:"errmsg"`
+		Data    data             `json:"data"`
+		Invalid []invalidAddress `json:"invalid,omitempty"`
+	}
+
+	var noError innererror.ErrCode = innererror.ErrNoError
+	resultMsg := msg{
+		Errno:  noError.Value(),
+		Errmsg: noError.ErrorInfo(),
+		Data:   data{Inputs: []buildInput{}, Outputs: []buildOutput{}},
+	}
+
+	// get request, the coins are the addresses or the used addresses of the extended public key
+	type recipient struct {
+		Address string `json:"address"`
+		Value   int64  `json:"value"`
+	}
+	type request struct {
+		Addresses      []string    `json:"addresses"`
+		Xpub           string      `json:"xpub"`
+		Type           string      `json:"type"`
+		Outputs        []recipient `json:"outputs"`
+		Fee_level      int         `json:"fee_level"`
+		Fee_rate       float64     `json:"fee_rate"`
+		Change_address string      `json:"change_address"`
+		Rbf            bool        `json:"rbf"`
+	}
+	var oneRequest request
+	if err := c.BindJSON(&oneRequest); nil != err {
+		var errorCode innererror.ErrCode = innererror.ErrDecodeError
+		resultMsg.Errno = errorCode.Value()
+		resultMsg.Errmsg = errorCode.ErrorInfo()
+		c.JSON(http.StatusOK, resultMsg)
+		return
+	}
+
+	addresses := []string{}
+	allPath := make(map[string]string)
+	changeAddress := oneRequest.Change_address
+	var account *hdkeychain.Account
+	if "" != oneRequest.Xpub {
+		var err error
+		account, err = hdkeychain.NewAccount(oneRequest.Xpub, oneRequest.Type, notify.ChainParams)
+		if nil != err {
+			var errorCode innererror.ErrCode = innererror.ErrInvalidParaError
+			resultMsg.Errno = errorCode.Value()
+			resultMsg.Errmsg = errorCode.ErrorInfo() + ": " + err.Error()
+			c.JSON(http.StatusOK, resultMsg)
+			return
+		}
+
+		errorCode, scan := scanAddresses(2, true, account.Addresses)
+		if innererror.ErrNoError != errorCode {
+			resultMsg.Errno = errorCode.Value()
+			resultMsg.Errmsg = errorCode.ErrorInfo()
+			c.JSON(http.StatusOK, resultMsg)
+			return
+		}
+		for _, oneUsed := range scan.Used {
+			addresses = append(addresses, oneUsed.Address)
+			allPath[oneUsed.Address] = oneUsed.Path
+		}
+
+		// change to the next unused internal address
+		if "" == changeAddress {
+			changeAddress = scan.Next[hdkeychain.InternalChain].Address
+			allPath[changeAddress] = scan.Next[hdkeychain.InternalChain].Path
+		}
+	} else {
+		var addressInvalid []invalidAddress
+		addresses, addressInvalid = filterAddress(oneRequest.Addresses)
+		resultMsg.Invalid = addressInvalid
+		if 0 == len(addresses) {
+			var errorCode innererror.ErrCode = innererror.ErrInvalidParaError
+			resultMsg.Errno = errorCode.Value()
+			resultMsg.Errmsg = errorCode.ErrorInfo()
+			c.JSON(http.StatusOK, resultMsg)
+			return
+		}
+	}
+
+	log.Log.Info("buildTransaction parameter address:", addresses, ", outputs:", oneRequest.Outputs)
+
+	errorCode, feeRate := queryFeeRate(oneRequest.Fee_rate, oneRequest.Fee_level)
+	if innererror.ErrNoError != errorCode {
+		resultMsg.Errno = errorCode.Value()
+		resultMsg.Errmsg = errorCode.ErrorInfo()
+		c.JSON(http.StatusOK, resultMsg)
+		return
+	}
+
+	errorCode, allUtxo := queryBuildUtxos(addresses, allPath)
+	if innererror.ErrNoError != errorCode {
+		resultMsg.Errno = errorCode.Value()
+		resultMsg.Errmsg = errorCode.ErrorInfo()
+		c.JSON(http.StatusOK, resultMsg)
+		return
+	}
+
+	// redeem scripts of the p2sh coins of the extended public key, the signer needs them to sign
+	for index := range allUtxo {
+		var chain, keyIndex uint32
+		if nil == account || !txscript.IsPayToScriptHash(allUtxo[index].PkScript) {
+			continue
+		}
+		if _, err := fmt.Sscanf(allUtxo[index].Path, "%d/%d", &chain, &keyIndex); nil != err {
+			continue
+		}
+		redeemScript, err := account.RedeemScript(chain, keyIndex)
+		if nil != err {
+			log.Log.Error(err, " get redeem script fail, path: ", allUtxo[index].Path)
+			continue
+		}
+		allUtxo[index].RedeemScript = redeemScript
+	}
+
+	buildRequest := &txbuilder.Request{
+		Utxos:         allUtxo,
+		FeeRate:       feeRate,
+		ChangeAddress: changeAddress,
+		Rbf:           oneRequest.Rbf,
+		Params:        notify.ChainParams,
+	}
+	for _, oneOutput := range oneRequest.Outputs {
+		buildRequest.Recipients = append(buildRequest.Recipients, txbuilder.Recipient{Address: oneOutput.Address, Value: oneOutput.Value})
+	}
+	err, result := txbuilder.Build(buildRequest)
+	if nil != err {
+		var errorCode innererror.ErrCode = innererror.ErrInvalidParaError
+		resultMsg.Errno = errorCode.Value()
+		resultMsg.Errmsg = errorCode.ErrorInfo() + ": " + err.Error()
+		c.JSON(http.StatusOK, resultMsg)
+		return
+	}
+
+	// previous transactions for the signers, required for inputs without witness
+	for index, oneUtxo := range result.Selected {
+		if isWitness, version, _ := txscript.ExtractWitnessProgram(oneUtxo.PkScript); isWitness && 0 != version {
+			continue
+		}
+		err, prevTx := queryRawTransaction(oneUtxo.Txid, oneUtxo.Blockhash)
+		if nil != err {
+			if nil != result.Packet.Inputs[index].WitnessUtxo {
+				continue
+			}
+			var errorCode innererror.ErrCode = innererror.ErrRPCCallError
+			resultMsg.Errno = errorCode.Value()
+			resultMsg.Errmsg = errorCode.ErrorInfo()
+			c.JSON(http.StatusOK, resultMsg)
+			return
+		}
+		result.Packet.Inputs[index].NonWitnessUtxo = prevTx
+	}
+
+	// result
+	resultMsg.Data.Psbt = result.Packet.B64Encode()
+	resultMsg.Data.Fee = fmt.Sprintf("%d", result.Fee)
+	resultMsg.Data.Fee_rate = feeRate
+	resultMsg.Data.Vsize = result.Vsize
+	resultMsg.Data.Algorithm = result.Algorithm
+	for _, oneUtxo := range result.Selected {
+		resultMsg.Data.Inputs = append(resultMsg.Data.Inputs, buildInput{oneUtxo.Address, oneUtxo.Txid, int64(oneUtxo.Vout), fmt.Sprintf("%d", oneUtxo.Value), oneUtxo.Path})
+	}
+	for _, oneOutput := range buildRequest.Recipients {
+		resultMsg.Data.Outputs = append(resultMsg.Data.Outputs, buildOutput{oneOutput.Address, fmt.Sprintf("%d", oneOutput.Value), false})
+	}
+	if -1 != result.ChangeIndex {
+		resultMsg.Data.Outputs = append(resultMsg.Data.Outputs, buildOutput{changeAddress, fmt.Sprintf("%d", result.Change), true})
+	}
+
+	log.Log.Info("buildTransaction result:", resultMsg)
+
+	c.JSON(http.StatusOK, resultMsg)
+}
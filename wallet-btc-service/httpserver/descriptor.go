@@ -0,0 +1,218 @@
+package httpserver
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/BlockABC/wallet-btc-service/common/descriptor"
+	"github.com/BlockABC/wallet-btc-service/common/log"
+	"github.com/BlockABC/wallet-btc-service/innererror"
+	"github.com/BlockABC/wallet-btc-service/notify"
+	"github.com/BlockABC/wallet-btc-service/price"
+	"github.com/gin-gonic/gin"
+)
+
+// descriptor request
+type descriptorRequest struct {
+	Descriptor string `json:"descriptor"`
+	Size       int    `json:"size"`
+	Page       int    `json:"page"`
+}
+
+// parseDescriptorRequest binds the request and scans the descriptor, the error code is ErrNoError on success
+func parseDescriptorRequest(c *gin.Context) (innererror.ErrCode, string, *descriptorRequest, *descriptor.Descriptor, *addressScan) {
+	var oneRequest descriptorRequest
+	if err := c.BindJSON(&oneRequest); nil != err {
+		var errorCode innererror.ErrCode = innererror.ErrDecodeError
+		return errorCode, errorCode.ErrorInfo(), nil, nil, nil
+	}
+
+	desc, err := descriptor.Parse(oneRequest.Descriptor, notify.ChainParams)
+	if nil == err {
+		// the script must have an address the indexer records
+		_, err = desc.Address(0, 0)
+	}
+	if nil != err {
+		var errorCode innererror.ErrCode = innererror.ErrInvalidParaError
+		return errorCode, errorCode.ErrorInfo() + ": " + err.Error(), nil, nil, nil
+	}
+
+	derive := func(chain uint32, begin uint32, count uint32) ([]string, error) {
+		return desc.Addresses(int(chain), begin, count)
+	}
+	errorCode, scan := scanAddresses(uint32(desc.Branches()), desc.IsRange(), derive)
+	if innererror.ErrNoError != errorCode {
+		return errorCode, errorCode.ErrorInfo(), nil, nil, nil
+	}
+
+	log.Log.Info("descriptor ", desc.String(), " used address:", scan.Used)
+
+	return innererror.ErrNoError, "", &oneRequest, desc, scan
+}
+
+func getDescriptorInfo(c *gin.Context) {
+	type info struct {
+		Address string `json:"address"`
+		Path    string `json:"path"`
+		Balance string `json:"balance"`
+	}
+
+	type data struct {
+		Descriptor  string           `json:"descriptor"`
+		Ranged      bool             `json:"ranged"`
+		Decimals    int              `json:"decimals"`
+		Usd_price   float64          `json:"usd_price"`
+		Price_age   int64            `json:"price_age"`
+		Price_stale bool             `json:"price_stale"`
+		Balance     string           `json:"balance"`
+		Next        []derivedAddress `json:"next"`
+		Info        []info           `json:"info"`
+	}
+
+	type msg struct {
+		Errno  int    `json:"errno"`
+		Errmsg string `json:"errmsg"`
+		Data   data   `json:"data"`
+	}
+
+	var noError innererror.ErrCode = innererror.ErrNoError
+	resultMsg := msg{
+		Errno:  noError.Value(),
+		Errmsg: noError.ErrorInfo(),
+		Data:   data{Next: []derivedAddress{}, Info: []info{}},
+	}
+
+	errorCode, errorInfo, _, desc, scan := parseDescriptorRequest(c)
+	if innererror.ErrNoError != errorCode {
+		resultMsg.Errno = errorCode.Value()
+		resultMsg.Errmsg = errorInfo
+		c.JSON(http.StatusOK, resultMsg)
+		return
+	}
+
+	errorCode, balance := queryAddressBalance(scan.usedAddress())
+	if innererror.ErrNoError != errorCode {
+		resultMsg.Errno = errorCode.Value()
+		resultMsg.Errmsg = errorCode.ErrorInfo()
+		c.JSON(http.StatusOK, resultMsg)
+		return
+	}
+
+	// price, the last known one
+	resultMsg.Data.Usd_price, resultMsg.Data.Price_age, resultMsg.Data.Price_stale = queryPrice(price.BITCOIN)
+	resultMsg.Data.Decimals = 8
+
+	// result
+	var total int64
+	for _, oneUsed := range scan.Used {
+		total += balance[oneUsed.Address]
+		resultMsg.Data.Info = append(resultMsg.Data.Info, info{oneUsed.Address, oneUsed.Path, fmt.Sprintf("%d", balance[oneUsed.Address])})
+	}
+	resultMsg.Data.Descriptor = desc.String()
+	resultMsg.Data.Ranged = desc.IsRange()
+	resultMsg.Data.Balance = fmt.Sprintf("%d", total)
+	resultMsg.Data.Next = append(resultMsg.Data.Next, scan.Next...)
+
+	log.Log.Info("getDescriptorInfo result:", resultMsg)
+
+	c.JSON(http.StatusOK, resultMsg)
+}
+
+func getDescriptorTransactions(c *gin.Context) {
+	type pagination struct {
+		Size int `json:"size"`
+		Page int `json:"page"`
+	}
+
+	type data struct {
+		Pagination pagination        `json:"pagination"`
+		List       []transactionInfo `json:"list"`
+	}
+
+	type msg struct {
+		Errno  int    `json:"errno"`
+		Errmsg string `json:"errmsg"`
+		Data   data   `json:"data"`
+	}
+
+	var noError innererror.ErrCode = innererror.ErrNoError
+	resultMsg := msg{
+		Errno:  noError.Value(),
+		Errmsg: noError.ErrorInfo(),
+		Data:   data{List: []transactionInfo{}},
+	}
+
+	errorCode, errorInfo, oneRequest, _, scan := parseDescriptorRequest(c)
+	if innererror.ErrNoError != errorCode {
+		resultMsg.Errno = errorCode.Value()
+		resultMsg.Errmsg = errorInfo
+		c.JSON(http.StatusOK, resultMsg)
+		return
+	}
+
+	resultMsg.Data.Pagination = pagination{
+		Size: oneRequest.Size,
+		Page: oneRequest.Page,
+	}
+
+	errorCode, list := queryAddressTransactions(scan.usedAddress(), oneRequest.Page, oneRequest.Size)
+	if innererror.ErrNoError != errorCode {
+		resultMsg.Errno = errorCode.Value()
+		resultMsg.Errmsg = errorCode.ErrorInfo()
+		c.JSON(http.StatusOK, resultMsg)
+		return
+	}
+	resultMsg.Data.List = list
+
+	log.Log.Info("getDescriptorTransactions result:", resultMsg)
+
+	c.JSON(http.StatusOK, resultMsg)
+}
+
+func getDescriptorUnspents(c *gin.Context) {
+	type descriptorUnspent struct {
+		unspent
+		Path string `json:"path"`
+	}
+
+	type msg struct {
+		Errno  int                 `json:"errno"`
+		Errmsg string              `json:"errmsg"`
+		Data   []descriptorUnspent `json:"data"`
+	}
+
+	var noError innererror.ErrCode = innererror.ErrNoError
+	resultMsg := msg{
+		Errno:  noError.Value(),
+		Errmsg: noError.ErrorInfo(),
+		Data:   []descriptorUnspent{},
+	}
+
+	errorCode, errorInfo, _, _, scan := parseDescriptorRequest(c)
+	if innererror.ErrNoError != errorCode {
+		resultMsg.Errno = errorCode.Value()
+		resultMsg.Errmsg = errorInfo
+		c.JSON(http.StatusOK, resultMsg)
+		return
+	}
+
+	errorCode, allUnspent := queryAddressUnspents(scan.usedAddress())
+	if innererror.ErrNoError != errorCode {
+		resultMsg.Errno = errorCode.Value()
+		resultMsg.Errmsg = errorCode.ErrorInfo()
+		c.JSON(http.StatusOK, resultMsg)
+		return
+	}
+
+	allPath := make(map[string]string)
+	for _, oneUsed := range scan.Used {
+		allPath[oneUsed.Address] = oneUsed.Path
+	}
+	for _, oneUnspent := range allUnspent {
+		resultMsg.Data = append(resultMsg.Data, descriptorUnspent{oneUnspent, allPath[oneUnspent.Address]})
+	}
+
+	log.Log.Info("getDescriptorUnspents result:", resultMsg)
+
+	c.JSON(http.StatusOK, resultMsg)
+}
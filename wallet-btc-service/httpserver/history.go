@@ -0,0 +1,456 @@
+package httpserver
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BlockABC/wallet-btc-service/common/config"
+	"github.com/BlockABC/wallet-btc-service/common/log"
+	"github.com/BlockABC/wallet-btc-service/database"
+	"github.com/BlockABC/wallet-btc-service/database/tables"
+	"github.com/BlockABC/wallet-btc-service/innererror"
+	"github.com/BlockABC/wallet-btc-service/notify"
+	"github.com/BlockABC/wallet-btc-service/omni"
+)
+
+const (
+	HISTORYDIRECTIONIN  = "in"  // the addresses receive
+	HISTORYDIRECTIONOUT = "out" // the addresses spend
+)
+
+// history filter of address transactions, zero values do not filter
+type historyFilter struct {
+	Direction  string `json:"direction"`  // in, out or empty for both
+	Status     string `json:"status"`     // confirmed, unconfirmed or empty for both
+	Min_height int32  `json:"min_height"` // unconfirmed transactions are excluded by a height range
+	Max_height int32  `json:"max_height"`
+	Begin_time int64  `json:"begin_time"` // block time, or receive time of unconfirmed transactions
+	End_time   int64  `json:"end_time"`
+	Min_amount string `json:"min_amount"` // received or sent by the addresses in the transaction
+}
+
+// validate checks the filter except the amount, whose unit differs between histories
+func (f *historyFilter) validate() innererror.ErrCode {
+	if "" != f.Direction && HISTORYDIRECTIONIN != f.Direction && HISTORYDIRECTIONOUT != f.Direction {
+		return innererror.ErrInvalidParaError
+	}
+	if "" != f.Status && notify.CONFIRMED != f.Status && notify.UNCONFIRMED != f.Status {
+		return innererror.ErrInvalidParaError
+	}
+	if f.Min_height < 0 || f.Max_height < 0 || (0 != f.Max_height && f.Min_height > f.Max_height) {
+		return innererror.ErrInvalidParaError
+	}
+	if f.Begin_time < 0 || f.End_time < 0 || (0 != f.End_time && f.Begin_time > f.End_time) {
+		return innererror.ErrInvalidParaError
+	}
+	return innererror.ErrNoError
+}
+
+func (f *historyFilter) withUnconfirmed() bool {
+	return notify.CONFIRMED != f.Status && 0 == f.Min_height && 0 == f.Max_height
+}
+
+func (f *historyFilter) withConfirmed() bool {
+	return notify.UNCONFIRMED != f.Status
+}
+
+// inTime reports if an unconfirmed transaction received at receiveTime is in the time range
+func (f *historyFilter) inTime(receiveTime int64) bool {
+	return receiveTime >= f.Begin_time && (0 == f.End_time || receiveTime <= f.End_time)
+}
+
+// rangeSql returns the sql condition of the height and time range
+func (f *historyFilter) rangeSql(heightColumn string, timeColumn string) string {
+	var result string
+	if 0 != f.Min_height {
+		result += fmt.Sprintf(" and %s >= %d", heightColumn, f.Min_height)
+	}
+	if 0 != f.Max_height {
+		result += fmt.Sprintf(" and %s <= %d", heightColumn, f.Max_height)
+	}
+	if 0 != f.Begin_time {
+		result += fmt.Sprintf(" and %s >= %d", timeColumn, f.Begin_time)
+	}
+	if 0 != f.End_time {
+		result += fmt.Sprintf(" and %s <= %d", timeColumn, f.End_time)
+	}
+	return result
+}
+
+// history cursor, the last transaction of a page. Unconfirmed transactions are ordered by receive time and
+// confirmed ones by height and position in block, both newest first and then by txid
+type historyCursor struct {
+	Unconfirmed bool
+	Time        int64
+	Height      int32
+	Position    int32
+	Txid        string
+}
+
+func (h *historyCursor) encode() string {
+	var info string
+	if h.Unconfirmed {
+		info = fmt.Sprintf("u:%d:%s", h.Time, h.Txid)
+	} else {
+		info = fmt.Sprintf("c:%d:%d:%s", h.Height, h.Position, h.Txid)
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(info))
+}
+
+// decodeHistoryCursor parses an opaque cursor, an empty cursor is the beginning
+func decodeHistoryCursor(cursor string) (innererror.ErrCode, *historyCursor) {
+	if "" == cursor {
+		return innererror.ErrNoError, nil
+	}
+
+	info, err := base64.RawURLEncoding.DecodeString(cursor)
+	if nil != err {
+		return innererror.ErrInvalidParaError, nil
+	}
+
+	fields := strings.Split(string(info), ":")
+	result := historyCursor{}
+	switch {
+	case 3 == len(fields) && "u" == fields[0]:
+		result.Unconfirmed = true
+		result.Time, err = strconv.ParseInt(fields[1], 10, 64)
+		result.Txid = fields[2]
+	case 4 == len(fields) && "c" == fields[0]:
+		var height, position int64
+		if height, err = strconv.ParseInt(fields[1], 10, 32); nil == err {
+			position, err = strconv.ParseInt(fields[2], 10, 32)
+		}
+		result.Height = int32(height)
+		result.Position = int32(position)
+		result.Txid = fields[3]
+	default:
+		return innererror.ErrInvalidParaError, nil
+	}
+	if nil != err || !isHash(result.Txid) {
+		return innererror.ErrInvalidParaError, nil
+	}
+
+	return innererror.ErrNoError, &result
+}
+
+// isHash reports if the string is a hex transaction hash, cursor txids are used in sql
+func isHash(hash string) bool {
+	if 64 != len(hash) {
+		return false
+	}
+	for _, one := range hash {
+		if !(one >= '0' && one <= '9') && !(one >= 'a' && one <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// unconfirmedAfter reports if an unconfirmed transaction comes after the cursor
+func (h *historyCursor) unconfirmedAfter(receiveTime int64, txid string) bool {
+	if nil == h {
+		return true
+	}
+	if !h.Unconfirmed {
+		return false
+	}
+	return receiveTime < h.Time || (receiveTime == h.Time && txid < h.Txid)
+}
+
+// confirmedSql returns the sql condition of confirmed transactions after the cursor
+func (h *historyCursor) confirmedSql(heightColumn string, positionColumn string, txidColumn string) string {
+	if nil == h || h.Unconfirmed {
+		return ""
+	}
+	return fmt.Sprintf(" and (%s < %d or (%s = %d and (%s < %d or (%s = %d and %s < '%s'))))",
+		heightColumn, h.Height, heightColumn, h.Height, positionColumn, h.Position, positionColumn, h.Position, txidColumn, h.Txid)
+}
+
+// historyPage splits a page between the unconfirmed transactions left after the cursor and the confirmed ones,
+// it returns the unconfirmed range and the offset and limit of confirmed transactions
+func historyPage(unconfirmedCount int, bCursor bool, page int, size int) (int, int, int, int) {
+	begin := 0
+	if !bCursor {
+		begin = (page - 1) * size
+	}
+	end := begin + size
+
+	if end <= unconfirmedCount {
+		return begin, end, 0, 0
+	} else if begin < unconfirmedCount {
+		return begin, unconfirmedCount, 0, end - unconfirmedCount
+	}
+	return 0, 0, begin - unconfirmedCount, size
+}
+
+// checkHistoryPage checks the page of a history request, a page is used only without cursor
+func checkHistoryPage(cursor string, page int, size int) (innererror.ErrCode, bool) {
+	bCursor := "" != cursor || page <= 0
+	if size <= 0 || (!bCursor && page <= 0) {
+		log.Log.Error(fmt.Sprintf("page number %d, size %d out of range", page, size))
+		return innererror.ErrOutOfRangeError, false
+	}
+	return innererror.ErrNoError, bCursor
+}
+
+// queryAddressHistory returns one page of transactions of the addresses matching the filter, unconfirmed first.
+// The page starts after cursor, or is chosen by page when cursor is empty and page is positive, the next cursor
+// is empty when the page is not full
+func queryAddressHistory(addresses []string, filter *historyFilter, cursor string, page int, size int) (innererror.ErrCode, []transactionInfo, string) {
+	list := []transactionInfo{}
+	errorCode, bCursor := checkHistoryPage(cursor, page, size)
+	if innererror.ErrNoError != errorCode {
+		return errorCode, nil, ""
+	}
+	if errorCode := filter.validate(); innererror.ErrNoError != errorCode {
+		return errorCode, nil, ""
+	}
+	var minAmount int64
+	if "" != filter.Min_amount {
+		value, err := strconv.ParseInt(filter.Min_amount, 10, 64)
+		if nil != err || value < 0 {
+			return innererror.ErrInvalidParaError, nil, ""
+		}
+		minAmount = value
+	}
+	errorCode, position := decodeHistoryCursor(cursor)
+	if innererror.ErrNoError != errorCode {
+		return errorCode, nil, ""
+	}
+	if 0 == len(addresses) {
+		return innererror.ErrNoError, list, ""
+	}
+
+	addressMap := make(map[string]bool)
+	for _, oneAddress := range addresses {
+		addressMap[oneAddress] = true
+	}
+
+	// unconfirmed transaction
+	unfmdTransaction := []notify.RedisTransaction{}
+	if filter.withUnconfirmed() && (nil == position || position.Unconfirmed) {
+		err, allRedis := notify.GetRedisUnconfirmedTransactionByAddress(addresses)
+		if nil != err {
+			log.Log.Error(err, " GetRedisUnconfirmedTransactionByAddress fail")
+			return innererror.ErrUnknown, nil, ""
+		}
+
+		for _, oneRedis := range allRedis {
+			if !filter.inTime(oneRedis.ReceiveTime) || !position.unconfirmedAfter(oneRedis.ReceiveTime, oneRedis.Txid) {
+				continue
+			}
+
+			var received, sent int64
+			bReceive, bSend := false, false
+			for _, oneOutput := range oneRedis.Vout {
+				if nil != oneOutput.Addresses && 0 != len(oneOutput.Addresses) && addressMap[oneOutput.Addresses[0]] {
+					received += oneOutput.Value
+					bReceive = true
+				}
+			}
+			for _, oneInput := range oneRedis.Vin {
+				if addressMap[oneInput.Address] {
+					sent += oneInput.Value
+					bSend = true
+				}
+			}
+
+			switch filter.Direction {
+			case HISTORYDIRECTIONIN:
+				if !bReceive || received < minAmount {
+					continue
+				}
+			case HISTORYDIRECTIONOUT:
+				if !bSend || sent < minAmount {
+					continue
+				}
+			default:
+				if received < minAmount && sent < minAmount {
+					continue
+				}
+			}
+			unfmdTransaction = append(unfmdTransaction, oneRedis)
+		}
+
+		sort.Slice(unfmdTransaction, func(i, j int) bool {
+			if unfmdTransaction[i].ReceiveTime != unfmdTransaction[j].ReceiveTime {
+				return unfmdTransaction[i].ReceiveTime > unfmdTransaction[j].ReceiveTime
+			}
+			return unfmdTransaction[i].Txid > unfmdTransaction[j].Txid
+		})
+	}
+
+	unfmdBegin, unfmdEnd, limitBegin, limitEnd := historyPage(len(unfmdTransaction), bCursor, page, size)
+	var last *historyCursor
+	for _, oneRedis := range unfmdTransaction[unfmdBegin:unfmdEnd] {
+		list = append(list, convertRedisTransactionToTransactionInfo(&oneRedis))
+		last = &historyCursor{Unconfirmed: true, Time: oneRedis.ReceiveTime, Txid: oneRedis.Txid}
+	}
+
+	// confirmed transaction
+	if filter.withConfirmed() && 0 != limitEnd {
+		strAddress := joinSqlString(addresses)
+		condition := filter.rangeSql("height", "`time`") + position.confirmedSql("height", "position", "txid")
+
+		receivedSql := fmt.Sprintf("(select ifnull(sum(`value`), 0) from t_output_info where `hash`=t.txid and `to` in (%s) and isfork=0)", strAddress)
+		sentSql := fmt.Sprintf("(select ifnull(sum(`value`), 0) from t_input_info where `hash`=t.txid and `from` in (%s) and isfork=0)", strAddress)
+		switch filter.Direction {
+		case HISTORYDIRECTIONIN:
+			condition += " and isfrom=0"
+			if 0 != minAmount {
+				condition += fmt.Sprintf(" and %s >= %d", receivedSql, minAmount)
+			}
+		case HISTORYDIRECTIONOUT:
+			condition += " and isfrom=1"
+			if 0 != minAmount {
+				condition += fmt.Sprintf(" and %s >= %d", sentSql, minAmount)
+			}
+		default:
+			if 0 != minAmount {
+				condition += fmt.Sprintf(" and (%s >= %d or %s >= %d)", receivedSql, minAmount, sentSql, minAmount)
+			}
+		}
+
+		type transactionId struct {
+			Txid     string
+			Height   int32
+			Position int32
+		}
+		allTransactionId := []transactionId{}
+		txidSelectSql := fmt.Sprintf("select distinct txid, height, position from t_transaction_input_output_address_info t where `address` in (%s)%s order by height desc, position desc, txid desc limit %d, %d;",
+			strAddress, condition, limitBegin, limitEnd)
+		log.Log.Info("queryAddressHistory select transaction id sql:", txidSelectSql)
+		if err := database.Db.Raw(txidSelectSql).Scan(&allTransactionId).Error; nil != err {
+			log.Log.Error(err, " exec sql fail: ", txidSelectSql)
+			return innererror.ErrSQLError, nil, ""
+		}
+
+		txIds := []string{}
+		for _, oneTableTxid := range allTransactionId {
+			txIds = append(txIds, oneTableTxid.Txid)
+			last = &historyCursor{Height: oneTableTxid.Height, Position: oneTableTxid.Position, Txid: oneTableTxid.Txid}
+		}
+
+		errorCode, allTransactionInfo := queryTransactionInfo(txIds)
+		if innererror.ErrNoError != errorCode {
+			return errorCode, nil, ""
+		}
+		list = append(list, allTransactionInfo...)
+	}
+
+	nextCursor := ""
+	if size == len(list) && nil != last {
+		nextCursor = last.encode()
+	}
+
+	return innererror.ErrNoError, list, nextCursor
+}
+
+// queryAddressUsdtHistory returns one page of usdt transactions of the addresses with the types matching the filter,
+// unconfirmed first, the page is chosen as in queryAddressHistory and the amount is in tokens
+func queryAddressUsdtHistory(addresses []string, transactionType []string, filter *historyFilter, cursor string, page int, size int) (innererror.ErrCode, []omni.OmniTransaction, []tables.TableOmniTransactionInfo, string) {
+	errorCode, bCursor := checkHistoryPage(cursor, page, size)
+	if innererror.ErrNoError != errorCode {
+		return errorCode, nil, nil, ""
+	}
+	if errorCode := filter.validate(); innererror.ErrNoError != errorCode {
+		return errorCode, nil, nil, ""
+	}
+	minAmount := new(big.Rat)
+	if "" != filter.Min_amount {
+		if _, ok := minAmount.SetString(filter.Min_amount); !ok || minAmount.Sign() < 0 {
+			return innererror.ErrInvalidParaError, nil, nil, ""
+		}
+	}
+	errorCode, position := decodeHistoryCursor(cursor)
+	if innererror.ErrNoError != errorCode {
+		return errorCode, nil, nil, ""
+	}
+
+	addressMap := make(map[string]bool)
+	for _, oneAddress := range addresses {
+		addressMap[oneAddress] = true
+	}
+
+	// unconfirmed transaction
+	unfmdTransaction := []omni.OmniTransaction{}
+	if filter.withUnconfirmed() && (nil == position || position.Unconfirmed) {
+		err, allRedis := omni.GetRedisUnconfirmedOmniTransactionByAddressAndType(addresses, transactionType)
+		if nil != err {
+			log.Log.Error(err, " GetRedisUnconfirmedOmniTransactionByAddressAndType fail")
+			return innererror.ErrUnknown, nil, nil, ""
+		}
+
+		for _, oneRedis := range allRedis {
+			if !filter.inTime(oneRedis.ReceiveTime) || !position.unconfirmedAfter(oneRedis.ReceiveTime, oneRedis.Txid) {
+				continue
+			}
+			if (HISTORYDIRECTIONIN == filter.Direction && !addressMap[oneRedis.Referenceaddress]) ||
+				(HISTORYDIRECTIONOUT == filter.Direction && !addressMap[oneRedis.Sendingaddress]) {
+				continue
+			}
+			if 0 != minAmount.Sign() {
+				amount, ok := new(big.Rat).SetString(oneRedis.Amount)
+				if !ok || amount.Cmp(minAmount) < 0 {
+					continue
+				}
+			}
+			unfmdTransaction = append(unfmdTransaction, oneRedis)
+		}
+
+		sort.Slice(unfmdTransaction, func(i, j int) bool {
+			if unfmdTransaction[i].ReceiveTime != unfmdTransaction[j].ReceiveTime {
+				return unfmdTransaction[i].ReceiveTime > unfmdTransaction[j].ReceiveTime
+			}
+			return unfmdTransaction[i].Txid > unfmdTransaction[j].Txid
+		})
+	}
+
+	unfmdBegin, unfmdEnd, limitBegin, limitEnd := historyPage(len(unfmdTransaction), bCursor, page, size)
+	unfmdTransaction = unfmdTransaction[unfmdBegin:unfmdEnd]
+	var last *historyCursor
+	if 0 != len(unfmdTransaction) {
+		lastRedis := unfmdTransaction[len(unfmdTransaction)-1]
+		last = &historyCursor{Unconfirmed: true, Time: lastRedis.ReceiveTime, Txid: lastRedis.Txid}
+	}
+
+	// confirmed transaction
+	allOmniTransaction := []tables.TableOmniTransactionInfo{}
+	if filter.withConfirmed() && 0 != limitEnd {
+		strAddress := joinSqlString(addresses)
+		condition := filter.rangeSql("block", "blocktime") + position.confirmedSql("block", "positioninblock", "txid")
+		switch filter.Direction {
+		case HISTORYDIRECTIONIN:
+			condition += fmt.Sprintf(" and `referenceaddress` in (%s)", strAddress)
+		case HISTORYDIRECTIONOUT:
+			condition += fmt.Sprintf(" and `sendingaddress` in (%s)", strAddress)
+		}
+		if 0 != minAmount.Sign() {
+			condition += fmt.Sprintf(" and cast(amount as decimal(40, 8)) >= %s", minAmount.FloatString(8))
+		}
+
+		selectSql := fmt.Sprintf("select * from t_omni_transaction_info where (`sendingaddress` in (%s) or `referenceaddress` in (%s)) and `type` in (%s) and propertyid = %d%s order by block desc, positioninblock desc, txid desc limit %d, %d;",
+			strAddress, strAddress, joinSqlString(transactionType), config.Cfg.OmniOpt.UsdtPropertyId, condition, limitBegin, limitEnd)
+		log.Log.Info("queryAddressUsdtHistory select transaction sql:", selectSql)
+		if err := database.Db.Raw(selectSql).Scan(&allOmniTransaction).Error; nil != err {
+			log.Log.Error(err, " exec sql fail: ", selectSql)
+			return innererror.ErrSQLError, nil, nil, ""
+		}
+
+		if 0 != len(allOmniTransaction) {
+			lastTable := allOmniTransaction[len(allOmniTransaction)-1]
+			last = &historyCursor{Height: lastTable.Block, Position: lastTable.Positioninblock, Txid: lastTable.Txid}
+		}
+	}
+
+	nextCursor := ""
+	if size == len(unfmdTransaction)+len(allOmniTransaction) && nil != last {
+		nextCursor = last.encode()
+	}
+
+	return innererror.ErrNoError, unfmdTransaction, allOmniTransaction, nextCursor
+}
@@ -0,0 +1,95 @@
+package httpserver
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/BlockABC/wallet-btc-service/common/log"
+	"github.com/BlockABC/wallet-btc-service/innererror"
+	"github.com/BlockABC/wallet-btc-service/price"
+	"github.com/gin-gonic/gin"
+)
+
+func getPrice(c *gin.Context) {
+	type info struct {
+		Id        string  `json:"id"`
+		Usd_price float64 `json:"usd_price"`
+		Provider  string  `json:"provider"`
+		Time      int64   `json:"time"`
+		Age       int64   `json:"age"`
+		Stale     bool    `json:"stale"`
+	}
+
+	type msg struct {
+		Errno  int    `json:"errno"`
+		Errmsg string `json:"errmsg"`
+		Data   []info `json:"data"`
+	}
+
+	var noError innererror.ErrCode = innererror.ErrNoError
+	resultMsg := msg{
+		Errno:  noError.Value(),
+		Errmsg: noError.ErrorInfo(),
+		Data:   []info{},
+	}
+
+	for _, oneId := range price.COINIDS {
+		err, onePrice := price.GetPrice(oneId)
+		if nil != err {
+			continue
+		}
+		resultMsg.Data = append(resultMsg.Data, info{oneId, onePrice.Usd, onePrice.Provider, onePrice.UpdateTime, onePrice.Age(), onePrice.Stale()})
+	}
+
+	c.JSON(http.StatusOK, resultMsg)
+}
+
+func getPriceHistory(c *gin.Context) {
+	type info struct {
+		Usd_price float64 `json:"usd_price"`
+		Provider  string  `json:"provider"`
+		Time      int64   `json:"time"`
+	}
+
+	type msg struct {
+		Errno  int    `json:"errno"`
+		Errmsg string `json:"errmsg"`
+		Data   []info `json:"data"`
+	}
+
+	var noError innererror.ErrCode = innererror.ErrNoError
+	resultMsg := msg{
+		Errno:  noError.Value(),
+		Errmsg: noError.ErrorInfo(),
+		Data:   []info{},
+	}
+
+	// coin id and time range, end 0 is now
+	id := c.DefaultQuery("id", price.BITCOIN)
+	begin, beginErr := strconv.ParseInt(c.DefaultQuery("begin", "0"), 10, 64)
+	end, endErr := strconv.ParseInt(c.DefaultQuery("end", "0"), 10, 64)
+	if nil != beginErr || nil != endErr || begin < 0 || end < 0 {
+		var errorCode innererror.ErrCode = innererror.ErrInvalidParaError
+		resultMsg.Errno = errorCode.Value()
+		resultMsg.Errmsg = errorCode.ErrorInfo()
+		c.JSON(http.StatusOK, resultMsg)
+		return
+	}
+
+	err, allHistory := price.GetPriceHistory(id, begin, end)
+	if nil != err {
+		var errorCode innererror.ErrCode = innererror.ErrSQLError
+		resultMsg.Errno = errorCode.Value()
+		resultMsg.Errmsg = errorCode.ErrorInfo()
+		c.JSON(http.StatusOK, resultMsg)
+		return
+	}
+
+	for _, oneHistory := range allHistory {
+		resultMsg.Data = append(resultMsg.Data, info{oneHistory.Price, oneHistory.Provider, oneHistory.Time})
+	}
+
+	log.Log.Info("getPriceHistory coin: ", id, ", count: ", len(resultMsg.Data))
+
+	c.JSON(http.StatusOK, resultMsg)
+}
@@ -0,0 +1,487 @@
+package httpserver
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/BlockABC/wallet-btc-service/common/log"
+	"github.com/BlockABC/wallet-btc-service/common/psbt"
+	"github.com/BlockABC/wallet-btc-service/common/txscript"
+	"github.com/BlockABC/wallet-btc-service/database"
+	"github.com/BlockABC/wallet-btc-service/innererror"
+	"github.com/BlockABC/wallet-btc-service/notify"
+	"github.com/BlockABC/wallet-btc-service/txbuilder"
+	"github.com/gin-gonic/gin"
+)
+
+// source of a previous output
+const (
+	PREVOUTDATABASE = "database"
+	PREVOUTPSBT     = "psbt"
+)
+
+// output spent by a psbt input, Source is empty when it is unknown
+type prevOut struct {
+	Address  string
+	Value    int64
+	PkScript []byte
+	Source   string
+}
+
+// parsePsbt decodes a base64 psbt, the error code is ErrNoError on success
+func parsePsbt(str string) (innererror.ErrCode, string, *psbt.Packet) {
+	packet, err := psbt.ParseBase64(str)
+	if nil != err {
+		var errorCode innererror.ErrCode = innererror.ErrInvalidParaError
+		return errorCode, errorCode.ErrorInfo() + ": " + err.Error(), nil
+	}
+	return innererror.ErrNoError, "", packet
+}
+
+// queryPrevOuts returns the outputs spent by the inputs of the psbt, taken from t_output_info, the unconfirmed
+// transactions and at last the utxo in the psbt
+func queryPrevOuts(packet *psbt.Packet) (innererror.ErrCode, []prevOut) {
+	txids := make([]string, 0, len(packet.UnsignedTx.TxIn))
+	for _, in := range packet.UnsignedTx.TxIn {
+		txids = append(txids, in.PreviousOutPoint.HashString())
+	}
+
+	type outputInfo struct {
+		Hash    string
+		N       int64
+		Value   int64
+		Hex     string
+		Address string
+	}
+	allOutput := make(map[string]outputInfo)
+	for begin := 0; begin < len(txids); begin += database.MAX_WITh_IN {
+		end := begin + database.MAX_WITh_IN
+		if end > len(txids) {
+			end = len(txids)
+		}
+
+		var result []outputInfo
+		selectSql := fmt.Sprintf("select hash, n, value, hex, `to` as address from t_output_info where hash in (%s) and isfork = 0;", joinSqlString(txids[begin:end]))
+		if err := database.Db.Raw(selectSql).Scan(&result).Error; nil != err {
+			log.Log.Error(err, " exec sql fail: ", selectSql)
+			return innererror.ErrSQLError, nil
+		}
+		for _, oneOutput := range result {
+			allOutput[fmt.Sprintf("%s:%d", oneOutput.Hash, oneOutput.N)] = oneOutput
+		}
+	}
+
+	result := make([]prevOut, len(txids))
+	for index, in := range packet.UnsignedTx.TxIn {
+		txid, vout := txids[index], in.PreviousOutPoint.Index
+
+		// confirmed
+		if oneOutput, ok := allOutput[fmt.Sprintf("%s:%d", txid, vout)]; ok {
+			pkScript, err := hex.DecodeString(oneOutput.Hex)
+			if nil == err {
+				result[index] = prevOut{oneOutput.Address, oneOutput.Value, pkScript, PREVOUTDATABASE}
+				continue
+			}
+			log.Log.Error(err, " decode output script fail, txid: ", txid, ", vout: ", vout)
+		}
+
+		// unconfirmed
+		err, exist, oneRedisTransaction := notify.GetRedisUnconfirmedTransactionByTxid(txid)
+		if nil != err {
+			return innererror.ErrUnknown, nil
+		}
+		if exist {
+			for _, oneOutput := range oneRedisTransaction.Vout {
+				if int64(vout) != oneOutput.N || 1 != len(oneOutput.Addresses) {
+					continue
+				}
+				pkScript, err := txscript.PayToAddrScript(oneOutput.Addresses[0], notify.ChainParams)
+				if nil == err {
+					result[index] = prevOut{oneOutput.Addresses[0], oneOutput.Value, pkScript, PREVOUTDATABASE}
+				}
+			}
+			if "" != result[index].Source {
+				continue
+			}
+		}
+
+		// psbt
+		if out := packet.PrevOut(index); nil != out {
+			oneAddress := ""
+			if _, _, addresses := txscript.ExtractPkScriptAddrs(out.PkScript, notify.ChainParams); 1 == len(addresses) {
+				oneAddress = addresses[0]
+			}
+			result[index] = prevOut{oneAddress, out.Value, out.PkScript, PREVOUTPSBT}
+		}
+	}
+
+	return innererror.ErrNoError, result
+}
+
+// finalizePsbt finalizes the inputs that have all their signatures, the spent script comes from the psbt or
+// from allPrevOut. It returns the error of the first input not finalized.
+func finalizePsbt(packet *psbt.Packet, allPrevOut []prevOut) error {
+	var firstErr error
+	for index := range packet.Inputs {
+		var pkScript []byte
+		if out := packet.PrevOut(index); nil != out {
+			pkScript = out.PkScript
+		} else {
+			pkScript = allPrevOut[index].PkScript
+		}
+
+		err := psbt.ErrMissingUtxo
+		if nil != pkScript {
+			err = packet.FinalizeInput(index, pkScript)
+		}
+		if nil != err && nil == firstErr {
+			firstErr = fmt.Errorf("input %d: %v", index, err)
+		}
+	}
+	return firstErr
+}
+
+func decodePsbt(c *gin.Context) {
+	type psbtInput struct {
+		Txid            string   `json:"txid"`
+		Vout_index      int64    `json:"vout_index"`
+		Address         string   `json:"address"`
+		Value           string   `json:"value"`
+		Source          string   `json:"source"`
+		Sequence        uint32   `json:"sequence"`
+		Finalized       bool     `json:"finalized"`
+		Required        int      `json:"required"`
+		Signed          int      `json:"signed"`
+		Missing_pubkeys []string `json:"missing_pubkeys"`
+		Error           string   `json:"error,omitempty"`
+	}
+
+	type psbtOutput struct {
+		Vout_index int64  `json:"vout_index"`
+		Address    string `json:"address"`
+		Value      string `json:"value"`
+		Type       string `json:"type"`
+	}
+
+	type data struct {
+		Txid         string       `json:"txid"`
+		Version      int32        `json:"version"`
+		Locktime     uint32       `json:"locktime"`
+		Rbf          bool         `json:"rbf"`
+		Input_value  string       `json:"input_value"`
+		Output_value string       `json:"output_value"`
+		Fee          string       `json:"fee"`
+		Vsize        int64        `json:"vsize"`
+		Fee_rate     float64      `json:"fee_rate"`
+		Complete     bool         `json:"complete"`
+		Inputs       []psbtInput  `json:"inputs"`
+		Outputs      []psbtOutput `json:"outputs"`
+	}
+
+	type msg struct {
+		Errno  int    `json:"errno"`
+		Errmsg string `json:"errmsg"`
+		Data   data   `json:"data"`
+	}
+
+	var noError innererror.ErrCode = innererror.ErrNoError
+	resultMsg := msg{
+		Errno:  noError.Value(),
+		Errmsg: noError.ErrorInfo(),
+		Data:   data{Inputs: []psbtInput{}, Outputs: []psbtOutput{}},
+	}
+
+	// get request
+	type request struct {
+		Psbt string `json:"psbt"`
+	}
+	var oneRequest request
+	if err := c.BindJSON(&oneRequest); nil != err {
+		var errorCode innererror.ErrCode = innererror.ErrDecodeError
+		resultMsg.Errno = errorCode.Value()
+		resultMsg.Errmsg = errorCode.ErrorInfo()
+		c.JSON(http.StatusOK, resultMsg)
+		return
+	}
+
+	errorCode, errorInfo, packet := parsePsbt(oneRequest.Psbt)
+	if innererror.ErrNoError != errorCode {
+		resultMsg.Errno = errorCode.Value()
+		resultMsg.Errmsg = errorInfo
+		c.JSON(http.StatusOK, resultMsg)
+		return
+	}
+
+	errorCode, allPrevOut := queryPrevOuts(packet)
+	if innererror.ErrNoError != errorCode {
+		resultMsg.Errno = errorCode.Value()
+		resultMsg.Errmsg = errorCode.ErrorInfo()
+		c.JSON(http.StatusOK, resultMsg)
+		return
+	}
+
+	// inputs, the value is unknown when an input has no known previous output
+	tx := packet.UnsignedTx
+	var inputValue, outputValue int64
+	valueKnown := true
+	pkScripts := make([][]byte, 0, len(tx.TxIn))
+	for index, in := range tx.TxIn {
+		onePrevOut := allPrevOut[index]
+		oneInput := psbtInput{
+			Txid:            in.PreviousOutPoint.HashString(),
+			Vout_index:      int64(in.PreviousOutPoint.Index),
+			Address:         onePrevOut.Address,
+			Value:           fmt.Sprintf("%d", onePrevOut.Value),
+			Source:          onePrevOut.Source,
+			Sequence:        in.Sequence,
+			Finalized:       packet.Inputs[index].IsFinalized(),
+			Missing_pubkeys: []string{},
+		}
+		if "" == onePrevOut.Source {
+			valueKnown = false
+			oneInput.Error = psbt.ErrMissingUtxo.Error()
+		} else {
+			required, signed, missing, err := packet.Inputs[index].SignStatus(onePrevOut.PkScript)
+			oneInput.Required, oneInput.Signed = required, signed
+			for _, pubKey := range missing {
+				oneInput.Missing_pubkeys = append(oneInput.Missing_pubkeys, hex.EncodeToString(pubKey))
+			}
+			if nil != err {
+				oneInput.Error = err.Error()
+			}
+		}
+		if in.Sequence < txbuilder.SEQUENCEFINAL-1 {
+			resultMsg.Data.Rbf = true
+		}
+		inputValue += onePrevOut.Value
+		pkScripts = append(pkScripts, onePrevOut.PkScript)
+		resultMsg.Data.Inputs = append(resultMsg.Data.Inputs, oneInput)
+	}
+
+	// outputs
+	for index, out := range tx.TxOut {
+		scriptType, _, addresses := txscript.ExtractPkScriptAddrs(out.PkScript, notify.ChainParams)
+		oneOutput := psbtOutput{Vout_index: int64(index), Value: fmt.Sprintf("%d", out.Value), Type: scriptType}
+		if 1 == len(addresses) {
+			oneOutput.Address = addresses[0]
+		}
+		outputValue += out.Value
+		resultMsg.Data.Outputs = append(resultMsg.Data.Outputs, oneOutput)
+	}
+
+	// result
+	resultMsg.Data.Txid = tx.TxHash()
+	resultMsg.Data.Version = tx.Version
+	resultMsg.Data.Locktime = tx.LockTime
+	resultMsg.Data.Output_value = fmt.Sprintf("%d", outputValue)
+	resultMsg.Data.Complete = packet.IsComplete()
+	resultMsg.Data.Vsize = packet.EstimateVsize(pkScripts)
+	if valueKnown {
+		resultMsg.Data.Input_value = fmt.Sprintf("%d", inputValue)
+		resultMsg.Data.Fee = fmt.Sprintf("%d", inputValue-outputValue)
+		if 0 != resultMsg.Data.Vsize {
+			resultMsg.Data.Fee_rate = float64(inputValue-outputValue) / float64(resultMsg.Data.Vsize)
+		}
+	}
+
+	log.Log.Info("decodePsbt result:", resultMsg)
+
+	c.JSON(http.StatusOK, resultMsg)
+}
+
+func combinePsbt(c *gin.Context) {
+	type data struct {
+		Psbt     string `json:"psbt"`
+		Complete bool   `json:"complete"`
+	}
+
+	type msg struct {
+		Errno  int    `json:"errno"`
+		Errmsg string `json:"errmsg"`
+		Data   data   `json:"data"`
+	}
+
+	var noError innererror.ErrCode = innererror.ErrNoError
+	resultMsg := msg{
+		Errno:  noError.Value(),
+		Errmsg: noError.ErrorInfo(),
+	}
+
+	// get request
+	type request struct {
+		Psbts []string `json:"psbts"`
+	}
+	var oneRequest request
+	if err := c.BindJSON(&oneRequest); nil != err {
+		var errorCode innererror.ErrCode = innererror.ErrDecodeError
+		resultMsg.Errno = errorCode.Value()
+		resultMsg.Errmsg = errorCode.ErrorInfo()
+		c.JSON(http.StatusOK, resultMsg)
+		return
+	}
+
+	allPacket := make([]*psbt.Packet, 0, len(oneRequest.Psbts))
+	for _, onePsbt := range oneRequest.Psbts {
+		errorCode, errorInfo, packet := parsePsbt(onePsbt)
+		if innererror.ErrNoError != errorCode {
+			resultMsg.Errno = errorCode.Value()
+			resultMsg.Errmsg = errorInfo
+			c.JSON(http.StatusOK, resultMsg)
+			return
+		}
+		allPacket = append(allPacket, packet)
+	}
+
+	packet, err := psbt.Combine(allPacket)
+	if nil != err {
+		var errorCode innererror.ErrCode = innererror.ErrInvalidParaError
+		resultMsg.Errno = errorCode.Value()
+		resultMsg.Errmsg = errorCode.ErrorInfo() + ": " + err.Error()
+		c.JSON(http.StatusOK, resultMsg)
+		return
+	}
+	resultMsg.Data.Psbt = packet.B64Encode()
+	resultMsg.Data.Complete = packet.IsComplete()
+
+	log.Log.Info("combinePsbt result:", resultMsg)
+
+	c.JSON(http.StatusOK, resultMsg)
+}
+
+// finalizeRequestPsbt binds the request and finalizes its psbt, the error code is ErrNoError when the psbt could
+// be decoded, finalizeErr is the reason it is not complete
+func finalizeRequestPsbt(c *gin.Context) (innererror.ErrCode, string, *psbt.Packet, error) {
+	type request struct {
+		Psbt string `json:"psbt"`
+	}
+	var oneRequest request
+	if err := c.BindJSON(&oneRequest); nil != err {
+		var errorCode innererror.ErrCode = innererror.ErrDecodeError
+		return errorCode, errorCode.ErrorInfo(), nil, nil
+	}
+
+	errorCode, errorInfo, packet := parsePsbt(oneRequest.Psbt)
+	if innererror.ErrNoError != errorCode {
+		return errorCode, errorInfo, nil, nil
+	}
+
+	errorCode, allPrevOut := queryPrevOuts(packet)
+	if innererror.ErrNoError != errorCode {
+		return errorCode, errorCode.ErrorInfo(), nil, nil
+	}
+
+	return innererror.ErrNoError, "", packet, finalizePsbt(packet, allPrevOut)
+}
+
+func finalizePsbtTransaction(c *gin.Context) {
+	type data struct {
+		Psbt     string `json:"psbt"`
+		Complete bool   `json:"complete"`
+		Hex      string `json:"hex,omitempty"`
+		Reason   string `json:"reason,omitempty"`
+	}
+
+	type msg struct {
+		Errno  int    `json:"errno"`
+		Errmsg string `json:"errmsg"`
+		Data   data   `json:"data"`
+	}
+
+	var noError innererror.ErrCode = innererror.ErrNoError
+	resultMsg := msg{
+		Errno:  noError.Value(),
+		Errmsg: noError.ErrorInfo(),
+	}
+
+	errorCode, errorInfo, packet, finalizeErr := finalizeRequestPsbt(c)
+	if innererror.ErrNoError != errorCode {
+		resultMsg.Errno = errorCode.Value()
+		resultMsg.Errmsg = errorInfo
+		c.JSON(http.StatusOK, resultMsg)
+		return
+	}
+
+	// a psbt not complete is returned with the inputs finalized so far
+	resultMsg.Data.Psbt = packet.B64Encode()
+	resultMsg.Data.Complete = packet.IsComplete()
+	if nil != finalizeErr {
+		resultMsg.Data.Reason = finalizeErr.Error()
+	}
+	if resultMsg.Data.Complete {
+		tx, err := packet.Extract()
+		if nil != err {
+			var errorCode innererror.ErrCode = innererror.ErrInvalidParaError
+			resultMsg.Errno = errorCode.Value()
+			resultMsg.Errmsg = errorCode.ErrorInfo() + ": " + err.Error()
+			c.JSON(http.StatusOK, resultMsg)
+			return
+		}
+		resultMsg.Data.Hex = hex.EncodeToString(tx.Serialize())
+	}
+
+	log.Log.Info("finalizePsbtTransaction result:", resultMsg)
+
+	c.JSON(http.StatusOK, resultMsg)
+}
+
+func broadcastPsbt(c *gin.Context) {
+	type data struct {
+		Txid        string `json:"txid"`
+		Receivetime string `json:"receivetime"`
+	}
+
+	type msg struct {
+		Errno  int    `json:"errno"`
+		Errmsg string `json:"errmsg"`
+		Data   data   `json:"data"`
+	}
+
+	var noError innererror.ErrCode = innererror.ErrNoError
+	resultMsg := msg{
+		Errno:  noError.Value(),
+		Errmsg: noError.ErrorInfo(),
+	}
+
+	errorCode, errorInfo, packet, finalizeErr := finalizeRequestPsbt(c)
+	if innererror.ErrNoError != errorCode {
+		resultMsg.Errno = errorCode.Value()
+		resultMsg.Errmsg = errorInfo
+		c.JSON(http.StatusOK, resultMsg)
+		return
+	}
+	if nil != finalizeErr {
+		var errorCode innererror.ErrCode = innererror.ErrInvalidParaError
+		resultMsg.Errno = errorCode.Value()
+		resultMsg.Errmsg = errorCode.ErrorInfo() + ": " + finalizeErr.Error()
+		c.JSON(http.StatusOK, resultMsg)
+		return
+	}
+
+	tx, err := packet.Extract()
+	if nil != err {
+		var errorCode innererror.ErrCode = innererror.ErrInvalidParaError
+		resultMsg.Errno = errorCode.Value()
+		resultMsg.Errmsg = errorCode.ErrorInfo() + ": " + err.Error()
+		c.JSON(http.StatusOK, resultMsg)
+		return
+	}
+
+	log.Log.Info("broadcastPsbt transaction:", tx.TxHash())
+
+	// same path as send raw transaction
+	errno, errmsg, txid, receiveTime := broadcastRawTransaction(hex.EncodeToString(tx.Serialize()))
+	resultMsg.Data.Txid = txid
+	if noError.Value() != errno {
+		resultMsg.Errno = errno
+		resultMsg.Errmsg = errmsg
+		c.JSON(http.StatusOK, resultMsg)
+		return
+	}
+	resultMsg.Data.Receivetime = time.Unix(receiveTime, 0).UTC().Format("2006-01-02T15:04:05.999999-0700")
+
+	log.Log.Info("broadcastPsbt result:", resultMsg)
+
+	c.JSON(http.StatusOK, resultMsg)
+}
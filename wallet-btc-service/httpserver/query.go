@@ -0,0 +1,231 @@
+package httpserver
+
+import (
+	"fmt"
+
+	"github.com/BlockABC/wallet-btc-service/common/log"
+	"github.com/BlockABC/wallet-btc-service/database"
+	"github.com/BlockABC/wallet-btc-service/database/tables"
+	"github.com/BlockABC/wallet-btc-service/innererror"
+	"github.com/BlockABC/wallet-btc-service/notify"
+	"github.com/BlockABC/wallet-btc-service/price"
+)
+
+// address unspent output
+type unspent struct {
+	Address    string `json:"address"`
+	Txid       string `json:"txid"`
+	Vout_index int64  `json:"vout_index"`
+	Value      string `json:"value"`
+}
+
+// joinSqlString returns the strings as a sql in list
+func joinSqlString(values []string) string {
+	var result string
+	for index, oneValue := range values {
+		if 0 == index {
+			result += `'` + oneValue + `'`
+		} else {
+			result += `,'` + oneValue + `'`
+		}
+	}
+	return result
+}
+
+// queryPrice returns the last known usd price of the coin with its age in seconds and if it is stale,
+// the age is -1 when no price is known yet
+func queryPrice(id string) (float64, int64, bool) {
+	err, onePrice := price.GetPrice(id)
+	if nil != err {
+		log.Log.Error(err, " get price fail, coin: ", id)
+		return 0, -1, true
+	}
+	return onePrice.Usd, onePrice.Age(), onePrice.Stale()
+}
+
+// queryAddressUsed returns if every address ever received an output, confirmed or not
+func queryAddressUsed(addresses []string) (innererror.ErrCode, map[string]bool) {
+	addressUsed := make(map[string]bool)
+	for _, oneAddress := range addresses {
+		addressUsed[oneAddress] = false
+	}
+	if 0 == len(addresses) {
+		return innererror.ErrNoError, addressUsed
+	}
+
+	var outputAddress []tables.TableOutputAddressInfo
+	selectSql := fmt.Sprintf("select distinct address from t_output_address_info where address in (%s);", joinSqlString(addresses))
+	if err := database.Db.Raw(selectSql).Scan(&outputAddress).Error; nil != err {
+		log.Log.Error(err, " exec sql fail: ", selectSql)
+		return innererror.ErrSQLError, nil
+	}
+	for _, oneOutput := range outputAddress {
+		addressUsed[oneOutput.Address] = true
+	}
+
+	err, unfmdUsed := notify.GetRedisUsedInfoByAddress(addresses)
+	if nil != err {
+		log.Log.Error(err, " GetRedisUsedInfoByAddress fail")
+		return innererror.ErrUnknown, nil
+	}
+
+	for unfmdAddress, bUsed := range unfmdUsed {
+		if bUsed {
+			addressUsed[unfmdAddress] = bUsed
+		}
+	}
+
+	return innererror.ErrNoError, addressUsed
+}
+
+// queryAddressStat returns the confirmed balance and statistics of the addresses, addresses never confirmed are missing
+func queryAddressStat(addresses []string) (innererror.ErrCode, map[string]tables.TableAddressBalanceInfo) {
+	err, result := notify.GetAddressBalance(addresses)
+	if nil != err {
+		log.Log.Error(err, " GetAddressBalance fail")
+		return innererror.ErrSQLError, nil
+	}
+
+	return innererror.ErrNoError, result
+}
+
+// queryAddressBalance returns the confirmed and unconfirmed balance of the addresses, confirmed outputs
+// spent by unconfirmed transactions are not counted
+func queryAddressBalance(addresses []string) (innererror.ErrCode, map[string]int64) {
+	result := make(map[string]int64)
+	if 0 == len(addresses) {
+		return innererror.ErrNoError, result
+	}
+
+	errorCode, allStat := queryAddressStat(addresses)
+	if innererror.ErrNoError != errorCode {
+		return errorCode, nil
+	}
+	for oneAddress, oneStat := range allStat {
+		result[oneAddress] = oneStat.Balance
+	}
+
+	// spent by unconfirmed transaction
+	err, unfmdSpent := notify.GetRedisUnconfirmedSpentByAddress(addresses)
+	if nil != err {
+		log.Log.Error(err, " GetRedisUnconfirmedSpentByAddress fail")
+		return innererror.ErrUnknown, nil
+	}
+	for oneUnfmdAddress, oneUnfmdSpent := range unfmdSpent {
+		result[oneUnfmdAddress] -= oneUnfmdSpent
+	}
+
+	// unconfirmed balance
+	err, unfmdBalance := notify.GetRedisUnconfirmedTransactionBalanceByAddress(addresses)
+	if nil != err {
+		log.Log.Error(err, " GetRedisUnconfirmedTransactionBalanceByAddress fail")
+		return innererror.ErrUnknown, nil
+	}
+	for oneUnfmdAddress, oneUnfmdBalance := range unfmdBalance {
+		result[oneUnfmdAddress] += oneUnfmdBalance
+	}
+
+	return innererror.ErrNoError, result
+}
+
+// queryAddressTransactions returns one page of transactions, unconfirmed first and then confirmed by height
+func queryAddressTransactions(addresses []string, page int, size int) (innererror.ErrCode, []transactionInfo) {
+	if page <= 0 {
+		log.Log.Error(fmt.Sprintf("page number %d, size %d out of range", page, size))
+		return innererror.ErrOutOfRangeError, nil
+	}
+
+	errorCode, list, _ := queryAddressHistory(addresses, &historyFilter{}, "", page, size)
+	return errorCode, list
+}
+
+// queryTransactionInfo returns the confirmed transactions in the order of txIds
+func queryTransactionInfo(txIds []string) (innererror.ErrCode, []transactionInfo) {
+	list := []transactionInfo{}
+	if 0 == len(txIds) {
+		return innererror.ErrNoError, list
+	}
+
+	strTxIds := joinSqlString(txIds)
+
+	var pageTransaction []tables.TableTransactionInfo
+	txSelectSql := fmt.Sprintf("select * from t_transaction_info where txid in (%s) and isfork=0;", strTxIds)
+	log.Log.Info("queryTransactionInfo select transaction sql:", txSelectSql)
+	if err := database.Db.Raw(txSelectSql).Scan(&pageTransaction).Error; nil != err {
+		log.Log.Error(err, " exec sql fail: ", txSelectSql)
+		return innererror.ErrSQLError, nil
+	}
+
+	var pageInput []tables.TableInputInfo
+	inputSelectSql := fmt.Sprintf("select * from t_input_info where hash in (%s) and isfork=0;", strTxIds)
+	log.Log.Info("queryTransactionInfo select transaction input sql:", inputSelectSql)
+	if err := database.Db.Raw(inputSelectSql).Scan(&pageInput).Error; nil != err {
+		log.Log.Error(err, " exec sql fail: ", inputSelectSql)
+		return innererror.ErrSQLError, nil
+	}
+
+	var pageOutput []tables.TableOutputInfo
+	outputSelectSql := fmt.Sprintf("select * from t_output_info where hash in (%s) and isfork=0;", strTxIds)
+	log.Log.Info("queryTransactionInfo select transaction output sql:", outputSelectSql)
+	if err := database.Db.Raw(outputSelectSql).Scan(&pageOutput).Error; nil != err {
+		log.Log.Error(err, " exec sql fail: ", outputSelectSql)
+		return innererror.ErrSQLError, nil
+	}
+
+	allTransactionInfo := convertToTransactionInfo(pageTransaction, pageInput, pageOutput)
+
+	for _, onrTxid := range txIds {
+		for _, oneTrx := range allTransactionInfo {
+			if onrTxid == oneTrx.Txid {
+				list = append(list, oneTrx)
+			}
+		}
+	}
+
+	return innererror.ErrNoError, list
+}
+
+// queryAddressUnspents returns the confirmed and unconfirmed unspent outputs of the addresses
+func queryAddressUnspents(addresses []string) (innererror.ErrCode, []unspent) {
+	result := []unspent{}
+	if 0 == len(addresses) {
+		return innererror.ErrNoError, result
+	}
+
+	// get unspent
+	type unspentTable struct {
+		Address    string
+		Txid       string
+		Vout_index int64
+		Value_int  int64
+	}
+	unspentsTable := []unspentTable{}
+	unspentSql := fmt.Sprintf("select `to` as address, hash as txid, n as vout_index, value as value_int from t_output_info where `to` in(%s) and state = 0 and isfork = 0;", joinSqlString(addresses))
+	log.Log.Info("queryAddressUnspents select unspent sql:", unspentSql)
+	if err := database.Db.Raw(unspentSql).Scan(&unspentsTable).Error; nil != err {
+		log.Log.Error(err, " exec sql fail: ", unspentSql)
+		return innererror.ErrSQLError, nil
+	}
+
+	err, unfmdUnspents := notify.GetRedisUnconfirmedTransactionUnspentByAddress(addresses)
+	if nil != err {
+		log.Log.Error(err, " GetRedisUnconfirmedTransactionUnspentByAddress fail")
+		return innererror.ErrUnknown, nil
+	}
+
+	// all unspent
+	for _, oneUnfmd := range unfmdUnspents {
+		unspentsTable = append(unspentsTable, unspentTable{oneUnfmd.Address, oneUnfmd.Txid, oneUnfmd.N, oneUnfmd.Value})
+	}
+
+	for _, oneTable := range unspentsTable {
+		result = append(result, unspent{
+			Address:    oneTable.Address,
+			Txid:       oneTable.Txid,
+			Vout_index: oneTable.Vout_index,
+			Value:      fmt.Sprintf("%d", oneTable.Value_int),
+		})
+	}
+
+	return innererror.ErrNoError, result
+}
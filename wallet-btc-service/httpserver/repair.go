@@ -0,0 +1,140 @@
+package httpserver
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/BlockABC/wallet-btc-service/common/log"
+	"github.com/BlockABC/wallet-btc-service/database/tables"
+	"github.com/BlockABC/wallet-btc-service/innererror"
+	"github.com/BlockABC/wallet-btc-service/repairqueue"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	DEFAULTREPAIRJOBSIZE = 100
+	MAXREPAIRJOBSIZE     = 1000
+)
+
+// jobs to retry or purge, every dead job of the type if ids is empty, of all types if type is empty too
+type repairJobRequest struct {
+	Type string  `json:"type"`
+	Ids  []int64 `json:"ids"`
+}
+
+func getRepairJobs(c *gin.Context) {
+	type data struct {
+		Total int64                       `json:"total"`
+		Jobs  []tables.TableRepairJobInfo `json:"jobs"`
+	}
+
+	type msg struct {
+		Errno  int    `json:"errno"`
+		Errmsg string `json:"errmsg"`
+		Data   data   `json:"data"`
+	}
+
+	var noError innererror.ErrCode = innererror.ErrNoError
+	resultMsg := msg{
+		Errno:  noError.Value(),
+		Errmsg: noError.ErrorInfo(),
+		Data:   data{Jobs: []tables.TableRepairJobInfo{}},
+	}
+
+	// job type, all types if empty, state and page
+	jobType := c.Query("type")
+	state, stateErr := strconv.Atoi(c.DefaultQuery("state", strconv.Itoa(repairqueue.JOBPENDING)))
+	page, pageErr := strconv.Atoi(c.DefaultQuery("page", "0"))
+	size, sizeErr := strconv.Atoi(c.DefaultQuery("size", strconv.Itoa(DEFAULTREPAIRJOBSIZE)))
+	if nil != stateErr || nil != pageErr || nil != sizeErr || (repairqueue.JOBPENDING != state && repairqueue.JOBDEAD != state) ||
+		page < 0 || size <= 0 || size > MAXREPAIRJOBSIZE || ("" != jobType && !repairqueue.ALLJOBTYPE[jobType]) {
+		var errorCode innererror.ErrCode = innererror.ErrInvalidParaError
+		resultMsg.Errno = errorCode.Value()
+		resultMsg.Errmsg = errorCode.ErrorInfo()
+		c.JSON(http.StatusOK, resultMsg)
+		return
+	}
+
+	err, total := repairqueue.Count(jobType, state)
+	if nil != err {
+		var errorCode innererror.ErrCode = innererror.ErrSQLError
+		resultMsg.Errno = errorCode.Value()
+		resultMsg.Errmsg = errorCode.ErrorInfo()
+		c.JSON(http.StatusOK, resultMsg)
+		return
+	}
+	err, allJob := repairqueue.List(jobType, state, page, size)
+	if nil != err {
+		var errorCode innererror.ErrCode = innererror.ErrSQLError
+		resultMsg.Errno = errorCode.Value()
+		resultMsg.Errmsg = errorCode.ErrorInfo()
+		c.JSON(http.StatusOK, resultMsg)
+		return
+	}
+
+	resultMsg.Data.Total = total
+	if nil != allJob {
+		resultMsg.Data.Jobs = allJob
+	}
+	c.JSON(http.StatusOK, resultMsg)
+}
+
+func retryRepairJobs(c *gin.Context) {
+	handleRepairJobs(c, "retry", repairqueue.Retry)
+}
+
+func purgeRepairJobs(c *gin.Context) {
+	handleRepairJobs(c, "purge", repairqueue.Purge)
+}
+
+// handleRepairJobs retries or purges the jobs of the request and replies how many jobs changed
+func handleRepairJobs(c *gin.Context, action string, handle func(string, []int64) (error, int64)) {
+	type data struct {
+		Count int64 `json:"count"`
+	}
+
+	type msg struct {
+		Errno  int    `json:"errno"`
+		Errmsg string `json:"errmsg"`
+		Data   data   `json:"data"`
+	}
+
+	var noError innererror.ErrCode = innererror.ErrNoError
+	resultMsg := msg{
+		Errno:  noError.Value(),
+		Errmsg: noError.ErrorInfo(),
+	}
+
+	var oneRequest repairJobRequest
+	if err := c.BindJSON(&oneRequest); nil != err {
+		var errorCode innererror.ErrCode = innererror.ErrDecodeError
+		resultMsg.Errno = errorCode.Value()
+		resultMsg.Errmsg = errorCode.ErrorInfo()
+		c.JSON(http.StatusOK, resultMsg)
+		return
+	}
+	if len(oneRequest.Ids) > MAXREPAIRJOBSIZE {
+		var errorCode innererror.ErrCode = innererror.ErrInvalidParaError
+		resultMsg.Errno = errorCode.Value()
+		resultMsg.Errmsg = errorCode.ErrorInfo()
+		c.JSON(http.StatusOK, resultMsg)
+		return
+	}
+
+	err, count := handle(oneRequest.Type, oneRequest.Ids)
+	if nil != err {
+		var errorCode innererror.ErrCode = innererror.ErrSQLError
+		if repairqueue.ErrInvalidJobType == err {
+			errorCode = innererror.ErrInvalidParaError
+		}
+		resultMsg.Errno = errorCode.Value()
+		resultMsg.Errmsg = errorCode.ErrorInfo() + ": " + err.Error()
+		c.JSON(http.StatusOK, resultMsg)
+		return
+	}
+
+	log.Log.Notice(action, " repair jobs, job type: ", oneRequest.Type, ", job ids: ", oneRequest.Ids, ", count: ", count)
+
+	resultMsg.Data.Count = count
+	c.JSON(http.StatusOK, resultMsg)
+}
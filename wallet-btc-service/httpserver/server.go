@@ -4,18 +4,23 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"math"
 	"net/http"
 	"time"
 
 	"github.com/BlockABC/wallet-btc-service/common/config"
 	"github.com/BlockABC/wallet-btc-service/common/log"
+	"github.com/BlockABC/wallet-btc-service/common/utility"
 	"github.com/BlockABC/wallet-btc-service/database"
 	"github.com/BlockABC/wallet-btc-service/database/tables"
+	"github.com/BlockABC/wallet-btc-service/fee"
+	"github.com/BlockABC/wallet-btc-service/health"
 	"github.com/BlockABC/wallet-btc-service/innererror"
 	"github.com/BlockABC/wallet-btc-service/jsonrpc"
+	"github.com/BlockABC/wallet-btc-service/metrics"
 	"github.com/BlockABC/wallet-btc-service/notify"
 	"github.com/BlockABC/wallet-btc-service/omni"
-	"github.com/BlockABC/wallet-btc-service/request"
+	"github.com/BlockABC/wallet-btc-service/price"
 	"github.com/gin-gonic/gin"
 )
 
@@ -23,8 +28,33 @@ func StartHttpServer(cfg *config.Config, ctx context.Context) (err error) {
 	//get router instance
 	router := gin.Default()
 
+	// latency of every request, also of the ones refused before their handler
+	router.Use(metrics.Http(router))
+
 	router.Use(cors())
 
+	// api key, quotas and rate limits
+	router.Use(auth())
+
+	// handle prometheus scrape, served without api key
+	router.GET(METRICSPATH, metrics.Handler())
+
+	// handle health and readiness checks, served without api key
+	router.GET(health.HEALTHPATH, health.Healthz)
+	router.GET(health.READYPATH, health.Readyz)
+
+	// handle api key management
+	admin := router.Group("/admin", adminAuth())
+	admin.GET("/keys", getApiKeys)
+	admin.POST("/keys/create", createApiKey)
+	admin.POST("/keys/update", updateApiKey)
+	admin.POST("/keys/delete", deleteApiKey)
+
+	// handle repair job management
+	admin.GET("/repair/jobs", getRepairJobs)
+	admin.POST("/repair/retry", retryRepairJobs)
+	admin.POST("/repair/purge", purgeRepairJobs)
+
 	// handle get address info
 	router.POST("/address", getAddressInfo)
 
@@ -40,6 +70,26 @@ func StartHttpServer(cfg *config.Config, ctx context.Context) (err error) {
 	// handle send raw transaction
 	router.POST("/send_raw_transaction", sendRawTransaction)
 
+	// handle build unsigned transaction
+	router.POST("/transaction/build", buildTransaction)
+
+	// handle psbt
+	router.POST("/psbt/decode", decodePsbt)
+	router.POST("/psbt/combine", combinePsbt)
+	router.POST("/psbt/finalize", finalizePsbtTransaction)
+	router.POST("/psbt/broadcast", broadcastPsbt)
+
+	// handle webhook
+	router.POST("/webhook/register", registerWebhook)
+	router.POST("/webhook/watch", watchWebhook)
+	router.GET("/webhook/list", getWebhooks)
+	router.POST("/webhook/delete", deleteWebhook)
+	router.GET("/webhook/deliveries", getWebhookDeliveries)
+	router.POST("/webhook/replay", replayWebhookDeliveries)
+
+	// handle streaming of blocks, mempool transactions and address activity
+	router.GET(STREAMPATH, streamEvents)
+
 	// handle get recommended fee rates
 	router.GET("/recommended_fee_rates", getFeeRate)
 
@@ -52,28 +102,59 @@ func StartHttpServer(cfg *config.Config, ctx context.Context) (err error) {
 	// handle get transaction info
 	router.GET("/usdt/:txid", getUsdtTransaction)
 
+	// handle get extended public key balance and next addresses
+	router.POST("/xpub", getXpubInfo)
+
+	// handle get extended public key transactions
+	router.POST("/xpub/transactions", getXpubTransactions)
+
+	// handle get extended public key unspent output
+	router.POST("/xpub/unspents", getXpubUnspents)
+
+	// handle get output descriptor balance and next addresses
+	router.POST("/descriptor", getDescriptorInfo)
+
+	// handle get output descriptor transactions
+	router.POST("/descriptor/transactions", getDescriptorTransactions)
+
+	// handle get output descriptor unspent output
+	router.POST("/descriptor/unspents", getDescriptorUnspents)
+
+	// handle get last known coin price
+	router.GET("/price", getPrice)
+
+	// handle get coin price history
+	router.GET("/price/history", getPriceHistory)
+
 	// listen and server
-	http.ListenAndServe(cfg.BtcOpt.ApiServerAddress, router)
-	return nil
+	return utility.ListenAndServe(ctx, cfg.BtcOpt.ApiServerAddress, router, time.Duration(cfg.BtcOpt.ShutdownTimeout)*time.Second)
 }
 
 func getAddressInfo(c *gin.Context) {
 	type info struct {
-		Address string `json:"address"`
-		Tx_used bool   `json:"tx_used"`
-		Balance string `json:"balance"`
+		Address      string `json:"address"`
+		Tx_used      bool   `json:"tx_used"`
+		Balance      string `json:"balance"`
+		Received     string `json:"received"`
+		Sent         string `json:"sent"`
+		Tx_count     int64  `json:"tx_count"`
+		First_height int32  `json:"first_height"`
+		Last_height  int32  `json:"last_height"`
 	}
 
 	type data struct {
-		Decimals  int     `json:"decimals"`
-		Usd_price float64 `json:"usd_price"`
-		Info      []info  `json:"info"`
+		Decimals    int     `json:"decimals"`
+		Usd_price   float64 `json:"usd_price"`
+		Price_age   int64   `json:"price_age"`
+		Price_stale bool    `json:"price_stale"`
+		Info        []info  `json:"info"`
 	}
 
 	type msg struct {
-		Errno  int    `json:"errno"`
-		Errmsg string `json:"errmsg"`
-		Data   data   `json:"data"`
+		Errno   int              `json:"errno"`
+		Errmsg  string           `json:"errmsg"`
+		Data    data             `json:"data"`
+		Invalid []invalidAddress `json:"invalid,omitempty"`
 	}
 
 	var noError innererror.ErrCode = innererror.ErrNoError
@@ -93,25 +174,9 @@ func getAddressInfo(c *gin.Context) {
 		return
 	}
 
-	// real address
-	addressReal := make([]string, 0)
-	for _, oneAddress := range addressBatch {
-		if !IsValidAddress(oneAddress) {
-			continue
-		}
-
-		bExist := false
-		for _, oneReal := range addressReal {
-			if oneAddress == oneReal {
-				bExist = true
-				break
-			}
-		}
-
-		if !bExist {
-			addressReal = append(addressReal, oneAddress)
-		}
-	}
+	// real address, invalid ones are reported with the reason
+	addressReal, addressInvalid := filterAddress(addressBatch)
+	resultMsg.Invalid = addressInvalid
 
 	// parameter invalid
 	if 0 == len(addressReal) {
@@ -124,127 +189,62 @@ func getAddressInfo(c *gin.Context) {
 
 	log.Log.Info("getAddressInfo parameter address:", addressReal)
 
-	// get count
-	addressUsed := make(map[string]bool)
-	for _, oneAddress := range addressReal {
-		var outputAddress []tables.TableOutputAddressInfo
-		if err := database.Db.Where("address = ?", oneAddress).Limit(1).Find(&outputAddress).Error; nil != err {
-			log.Log.Error(err, "  select * from t_output_address_info fail")
-			var errorCode innererror.ErrCode = innererror.ErrSQLError
-			resultMsg.Errno = errorCode.Value()
-			resultMsg.Errmsg = errorCode.ErrorInfo()
-			c.JSON(http.StatusOK, resultMsg)
-			return
-		}
-		if 0 != len(outputAddress) {
-			addressUsed[oneAddress] = true
-		} else {
-			addressUsed[oneAddress] = false
-		}
-	}
-
-	err, unfmdUsed := notify.GetRedisUsedInfoByAddress(addressReal)
-	if nil != err {
-		log.Log.Error(err, " GetRedisUsedInfoByAddress fail")
-		var errorCode innererror.ErrCode = innererror.ErrUnknown
+	// used
+	errorCode, addressUsed := queryAddressUsed(addressReal)
+	if innererror.ErrNoError != errorCode {
 		resultMsg.Errno = errorCode.Value()
 		resultMsg.Errmsg = errorCode.ErrorInfo()
 		c.JSON(http.StatusOK, resultMsg)
 		return
 	}
 
-	for unfmdAddress, unfmdUsed := range unfmdUsed {
-		if unfmdUsed {
-			addressUsed[unfmdAddress] = unfmdUsed
-		}
-	}
-
 	// balance
-	address := ""
-	bFirst := true
+	addressUsedReal := make([]string, 0)
 	for oneAddress, bUsed := range addressUsed {
 		if bUsed {
-			if bFirst {
-				address += "'" + oneAddress + "'"
-				bFirst = false
-			} else {
-				address += ",'" + oneAddress + "'"
-			}
+			addressUsedReal = append(addressUsedReal, oneAddress)
 		}
 	}
-	type OneBalance struct {
-		Balance int64
-		Address string
-	}
-	balance := make([]OneBalance, 0)
-	if "" != address {
-		selectBalanceSql := fmt.Sprintf("select sum(value) as balance, `to` as address from t_output_info  where `to` in (%s) and state=0 group by `to`", address)
-		log.Log.Info("getAddressInfo select balance sql:", selectBalanceSql)
-		if err := database.Db.Raw(selectBalanceSql).Scan(&balance).Error; nil != err {
-			log.Log.Error(err, " exec sql fail: ", selectBalanceSql)
-			var errorCode innererror.ErrCode = innererror.ErrSQLError
-			resultMsg.Errno = errorCode.Value()
-			resultMsg.Errmsg = errorCode.ErrorInfo()
-			c.JSON(http.StatusOK, resultMsg)
-			return
-		}
-	}
-
-	// unconfirmed balance
-	err, unfmdBalance := notify.GetRedisUnconfirmedTransactionBalanceByAddress(addressReal)
-	if nil != err {
-		log.Log.Error(err, " GetRedisUnconfirmedTransactionBalanceByAddress fail")
-		var errorCode innererror.ErrCode = innererror.ErrUnknown
+	errorCode, balance := queryAddressBalance(addressUsedReal)
+	if innererror.ErrNoError != errorCode {
 		resultMsg.Errno = errorCode.Value()
 		resultMsg.Errmsg = errorCode.ErrorInfo()
 		c.JSON(http.StatusOK, resultMsg)
 		return
 	}
 
-	for oneUnfmdAddress, oneUnfmdBalance := range unfmdBalance {
-		bFind := false
-		for index, oneBalance := range balance {
-			if oneUnfmdAddress == oneBalance.Address {
-				balance[index].Balance += oneUnfmdBalance
-				bFind = true
-				break
-			}
-		}
-
-		if !bFind {
-			balance = append(balance, OneBalance{oneUnfmdBalance, oneUnfmdAddress})
-		}
-	}
-
-	// price
-	ids := []string{"bitcoin"}
-	err, resultPrice := request.GetPrice(ids)
-	if nil != err {
-		var errorCode innererror.ErrCode = innererror.ErrRPCCallError
+	// confirmed statistics
+	errorCode, stat := queryAddressStat(addressUsedReal)
+	if innererror.ErrNoError != errorCode {
 		resultMsg.Errno = errorCode.Value()
 		resultMsg.Errmsg = errorCode.ErrorInfo()
 		c.JSON(http.StatusOK, resultMsg)
 		return
 	}
-	price := resultPrice["bitcoin"]
-	resultMsg.Data.Usd_price = price
+
+	// price, the last known one
+	resultMsg.Data.Usd_price, resultMsg.Data.Price_age, resultMsg.Data.Price_stale = queryPrice(price.BITCOIN)
 	resultMsg.Data.Decimals = 8
 
 	// result
 	for oneAddress, bUsed := range addressUsed {
 		oneData := info{
-			Address: oneAddress,
-			Tx_used: bUsed,
-			Balance: "0",
+			Address:  oneAddress,
+			Tx_used:  bUsed,
+			Balance:  "0",
+			Received: "0",
+			Sent:     "0",
 		}
 
 		if bUsed {
-			for _, oneBalance := range balance {
-				if oneAddress == oneBalance.Address {
-					oneData.Balance = fmt.Sprintf("%d", oneBalance.Balance)
-					break
-				}
-			}
+			oneData.Balance = fmt.Sprintf("%d", balance[oneAddress])
+		}
+		if oneStat, ok := stat[oneAddress]; ok {
+			oneData.Received = fmt.Sprintf("%d", oneStat.Received)
+			oneData.Sent = fmt.Sprintf("%d", oneStat.Sent)
+			oneData.Tx_count = oneStat.Txcount
+			oneData.First_height = oneStat.Firstheight
+			oneData.Last_height = oneStat.Lastheight
 		}
 		resultMsg.Data.Info = append(resultMsg.Data.Info, oneData)
 	}
@@ -258,8 +258,10 @@ func getAddressInfo(c *gin.Context) {
 func getAddressTransactions(c *gin.Context) {
 	// message type
 	type pagination struct {
-		Size int `json:"size"`
-		Page int `json:"page"`
+		Size        int    `json:"size"`
+		Page        int    `json:"page"`
+		Cursor      string `json:"cursor"`
+		Next_cursor string `json:"next_cursor"`
 	}
 
 	type data struct {
@@ -268,9 +270,10 @@ func getAddressTransactions(c *gin.Context) {
 	}
 
 	type msg struct {
-		Errno  int    `json:"errno"`
-		Errmsg string `json:"errmsg"`
-		Data   data   `json:"data"`
+		Errno   int              `json:"errno"`
+		Errmsg  string           `json:"errmsg"`
+		Data    data             `json:"data"`
+		Invalid []invalidAddress `json:"invalid,omitempty"`
 	}
 
 	// init message
@@ -285,7 +288,9 @@ func getAddressTransactions(c *gin.Context) {
 	type request struct {
 		Size      int
 		Page      int
+		Cursor    string
 		Addresses []string
+		historyFilter
 	}
 
 	var oneRequest request
@@ -297,25 +302,9 @@ func getAddressTransactions(c *gin.Context) {
 		return
 	}
 
-	// real address
-	addressReal := make([]string, 0)
-	for _, oneAddress := range oneRequest.Addresses {
-		if !IsValidAddress(oneAddress) {
-			continue
-		}
-
-		bExist := false
-		for _, oneReal := range addressReal {
-			if oneAddress == oneReal {
-				bExist = true
-				break
-			}
-		}
-
-		if !bExist {
-			addressReal = append(addressReal, oneAddress)
-		}
-	}
+	// real address, invalid ones are reported with the reason
+	addressReal, addressInvalid := filterAddress(oneRequest.Addresses)
+	resultMsg.Invalid = addressInvalid
 
 	// parameter invalid
 	if 0 == len(addressReal) {
@@ -328,157 +317,23 @@ func getAddressTransactions(c *gin.Context) {
 
 	log.Log.Info("getAddressTransactions parameter address:", addressReal)
 
-	var address string
-	for index, oneAddress := range addressReal {
-		if 0 == index {
-			address += `'` + oneAddress + `'`
-		} else {
-			address += `,'` + oneAddress + `'`
-		}
-	}
-
-	// transaction count
-	type hashAndTime struct {
-		Txid   string
-		Txtime int64
-	}
-
-	// unconfirmed transaction count
-	err, unfmdTransaction := notify.GetRedisUnconfirmedTransactionByAddress(addressReal)
-	if nil != err {
-		log.Log.Error(err, " GetRedisUnconfirmedTransactionByAddress fail")
-		var errorCode innererror.ErrCode = innererror.ErrUnknown
-		resultMsg.Errno = errorCode.Value()
-		resultMsg.Errmsg = errorCode.ErrorInfo()
-		c.JSON(http.StatusOK, resultMsg)
-		return
-	}
-
 	// get transaction
-	pageInfo := pagination{
-		Size: oneRequest.Size,
-		Page: oneRequest.Page,
+	resultMsg.Data.Pagination = pagination{
+		Size:   oneRequest.Size,
+		Page:   oneRequest.Page,
+		Cursor: oneRequest.Cursor,
 	}
-	resultMsg.Data.Pagination = pageInfo
 
-	if oneRequest.Page <= 0 {
-		log.Log.Error(fmt.Sprintf("page number %d, size %d out of range", oneRequest.Page, oneRequest.Size))
-		var errorCode innererror.ErrCode = innererror.ErrOutOfRangeError
+	errorCode, list, nextCursor := queryAddressHistory(addressReal, &oneRequest.historyFilter, oneRequest.Cursor, oneRequest.Page, oneRequest.Size)
+	if innererror.ErrNoError != errorCode {
 		resultMsg.Errno = errorCode.Value()
 		resultMsg.Errmsg = errorCode.ErrorInfo()
 		c.JSON(http.StatusOK, resultMsg)
 		return
 	}
 
-	// all unconfirmed and confirmed transactions
-	txUnfmdRedisTrx := []notify.RedisTransaction{}
-	txIds := []string{}
-	begin := (oneRequest.Page - 1) * oneRequest.Size
-	end := oneRequest.Page * oneRequest.Size
-	limitBegin := 0
-	limitEnd := 0
-	if end <= len(unfmdTransaction) {
-		for i := begin; i < end; i++ {
-			txUnfmdRedisTrx = append(txUnfmdRedisTrx, unfmdTransaction[i])
-		}
-	} else if begin < len(unfmdTransaction) {
-		for i := begin; i < len(unfmdTransaction); i++ {
-			txUnfmdRedisTrx = append(txUnfmdRedisTrx, unfmdTransaction[i])
-		}
-		limitBegin = 0
-		limitEnd = oneRequest.Size - len(txUnfmdRedisTrx)
-	} else {
-		limitBegin = begin - len(unfmdTransaction)
-		limitEnd = oneRequest.Size
-	}
-
-	if 0 != limitEnd {
-		type transactionId struct {
-			Txid string
-		}
-		allTransactionId := []transactionId{}
-		txidSelectSql := fmt.Sprintf("select distinct txid from t_transaction_input_output_address_info where `address` in (%s) order by time desc limit %d, %d;", address, limitBegin, limitEnd)
-		log.Log.Info("getAddressTransactions select transaction id sql:", txidSelectSql)
-		if err := database.Db.Raw(txidSelectSql).Scan(&allTransactionId).Error; nil != err {
-			log.Log.Error(err, " exec sql fail: ", txidSelectSql)
-			var errorCode innererror.ErrCode = innererror.ErrSQLError
-			resultMsg.Errno = errorCode.Value()
-			resultMsg.Errmsg = errorCode.ErrorInfo()
-			c.JSON(http.StatusOK, resultMsg)
-			return
-		}
-		for _, oneTableTxid := range allTransactionId {
-			txIds = append(txIds, oneTableTxid.Txid)
-		}
-	}
-
-	// unconfirmed transaction
-	list := []transactionInfo{}
-	if 0 != len(txUnfmdRedisTrx) {
-		for _, oneRedis := range txUnfmdRedisTrx {
-			list = append(list, convertRedisTransactionToTransactionInfo(&oneRedis))
-		}
-	}
-
-	// transaction
-	if 0 != len(txIds) {
-		var strTxIds string
-		for index, oneTxId := range txIds {
-			if 0 == index {
-				strTxIds += "'" + oneTxId + "'"
-			} else {
-				strTxIds += ",'" + oneTxId + "'"
-			}
-		}
-
-		var pageTransaction []tables.TableTransactionInfo
-		txSelectSql := fmt.Sprintf("select * from t_transaction_info where txid in (%s);", strTxIds)
-		log.Log.Info("getAddressTransactions select transaction sql:", txSelectSql)
-		if err := database.Db.Raw(txSelectSql).Scan(&pageTransaction).Error; nil != err {
-			log.Log.Error(err, " exec sql fail: ", txSelectSql)
-			var errorCode innererror.ErrCode = innererror.ErrSQLError
-			resultMsg.Errno = errorCode.Value()
-			resultMsg.Errmsg = errorCode.ErrorInfo()
-			c.JSON(http.StatusOK, resultMsg)
-			return
-		}
-
-		var pageInput []tables.TableInputInfo
-		inputSelectSql := fmt.Sprintf("select * from t_input_info where hash in (%s);", strTxIds)
-		log.Log.Info("getAddressTransactions select transaction input sql:", inputSelectSql)
-		if err := database.Db.Raw(inputSelectSql).Scan(&pageInput).Error; nil != err {
-			log.Log.Error(err, " exec sql fail: ", inputSelectSql)
-			var errorCode innererror.ErrCode = innererror.ErrSQLError
-			resultMsg.Errno = errorCode.Value()
-			resultMsg.Errmsg = errorCode.ErrorInfo()
-			c.JSON(http.StatusOK, resultMsg)
-			return
-		}
-
-		var pageOutput []tables.TableOutputInfo
-		outputSelectSql := fmt.Sprintf("select * from t_output_info where hash in (%s);", strTxIds)
-		log.Log.Info("getAddressTransactions select transaction output sql:", outputSelectSql)
-		if err := database.Db.Raw(outputSelectSql).Scan(&pageOutput).Error; nil != err {
-			log.Log.Error(err, " exec sql fail: ", outputSelectSql)
-			var errorCode innererror.ErrCode = innererror.ErrSQLError
-			resultMsg.Errno = errorCode.Value()
-			resultMsg.Errmsg = errorCode.ErrorInfo()
-			c.JSON(http.StatusOK, resultMsg)
-			return
-		}
-
-		allTransactionInfo := convertToTransactionInfo(pageTransaction, pageInput, pageOutput)
-
-		for _, onrTxid := range txIds {
-			for _, oneTrx := range allTransactionInfo {
-				if onrTxid == oneTrx.Txid {
-					list = append(list, oneTrx)
-				}
-			}
-		}
-	}
-
 	resultMsg.Data.List = list
+	resultMsg.Data.Pagination.Next_cursor = nextCursor
 
 	log.Log.Info("getAddressTransactions result:", resultMsg)
 
@@ -541,6 +396,26 @@ func getTransaction(c *gin.Context) {
 		return
 	}
 
+	// evicted from mempool or double spent
+	err, bDropped, oneDropped := notify.GetDroppedTransaction(txid)
+	if nil != err {
+		log.Log.Error(err, " GetDroppedTransaction fail")
+		var errorCode innererror.ErrCode = innererror.ErrUnknown
+		resultMsg.Errno = errorCode.Value()
+		resultMsg.Errmsg = errorCode.ErrorInfo()
+		c.JSON(http.StatusOK, resultMsg)
+		return
+	}
+
+	if bDropped {
+		resultMsg.Data = convertRedisTransactionToTransactionInfo(&oneDropped.Transaction)
+		resultMsg.Data.Status = oneDropped.Status
+		resultMsg.Data.Replaced_by = oneDropped.ReplacedBy
+		log.Log.Info("getTransaction result:", resultMsg)
+		c.JSON(http.StatusOK, resultMsg)
+		return
+	}
+
 	var errorCode innererror.ErrCode = innererror.ErrInvalidParaError
 	resultMsg.Errno = errorCode.Value()
 	resultMsg.Errmsg = errorCode.ErrorInfo()
@@ -548,17 +423,11 @@ func getTransaction(c *gin.Context) {
 }
 
 func getUnspents(c *gin.Context) {
-	type unspent struct {
-		Address    string `json:"address"`
-		Txid       string `json:"txid"`
-		Vout_index int64  `json:"vout_index"`
-		Value      string `json:"value"`
-	}
-
 	type msg struct {
-		Errno  int       `json:"errno"`
-		Errmsg string    `json:"errmsg"`
-		Data   []unspent `json:"data"`
+		Errno   int              `json:"errno"`
+		Errmsg  string           `json:"errmsg"`
+		Data    []unspent        `json:"data"`
+		Invalid []invalidAddress `json:"invalid,omitempty"`
 	}
 
 	var noError innererror.ErrCode = innererror.ErrNoError
@@ -578,25 +447,9 @@ func getUnspents(c *gin.Context) {
 		return
 	}
 
-	// real address
-	addressReal := make([]string, 0)
-	for _, oneAddress := range addressBatch {
-		if !IsValidAddress(oneAddress) {
-			continue
-		}
-
-		bExist := false
-		for _, oneReal := range addressReal {
-			if oneAddress == oneReal {
-				bExist = true
-				break
-			}
-		}
-
-		if !bExist {
-			addressReal = append(addressReal, oneAddress)
-		}
-	}
+	// real address, invalid ones are reported with the reason
+	addressReal, addressInvalid := filterAddress(addressBatch)
+	resultMsg.Invalid = addressInvalid
 
 	// parameter invalid
 	if 0 == len(addressReal) {
@@ -609,59 +462,14 @@ func getUnspents(c *gin.Context) {
 
 	log.Log.Info("getUnspents parameter address:", addressReal)
 
-	var address string
-	for index, oneAddress := range addressReal {
-		if 0 == index {
-			address += `'` + oneAddress + `'`
-		} else {
-			address += `,'` + oneAddress + `'`
-		}
-	}
-
-	// get unspent
-	type unspentTable struct {
-		Address    string
-		Txid       string
-		Vout_index int64
-		Value_int  int64
-	}
-	unspentsTable := []unspentTable{}
-	unspentSql := fmt.Sprintf("select `to` as address, hash as txid, n as vout_index, value as value_int from t_output_info where `to` in(%s) and state = 0;", address)
-	log.Log.Info("getUnspents select unspent sql:", unspentSql)
-	if err := database.Db.Raw(unspentSql).Scan(&unspentsTable).Error; nil != err {
-		log.Log.Error(err, " exec sql fail: ", unspentSql)
-		var errorCode innererror.ErrCode = innererror.ErrSQLError
-		resultMsg.Errno = errorCode.Value()
-		resultMsg.Errmsg = errorCode.ErrorInfo()
-		c.JSON(http.StatusOK, resultMsg)
-		return
-	}
-
-	err, unfmdUnspents := notify.GetRedisUnconfirmedTransactionUnspentByAddress(addressReal)
-	if nil != err {
-		log.Log.Error(err, " GetRedisUnconfirmedTransactionByTxid fail")
-		var errorCode innererror.ErrCode = innererror.ErrUnknown
+	errorCode, allUnspent := queryAddressUnspents(addressReal)
+	if innererror.ErrNoError != errorCode {
 		resultMsg.Errno = errorCode.Value()
 		resultMsg.Errmsg = errorCode.ErrorInfo()
 		c.JSON(http.StatusOK, resultMsg)
 		return
 	}
-
-	// all unspent
-	for _, oneUnfmd := range unfmdUnspents {
-		unspentsTable = append(unspentsTable, unspentTable{oneUnfmd.Address, oneUnfmd.Txid, oneUnfmd.N, oneUnfmd.Value})
-	}
-
-	// result
-	for _, oneTable := range unspentsTable {
-		oneUnspent := unspent{
-			Address:    oneTable.Address,
-			Txid:       oneTable.Txid,
-			Vout_index: oneTable.Vout_index,
-			Value:      fmt.Sprintf("%d", oneTable.Value_int),
-		}
-		resultMsg.Data = append(resultMsg.Data, oneUnspent)
-	}
+	resultMsg.Data = allUnspent
 
 	log.Log.Info("getUnspents result:", resultMsg)
 
@@ -702,57 +510,19 @@ func sendRawTransaction(c *gin.Context) {
 
 	log.Log.Info("sendRawTransaction parameter hex transaction info:", oneRequest)
 
-	// send raw transaction
-	result, err := jsonrpc.Call(1, "sendrawtransaction", []interface{}{oneRequest.Tx})
-	if nil != err {
-		type ResultErr struct {
-			Code    int
-			Message string
-		}
-		type resultRpcErr struct {
-			Result string
-			Error  ResultErr
-			Id     int
-		}
-		info := err.Error()
-		var resultInfo resultRpcErr
-		err = json.Unmarshal([]byte(info), &resultInfo)
-		if nil != err {
-			var errorCode innererror.ErrCode = innererror.ErrRPCCallError
-			resultMsg.Errno = errorCode.Value()
-			resultMsg.Errmsg = errorCode.ErrorInfo()
-			c.JSON(http.StatusOK, resultMsg)
-			return
-		} else {
-			resultMsg.Errno = resultInfo.Error.Code
-			resultMsg.Errmsg = resultInfo.Error.Message
-			c.JSON(http.StatusOK, resultMsg)
-			return
-		}
-	} else {
-		var txid string
-		if err := json.Unmarshal(result, &txid); nil != err {
-			var errorCode innererror.ErrCode = innererror.ErrRPCCallError
-			resultMsg.Errno = errorCode.Value()
-			resultMsg.Errmsg = errorCode.ErrorInfo()
-			c.JSON(http.StatusOK, resultMsg)
-			return
-		} else {
-			resultMsg.Data.Txid = txid
-			pushErr, receiveTime := notify.HandlePushTransaction(txid)
-			if nil != pushErr {
-				var errorCode innererror.ErrCode = innererror.ErrRPCCallError
-				resultMsg.Errno = errorCode.Value()
-				resultMsg.Errmsg = errorCode.ErrorInfo()
-				c.JSON(http.StatusOK, resultMsg)
-			}
-			resultMsg.Data.Receivetime = time.Unix(receiveTime, 0).UTC().Format("2006-01-02T15:04:05.999999-0700")
-			log.Log.Info("sendRawTransaction result:", resultMsg)
-			c.JSON(http.StatusOK, resultMsg)
-			return
-		}
+	// send raw transaction, the txid is set when the node accepted it
+	errno, errmsg, txid, receiveTime := broadcastRawTransaction(oneRequest.Tx)
+	resultMsg.Data.Txid = txid
+	if noError.Value() != errno {
+		resultMsg.Errno = errno
+		resultMsg.Errmsg = errmsg
+		c.JSON(http.StatusOK, resultMsg)
+		return
 	}
 
+	resultMsg.Data.Receivetime = time.Unix(receiveTime, 0).UTC().Format("2006-01-02T15:04:05.999999-0700")
+	log.Log.Info("sendRawTransaction result:", resultMsg)
+	c.JSON(http.StatusOK, resultMsg)
 }
 
 func getFeeRate(c *gin.Context) {
@@ -762,9 +532,10 @@ func getFeeRate(c *gin.Context) {
 	}
 
 	type msg struct {
-		Errno  int        `json:"errno"`
-		Errmsg string     `json:"errmsg"`
-		Data   []levelFee `json:"data"`
+		Errno   int            `json:"errno"`
+		Errmsg  string         `json:"errmsg"`
+		Data    []levelFee     `json:"data"`
+		Targets []fee.Estimate `json:"targets"`
 	}
 
 	var noError innererror.ErrCode = innererror.ErrNoError
@@ -773,86 +544,46 @@ func getFeeRate(c *gin.Context) {
 		Errmsg: noError.ErrorInfo(),
 	}
 
-	// send raw transaction
-	result, err := jsonrpc.Call(1, "estimatesmartfee", []interface{}{config.Cfg.Number.BlockNum})
+	// targets of the response and of the fee levels
+	err, targets := fee.ParseTargets(config.Cfg.FeeOpt.Targets)
 	if nil != err {
-		type ResultErr struct {
-			Code    int
-			Message string
-		}
-		type resultRpcErr struct {
-			Result string
-			Error  ResultErr
-			Id     int
-		}
-		info := err.Error()
-		var resultInfo resultRpcErr
-		err = json.Unmarshal([]byte(info), &resultInfo)
-		if nil != err {
-			var errorCode innererror.ErrCode = innererror.ErrRPCCallError
-			resultMsg.Errno = errorCode.Value()
-			resultMsg.Errmsg = errorCode.ErrorInfo()
-			c.JSON(http.StatusBadRequest, resultMsg)
-			return
-		} else {
-			resultMsg.Errno = resultInfo.Error.Code
-			resultMsg.Errmsg = resultInfo.Error.Message
-			c.JSON(http.StatusBadRequest, resultMsg)
-			return
-		}
-	} else {
-		type blockFee struct {
-			Feerate float64
-			Blocks  int
-		}
-
-		var oneBlockFee blockFee
-		if err := json.Unmarshal(result, &oneBlockFee); nil != err {
-			var errorCode innererror.ErrCode = innererror.ErrRPCCallError
-			resultMsg.Errno = errorCode.Value()
-			resultMsg.Errmsg = errorCode.ErrorInfo()
-			c.JSON(http.StatusBadRequest, resultMsg)
-			return
-		} else {
-			for i := 4; i >= 1; i-- {
-				var oneLevelFee levelFee
-				if 1 == i {
-					oneLevelFee = levelFee{
-						Weight: i,
-						Value:  fmt.Sprintf("%d", int64(oneBlockFee.Feerate*float64(notify.COIN))),
-					}
-				}
-
-				// normal
-				if 2 == i {
-					oneLevelFee = levelFee{
-						Weight: i,
-						Value:  fmt.Sprintf("%d", int64(oneBlockFee.Feerate*config.Cfg.Number.Normal*float64(notify.COIN))),
-					}
-				}
-
-				// priority
-				if 3 == i {
-					oneLevelFee = levelFee{
-						Weight: i,
-						Value:  fmt.Sprintf("%d", int64(oneBlockFee.Feerate*config.Cfg.Number.Priority*float64(notify.COIN))),
-					}
-				}
+		log.Log.Error(err, " parse fee targets fail")
+		var errorCode innererror.ErrCode = innererror.ErrInvalidParaError
+		resultMsg.Errno = errorCode.Value()
+		resultMsg.Errmsg = errorCode.ErrorInfo()
+		c.JSON(http.StatusBadRequest, resultMsg)
+		return
+	}
+	err, levelTargets := fee.ParseTargets(config.Cfg.FeeOpt.LevelTargets)
+	if nil != err {
+		log.Log.Error(err, " parse fee level targets fail")
+		var errorCode innererror.ErrCode = innererror.ErrInvalidParaError
+		resultMsg.Errno = errorCode.Value()
+		resultMsg.Errmsg = errorCode.ErrorInfo()
+		c.JSON(http.StatusBadRequest, resultMsg)
+		return
+	}
 
-				// quick
-				if 4 == i {
-					oneLevelFee = levelFee{
-						Weight: i,
-						Value:  fmt.Sprintf("%d", int64(oneBlockFee.Feerate*config.Cfg.Number.Quick*float64(notify.COIN))),
-					}
-				}
+	err, allEstimate := fee.EstimateFee(append(append([]int{}, targets...), levelTargets...))
+	if nil != err {
+		var errorCode innererror.ErrCode = innererror.ErrRPCCallError
+		resultMsg.Errno = errorCode.Value()
+		resultMsg.Errmsg = errorCode.ErrorInfo()
+		c.JSON(http.StatusBadRequest, resultMsg)
+		return
+	}
+	resultMsg.Targets = allEstimate[:len(targets)]
 
-				resultMsg.Data = append(resultMsg.Data, oneLevelFee)
-			}
-			c.JSON(http.StatusOK, resultMsg)
-			return
-		}
+	// levels in sat/kB, highest weight first
+	levelEstimate := allEstimate[len(targets):]
+	for i := len(levelEstimate); i >= 1; i-- {
+		resultMsg.Data = append(resultMsg.Data, levelFee{
+			Weight: i,
+			Value:  fmt.Sprintf("%d", int64(math.Ceil(levelEstimate[i-1].Feerate*1000))),
+		})
 	}
+
+	c.JSON(http.StatusOK, resultMsg)
 }
 
 func getUsdtBalances(c *gin.Context) {
@@ -864,15 +595,18 @@ func getUsdtBalances(c *gin.Context) {
 	}
 
 	type data struct {
-		Usd_price float64 `json:"usd_price"`
-		Decimals  int     `json:"decimals"`
-		Info      []info  `json:"info"`
+		Usd_price   float64 `json:"usd_price"`
+		Price_age   int64   `json:"price_age"`
+		Price_stale bool    `json:"price_stale"`
+		Decimals    int     `json:"decimals"`
+		Info        []info  `json:"info"`
 	}
 
 	type msg struct {
-		Errno  int    `json:"errno"`
-		Errmsg string `json:"errmsg"`
-		Data   data   `json:"data"`
+		Errno   int              `json:"errno"`
+		Errmsg  string           `json:"errmsg"`
+		Data    data             `json:"data"`
+		Invalid []invalidAddress `json:"invalid,omitempty"`
 	}
 
 	var noError innererror.ErrCode = innererror.ErrNoError
@@ -893,25 +627,9 @@ func getUsdtBalances(c *gin.Context) {
 		return
 	}
 
-	// real address
-	addressReal := make([]string, 0)
-	for _, oneAddress := range addressBatch {
-		if !IsValidAddress(oneAddress) {
-			continue
-		}
-
-		bExist := false
-		for _, oneReal := range addressReal {
-			if oneAddress == oneReal {
-				bExist = true
-				break
-			}
-		}
-
-		if !bExist {
-			addressReal = append(addressReal, oneAddress)
-		}
-	}
+	// real address, invalid ones are reported with the reason
+	addressReal, addressInvalid := filterAddress(addressBatch)
+	resultMsg.Invalid = addressInvalid
 
 	// parameter invalid
 	if 0 == len(addressReal) {
@@ -924,24 +642,13 @@ func getUsdtBalances(c *gin.Context) {
 
 	log.Log.Info("getUsdtBalances address: ", addressReal)
 
-	// price
-	ids := []string{"tether"}
-	err, resultPrice := request.GetPrice(ids)
-	if nil != err {
-		log.Log.Error(err, " getUsdtBalances get price fail")
-		var errorCode innererror.ErrCode = innererror.ErrRPCCallError
-		resultMsg.Errno = errorCode.Value()
-		resultMsg.Errmsg = errorCode.ErrorInfo()
-		c.JSON(http.StatusOK, resultMsg)
-		return
-	}
-	price := resultPrice["tether"]
-	resultMsg.Data.Usd_price = price
+	// price, the last known one
+	resultMsg.Data.Usd_price, resultMsg.Data.Price_age, resultMsg.Data.Price_stale = queryPrice(price.TETHER)
 	resultMsg.Data.Decimals = 8
 
 	// get balance
 	type addressBalance struct {
-		Propertyid int    `json:"propertyid"`
+		Propertyid uint64 `json:"propertyid"`
 		Name       string `json:"name"`
 		Balance    string `json:"balance"`
 		Reserved   string `json:"reserved"`
@@ -962,7 +669,7 @@ func getUsdtBalances(c *gin.Context) {
 		}
 
 		for _, oneBalance := range allBalance {
-			if 31 == oneBalance.Propertyid {
+			if config.Cfg.OmniOpt.UsdtPropertyId == oneBalance.Propertyid {
 				oneData := info{
 					Address:  oneAddress,
 					Balance:  oneBalance.Balance,
@@ -985,8 +692,10 @@ func getUsdtBalances(c *gin.Context) {
 func getAddressUsdtTransactions(c *gin.Context) {
 	// message type
 	type pagination struct {
-		Size int `json:"size"`
-		Page int `json:"page"`
+		Size        int    `json:"size"`
+		Page        int    `json:"page"`
+		Cursor      string `json:"cursor"`
+		Next_cursor string `json:"next_cursor"`
 	}
 
 	type record struct {
@@ -1000,9 +709,10 @@ func getAddressUsdtTransactions(c *gin.Context) {
 	}
 
 	type msg struct {
-		Errno  int    `json:"errno"`
-		Errmsg string `json:"errmsg"`
-		Data   data   `json:"data"`
+		Errno   int              `json:"errno"`
+		Errmsg  string           `json:"errmsg"`
+		Data    data             `json:"data"`
+		Invalid []invalidAddress `json:"invalid,omitempty"`
 	}
 
 	// init message
@@ -1016,8 +726,10 @@ func getAddressUsdtTransactions(c *gin.Context) {
 	type request struct {
 		Size      int      `json:"size"`
 		Page      int      `json:"page"`
+		Cursor    string   `json:"cursor"`
 		Addresses []string `json:"addresses"`
 		Type      []string `json:"type"`
+		historyFilter
 	}
 
 	var oneRequest request
@@ -1029,25 +741,9 @@ func getAddressUsdtTransactions(c *gin.Context) {
 		return
 	}
 
-	// real address
-	addressReal := make([]string, 0)
-	for _, oneAddress := range oneRequest.Addresses {
-		if !IsValidAddress(oneAddress) {
-			continue
-		}
-
-		bExist := false
-		for _, oneReal := range addressReal {
-			if oneAddress == oneReal {
-				bExist = true
-				break
-			}
-		}
-
-		if !bExist {
-			addressReal = append(addressReal, oneAddress)
-		}
-	}
+	// real address, invalid ones are reported with the reason
+	addressReal, addressInvalid := filterAddress(oneRequest.Addresses)
+	resultMsg.Invalid = addressInvalid
 
 	// parameter invalid
 	if 0 == len(addressReal) {
@@ -1060,71 +756,21 @@ func getAddressUsdtTransactions(c *gin.Context) {
 
 	log.Log.Info("getAddressUsdtTransactions address: ", addressReal)
 
-	var address string
-	for index, oneAddress := range addressReal {
-		if 0 == index {
-			address += `'` + oneAddress + `'`
-		} else {
-			address += `,'` + oneAddress + `'`
-		}
-	}
-
-	var strType string
-	for index, oneType := range oneRequest.Type {
-		if 0 == index {
-			strType += `'` + oneType + `'`
-		} else {
-			strType += `,'` + oneType + `'`
-		}
-	}
-
-	// unconfirmed transaction count
-	err, unfmdTransaction := omni.GetRedisUnconfirmedOmniTransactionByAddressAndType(addressReal, oneRequest.Type)
-	if nil != err {
-		log.Log.Error(err, " GetRedisUnconfirmedTransactionByAddress fail")
-		var errorCode innererror.ErrCode = innererror.ErrUnknown
-		resultMsg.Errno = errorCode.Value()
-		resultMsg.Errmsg = errorCode.ErrorInfo()
-		c.JSON(http.StatusOK, resultMsg)
-		return
-	}
-
 	// get transaction
-	pageInfo := pagination{
-		Size: oneRequest.Size,
-		Page: oneRequest.Page,
+	resultMsg.Data.Pagination = pagination{
+		Size:   oneRequest.Size,
+		Page:   oneRequest.Page,
+		Cursor: oneRequest.Cursor,
 	}
-	resultMsg.Data.Pagination = pageInfo
 
-	if oneRequest.Page <= 0 {
-		log.Log.Error(fmt.Sprintf("page number %d, size %d out of range", oneRequest.Page, oneRequest.Size))
-		var errorCode innererror.ErrCode = innererror.ErrOutOfRangeError
+	errorCode, txUnfmdRedisTrx, allOmniTransaction, nextCursor := queryAddressUsdtHistory(addressReal, oneRequest.Type, &oneRequest.historyFilter, oneRequest.Cursor, oneRequest.Page, oneRequest.Size)
+	if innererror.ErrNoError != errorCode {
 		resultMsg.Errno = errorCode.Value()
 		resultMsg.Errmsg = errorCode.ErrorInfo()
 		c.JSON(http.StatusOK, resultMsg)
 		return
 	}
-
-	// all unconfirmed and confirmed transactions
-	txUnfmdRedisTrx := []omni.OmniTransaction{}
-	begin := (oneRequest.Page - 1) * oneRequest.Size
-	end := oneRequest.Page * oneRequest.Size
-	limitBegin := 0
-	limitEnd := 0
-	if end <= len(unfmdTransaction) {
-		for i := begin; i < end; i++ {
-			txUnfmdRedisTrx = append(txUnfmdRedisTrx, unfmdTransaction[i])
-		}
-	} else if begin < len(unfmdTransaction) {
-		for i := begin; i < len(unfmdTransaction); i++ {
-			txUnfmdRedisTrx = append(txUnfmdRedisTrx, unfmdTransaction[i])
-		}
-		limitBegin = 0
-		limitEnd = oneRequest.Size - len(txUnfmdRedisTrx)
-	} else {
-		limitBegin = begin - len(unfmdTransaction)
-		limitEnd = oneRequest.Size
-	}
+	resultMsg.Data.Pagination.Next_cursor = nextCursor
 
 	list := []record{}
 	if 0 != len(txUnfmdRedisTrx) {
@@ -1149,19 +795,7 @@ func getAddressUsdtTransactions(c *gin.Context) {
 		}
 	}
 
-	if 0 != limitEnd {
-		allOmniTransaction := []tables.TableOmniTransactionInfo{}
-		selectSql := fmt.Sprintf("select * from t_omni_transaction_info where (`sendingaddress` in (%s) or `referenceaddress` in (%s)) and `type` in (%s) and propertyid = 31 order by blocktime desc limit %d, %d;", address, address, strType, limitBegin, limitEnd)
-		log.Log.Info("get omni transaction by address and type select transaction sql:", selectSql)
-		if err := database.Db.Raw(selectSql).Scan(&allOmniTransaction).Error; nil != err {
-			log.Log.Error(err, " exec sql fail: ", selectSql)
-			var errorCode innererror.ErrCode = innererror.ErrSQLError
-			resultMsg.Errno = errorCode.Value()
-			resultMsg.Errmsg = errorCode.ErrorInfo()
-			c.JSON(http.StatusOK, resultMsg)
-			return
-		}
-
+	if 0 != len(allOmniTransaction) {
 		for _, oneTrx := range allOmniTransaction {
 			if err, typeInfo, receiveTime, detail := omni.ConvertToRecord(&oneTrx, false, nil); nil != err {
 				log.Log.Error(err, " ConvertToRecord fail, omni transaction hash:", oneTrx.Txid)
@@ -1191,8 +825,10 @@ func getAddressUsdtTransactions(c *gin.Context) {
 
 func getUsdtTransaction(c *gin.Context) {
 	type usdtTransaction struct {
-		Type   string      `json:"type"`
-		Detail interface{} `json:"detail"`
+		Type        string      `json:"type"`
+		Detail      interface{} `json:"detail"`
+		Status      string      `json:"status"`
+		Replaced_by string      `json:"replaced_by,omitempty"`
 	}
 
 	// message type
@@ -1244,6 +880,7 @@ func getUsdtTransaction(c *gin.Context) {
 			one := usdtTransaction{
 				Type:   typeInfo,
 				Detail: message,
+				Status: omni.UNCONFIRMED,
 			}
 			resultMsg.Data = one
 			log.Log.Info("getUsdtTransaction result:", resultMsg)
@@ -1283,6 +920,48 @@ func getUsdtTransaction(c *gin.Context) {
 			one := usdtTransaction{
 				Type:   typeInfo,
 				Detail: message,
+				Status: omni.CONFIRMED,
+			}
+			resultMsg.Data = one
+			log.Log.Info("getUsdtTransaction result:", resultMsg)
+			c.JSON(http.StatusOK, resultMsg)
+			return
+		}
+	}
+
+	// evicted from mempool or double spent
+	err, bDropped, oneDropped := omni.GetDroppedOmniTransaction(txid)
+	if nil != err {
+		log.Log.Error(err, " GetDroppedOmniTransaction fail")
+		var errorCode innererror.ErrCode = innererror.ErrUnknown
+		resultMsg.Errno = errorCode.Value()
+		resultMsg.Errmsg = errorCode.ErrorInfo()
+		c.JSON(http.StatusOK, resultMsg)
+		return
+	}
+
+	if bDropped {
+		if err, typeInfo, receiveTime, detail := omni.ConvertToRecord(omni.ConvertTransactionToTableOmniTransactionInfo(&oneDropped.Transaction), true, &oneDropped.Transaction); nil != err {
+			log.Log.Error(err, " ConvertToRecord fail, omni dropped transaction hash:", oneDropped.Transaction.Txid)
+			var errorCode innererror.ErrCode = innererror.ErrUnknown
+			resultMsg.Errno = errorCode.Value()
+			resultMsg.Errmsg = errorCode.ErrorInfo()
+			c.JSON(http.StatusOK, resultMsg)
+			return
+		} else {
+			msgErr, message := omni.ConvertToMessage(detail, receiveTime)
+			if nil != msgErr {
+				var errorCode innererror.ErrCode = innererror.ErrUnknown
+				resultMsg.Errno = errorCode.Value()
+				resultMsg.Errmsg = errorCode.ErrorInfo()
+				c.JSON(http.StatusOK, resultMsg)
+				return
+			}
+			one := usdtTransaction{
+				Type:        typeInfo,
+				Detail:      message,
+				Status:      oneDropped.Status,
+				Replaced_by: oneDropped.ReplacedBy,
 			}
 			resultMsg.Data = one
 			log.Log.Info("getUsdtTransaction result:", resultMsg)
@@ -0,0 +1,196 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BlockABC/wallet-btc-service/common/log"
+	"github.com/BlockABC/wallet-btc-service/common/websocket"
+	"github.com/BlockABC/wallet-btc-service/innererror"
+	"github.com/BlockABC/wallet-btc-service/stream"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	STREAMPINGINTERVAL = 30 * time.Second // keepalive of an idle stream
+	STREAMREADTIMEOUT  = 90 * time.Second // silence allowed to a websocket client, pongs included
+	STREAMWRITETIMEOUT = 10 * time.Second
+)
+
+// operation of a websocket client
+const (
+	STREAMSUBSCRIBE   = "subscribe"
+	STREAMUNSUBSCRIBE = "unsubscribe"
+)
+
+// event types of the replies to a websocket client
+const (
+	STREAMSUBSCRIBED = "subscribed"
+	STREAMERROR      = "error"
+)
+
+// topics of a stream, the query of the request or a websocket message
+type streamRequest struct {
+	Op        string   `json:"op"`
+	Blocks    bool     `json:"blocks"`
+	Mempool   bool     `json:"mempool"`
+	Addresses []string `json:"addresses"`
+}
+
+// topics a websocket client receives after a request
+type streamTopics struct {
+	Blocks    bool             `json:"blocks"`
+	Mempool   bool             `json:"mempool"`
+	Addresses []string         `json:"addresses"`
+	Invalid   []invalidAddress `json:"invalid,omitempty"`
+}
+
+// streamEvents streams new blocks, mempool transactions and the activity of addresses. A websocket
+// upgrade gets a websocket, other requests get server sent events. The topics are given by the query, e.g.
+// ?blocks=true&mempool=false&addresses=a,b, a websocket client can change them later.
+func streamEvents(c *gin.Context) {
+	type msg struct {
+		Errno   int              `json:"errno"`
+		Errmsg  string           `json:"errmsg"`
+		Invalid []invalidAddress `json:"invalid,omitempty"`
+	}
+
+	blocks, _ := strconv.ParseBool(c.DefaultQuery("blocks", "false"))
+	mempool, _ := strconv.ParseBool(c.DefaultQuery("mempool", "false"))
+	addressBatch := make([]string, 0)
+	for _, oneAddress := range strings.Split(c.Query("addresses"), ",") {
+		if oneAddress = strings.TrimSpace(oneAddress); "" != oneAddress {
+			addressBatch = append(addressBatch, oneAddress)
+		}
+	}
+
+	addressReal, addressInvalid := filterAddress(addressBatch)
+	if 0 != len(addressInvalid) {
+		var errorCode innererror.ErrCode = innererror.ErrInvalidParaError
+		c.JSON(http.StatusOK, msg{Errno: errorCode.Value(), Errmsg: errorCode.ErrorInfo(), Invalid: addressInvalid})
+		return
+	}
+
+	sub := stream.NewSubscription()
+	defer sub.Close()
+	if err := sub.Subscribe(blocks, mempool, addressReal); nil != err {
+		var errorCode innererror.ErrCode = innererror.ErrInvalidParaError
+		c.JSON(http.StatusOK, msg{Errno: errorCode.Value(), Errmsg: errorCode.ErrorInfo() + ": " + err.Error()})
+		return
+	}
+
+	if websocket.IsUpgrade(c.Request) {
+		streamWebsocket(c, sub)
+	} else {
+		streamSse(c, sub)
+	}
+}
+
+// streamWebsocket sends the events of the subscription as text messages and applies the requests of
+// the client until either side closes
+func streamWebsocket(c *gin.Context, sub *stream.Subscription) {
+	conn, err := websocket.Upgrade(c.Writer, c.Request)
+	if nil != err {
+		log.Log.Error(err, " streamWebsocket upgrade fail")
+		return
+	}
+	defer conn.Close()
+	conn.ReadTimeout = STREAMREADTIMEOUT
+
+	// client requests
+	go func() {
+		defer sub.Close()
+		for {
+			_, message, err := conn.ReadMessage()
+			if nil != err {
+				return
+			}
+
+			var reply stream.Event
+			var request streamRequest
+			if err := json.Unmarshal(message, &request); nil != err {
+				reply = stream.Event{Type: STREAMERROR, Data: "invalid request: " + err.Error()}
+			} else {
+				reply = updateStream(sub, &request)
+			}
+			info, _ := json.Marshal(reply)
+			conn.SetWriteDeadline(time.Now().Add(STREAMWRITETIMEOUT))
+			if err := conn.WriteMessage(websocket.TextMessage, info); nil != err {
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(STREAMPINGINTERVAL)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-sub.Done:
+			conn.WriteMessage(websocket.CloseMessage, nil)
+			return
+		case oneMessage := <-sub.Messages:
+			conn.SetWriteDeadline(time.Now().Add(STREAMWRITETIMEOUT))
+			if err := conn.WriteMessage(websocket.TextMessage, oneMessage.Payload); nil != err {
+				return
+			}
+		case <-ticker.C:
+			conn.SetWriteDeadline(time.Now().Add(STREAMWRITETIMEOUT))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); nil != err {
+				return
+			}
+		}
+	}
+}
+
+// updateStream applies a websocket request to the subscription and returns the reply
+func updateStream(sub *stream.Subscription, request *streamRequest) stream.Event {
+	addressReal, addressInvalid := filterAddress(request.Addresses)
+	switch request.Op {
+	case STREAMSUBSCRIBE:
+		if err := sub.Subscribe(request.Blocks, request.Mempool, addressReal); nil != err {
+			return stream.Event{Type: STREAMERROR, Data: err.Error()}
+		}
+	case STREAMUNSUBSCRIBE:
+		sub.Unsubscribe(request.Blocks, request.Mempool, addressReal)
+	default:
+		return stream.Event{Type: STREAMERROR, Data: "unknown op: " + request.Op}
+	}
+
+	blocks, mempool, addresses := sub.Topics()
+	return stream.Event{Type: STREAMSUBSCRIBED, Data: streamTopics{blocks, mempool, addresses, addressInvalid}}
+}
+
+// streamSse sends the events of the subscription as server sent events until the client goes away
+func streamSse(c *gin.Context, sub *stream.Subscription) {
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	ticker := time.NewTicker(STREAMPINGINTERVAL)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-sub.Done:
+			return
+		case oneMessage := <-sub.Messages:
+			if _, err := fmt.Fprintf(c.Writer, "event: %s\ndata: %s\n\n", oneMessage.Type, oneMessage.Payload); nil != err {
+				return
+			}
+			c.Writer.Flush()
+		case <-ticker.C:
+			if _, err := fmt.Fprint(c.Writer, ": ping\n\n"); nil != err {
+				return
+			}
+			c.Writer.Flush()
+		}
+	}
+}
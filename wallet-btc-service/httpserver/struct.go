@@ -40,6 +40,8 @@ type transactionInfo struct {
 	Confirmations int32    `json:"confirmations"`
 	Receivetime   string   `json:"receivetime"`
 	Blocktime     string   `json:"blocktime"`
+	Status        string   `json:"status"`
+	Replaced_by   string   `json:"replaced_by,omitempty"`
 }
 
 // convert redis transaction to transaction info
@@ -68,6 +70,7 @@ func convertRedisTransactionToTransactionInfo(oneRedisTransaction *notify.RedisT
 		Outputs:       outputs,
 		Confirmations: -1,
 		Receivetime:   time.Unix(oneRedisTransaction.ReceiveTime, 0).UTC().Format("2006-01-02T15:04:05.999999-0700"),
+		Status:        notify.UNCONFIRMED,
 	}
 }
 
@@ -139,6 +142,7 @@ func convertViewTransactionInfo(oneTransaction []tables.ViewTransactionInfo) tra
 		Outputs:       outputs,
 		Confirmations: height - oneTransaction[0].Blockheight,
 		Blocktime:     time.Unix(oneTransaction[0].Time, 0).UTC().Format("2006-01-02T15:04:05.999999-0700"),
+		Status:        notify.CONFIRMED,
 	}
 }
 
@@ -190,6 +194,7 @@ func convertToTransactionInfo(pageTransaction []tables.TableTransactionInfo, pag
 			Outputs:       outputs,
 			Confirmations: height - oneTrx.Blockheight,
 			Blocktime:     time.Unix(oneTrx.Time, 0).UTC().Format("2006-01-02T15:04:05.999999-0700"),
+			Status:        notify.CONFIRMED,
 		}
 		result = append(result, oneTxInfo)
 	}
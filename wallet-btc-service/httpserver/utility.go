@@ -5,6 +5,9 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/BlockABC/wallet-btc-service/apikey"
+	"github.com/BlockABC/wallet-btc-service/common/address"
+	"github.com/BlockABC/wallet-btc-service/notify"
 	"github.com/gin-gonic/gin"
 )
 
@@ -22,12 +25,13 @@ func cors() gin.HandlerFunc {
 		} else {
 			headerStr = "access-control-allow-origin, access-control-allow-headers"
 		}
-		if origin != "" {
-			c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-			c.Header("Access-Control-Allow-Origin", "*")
+		// origins allowed by the configuration or an api key, the key of the request is checked by auth
+		if origin != "" && apikey.AnyAllowsOrigin(origin) {
+			c.Header("Access-Control-Allow-Origin", origin)
+			c.Header("Vary", "Origin")
 			c.Header("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE,UPDATE")
-			c.Header("Access-Control-Allow-Headers", "Authorization, Content-Length, X-CSRF-Token, Token,session,X_Requested_With,Accept, Origin, Host, Connection, Accept-Encoding, Accept-Language,DNT, X-CustomHeader, Keep-Alive, User-Agent, X-Requested-With, If-Modified-Since, Cache-Control, Content-Type, Pragma")
-			c.Header("Access-Control-Expose-Headers", "Content-Length, Access-Control-Allow-Origin, Access-Control-Allow-Headers,Cache-Control,Content-Language,Content-Type,Expires,Last-Modified,Pragma,FooBar")
+			c.Header("Access-Control-Allow-Headers", "Authorization, Content-Length, X-CSRF-Token, Token,session,X_Requested_With,Accept, Origin, Host, Connection, Accept-Encoding, Accept-Language,DNT, X-CustomHeader, Keep-Alive, User-Agent, X-Requested-With, If-Modified-Since, Cache-Control, Content-Type, Pragma, X-Api-Key")
+			c.Header("Access-Control-Expose-Headers", "Content-Length, Access-Control-Allow-Origin, Access-Control-Allow-Headers,Cache-Control,Content-Language,Content-Type,Expires,Last-Modified,Pragma,FooBar, X-RateLimit-Limit, X-RateLimit-Remaining, X-RateLimit-Reset, Retry-After")
 			c.Header("Access-Control-Max-Age", "172800")
 			c.Header("Access-Control-Allow-Credentials", "false")
 			c.Set("content-type", "application/json")
@@ -40,9 +44,37 @@ func cors() gin.HandlerFunc {
 	}
 }
 
+type invalidAddress struct {
+	Address string `json:"address"`
+	Reason  string `json:"reason"`
+}
+
 func IsValidAddress(oneAddress string) bool {
-	if len(oneAddress) < 26 {
-		return false
+	return nil == address.ValidateAddress(oneAddress, notify.ChainParams)
+}
+
+// filterAddress removes duplicate addresses and returns the invalid ones with the reason
+func filterAddress(addressBatch []string) ([]string, []invalidAddress) {
+	addressReal := make([]string, 0)
+	addressInvalid := make([]invalidAddress, 0)
+	for _, oneAddress := range addressBatch {
+		if err := address.ValidateAddress(oneAddress, notify.ChainParams); nil != err {
+			addressInvalid = append(addressInvalid, invalidAddress{oneAddress, err.Error()})
+			continue
+		}
+
+		bExist := false
+		for _, oneReal := range addressReal {
+			if oneAddress == oneReal {
+				bExist = true
+				break
+			}
+		}
+
+		if !bExist {
+			addressReal = append(addressReal, oneAddress)
+		}
 	}
-	return true
+
+	return addressReal, addressInvalid
 }
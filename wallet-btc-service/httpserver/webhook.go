@@ -0,0 +1,464 @@
+package httpserver
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/BlockABC/wallet-btc-service/common/hdkeychain"
+	"github.com/BlockABC/wallet-btc-service/common/log"
+	"github.com/BlockABC/wallet-btc-service/innererror"
+	"github.com/BlockABC/wallet-btc-service/notify"
+	"github.com/BlockABC/wallet-btc-service/webhook"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	MAXWEBHOOKDELIVERYSIZE = 100
+)
+
+// state names of the deliveries query
+var webhookDeliveryState = map[string]int{
+	"pending":   webhook.DELIVERYPENDING,
+	"delivered": webhook.DELIVERYDELIVERED,
+	"dead":      webhook.DELIVERYDEAD,
+}
+
+// extended public key in a watch list
+type webhookXpub struct {
+	Xpub string `json:"xpub"`
+	Type string `json:"type"`
+}
+
+// watch list changes of a webhook
+type webhookWatchRequest struct {
+	Id               int64         `json:"id"`
+	Addresses        []string      `json:"addresses"`
+	Xpubs            []webhookXpub `json:"xpubs"`
+	Remove_addresses []string      `json:"remove_addresses"`
+	Remove_xpubs     []string      `json:"remove_xpubs"`
+}
+
+// watchXpub watches an extended public key from the first unused addresses of its chains
+func watchXpub(id int64, oneXpub webhookXpub) (innererror.ErrCode, string) {
+	account, err := hdkeychain.NewAccount(oneXpub.Xpub, oneXpub.Type, notify.ChainParams)
+	if nil != err {
+		var errorCode innererror.ErrCode = innererror.ErrInvalidParaError
+		return errorCode, errorCode.ErrorInfo() + ": " + err.Error()
+	}
+
+	errorCode, scan := scanAddresses(webhook.XPUBCHAINS, true, account.Addresses)
+	if innererror.ErrNoError != errorCode {
+		return errorCode, errorCode.ErrorInfo()
+	}
+	next := make([]uint32, webhook.XPUBCHAINS)
+	for _, oneNext := range scan.Next {
+		var chain, index uint32
+		if _, err := fmt.Sscanf(oneNext.Path, "%d/%d", &chain, &index); nil == err && chain < webhook.XPUBCHAINS {
+			next[chain] = index
+		}
+	}
+
+	if err := webhook.WatchXpub(id, oneXpub.Xpub, oneXpub.Type, next); nil != err {
+		var errorCode innererror.ErrCode = innererror.ErrSQLError
+		return errorCode, errorCode.ErrorInfo()
+	}
+	return innererror.ErrNoError, ""
+}
+
+// updateWatch applies the watch list changes, it returns the invalid addresses
+func updateWatch(oneRequest *webhookWatchRequest) (innererror.ErrCode, string, []invalidAddress) {
+	addressReal, addressInvalid := filterAddress(oneRequest.Addresses)
+	if err := webhook.WatchAddresses(oneRequest.Id, addressReal); nil != err {
+		var errorCode innererror.ErrCode = innererror.ErrSQLError
+		return errorCode, errorCode.ErrorInfo(), nil
+	}
+	for _, oneXpub := range oneRequest.Xpubs {
+		if errorCode, errorInfo := watchXpub(oneRequest.Id, oneXpub); innererror.ErrNoError != errorCode {
+			return errorCode, errorInfo, nil
+		}
+	}
+
+	if err := webhook.UnwatchAddresses(oneRequest.Id, oneRequest.Remove_addresses); nil != err {
+		var errorCode innererror.ErrCode = innererror.ErrSQLError
+		return errorCode, errorCode.ErrorInfo(), nil
+	}
+	for _, oneXpub := range oneRequest.Remove_xpubs {
+		if err := webhook.UnwatchXpub(oneRequest.Id, oneXpub); nil != err {
+			var errorCode innererror.ErrCode = innererror.ErrSQLError
+			return errorCode, errorCode.ErrorInfo(), nil
+		}
+	}
+
+	return innererror.ErrNoError, "", addressInvalid
+}
+
+// checkWebhookId returns the error code of a webhook id not found among the webhooks of the api key
+func checkWebhookId(apiKeyId int64, id int64) (innererror.ErrCode, string) {
+	err, _ := webhook.GetWebhook(apiKeyId, id)
+	if webhook.ErrWebhookNotFind == err {
+		var errorCode innererror.ErrCode = innererror.ErrInvalidParaError
+		return errorCode, errorCode.ErrorInfo() + ": " + err.Error()
+	}
+	if nil != err {
+		var errorCode innererror.ErrCode = innererror.ErrSQLError
+		return errorCode, errorCode.ErrorInfo()
+	}
+	return innererror.ErrNoError, ""
+}
+
+func registerWebhook(c *gin.Context) {
+	type data struct {
+		Id              int64            `json:"id"`
+		Url             string           `json:"url"`
+		Events          string           `json:"events"`
+		Secret          string           `json:"secret"`
+		Invalid_address []invalidAddress `json:"invalid_address"`
+	}
+
+	type msg struct {
+		Errno  int    `json:"errno"`
+		Errmsg string `json:"errmsg"`
+		Data   data   `json:"data"`
+	}
+
+	var noError innererror.ErrCode = innererror.ErrNoError
+	resultMsg := msg{
+		Errno:  noError.Value(),
+		Errmsg: noError.ErrorInfo(),
+	}
+
+	// get request
+	type request struct {
+		Url       string        `json:"url"`
+		Events    []string      `json:"events"`
+		Addresses []string      `json:"addresses"`
+		Xpubs     []webhookXpub `json:"xpubs"`
+	}
+	var oneRequest request
+	if err := c.BindJSON(&oneRequest); nil != err {
+		var errorCode innererror.ErrCode = innererror.ErrDecodeError
+		resultMsg.Errno = errorCode.Value()
+		resultMsg.Errmsg = errorCode.ErrorInfo()
+		c.JSON(http.StatusOK, resultMsg)
+		return
+	}
+
+	err, events := webhook.ParseEvents(oneRequest.Events)
+	if nil != err {
+		var errorCode innererror.ErrCode = innererror.ErrInvalidParaError
+		resultMsg.Errno = errorCode.Value()
+		resultMsg.Errmsg = errorCode.ErrorInfo() + ": " + err.Error()
+		c.JSON(http.StatusOK, resultMsg)
+		return
+	}
+	for _, oneXpub := range oneRequest.Xpubs {
+		if _, err := hdkeychain.NewAccount(oneXpub.Xpub, oneXpub.Type, notify.ChainParams); nil != err {
+			var errorCode innererror.ErrCode = innererror.ErrInvalidParaError
+			resultMsg.Errno = errorCode.Value()
+			resultMsg.Errmsg = errorCode.ErrorInfo() + ": " + err.Error()
+			c.JSON(http.StatusOK, resultMsg)
+			return
+		}
+	}
+
+	err, oneWebhook := webhook.Register(apiKeyId(c), oneRequest.Url, events)
+	if webhook.ErrInvalidUrl == err || webhook.ErrForbiddenHost == err {
+		var errorCode innererror.ErrCode = innererror.ErrInvalidParaError
+		resultMsg.Errno = errorCode.Value()
+		resultMsg.Errmsg = errorCode.ErrorInfo() + ": " + err.Error()
+		c.JSON(http.StatusOK, resultMsg)
+		return
+	}
+	if nil != err {
+		var errorCode innererror.ErrCode = innererror.ErrSQLError
+		resultMsg.Errno = errorCode.Value()
+		resultMsg.Errmsg = errorCode.ErrorInfo()
+		c.JSON(http.StatusOK, resultMsg)
+		return
+	}
+	resultMsg.Data = data{Id: oneWebhook.Id, Url: oneWebhook.Url, Events: oneWebhook.Events, Secret: oneWebhook.Secret}
+
+	errorCode, errorInfo, addressInvalid := updateWatch(&webhookWatchRequest{Id: oneWebhook.Id, Addresses: oneRequest.Addresses, Xpubs: oneRequest.Xpubs})
+	if innererror.ErrNoError != errorCode {
+		resultMsg.Errno = errorCode.Value()
+		resultMsg.Errmsg = errorInfo
+		c.JSON(http.StatusOK, resultMsg)
+		return
+	}
+	resultMsg.Data.Invalid_address = addressInvalid
+
+	log.Log.Info("registerWebhook id: ", oneWebhook.Id, ", url: ", oneWebhook.Url, ", events: ", oneWebhook.Events)
+
+	c.JSON(http.StatusOK, resultMsg)
+}
+
+func watchWebhook(c *gin.Context) {
+	type data struct {
+		Invalid_address []invalidAddress `json:"invalid_address"`
+	}
+
+	type msg struct {
+		Errno  int    `json:"errno"`
+		Errmsg string `json:"errmsg"`
+		Data   data   `json:"data"`
+	}
+
+	var noError innererror.ErrCode = innererror.ErrNoError
+	resultMsg := msg{
+		Errno:  noError.Value(),
+		Errmsg: noError.ErrorInfo(),
+	}
+
+	// get request
+	var oneRequest webhookWatchRequest
+	if err := c.BindJSON(&oneRequest); nil != err {
+		var errorCode innererror.ErrCode = innererror.ErrDecodeError
+		resultMsg.Errno = errorCode.Value()
+		resultMsg.Errmsg = errorCode.ErrorInfo()
+		c.JSON(http.StatusOK, resultMsg)
+		return
+	}
+
+	if errorCode, errorInfo := checkWebhookId(apiKeyId(c), oneRequest.Id); innererror.ErrNoError != errorCode {
+		resultMsg.Errno = errorCode.Value()
+		resultMsg.Errmsg = errorInfo
+		c.JSON(http.StatusOK, resultMsg)
+		return
+	}
+
+	errorCode, errorInfo, addressInvalid := updateWatch(&oneRequest)
+	if innererror.ErrNoError != errorCode {
+		resultMsg.Errno = errorCode.Value()
+		resultMsg.Errmsg = errorInfo
+		c.JSON(http.StatusOK, resultMsg)
+		return
+	}
+	resultMsg.Data.Invalid_address = addressInvalid
+
+	log.Log.Info("watchWebhook result:", resultMsg)
+
+	c.JSON(http.StatusOK, resultMsg)
+}
+
+func getWebhooks(c *gin.Context) {
+	type info struct {
+		Id         int64         `json:"id"`
+		Url        string        `json:"url"`
+		Events     string        `json:"events"`
+		Createtime int64         `json:"createtime"`
+		Addresses  []string      `json:"addresses"`
+		Xpubs      []webhookXpub `json:"xpubs"`
+	}
+
+	type msg struct {
+		Errno  int    `json:"errno"`
+		Errmsg string `json:"errmsg"`
+		Data   []info `json:"data"`
+	}
+
+	var noError innererror.ErrCode = innererror.ErrNoError
+	resultMsg := msg{
+		Errno:  noError.Value(),
+		Errmsg: noError.ErrorInfo(),
+		Data:   []info{},
+	}
+
+	err, allWebhook := webhook.GetAllWebhook(apiKeyId(c))
+	if nil != err {
+		var errorCode innererror.ErrCode = innererror.ErrSQLError
+		resultMsg.Errno = errorCode.Value()
+		resultMsg.Errmsg = errorCode.ErrorInfo()
+		c.JSON(http.StatusOK, resultMsg)
+		return
+	}
+
+	for _, oneWebhook := range allWebhook {
+		err, allAddress, allXpub := webhook.GetWatch(oneWebhook.Id)
+		if nil != err {
+			var errorCode innererror.ErrCode = innererror.ErrSQLError
+			resultMsg.Errno = errorCode.Value()
+			resultMsg.Errmsg = errorCode.ErrorInfo()
+			c.JSON(http.StatusOK, resultMsg)
+			return
+		}
+
+		// derived addresses are listed by their extended public key
+		oneInfo := info{oneWebhook.Id, oneWebhook.Url, oneWebhook.Events, oneWebhook.Createtime, []string{}, []webhookXpub{}}
+		for _, oneAddress := range allAddress {
+			if 0 == oneAddress.Xpubid {
+				oneInfo.Addresses = append(oneInfo.Addresses, oneAddress.Address)
+			}
+		}
+		for _, oneXpub := range allXpub {
+			oneInfo.Xpubs = append(oneInfo.Xpubs, webhookXpub{oneXpub.Xpub, oneXpub.Type})
+		}
+		resultMsg.Data = append(resultMsg.Data, oneInfo)
+	}
+
+	c.JSON(http.StatusOK, resultMsg)
+}
+
+func deleteWebhook(c *gin.Context) {
+	type msg struct {
+		Errno  int    `json:"errno"`
+		Errmsg string `json:"errmsg"`
+	}
+
+	var noError innererror.ErrCode = innererror.ErrNoError
+	resultMsg := msg{
+		Errno:  noError.Value(),
+		Errmsg: noError.ErrorInfo(),
+	}
+
+	// get request
+	type request struct {
+		Id int64 `json:"id"`
+	}
+	var oneRequest request
+	if err := c.BindJSON(&oneRequest); nil != err {
+		var errorCode innererror.ErrCode = innererror.ErrDecodeError
+		resultMsg.Errno = errorCode.Value()
+		resultMsg.Errmsg = errorCode.ErrorInfo()
+		c.JSON(http.StatusOK, resultMsg)
+		return
+	}
+
+	if errorCode, errorInfo := checkWebhookId(apiKeyId(c), oneRequest.Id); innererror.ErrNoError != errorCode {
+		resultMsg.Errno = errorCode.Value()
+		resultMsg.Errmsg = errorInfo
+		c.JSON(http.StatusOK, resultMsg)
+		return
+	}
+	if err := webhook.Delete(oneRequest.Id); nil != err {
+		var errorCode innererror.ErrCode = innererror.ErrSQLError
+		resultMsg.Errno = errorCode.Value()
+		resultMsg.Errmsg = errorCode.ErrorInfo()
+		c.JSON(http.StatusOK, resultMsg)
+		return
+	}
+
+	log.Log.Info("deleteWebhook id: ", oneRequest.Id)
+
+	c.JSON(http.StatusOK, resultMsg)
+}
+
+func getWebhookDeliveries(c *gin.Context) {
+	type info struct {
+		Id          int64  `json:"id"`
+		Eventid     string `json:"eventid"`
+		Event       string `json:"event"`
+		Payload     string `json:"payload"`
+		Attempts    int32  `json:"attempts"`
+		Nextattempt int64  `json:"nextattempt"`
+		Lasterror   string `json:"lasterror"`
+		Createtime  int64  `json:"createtime"`
+		Updatetime  int64  `json:"updatetime"`
+	}
+
+	type msg struct {
+		Errno  int    `json:"errno"`
+		Errmsg string `json:"errmsg"`
+		Data   []info `json:"data"`
+	}
+
+	var noError innererror.ErrCode = innererror.ErrNoError
+	resultMsg := msg{
+		Errno:  noError.Value(),
+		Errmsg: noError.ErrorInfo(),
+		Data:   []info{},
+	}
+
+	// webhook id, state name and page, the dead letters by default
+	id, idErr := strconv.ParseInt(c.Query("id"), 10, 64)
+	state, stateOk := webhookDeliveryState[strings.ToLower(c.DefaultQuery("state", "dead"))]
+	page, pageErr := strconv.Atoi(c.DefaultQuery("page", "0"))
+	size, sizeErr := strconv.Atoi(c.DefaultQuery("size", "20"))
+	if nil != idErr || !stateOk || nil != pageErr || nil != sizeErr || page < 0 || size <= 0 {
+		var errorCode innererror.ErrCode = innererror.ErrInvalidParaError
+		resultMsg.Errno = errorCode.Value()
+		resultMsg.Errmsg = errorCode.ErrorInfo()
+		c.JSON(http.StatusOK, resultMsg)
+		return
+	}
+	if size > MAXWEBHOOKDELIVERYSIZE {
+		var errorCode innererror.ErrCode = innererror.ErrOutOfRangeError
+		resultMsg.Errno = errorCode.Value()
+		resultMsg.Errmsg = errorCode.ErrorInfo()
+		c.JSON(http.StatusOK, resultMsg)
+		return
+	}
+	if errorCode, errorInfo := checkWebhookId(apiKeyId(c), id); innererror.ErrNoError != errorCode {
+		resultMsg.Errno = errorCode.Value()
+		resultMsg.Errmsg = errorInfo
+		c.JSON(http.StatusOK, resultMsg)
+		return
+	}
+
+	err, allDelivery := webhook.GetDeliveries(id, state, page, size)
+	if nil != err {
+		var errorCode innererror.ErrCode = innererror.ErrSQLError
+		resultMsg.Errno = errorCode.Value()
+		resultMsg.Errmsg = errorCode.ErrorInfo()
+		c.JSON(http.StatusOK, resultMsg)
+		return
+	}
+	for _, one := range allDelivery {
+		resultMsg.Data = append(resultMsg.Data, info{one.Id, one.Eventid, one.Event, one.Payload, one.Attempts, one.Nextattempt, one.Lasterror, one.Createtime, one.Updatetime})
+	}
+
+	c.JSON(http.StatusOK, resultMsg)
+}
+
+func replayWebhookDeliveries(c *gin.Context) {
+	type data struct {
+		Replayed int64 `json:"replayed"`
+	}
+
+	type msg struct {
+		Errno  int    `json:"errno"`
+		Errmsg string `json:"errmsg"`
+		Data   data   `json:"data"`
+	}
+
+	var noError innererror.ErrCode = innererror.ErrNoError
+	resultMsg := msg{
+		Errno:  noError.Value(),
+		Errmsg: noError.ErrorInfo(),
+	}
+
+	// get request
+	type request struct {
+		Id  int64   `json:"id"`
+		Ids []int64 `json:"ids"`
+	}
+	var oneRequest request
+	if err := c.BindJSON(&oneRequest); nil != err {
+		var errorCode innererror.ErrCode = innererror.ErrDecodeError
+		resultMsg.Errno = errorCode.Value()
+		resultMsg.Errmsg = errorCode.ErrorInfo()
+		c.JSON(http.StatusOK, resultMsg)
+		return
+	}
+	if errorCode, errorInfo := checkWebhookId(apiKeyId(c), oneRequest.Id); innererror.ErrNoError != errorCode {
+		resultMsg.Errno = errorCode.Value()
+		resultMsg.Errmsg = errorInfo
+		c.JSON(http.StatusOK, resultMsg)
+		return
+	}
+
+	err, replayed := webhook.Replay(oneRequest.Id, oneRequest.Ids)
+	if nil != err {
+		var errorCode innererror.ErrCode = innererror.ErrSQLError
+		resultMsg.Errno = errorCode.Value()
+		resultMsg.Errmsg = errorCode.ErrorInfo()
+		c.JSON(http.StatusOK, resultMsg)
+		return
+	}
+	resultMsg.Data.Replayed = replayed
+
+	log.Log.Info("replayWebhookDeliveries webhook id: ", oneRequest.Id, ", replayed: ", replayed)
+
+	c.JSON(http.StatusOK, resultMsg)
+}
@@ -0,0 +1,286 @@
+package httpserver
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/BlockABC/wallet-btc-service/common/config"
+	"github.com/BlockABC/wallet-btc-service/common/hdkeychain"
+	"github.com/BlockABC/wallet-btc-service/common/log"
+	"github.com/BlockABC/wallet-btc-service/innererror"
+	"github.com/BlockABC/wallet-btc-service/notify"
+	"github.com/BlockABC/wallet-btc-service/price"
+	"github.com/gin-gonic/gin"
+)
+
+// address derived from an account, path is chain/index
+type derivedAddress struct {
+	Address string `json:"address"`
+	Path    string `json:"path"`
+}
+
+// derives count addresses of chain from index begin
+type addressDeriver func(chain uint32, begin uint32, count uint32) ([]string, error)
+
+// scan result, used addresses of all chains and the first unused address of every chain
+type addressScan struct {
+	Used []derivedAddress
+	Next []derivedAddress
+}
+
+func (s *addressScan) usedAddress() []string {
+	result := make([]string, 0, len(s.Used))
+	for _, one := range s.Used {
+		result = append(result, one.Address)
+	}
+	return result
+}
+
+// scanAddresses derives every chain until the gap limit of unused addresses in a row,
+// a not ranged source has a single address per chain and no next address
+func scanAddresses(chains uint32, ranged bool, derive addressDeriver) (innererror.ErrCode, *addressScan) {
+	gapLimit := config.Cfg.BtcOpt.XpubGapLimit
+	if gapLimit <= 0 {
+		gapLimit = 20
+	}
+	maxAddress := config.Cfg.BtcOpt.XpubMaxAddress
+	batch := gapLimit
+	if !ranged {
+		batch = 1
+	}
+
+	result := &addressScan{}
+	for chain := uint32(0); chain < chains; chain++ {
+		next := 0
+		for index := 0; (ranged || 0 == index) && index-next < gapLimit && (maxAddress <= 0 || index < maxAddress); index += batch {
+			addresses, err := derive(chain, uint32(index), uint32(batch))
+			if nil != err {
+				log.Log.Error(err, " scanAddresses derive address fail, chain: ", chain, ", index: ", index)
+				return innererror.ErrUnknown, nil
+			}
+
+			errorCode, addressUsed := queryAddressUsed(addresses)
+			if innererror.ErrNoError != errorCode {
+				return errorCode, nil
+			}
+
+			for offset, oneAddress := range addresses {
+				if addressUsed[oneAddress] {
+					result.Used = append(result.Used, derivedAddress{oneAddress, fmt.Sprintf("%d/%d", chain, index+offset)})
+					next = index + offset + 1
+				}
+			}
+		}
+
+		if !ranged {
+			continue
+		}
+		nextAddress, err := derive(chain, uint32(next), 1)
+		if nil != err {
+			log.Log.Error(err, " scanAddresses derive next address fail, chain: ", chain, ", index: ", next)
+			return innererror.ErrUnknown, nil
+		}
+		result.Next = append(result.Next, derivedAddress{nextAddress[0], fmt.Sprintf("%d/%d", chain, next)})
+	}
+
+	return innererror.ErrNoError, result
+}
+
+// xpub request
+type xpubRequest struct {
+	Xpub string `json:"xpub"`
+	Type string `json:"type"`
+	Size int    `json:"size"`
+	Page int    `json:"page"`
+}
+
+// parseXpubRequest binds the request and scans the account, the error code is ErrNoError on success
+func parseXpubRequest(c *gin.Context) (innererror.ErrCode, string, *xpubRequest, *hdkeychain.Account, *addressScan) {
+	var oneRequest xpubRequest
+	if err := c.BindJSON(&oneRequest); nil != err {
+		var errorCode innererror.ErrCode = innererror.ErrDecodeError
+		return errorCode, errorCode.ErrorInfo(), nil, nil, nil
+	}
+
+	account, err := hdkeychain.NewAccount(oneRequest.Xpub, oneRequest.Type, notify.ChainParams)
+	if nil != err {
+		var errorCode innererror.ErrCode = innererror.ErrInvalidParaError
+		return errorCode, errorCode.ErrorInfo() + ": " + err.Error(), nil, nil, nil
+	}
+
+	errorCode, scan := scanAddresses(2, true, account.Addresses)
+	if innererror.ErrNoError != errorCode {
+		return errorCode, errorCode.ErrorInfo(), nil, nil, nil
+	}
+
+	log.Log.Info("xpub ", account.Derivation, " used address:", scan.Used)
+
+	return innererror.ErrNoError, "", &oneRequest, account, scan
+}
+
+func getXpubInfo(c *gin.Context) {
+	type info struct {
+		Address string `json:"address"`
+		Path    string `json:"path"`
+		Balance string `json:"balance"`
+	}
+
+	type data struct {
+		Derivation   string         `json:"derivation"`
+		Decimals     int            `json:"decimals"`
+		Usd_price    float64        `json:"usd_price"`
+		Price_age    int64          `json:"price_age"`
+		Price_stale  bool           `json:"price_stale"`
+		Balance      string         `json:"balance"`
+		Next_receive derivedAddress `json:"next_receive"`
+		Next_change  derivedAddress `json:"next_change"`
+		Info         []info         `json:"info"`
+	}
+
+	type msg struct {
+		Errno  int    `json:"errno"`
+		Errmsg string `json:"errmsg"`
+		Data   data   `json:"data"`
+	}
+
+	var noError innererror.ErrCode = innererror.ErrNoError
+	resultMsg := msg{
+		Errno:  noError.Value(),
+		Errmsg: noError.ErrorInfo(),
+		Data:   data{Info: []info{}},
+	}
+
+	errorCode, errorInfo, _, account, scan := parseXpubRequest(c)
+	if innererror.ErrNoError != errorCode {
+		resultMsg.Errno = errorCode.Value()
+		resultMsg.Errmsg = errorInfo
+		c.JSON(http.StatusOK, resultMsg)
+		return
+	}
+
+	errorCode, balance := queryAddressBalance(scan.usedAddress())
+	if innererror.ErrNoError != errorCode {
+		resultMsg.Errno = errorCode.Value()
+		resultMsg.Errmsg = errorCode.ErrorInfo()
+		c.JSON(http.StatusOK, resultMsg)
+		return
+	}
+
+	// price, the last known one
+	resultMsg.Data.Usd_price, resultMsg.Data.Price_age, resultMsg.Data.Price_stale = queryPrice(price.BITCOIN)
+	resultMsg.Data.Decimals = 8
+
+	// result
+	var total int64
+	for _, oneUsed := range scan.Used {
+		total += balance[oneUsed.Address]
+		resultMsg.Data.Info = append(resultMsg.Data.Info, info{oneUsed.Address, oneUsed.Path, fmt.Sprintf("%d", balance[oneUsed.Address])})
+	}
+	resultMsg.Data.Derivation = account.Derivation
+	resultMsg.Data.Balance = fmt.Sprintf("%d", total)
+	resultMsg.Data.Next_receive = scan.Next[hdkeychain.ExternalChain]
+	resultMsg.Data.Next_change = scan.Next[hdkeychain.InternalChain]
+
+	log.Log.Info("getXpubInfo result:", resultMsg)
+
+	c.JSON(http.StatusOK, resultMsg)
+}
+
+func getXpubTransactions(c *gin.Context) {
+	type pagination struct {
+		Size int `json:"size"`
+		Page int `json:"page"`
+	}
+
+	type data struct {
+		Pagination pagination        `json:"pagination"`
+		List       []transactionInfo `json:"list"`
+	}
+
+	type msg struct {
+		Errno  int    `json:"errno"`
+		Errmsg string `json:"errmsg"`
+		Data   data   `json:"data"`
+	}
+
+	var noError innererror.ErrCode = innererror.ErrNoError
+	resultMsg := msg{
+		Errno:  noError.Value(),
+		Errmsg: noError.ErrorInfo(),
+		Data:   data{List: []transactionInfo{}},
+	}
+
+	errorCode, errorInfo, oneRequest, _, scan := parseXpubRequest(c)
+	if innererror.ErrNoError != errorCode {
+		resultMsg.Errno = errorCode.Value()
+		resultMsg.Errmsg = errorInfo
+		c.JSON(http.StatusOK, resultMsg)
+		return
+	}
+
+	resultMsg.Data.Pagination = pagination{
+		Size: oneRequest.Size,
+		Page: oneRequest.Page,
+	}
+
+	errorCode, list := queryAddressTransactions(scan.usedAddress(), oneRequest.Page, oneRequest.Size)
+	if innererror.ErrNoError != errorCode {
+		resultMsg.Errno = errorCode.Value()
+		resultMsg.Errmsg = errorCode.ErrorInfo()
+		c.JSON(http.StatusOK, resultMsg)
+		return
+	}
+	resultMsg.Data.List = list
+
+	log.Log.Info("getXpubTransactions result:", resultMsg)
+
+	c.JSON(http.StatusOK, resultMsg)
+}
+
+func getXpubUnspents(c *gin.Context) {
+	type xpubUnspent struct {
+		unspent
+		Path string `json:"path"`
+	}
+
+	type msg struct {
+		Errno  int           `json:"errno"`
+		Errmsg string        `json:"errmsg"`
+		Data   []xpubUnspent `json:"data"`
+	}
+
+	var noError innererror.ErrCode = innererror.ErrNoError
+	resultMsg := msg{
+		Errno:  noError.Value(),
+		Errmsg: noError.ErrorInfo(),
+		Data:   []xpubUnspent{},
+	}
+
+	errorCode, errorInfo, _, _, scan := parseXpubRequest(c)
+	if innererror.ErrNoError != errorCode {
+		resultMsg.Errno = errorCode.Value()
+		resultMsg.Errmsg = errorInfo
+		c.JSON(http.StatusOK, resultMsg)
+		return
+	}
+
+	errorCode, allUnspent := queryAddressUnspents(scan.usedAddress())
+	if innererror.ErrNoError != errorCode {
+		resultMsg.Errno = errorCode.Value()
+		resultMsg.Errmsg = errorCode.ErrorInfo()
+		c.JSON(http.StatusOK, resultMsg)
+		return
+	}
+
+	allPath := make(map[string]string)
+	for _, oneUsed := range scan.Used {
+		allPath[oneUsed.Address] = oneUsed.Path
+	}
+	for _, oneUnspent := range allUnspent {
+		resultMsg.Data = append(resultMsg.Data, xpubUnspent{oneUnspent, allPath[oneUnspent.Address]})
+	}
+
+	log.Log.Info("getXpubUnspents result:", resultMsg)
+
+	c.JSON(http.StatusOK, resultMsg)
+}
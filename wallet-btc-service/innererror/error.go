@@ -13,6 +13,23 @@ const (
 	ErrInvalidParaError ErrCode = 45004
 	ErrOutOfRangeError  ErrCode = 45005
 	ErrRPCCallError     ErrCode = 45006
+
+	// rejections of a broadcast transaction, checked before it is relayed
+	ErrTxDecodeError   ErrCode = 45007 // the raw transaction can not be decoded
+	ErrTxAlreadySpent  ErrCode = 45008 // an input is spent by a confirmed or unconfirmed transaction
+	ErrTxFeeTooLow     ErrCode = 45009 // the fee is below the relay or mempool minimum, or too low to replace
+	ErrTxNonStandard   ErrCode = 45010 // the transaction is not standard, dust outputs included
+	ErrTxMissingInputs ErrCode = 45011 // an input is unknown
+	ErrTxMempoolChain  ErrCode = 45012 // too many unconfirmed ancestors or descendants
+	ErrTxRejected      ErrCode = 45013 // rejected by the node for another reason, the reason is in errmsg
+
+	// access control of the public api
+	ErrApiKeyMissing    ErrCode = 45014 // no api key in the request
+	ErrApiKeyInvalid    ErrCode = 45015 // the api key is unknown or disabled
+	ErrOriginNotAllowed ErrCode = 45016 // the origin is not allowed for the api key
+	ErrRateLimited      ErrCode = 45017 // too many requests in the current minute
+	ErrTooManyAddress   ErrCode = 45018 // more addresses in the request than the api key allows
+	ErrAdminForbidden   ErrCode = 45019 // admin endpoints disabled or wrong admin key
 )
 
 func (err ErrCode) ErrorInfo() string {
@@ -33,6 +50,32 @@ func (err ErrCode) ErrorInfo() string {
 		return "out of range"
 	case ErrRPCCallError:
 		return "call json rpc error"
+	case ErrTxDecodeError:
+		return "Decoding raw transaction error"
+	case ErrTxAlreadySpent:
+		return "transaction input already spent"
+	case ErrTxFeeTooLow:
+		return "transaction fee too low"
+	case ErrTxNonStandard:
+		return "transaction not standard"
+	case ErrTxMissingInputs:
+		return "transaction input missing"
+	case ErrTxMempoolChain:
+		return "too long unconfirmed transaction chain"
+	case ErrTxRejected:
+		return "transaction rejected"
+	case ErrApiKeyMissing:
+		return "api key missing"
+	case ErrApiKeyInvalid:
+		return "api key invalid"
+	case ErrOriginNotAllowed:
+		return "origin not allowed"
+	case ErrRateLimited:
+		return "rate limit exceeded"
+	case ErrTooManyAddress:
+		return "too many addresses"
+	case ErrAdminForbidden:
+		return "admin access forbidden"
 	}
 
 	return fmt.Sprintf("Unknown error? Error code = %d", err)
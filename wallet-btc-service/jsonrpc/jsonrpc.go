@@ -7,8 +7,10 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"time"
 
 	"github.com/BlockABC/wallet-btc-service/common/config"
+	"github.com/BlockABC/wallet-btc-service/metrics"
 )
 
 type Request struct {
@@ -139,7 +141,9 @@ func Call(id interface{}, method string, params []interface{}) ([]byte, error) {
 		return nil, err
 	}
 
+	begin := time.Now()
 	resultByte, err := sendPostRequest(jsonRequest, config.Cfg.BtcOpt.RpcAddress, config.Cfg.BtcOpt.RpcPort, config.Cfg.BtcOpt.RpcUser, config.Cfg.BtcOpt.RpcPassword)
+	metrics.ObserveRpc(metrics.NODEBTC, method, begin, err)
 	if nil != err {
 		return nil, err
 	}
@@ -158,7 +162,9 @@ func OmniCall(id interface{}, method string, params []interface{}) ([]byte, erro
 		return nil, err
 	}
 
+	begin := time.Now()
 	resultByte, err := sendPostRequest(jsonRequest, config.Cfg.OmniOpt.RpcAddress, config.Cfg.OmniOpt.RpcPort, config.Cfg.OmniOpt.RpcUser, config.Cfg.OmniOpt.RpcPassword)
+	metrics.ObserveRpc(metrics.NODEOMNI, method, begin, err)
 	if nil != err {
 		return nil, err
 	}
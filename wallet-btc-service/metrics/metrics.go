@@ -0,0 +1,98 @@
+// Package metrics holds the prometheus metrics of the client and the server, both serve them on /metrics.
+// Alert rules over these metrics are in alerts.yml.
+package metrics
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BlockABC/wallet-btc-service/common/prometheus"
+	"github.com/gin-gonic/gin"
+)
+
+// node label of rpc metrics
+const (
+	NODEBTC  = "btc"
+	NODEOMNI = "omni"
+)
+
+// stage label of block save metrics
+const (
+	STAGESAVEBLOCK = "SaveBlockNotUpdateStateAndFrom"
+	STAGEUPDATE    = "updateStateAndFrom"
+	STAGEOMNI      = "omni.HandleOmniBlock"
+)
+
+// route label of a request that matched no route
+const UNMATCHEDROUTE = "unmatched"
+
+// buckets in seconds, a block stage of a full block takes seconds
+var BLOCKBUCKETS = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120}
+
+var (
+	BlockStageSeconds = prometheus.NewHistogram("wallet_btc_block_stage_seconds",
+		"Duration of the stages of saving a block", BLOCKBUCKETS, "stage")
+
+	RpcSeconds = prometheus.NewHistogram("wallet_btc_rpc_duration_seconds",
+		"Latency of the json rpc calls to the nodes", prometheus.DefaultBuckets, "node", "method")
+
+	RpcErrors = prometheus.NewCounter("wallet_btc_rpc_errors_total",
+		"Failed json rpc calls to the nodes", "node", "method")
+
+	HttpSeconds = prometheus.NewHistogram("wallet_btc_http_request_duration_seconds",
+		"Latency of the http requests", prometheus.DefaultBuckets, "route", "method")
+
+	HttpRequests = prometheus.NewCounter("wallet_btc_http_requests_total",
+		"Http requests by status code", "route", "method", "code")
+)
+
+// ObserveStage records the duration of a block stage started at begin
+func ObserveStage(stage string, begin time.Time) {
+	BlockStageSeconds.Observe(time.Since(begin).Seconds(), stage)
+}
+
+// ObserveRpc records the latency of a json rpc call started at begin and counts it if it failed
+func ObserveRpc(node string, method string, begin time.Time, err error) {
+	RpcSeconds.Observe(time.Since(begin).Seconds(), node, method)
+	if nil != err {
+		RpcErrors.Inc(node, method)
+	}
+}
+
+// Http records the latency of every request of the router by route. gin does not give the route of a request,
+// so it is found by the name of its handler in the routes of the router.
+func Http(router *gin.Engine) gin.HandlerFunc {
+	var routesOnce sync.Once
+	var routes map[string]string
+
+	return func(c *gin.Context) {
+		begin := time.Now()
+		c.Next()
+
+		routesOnce.Do(func() {
+			routes = make(map[string]string)
+			for _, oneRoute := range router.Routes() {
+				routes[oneRoute.Method+" "+oneRoute.Handler] = oneRoute.Path
+			}
+		})
+
+		route, ok := routes[c.Request.Method+" "+c.HandlerName()]
+		if !ok {
+			route = UNMATCHEDROUTE
+		}
+		method := strings.ToUpper(c.Request.Method)
+		HttpSeconds.Observe(time.Since(begin).Seconds(), route, method)
+		HttpRequests.Inc(route, method, statusCode(c.Writer.Status()))
+	}
+}
+
+// statusCode returns the status class like 2xx, it keeps the label values few
+func statusCode(status int) string {
+	return string('0'+byte(status/100)) + "xx"
+}
+
+// Handler serves the metrics
+func Handler() gin.HandlerFunc {
+	return gin.WrapH(prometheus.Handler())
+}
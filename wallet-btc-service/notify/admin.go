@@ -0,0 +1,381 @@
+package notify
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/BlockABC/wallet-btc-service/common/address"
+	"github.com/BlockABC/wallet-btc-service/common/log"
+	"github.com/BlockABC/wallet-btc-service/database"
+	"github.com/BlockABC/wallet-btc-service/filestore"
+	"github.com/BlockABC/wallet-btc-service/jsonrpc"
+	"github.com/BlockABC/wallet-btc-service/omni"
+	"github.com/BlockABC/wallet-btc-service/repairqueue"
+)
+
+var ErrBlockNotIndexed = errors.New("block of the transaction is not indexed on the main chain")
+
+// ReindexBlocks saves the blocks of the node in [begin, end) again, the blocks stored at these heights are
+// deleted first, fork ones too. State and from, the address index and the address balance of the range are
+// rebuilt after.
+func ReindexBlocks(begin, end int32) error {
+	for height := begin; height < end; height++ {
+		err, hash := GetBlockHashWithHeight(height)
+		if nil != err {
+			return err
+		}
+
+		var allBlock []struct {
+			Hash string
+		}
+		selectSql := fmt.Sprintf("select hash from t_block_info where height = %d;", height)
+		if err := database.Db.Raw(selectSql).Scan(&allBlock).Error; nil != err {
+			log.Log.Error(err, " exec sql fail: ", selectSql)
+			return err
+		}
+		for _, oneBlock := range allBlock {
+			if oneBlock.Hash == hash {
+				continue
+			}
+			if err := deleteBlock(oneBlock.Hash); nil != err {
+				return err
+			}
+		}
+
+		if err := RefetchBlock(hash); nil != err {
+			return err
+		}
+	}
+
+	return RebuildStateAndFrom(begin, end)
+}
+
+// RefetchBlock gets a block from the node and saves it again with its omni transactions, the stored one is
+// deleted first. A block not on the node best chain is refused, the events of the block are not published again.
+func RefetchBlock(hash string) error {
+	err, newBlock := GetBlock(hash)
+	if nil != err {
+		return err
+	}
+
+	err, bestHash := GetBlockHashWithHeight(newBlock.Height)
+	if nil != err {
+		return err
+	}
+	if bestHash != hash {
+		log.Log.Error("refetch block refused, block height: ", newBlock.Height, ", block hash: ", hash, ", best chain hash: ", bestHash)
+		return ErrStaleBlock
+	}
+
+	if err := deleteBlock(hash); nil != err {
+		return err
+	}
+	if err := saveBlock(newBlock, false); nil != err {
+		return err
+	}
+
+	// outputs of the block spent by later blocks, SaveBlock only applies its own inputs
+	if err := rebuildRange(newBlock.Height, newBlock.Height+1); nil != err {
+		return err
+	}
+	if err := omni.HandleOmniBlock(newBlock.Height); nil != err {
+		return err
+	}
+
+	log.Log.Notice("refetch block success, block height: ", newBlock.Height, ", block hash: ", hash)
+	return nil
+}
+
+// RefetchTransaction gets a transaction from the node and saves it again, into its block on the main chain or
+// into redis when it is unconfirmed, without notifying it again. The node needs txindex for transactions out of
+// its mempool.
+func RefetchTransaction(txid string) error {
+	result, err := jsonrpc.Call(1, "getrawtransaction", []interface{}{txid, true})
+	if nil != err {
+		log.Log.Error(err, " RefetchTransaction jsonrpc call getrawtransaction fail, transaction hash: ", txid)
+		return err
+	}
+	newTransaction := Transaction{}
+	if err := json.Unmarshal(result, &newTransaction); nil != err {
+		log.Log.Error(err, " RefetchTransaction Unmarshal result to transaction struct fail")
+		return err
+	}
+
+	// unconfirmed
+	if "" == newTransaction.BlockHash {
+		if err := DeleteRedisTransactionByHashs([]string{txid}); nil != err {
+			return err
+		}
+		err, oneRedisTransaction := convertUnconfirmedTransactionToRedisTransaction(&newTransaction)
+		if nil != err {
+			return err
+		}
+		if err := SaveOneRedisTransaction(oneRedisTransaction); nil != err {
+			return err
+		}
+		SaveRedisTransactionVsize(txid, newTransaction.Vsize)
+		return nil
+	}
+
+	err, bExist, oneBlock := getMainChainBlock(newTransaction.BlockHash)
+	if nil != err {
+		return err
+	}
+	if !bExist {
+		return ErrBlockNotIndexed
+	}
+
+	// position in the block
+	err, newBlock := GetBlock(newTransaction.BlockHash)
+	if nil != err {
+		return err
+	}
+	position := -1
+	for index, oneTrx := range newBlock.Tx {
+		if oneTrx.Txid == txid {
+			position = index
+			break
+		}
+	}
+	if position < 0 {
+		return fmt.Errorf("transaction %s not in block %s", txid, newBlock.Hash)
+	}
+
+	oneTrx := newBlock.Tx[position]
+	oneTrx.BlockHash = newBlock.Hash
+	oneTrx.BlockTime = newBlock.Time
+	oneTrx.Blockheight = newBlock.Height
+	oneTrx.Position = int32(position)
+
+	if err := execSql(deleteBlockSql(newBlock.Hash, txid)); nil != err {
+		return err
+	}
+	if err := SaveTransaction(&oneTrx); nil != err {
+		return err
+	}
+
+	// outputs spent by the transaction, the ones it created are updated with its block
+	if err := updateStateAndFrom([]Transaction{oneTrx}); nil != err {
+		return err
+	}
+
+	log.Log.Notice("refetch transaction success, block height: ", oneBlock.Height, ", transaction hash: ", txid)
+	return rebuildRange(oneBlock.Height, oneBlock.Height+1)
+}
+
+// RebuildStateAndFrom updates the spent state of the outputs and the from of the inputs of the main chain
+// blocks in [begin, end), then the address index and the address balance
+func RebuildStateAndFrom(begin, end int32) error {
+	for intervalBegin := begin; intervalBegin < end; intervalBegin += INTERVALLENGTH {
+		intervalEnd := intervalBegin + INTERVALLENGTH
+		if intervalEnd > end {
+			intervalEnd = end
+		}
+
+		if err := rebuildRange(intervalBegin, intervalEnd); nil != err {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ResyncMempool syncs the unconfirmed transactions in redis with the mempool of the node and rebuilds their
+// address index
+func ResyncMempool() error {
+	if err := RepairUnconfirmedTransaction(); nil != err {
+		return err
+	}
+	return RebuildRedisAddressIndex()
+}
+
+// RescanAddress rebuilds state and from, the address index and the address balance of the main chain blocks
+// the address receives or spends in
+func RescanAddress(oneAddress string) error {
+	if err := address.ValidateAddress(oneAddress, ChainParams); nil != err {
+		return err
+	}
+
+	var allHeight []struct {
+		Height int32
+	}
+	selectSql := fmt.Sprintf("select distinct t2.height from t_output_info t1, t_block_info t2 where t1.`to`='%s' and t1.isfork=0 and t2.hash=t1.blockhash and t2.isfork=0 "+
+		"union select distinct t3.height from t_output_info t1, t_input_info t2, t_block_info t3 where t1.`to`='%s' and t1.isfork=0 and t2.txid=t1.hash and t2.vout=t1.n and t2.isfork=0 and t3.hash=t2.blockhash and t3.isfork=0 "+
+		"order by height;", oneAddress, oneAddress)
+	if err := database.Db.Raw(selectSql).Scan(&allHeight).Error; nil != err {
+		log.Log.Error(err, " exec sql fail: ", selectSql)
+		return err
+	}
+
+	// consecutive heights are rebuilt together
+	for begin := 0; begin < len(allHeight); {
+		end := begin + 1
+		for end < len(allHeight) && allHeight[end].Height == allHeight[end-1].Height+1 && allHeight[end].Height-allHeight[begin].Height < INTERVALLENGTH {
+			end++
+		}
+
+		if err := rebuildRange(allHeight[begin].Height, allHeight[end-1].Height+1); nil != err {
+			return err
+		}
+		begin = end
+	}
+
+	log.Log.Notice("rescan address success, address: ", oneAddress, ", blocks: ", len(allHeight))
+	return nil
+}
+
+// rebuildRange rebuilds what is derived from the stored transactions of the main chain blocks in [begin, end)
+func rebuildRange(begin, end int32) error {
+	if err := repairStateAndFrom(begin, end); nil != err {
+		return err
+	}
+	if err := repairTransactionAddress(begin, end); nil != err {
+		return err
+	}
+	return repairAddressBalance(begin, end)
+}
+
+// deleteBlock deletes a stored block with its transactions, fee and omni transactions and reverts its address
+// balance
+func deleteBlock(hash string) error {
+	if err := execSql(deleteBlockSql(hash, "")); nil != err {
+		return err
+	}
+	if err := omni.DeleteOmniBlockTransaction(hash); nil != err {
+		return err
+	}
+
+	// the block is gone, its recorded balance change is only reverted
+	return UpdateAddressBalance([]string{hash})
+}
+
+// deleteBlockSql returns the sql deleting what is saved for a transaction of a block, for the whole block if
+// txid is empty. The outputs the deleted inputs spent are unspent again.
+func deleteBlockSql(hash string, txid string) []string {
+	if "" == txid {
+		return []string{
+			restoreSpentOutputSql(hash, ""),
+			fmt.Sprintf("delete from t_transaction_input_output_address_info where blockhash='%s';", hash),
+			fmt.Sprintf("delete from t_output_address_info where blockhash='%s';", hash),
+			fmt.Sprintf("delete from t_input_info where blockhash='%s';", hash),
+			fmt.Sprintf("delete from t_output_info where blockhash='%s';", hash),
+			fmt.Sprintf("delete from t_transaction_info where blockhash='%s';", hash),
+			fmt.Sprintf("delete from t_block_fee_info where blockhash='%s';", hash),
+			fmt.Sprintf("delete from t_block_info where hash='%s';", hash),
+		}
+	}
+
+	return []string{
+		restoreSpentOutputSql(hash, txid),
+		fmt.Sprintf("delete from t_transaction_input_output_address_info where blockhash='%s' and txid='%s';", hash, txid),
+		fmt.Sprintf("delete from t_output_address_info where blockhash='%s' and hash='%s';", hash, txid),
+		fmt.Sprintf("delete from t_input_info where blockhash='%s' and hash='%s';", hash, txid),
+		fmt.Sprintf("delete from t_output_info where blockhash='%s' and hash='%s';", hash, txid),
+		fmt.Sprintf("delete from t_transaction_info where blockhash='%s' and txid='%s';", hash, txid),
+	}
+}
+
+// execSql runs the sql in one database transaction
+func execSql(allSql []string) error {
+	dbTx := database.Db.Begin()
+	if err := dbTx.Error; nil != err {
+		log.Log.Error(err, " execSql start database transaction fail")
+		return err
+	}
+
+	for _, oneSql := range allSql {
+		if err := dbTx.Exec(oneSql).Error; nil != err {
+			log.Log.Error(err, " exec sql fail: ", oneSql)
+			dbTx.Rollback()
+			return err
+		}
+	}
+
+	if err := dbTx.Commit().Error; nil != err {
+		log.Log.Error(err, " execSql commit fail")
+		dbTx.Rollback()
+		return err
+	}
+	return nil
+}
+
+// repair jobs of one type
+type RepairJobCount struct {
+	Pending int64 `json:"pending"`
+	Dead    int64 `json:"dead"`
+}
+
+// IndexerStatus is where the index, the node and the repair are, a part that can not be read is in Errors
+type IndexerStatus struct {
+	Height          int32                     `json:"height"`     // main chain height in mysql
+	NodeHeight      int32                     `json:"nodeheight"` // block count of bitcoind
+	Lag             int32                     `json:"lag"`
+	OmniHeight      int32                     `json:"omniheight"`      // height of the last omni transaction in mysql
+	OmniNodeHeight  int32                     `json:"omninodeheight"`  // block count of omnicore
+	RepairBegin     int32                     `json:"repairbegin"`     // height the repair of all blocks goes on from
+	OmniRepairBegin int32                     `json:"omnirepairbegin"` // height the repair of all omni blocks goes on from
+	Unconfirmed     int64                     `json:"unconfirmed"`     // unconfirmed transactions in redis
+	RepairJobs      map[string]RepairJobCount `json:"repairjobs"`      // by job type
+	Errors          []string                  `json:"errors,omitempty"`
+}
+
+// GetIndexerStatus returns the status of the index, it goes on when a part fails
+func GetIndexerStatus() *IndexerStatus {
+	status := &IndexerStatus{RepairJobs: make(map[string]RepairJobCount)}
+	addError := func(part string, err error) {
+		status.Errors = append(status.Errors, part+": "+err.Error())
+	}
+
+	if err, height := GetBlockDbMaxHeight(); nil != err {
+		addError("height", err)
+	} else {
+		status.Height = height
+	}
+	if err, height := GetBlockHeight(); nil != err {
+		addError("nodeheight", err)
+	} else {
+		status.NodeHeight = height
+		status.Lag = status.NodeHeight - status.Height
+	}
+	if err, height := omni.GetOmniDbMaxHeight(); nil != err {
+		addError("omniheight", err)
+	} else {
+		status.OmniHeight = height
+	}
+	if err, height := omni.GetOmniBlockHeight(); nil != err {
+		addError("omninodeheight", err)
+	} else {
+		status.OmniNodeHeight = height
+	}
+	if err, height := filestore.RepairStoreInstance.GetBlockBegin(); nil == err {
+		status.RepairBegin = height
+	}
+	if err, height := filestore.RepairStoreInstance.GetOmniBegin(); nil == err {
+		status.OmniRepairBegin = height
+	}
+	if count, err := database.RedisDb.HLen(REDISUNFMDTRXKEY).Result(); nil != err {
+		addError("unconfirmed", err)
+	} else {
+		status.Unconfirmed = count
+	}
+
+	for jobType := range repairqueue.ALLJOBTYPE {
+		var oneCount RepairJobCount
+		err, pending := repairqueue.Count(jobType, repairqueue.JOBPENDING)
+		if nil != err {
+			addError("repairjobs", err)
+			break
+		}
+		err, dead := repairqueue.Count(jobType, repairqueue.JOBDEAD)
+		if nil != err {
+			addError("repairjobs", err)
+			break
+		}
+		oneCount.Pending = pending
+		oneCount.Dead = dead
+		status.RepairJobs[jobType] = oneCount
+	}
+
+	return status
+}
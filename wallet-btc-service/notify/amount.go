@@ -0,0 +1,93 @@
+package notify
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Amount is an output value in satoshi, in json it is the BTC decimal bitcoind uses
+type Amount int64
+
+var ErrInvalidAmount = errors.New("invalid amount")
+
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	str := strings.Trim(string(data), `"`)
+	if "null" == str {
+		return nil
+	}
+
+	value, err := ParseAmount(str)
+	if nil != err {
+		return err
+	}
+	*a = value
+	return nil
+}
+
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// String is the BTC value with eight decimals
+func (a Amount) String() string {
+	value := int64(a)
+	sign := ""
+	if value < 0 {
+		sign = "-"
+		value = -value
+	}
+	fraction := strconv.FormatInt(value%COIN, 10)
+	return sign + strconv.FormatInt(value/COIN, 10) + "." + strings.Repeat("0", 8-len(fraction)) + fraction
+}
+
+// ParseAmount converts a BTC decimal to satoshi without going through float64
+func ParseAmount(str string) (Amount, error) {
+	if 0 == len(str) {
+		return 0, ErrInvalidAmount
+	}
+
+	// exponent form is not produced by bitcoind, round it
+	if strings.ContainsAny(str, "eE") {
+		value, err := strconv.ParseFloat(str, 64)
+		if nil != err {
+			return 0, err
+		}
+		return Amount(math.Round(value * float64(COIN))), nil
+	}
+
+	negative := false
+	if '-' == str[0] {
+		negative = true
+		str = str[1:]
+	}
+
+	integer, fraction := str, ""
+	if index := strings.IndexByte(str, '.'); index >= 0 {
+		integer, fraction = str[:index], str[index+1:]
+	}
+	if 0 == len(integer) && 0 == len(fraction) {
+		return 0, ErrInvalidAmount
+	}
+	if len(fraction) > 8 {
+		if 0 != len(strings.Trim(fraction[8:], "0")) {
+			return 0, ErrInvalidAmount
+		}
+		fraction = fraction[:8]
+	}
+	fraction += strings.Repeat("0", 8-len(fraction))
+	if 0 == len(integer) {
+		integer = "0"
+	}
+
+	value, err := strconv.ParseInt(integer+fraction, 10, 64)
+	if nil != err {
+		return 0, err
+	}
+	if negative {
+		value = -value
+	}
+
+	return Amount(value), nil
+}
@@ -0,0 +1,183 @@
+package notify
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/BlockABC/wallet-btc-service/common/log"
+	"github.com/BlockABC/wallet-btc-service/database"
+	"github.com/BlockABC/wallet-btc-service/database/tables"
+	"github.com/jinzhu/gorm"
+)
+
+const (
+	ADDRESSBALANCEBATCH = 1000 // block heights built at once by InitAddressBalance
+)
+
+var addressBalanceMutex sync.Mutex
+
+// refreshAddressBalance reverts the balance change recorded for the blocks and records it again from the
+// stored outputs and inputs, fork blocks are only reverted. Running it twice for a block changes nothing.
+func refreshAddressBalance(dbTx *gorm.DB, blockhashes []string) error {
+	if 0 == len(blockhashes) {
+		return nil
+	}
+
+	var strHash string
+	for index, oneHash := range blockhashes {
+		if 0 == index {
+			strHash += fmt.Sprintf("'%s'", oneHash)
+		} else {
+			strHash += fmt.Sprintf(",'%s'", oneHash)
+		}
+	}
+
+	allSql := []string{
+		// first and last height without these blocks
+		fmt.Sprintf("update t_address_balance_info t1, (select distinct address from t_address_balance_block where blockhash in (%s)) t2 set "+
+			"t1.firstheight=ifnull((select min(t3.height) from t_address_balance_block t3 where t3.address=t1.address and t3.blockhash not in (%s)), 0), "+
+			"t1.lastheight=ifnull((select max(t3.height) from t_address_balance_block t3 where t3.address=t1.address and t3.blockhash not in (%s)), 0) "+
+			"where t1.address=t2.address;", strHash, strHash, strHash),
+
+		// revert
+		fmt.Sprintf("update t_address_balance_info t1, (select address, sum(received) as received, sum(sent) as sent, sum(txcount) as txcount from t_address_balance_block where blockhash in (%s) group by address) t2 set "+
+			"t1.balance=t1.balance-t2.received+t2.sent, t1.received=t1.received-t2.received, t1.sent=t1.sent-t2.sent, t1.txcount=t1.txcount-t2.txcount where t1.address=t2.address;", strHash),
+		fmt.Sprintf("delete from t_address_balance_block where blockhash in (%s);", strHash),
+
+		// record main chain blocks
+		fmt.Sprintf("insert into t_address_balance_block(blockhash, height, address, received, sent, txcount) "+
+			"select t1.blockhash, t2.height, t1.address, sum(t1.received), sum(t1.sent), count(distinct t1.txid) from ("+
+			"select blockhash, `hash` as txid, `to` as address, `value` as received, 0 as sent from t_output_info where blockhash in (%s) and isfork=0 and `to`!='' "+
+			"union all select blockhash, `hash` as txid, `from` as address, 0 as received, `value` as sent from t_input_info where blockhash in (%s) and isfork=0 and `from`!=''"+
+			") t1, t_block_info t2 where t1.blockhash=t2.hash and t2.isfork=0 group by t1.blockhash, t2.height, t1.address;", strHash, strHash),
+
+		// apply, heights are updated before txcount
+		fmt.Sprintf("insert into t_address_balance_info(address, balance, received, sent, txcount, firstheight, lastheight) "+
+			"select address, sum(received)-sum(sent), sum(received), sum(sent), sum(txcount), min(height), max(height) from t_address_balance_block where blockhash in (%s) group by address "+
+			"on duplicate key update firstheight=if(0=txcount, values(firstheight), least(firstheight, values(firstheight))), lastheight=greatest(lastheight, values(lastheight)), "+
+			"balance=balance+values(balance), received=received+values(received), sent=sent+values(sent), txcount=txcount+values(txcount);", strHash),
+	}
+
+	for _, oneSql := range allSql {
+		if err := dbTx.Exec(oneSql).Error; nil != err {
+			log.Log.Error(err, " exec sql fail: ", oneSql)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// UpdateAddressBalance refreshes the address balance of the blocks, it runs after their state and from are updated
+func UpdateAddressBalance(blockhashes []string) error {
+	addressBalanceMutex.Lock()
+	defer addressBalanceMutex.Unlock()
+
+	for begin := 0; begin < len(blockhashes); begin += database.MAX_WITh_IN {
+		end := begin + database.MAX_WITh_IN
+		if end > len(blockhashes) {
+			end = len(blockhashes)
+		}
+
+		dbTx := database.Db.Begin()
+		if err := dbTx.Error; nil != err {
+			log.Log.Error(err, " UpdateAddressBalance start database transaction fail")
+			return err
+		}
+
+		if err := refreshAddressBalance(dbTx, blockhashes[begin:end]); nil != err {
+			dbTx.Rollback()
+			return err
+		}
+
+		if err := dbTx.Commit().Error; nil != err {
+			log.Log.Error(err, " UpdateAddressBalance commit fail, blocks: ", blockhashes[begin:end])
+			dbTx.Rollback()
+			return err
+		}
+	}
+
+	return nil
+}
+
+// updateBlockAddressBalance refreshes the address balance of the blocks the transactions belong to
+func updateBlockAddressBalance(allTrx []Transaction) error {
+	blockhashes := make([]string, 0)
+	exist := make(map[string]bool)
+	for _, oneTrx := range allTrx {
+		if "" != oneTrx.BlockHash && !exist[oneTrx.BlockHash] {
+			exist[oneTrx.BlockHash] = true
+			blockhashes = append(blockhashes, oneTrx.BlockHash)
+		}
+	}
+
+	return UpdateAddressBalance(blockhashes)
+}
+
+// repairAddressBalance refreshes the address balance of the main chain blocks in [begin, end)
+func repairAddressBalance(begin, end int32) error {
+	var allBlock []tables.TableBlockInfo
+	if err := database.Db.Select("hash").Where("height >= ? AND height < ? AND isfork = 0", begin, end).Find(&allBlock).Error; nil != err {
+		log.Log.Error(err, fmt.Sprintf(" exec sql fail select hash from t_block_info where height >= %d and height < %d and isfork=0", begin, end))
+		return err
+	}
+
+	blockhashes := make([]string, 0, len(allBlock))
+	for _, oneBlock := range allBlock {
+		blockhashes = append(blockhashes, oneBlock.Hash)
+	}
+
+	return UpdateAddressBalance(blockhashes)
+}
+
+// InitAddressBalance builds the address balance of the stored blocks above the highest recorded one, a batch of
+// heights is recorded at once so an interrupted build goes on from where it stopped. It runs before blocks are
+// ingested, the highest recorded block is then the end of the build or the last block saved.
+func InitAddressBalance() error {
+	type maxHeight struct {
+		Recorded int32
+		Stored   int32
+	}
+	var result maxHeight
+	selectSql := "select coalesce((select max(height) from t_address_balance_block), 0) as recorded, coalesce((select max(height) from t_block_info where isfork = 0), 0) as stored;"
+	if err := database.Db.Raw(selectSql).Scan(&result).Error; nil != err {
+		log.Log.Error(err, " exec sql fail: ", selectSql)
+		return err
+	}
+	if result.Recorded >= result.Stored {
+		return nil
+	}
+
+	log.Log.Notice("build address balance, recorded height: ", result.Recorded, ", database max height: ", result.Stored)
+	for begin := result.Recorded; begin <= result.Stored; begin += ADDRESSBALANCEBATCH {
+		if err := repairAddressBalance(begin, begin+ADDRESSBALANCEBATCH); nil != err {
+			log.Log.Error(err, " build address balance fail, block height begin: ", begin)
+			return err
+		}
+	}
+	log.Log.Notice("build address balance success, database max height: ", result.Stored)
+
+	return nil
+}
+
+// GetAddressBalance returns the confirmed balance and statistics of the addresses, addresses never seen are missing
+func GetAddressBalance(address []string) (error, map[string]tables.TableAddressBalanceInfo) {
+	result := make(map[string]tables.TableAddressBalanceInfo)
+	for begin := 0; begin < len(address); begin += database.MAX_WITh_IN {
+		end := begin + database.MAX_WITh_IN
+		if end > len(address) {
+			end = len(address)
+		}
+
+		var allBalance []tables.TableAddressBalanceInfo
+		if err := database.Db.Where("address IN (?)", address[begin:end]).Find(&allBalance).Error; nil != err {
+			log.Log.Error(err, " select * from t_address_balance_info fail")
+			return err, nil
+		}
+		for _, oneBalance := range allBalance {
+			result[oneBalance.Address] = oneBalance
+		}
+	}
+
+	return nil, result
+}
@@ -4,12 +4,16 @@ import (
 	"fmt"
 	"net/http"
 	"sync"
+	"time"
 
 	"github.com/BlockABC/wallet-btc-service/common/config"
 	"github.com/BlockABC/wallet-btc-service/common/log"
 	"github.com/BlockABC/wallet-btc-service/database"
 	"github.com/BlockABC/wallet-btc-service/database/tables"
+	"github.com/BlockABC/wallet-btc-service/metrics"
 	"github.com/BlockABC/wallet-btc-service/omni"
+	"github.com/BlockABC/wallet-btc-service/stream"
+	"github.com/BlockABC/wallet-btc-service/webhook"
 	"github.com/gin-gonic/gin"
 )
 
@@ -55,6 +59,11 @@ func newBlockCome(newBlock *Block) error {
 	}
 	allBlockHash = append(allBlockHash, newBlock.Hash)
 
+	// drained on shutdown
+	if err := beginBlock(newBlock.Hash); nil != err {
+		return err
+	}
+
 	// write to channel
 	blockManagechan <- newBlock.Hash
 
@@ -62,6 +71,7 @@ func newBlockCome(newBlock *Block) error {
 	go func() {
 		defer func() {
 			<-blockManagechan
+			endBlock(newBlock.Hash)
 
 			// handle panic
 			if err := recover(); err != nil {
@@ -69,16 +79,72 @@ func newBlockCome(newBlock *Block) error {
 			}
 		}()
 
-		// save block
-		SaveBlock(newBlock)
-
-		// process block omni transactions
-		omni.HandleOmniBlock(newBlock.Height)
+		processBlock(newBlock)
 	}()
 
 	return nil
 }
 
+// processBlock handles chain reorganization, saves the block and its omni transactions and tracks the
+// confirmations of watched transactions
+func processBlock(newBlock *Block) error {
+	// already stored by another ingest source
+	err, bExist, _ := getMainChainBlock(newBlock.Hash)
+	if nil != err {
+		return err
+	}
+	if bExist {
+		return nil
+	}
+
+	// handle chain reorganization
+	if err := HandleChainReorganization(newBlock); nil != err {
+		log.Log.Error(err, " handle chain reorganization fail, block height: ", newBlock.Height, ", block hash: ", newBlock.Hash)
+		// a stale block is not repaired, the node best chain block comes instead
+		if ErrStaleBlock != err {
+			StoreFailBlockHash(newBlock.Hash)
+		}
+		return err
+	}
+
+	// save block, a block orphaned by an earlier reorganization is reconnected
+	var forkBlock []tables.TableBlockInfo
+	if err := database.Db.Where("hash = ? AND isfork = 1", newBlock.Hash).Find(&forkBlock).Error; nil != err {
+		log.Log.Error(err, " select * from t_block_info fail, block hash: ", newBlock.Hash)
+		return err
+	}
+	if 0 == len(forkBlock) {
+		if err := SaveBlock(newBlock); nil != err {
+			return err
+		}
+	} else {
+		if err := reconnectForkBlock(newBlock); nil != err {
+			return err
+		}
+	}
+
+	// process block omni transactions
+	begin := time.Now()
+	omni.HandleOmniBlock(newBlock.Height)
+	metrics.ObserveStage(metrics.STAGEOMNI, begin)
+
+	// confirmation depth of watched transactions
+	TrackConfirmation()
+
+	return nil
+}
+
+// streamBlockNotify streams a block stored on the main chain
+func streamBlockNotify(newBlock *Block) error {
+	return stream.PublishBlock(stream.BlockData{
+		Hash:              newBlock.Hash,
+		Height:            newBlock.Height,
+		Previousblockhash: newBlock.Previousblockhash,
+		Time:              newBlock.Time,
+		NTx:               int64(len(newBlock.Tx)),
+	})
+}
+
 func bitcoindBlockNotify(c *gin.Context) {
 	var newBlock Block
 	if err := c.BindJSON(&newBlock); nil != err {
@@ -89,7 +155,11 @@ func bitcoindBlockNotify(c *gin.Context) {
 	log.Log.Info("New block notifications received, block hash:", newBlock.Hash)
 
 	if err := newBlockCome(&newBlock); nil != err {
-		c.JSON(http.StatusBadRequest, gin.H{"result": err.Error()})
+		status := http.StatusBadRequest
+		if ErrStopping == err {
+			status = http.StatusServiceUnavailable
+		}
+		c.JSON(status, gin.H{"result": err.Error()})
 		return
 	}
 
@@ -97,14 +167,52 @@ func bitcoindBlockNotify(c *gin.Context) {
 }
 
 func SaveBlock(newBlock *Block) error {
+	return saveBlock(newBlock, true)
+}
+
+// saveBlock saves a block, the webhook and stream events of the block are published when publish is set
+func saveBlock(newBlock *Block, publish bool) error {
 	// save block not update state and from
+	begin := time.Now()
 	if err := SaveBlockNotUpdateStateAndFrom(newBlock); nil != err {
 		log.Log.Error(err, " save block not update state and from fail, block height: ", newBlock.Height, ", block hash: ", newBlock.Hash)
 		return err
 	}
+	metrics.ObserveStage(metrics.STAGESAVEBLOCK, begin)
+
+	// update state and from, the block is saved so a failure is repaired by rebuilding its height
+	begin = time.Now()
+	if err := updateStateAndFrom(newBlock.Tx); nil != err {
+		log.Log.Error(err, " update state and from fail, block height: ", newBlock.Height, ", block hash: ", newBlock.Hash)
+		StoreFailBlockState(newBlock.Height)
+	}
+	metrics.ObserveStage(metrics.STAGEUPDATE, begin)
+
+	// address balance
+	if err := UpdateAddressBalance([]string{newBlock.Hash}); nil != err {
+		log.Log.Error(err, " update address balance fail, block height: ", newBlock.Height, ", block hash: ", newBlock.Hash)
+		StoreFailBlockState(newBlock.Height)
+	}
+
+	// fee rate distribution
+	if err := SaveBlockFee(newBlock.Hash, newBlock.Height); nil != err {
+		log.Log.Error(err, " save block fee fail, block height: ", newBlock.Height, ", block hash: ", newBlock.Hash)
+	}
+
+	if publish {
+		// webhook events of the block
+		if err := webhook.PublishBlock(newBlock.Hash, newBlock.Height); nil != err {
+			log.Log.Error(err, " publish block webhook events fail, block height: ", newBlock.Height, ", block hash: ", newBlock.Hash)
+		}
+
+		// stream the block to the http servers
+		if err := streamBlockNotify(newBlock); nil != err {
+			log.Log.Error(err, " stream block fail, block height: ", newBlock.Height, ", block hash: ", newBlock.Hash)
+		}
+	}
 
-	// update state and from
-	updateStateAndFrom(newBlock.Tx)
+	// drop unconfirmed transaction double spent by the block
+	removeConflictTransaction(newBlock)
 
 	return nil
 }
@@ -142,6 +250,7 @@ func SaveBlockNotUpdateStateAndFrom(newBlock *Block) error {
 		newBlock.Tx[index].BlockHash = newBlock.Hash
 		newBlock.Tx[index].BlockTime = newBlock.Time
 		newBlock.Tx[index].Blockheight = newBlock.Height
+		newBlock.Tx[index].Position = int32(index)
 	}
 
 	// handle transaction
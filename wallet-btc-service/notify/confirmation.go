@@ -0,0 +1,358 @@
+package notify
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BlockABC/wallet-btc-service/common/address"
+	"github.com/BlockABC/wallet-btc-service/common/config"
+	"github.com/BlockABC/wallet-btc-service/common/log"
+	"github.com/BlockABC/wallet-btc-service/database"
+	"github.com/BlockABC/wallet-btc-service/database/tables"
+	"github.com/BlockABC/wallet-btc-service/request"
+	"github.com/BlockABC/wallet-btc-service/webhook"
+)
+
+// state of a tracked transaction
+const (
+	CONFIRMATIONTRACKING = 0
+	CONFIRMATIONDONE     = 1
+	CONFIRMATIONREVERTED = 2
+)
+
+// confirmations an event is sent at
+var CONFIRMATIONDEPTH = []int32{1, 3, 6}
+
+// seconds the addresses of the push service are kept
+const NOTIFYADDRESSCACHETIME = 60
+
+var confirmationMutex sync.Mutex
+
+var (
+	notifyAddressMutex  sync.Mutex
+	notifyAddressCache  []request.NotifyAddress
+	notifyAddressExpire int64
+)
+
+// getNotifyAddress returns the valid addresses of the push service, they are fetched again after the cache time
+func getNotifyAddress() (error, []request.NotifyAddress) {
+	notifyAddressMutex.Lock()
+	defer notifyAddressMutex.Unlock()
+
+	now := time.Now().Unix()
+	if now < notifyAddressExpire {
+		return nil, notifyAddressCache
+	}
+
+	err, allAddress := request.GetNotifyAddress()
+	if nil != err {
+		return err, nil
+	}
+	validAddress := make([]request.NotifyAddress, 0, len(allAddress))
+	for _, oneAddress := range allAddress {
+		if err := address.ValidateAddress(oneAddress.Name, ChainParams); nil != err {
+			log.Log.Info("getNotifyAddress skip invalid address: ", oneAddress.Name)
+			continue
+		}
+		validAddress = append(validAddress, oneAddress)
+	}
+	notifyAddressCache = validAddress
+	notifyAddressExpire = now + NOTIFYADDRESSCACHETIME
+	return nil, notifyAddressCache
+}
+
+// ConfirmationDepths returns the depths reached by confirmations that are not notified yet
+func ConfirmationDepths(notified int32, confirmations int32) []int32 {
+	result := make([]int32, 0)
+	for _, depth := range CONFIRMATIONDEPTH {
+		if depth > notified && depth <= confirmations {
+			result = append(result, depth)
+		}
+	}
+	return result
+}
+
+// confirmationMsgType returns the push msg type of a depth
+func confirmationMsgType(depth int32) int {
+	switch depth {
+	case 1:
+		return request.MSGTYPECONFIRM1
+	case 3:
+		return request.MSGTYPECONFIRM3
+	default:
+		return request.MSGTYPECONFIRM6
+	}
+}
+
+// confirmation or revert of a tracked transaction, depth is 0 for a revert
+type confirmationEvent struct {
+	tables.TableConfirmationInfo
+	Depth int32
+}
+
+// TrackConfirmation starts tracking the transactions to watched addresses in the blocks not deep enough yet
+// and sends the depths the tracked transactions reached since the last block
+func TrackConfirmation() error {
+	confirmationMutex.Lock()
+	defer confirmationMutex.Unlock()
+
+	type blockHeight struct {
+		Height int32
+	}
+	var allTip []blockHeight
+	tipSql := "select max(height) as height from t_block_info where isfork = 0;"
+	if err := database.Db.Raw(tipSql).Scan(&allTip).Error; nil != err {
+		log.Log.Error(err, " exec sql fail: ", tipSql)
+		return err
+	}
+	if 0 == len(allTip) || 0 == allTip[0].Height {
+		return nil
+	}
+	tip := allTip[0].Height
+
+	err, allAddress := getNotifyAddress()
+	if nil != err {
+		log.Log.Error("TrackConfirmation get notify address fail, ", err)
+		allAddress = []request.NotifyAddress{}
+	}
+	if err := trackConfirmation(tip, allAddress); nil != err {
+		return err
+	}
+
+	var allTracking []tables.TableConfirmationInfo
+	trackingSql := fmt.Sprintf("select t1.* from t_confirmation_info t1, t_block_info t2 where t1.state = %d and t2.hash = t1.blockhash and t2.isfork = 0;", CONFIRMATIONTRACKING)
+	if err := database.Db.Raw(trackingSql).Scan(&allTracking).Error; nil != err {
+		log.Log.Error(err, " exec sql fail: ", trackingSql)
+		return err
+	}
+
+	allEvent := make([]confirmationEvent, 0)
+	for _, oneTracking := range allTracking {
+		depths := ConfirmationDepths(oneTracking.Notified, tip-oneTracking.Height+1)
+		for _, depth := range depths {
+			allEvent = append(allEvent, confirmationEvent{TableConfirmationInfo: oneTracking, Depth: depth})
+		}
+	}
+	if 0 == len(allEvent) {
+		return nil
+	}
+
+	// webhook deliveries are idempotent, a failed block is tracked again with the next one
+	if err := webhook.Publish(confirmationActivity(allEvent)); nil != err {
+		log.Log.Error(err, " TrackConfirmation publish fail")
+		return err
+	}
+
+	now := time.Now().Unix()
+	finalDepth := CONFIRMATIONDEPTH[len(CONFIRMATIONDEPTH)-1]
+	for index, oneEvent := range allEvent {
+		// the deepest event of a transaction is the last one
+		if index+1 < len(allEvent) && allEvent[index+1].Id == oneEvent.Id {
+			continue
+		}
+		state := CONFIRMATIONTRACKING
+		if oneEvent.Depth >= finalDepth {
+			state = CONFIRMATIONDONE
+		}
+		updateSql := fmt.Sprintf("update t_confirmation_info set notified = %d, state = %d, updatetime = %d where id = %d;", oneEvent.Depth, state, now, oneEvent.Id)
+		if err := database.Db.Exec(updateSql).Error; nil != err {
+			log.Log.Error(err, " exec sql fail: ", updateSql)
+			return err
+		}
+	}
+
+	pushConfirmation(allEvent, allAddress)
+	return nil
+}
+
+// trackConfirmation inserts the btc outputs and valid omni transfers to watched addresses in the blocks above
+// tip-6, transactions already tracked are ignored. allAddress are validated by getNotifyAddress
+func trackConfirmation(tip int32, allAddress []request.NotifyAddress) error {
+	minHeight := tip - CONFIRMATIONDEPTH[len(CONFIRMATIONDEPTH)-1]
+
+	// addresses watched by a webhook and pushed ones
+	allFilter := []string{"in (select address from t_webhook_address_info)"}
+	for begin := 0; begin < len(allAddress); begin += database.MAX_WITh_IN {
+		end := begin + database.MAX_WITh_IN
+		if end > len(allAddress) {
+			end = len(allAddress)
+		}
+		var strAddress string
+		for index, oneAddress := range allAddress[begin:end] {
+			if 0 == index {
+				strAddress += fmt.Sprintf("'%s'", oneAddress.Name)
+			} else {
+				strAddress += fmt.Sprintf(",'%s'", oneAddress.Name)
+			}
+		}
+		allFilter = append(allFilter, fmt.Sprintf("in (%s)", strAddress))
+	}
+
+	allTracking := make([]tables.TableConfirmationInfo, 0)
+	for _, oneFilter := range allFilter {
+		var allOutput []tables.TableConfirmationInfo
+		outputSql := fmt.Sprintf("select t1.hash as txid, t1.`to` as address, cast(sum(t1.value) as char) as amount, t1.blockhash, t2.height from t_output_info t1, t_block_info t2 where t2.height > %d and t2.isfork = 0 and t1.blockhash = t2.hash and t1.isfork = 0 and t1.`to` %s group by t1.hash, t1.`to`, t1.blockhash, t2.height;", minHeight, oneFilter)
+		if err := database.Db.Raw(outputSql).Scan(&allOutput).Error; nil != err {
+			log.Log.Error(err, " exec sql fail: ", outputSql)
+			return err
+		}
+		for index := range allOutput {
+			allOutput[index].Token = webhook.TOKENBTC
+		}
+		allTracking = append(allTracking, allOutput...)
+
+		var allOmni []tables.TableConfirmationInfo
+		omniSql := fmt.Sprintf("select txid, referenceaddress as address, amount, propertyid, blockhash, block as height from t_omni_transaction_info where block > %d and blockhash != '' and valid = 1 and referenceaddress %s;", minHeight, oneFilter)
+		if err := database.Db.Raw(omniSql).Scan(&allOmni).Error; nil != err {
+			log.Log.Error(err, " exec sql fail: ", omniSql)
+			return err
+		}
+		for index := range allOmni {
+			allOmni[index].Token = webhook.TOKENOMNI
+			if allOmni[index].Propertyid == config.Cfg.OmniOpt.UsdtPropertyId {
+				allOmni[index].Token = webhook.TOKENUSDT
+			}
+		}
+		allTracking = append(allTracking, allOmni...)
+	}
+
+	// trackings, 7 arguments each
+	now := time.Now().Unix()
+	for begin := 0; begin < len(allTracking); begin += database.MAX_WITH_INSERT {
+		end := begin + database.MAX_WITH_INSERT
+		if end > len(allTracking) {
+			end = len(allTracking)
+		}
+		values := make([]string, 0, end-begin)
+		args := make([]interface{}, 0, 7*(end-begin))
+		for _, oneTracking := range allTracking[begin:end] {
+			values = append(values, fmt.Sprintf("(?, ?, ?, ?, ?, ?, ?, 0, %d, %d, %d)", CONFIRMATIONTRACKING, now, now))
+			args = append(args, oneTracking.Txid, oneTracking.Address, oneTracking.Token, oneTracking.Amount, oneTracking.Propertyid, oneTracking.Blockhash, oneTracking.Height)
+		}
+		insertSql := "insert ignore into t_confirmation_info(txid, address, token, amount, propertyid, blockhash, height, notified, state, createtime, updatetime) values " + strings.Join(values, ",") + ";"
+		if err := database.Db.Exec(insertSql, args...).Error; nil != err {
+			log.Log.Error(err, " insert into t_confirmation_info fail")
+			return err
+		}
+	}
+	return nil
+}
+
+// RevertConfirmation stops tracking the transactions of a reverted block, the ones already notified as
+// confirmed are sent a reverted event
+func RevertConfirmation(blockhash string) error {
+	confirmationMutex.Lock()
+	defer confirmationMutex.Unlock()
+
+	var allTracking []tables.TableConfirmationInfo
+	if err := database.Db.Where("blockhash = ? AND state != ?", blockhash, CONFIRMATIONREVERTED).Find(&allTracking).Error; nil != err {
+		log.Log.Error(err, " select * from t_confirmation_info fail, block hash: ", blockhash)
+		return err
+	}
+	if 0 == len(allTracking) {
+		return nil
+	}
+
+	allEvent := make([]confirmationEvent, 0)
+	for _, oneTracking := range allTracking {
+		if oneTracking.Notified > 0 {
+			allEvent = append(allEvent, confirmationEvent{TableConfirmationInfo: oneTracking})
+		}
+	}
+	if err := webhook.Publish(confirmationActivity(allEvent)); nil != err {
+		log.Log.Error(err, " RevertConfirmation publish fail, block hash: ", blockhash)
+		return err
+	}
+
+	updateSql := fmt.Sprintf("update t_confirmation_info set state = %d, updatetime = %d where blockhash = '%s';", CONFIRMATIONREVERTED, time.Now().Unix(), blockhash)
+	if err := database.Db.Exec(updateSql).Error; nil != err {
+		log.Log.Error(err, " exec sql fail: ", updateSql)
+		return err
+	}
+
+	if 0 != len(allEvent) {
+		err, allAddress := getNotifyAddress()
+		if nil != err {
+			log.Log.Error("RevertConfirmation get notify address fail, ", err)
+			return err
+		}
+		pushConfirmation(allEvent, allAddress)
+	}
+	return nil
+}
+
+// confirmationActivity returns the webhook events of confirmations and reverts
+func confirmationActivity(allEvent []confirmationEvent) []webhook.Activity {
+	result := make([]webhook.Activity, 0, len(allEvent))
+	for _, oneEvent := range allEvent {
+		oneActivity := webhook.Activity{
+			Event:         webhook.EVENTCONFIRMATION,
+			Txid:          oneEvent.Txid,
+			Address:       oneEvent.Address,
+			Token:         oneEvent.Token,
+			Blockhash:     oneEvent.Blockhash,
+			Height:        oneEvent.Height,
+			Confirmations: oneEvent.Depth,
+		}
+		if 0 == oneEvent.Depth {
+			oneActivity.Event = webhook.EVENTREVERTED
+		}
+		if webhook.TOKENBTC == oneEvent.Token {
+			oneActivity.Value, _ = strconv.ParseInt(oneEvent.Amount, 10, 64)
+		} else {
+			oneActivity.Amount = oneEvent.Amount
+			oneActivity.Propertyid = oneEvent.Propertyid
+			oneActivity.Direction = webhook.DIRECTIONIN
+		}
+		result = append(result, oneActivity)
+	}
+	return result
+}
+
+// pushConfirmation pushes confirmations and reverts to the subscribers of their address, omni events are not
+// pushed to platform 3
+func pushConfirmation(allEvent []confirmationEvent, allAddress []request.NotifyAddress) {
+	if 0 == len(allAddress) {
+		return
+	}
+
+	addressMap := make(map[string][]request.NotifyAddress)
+	for _, oneAddress := range allAddress {
+		addressMap[oneAddress.Name] = append(addressMap[oneAddress.Name], oneAddress)
+	}
+
+	info := request.Push_list{}
+	for _, oneEvent := range allEvent {
+		msgType := request.MSGTYPEREVERTED
+		if 0 != oneEvent.Depth {
+			msgType = confirmationMsgType(oneEvent.Depth)
+		}
+		for _, oneAddress := range addressMap[oneEvent.Address] {
+			if webhook.TOKENBTC != oneEvent.Token && 3 == oneAddress.Platform {
+				continue
+			}
+			oneNotify := request.NotifyInfo{
+				Chain_type: oneAddress.Chain_type,
+				Chain_id:   oneAddress.Chain_id,
+				Msg_type:   msgType,
+				Cid:        oneAddress.Cid,
+				Msg_id:     fmt.Sprintf("%d_%s_%s_%s", msgType, oneEvent.Txid, oneEvent.Address, oneEvent.Blockhash),
+				Language:   oneAddress.Language,
+				Token_name: oneEvent.Token,
+				Name:       oneAddress.Name,
+				Platform:   oneAddress.Platform,
+			}
+			info.List = append(info.List, oneNotify)
+		}
+	}
+
+	if 0 == len(info.List) {
+		return
+	}
+	if err := request.NotifyTerminal(info); nil != err {
+		log.Log.Error(err, " pushConfirmation notify terminal fail")
+	}
+}
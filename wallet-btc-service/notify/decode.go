@@ -0,0 +1,134 @@
+package notify
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/BlockABC/wallet-btc-service/common/config"
+	"github.com/BlockABC/wallet-btc-service/common/log"
+	"github.com/BlockABC/wallet-btc-service/common/txscript"
+	"github.com/BlockABC/wallet-btc-service/common/wire"
+	"github.com/BlockABC/wallet-btc-service/jsonrpc"
+)
+
+// ChainParams decides the address encoding of decoded scripts
+var ChainParams = config.Cfg.ChainParams
+
+// GetBlock gets the serialized block (getblock verbosity 0) and decodes it natively,
+// height, difficulty, mediantime and chainwork come from getblockheader
+func GetBlock(hash string) (error, *Block) {
+	result, err := jsonrpc.Call(1, "getblock", []interface{}{hash, 0})
+	if nil != err {
+		log.Log.Error(err, " GetBlock jsonrpc call getblock fail, block hash: ", hash)
+		return err, nil
+	}
+	var rawHex string
+	if err := json.Unmarshal(result, &rawHex); nil != err {
+		log.Log.Error(err, " GetBlock Unmarshal result to block hex fail")
+		return err, nil
+	}
+	raw, err := hex.DecodeString(rawHex)
+	if nil != err {
+		log.Log.Error(err, " GetBlock decode block hex fail, block hash: ", hash)
+		return err, nil
+	}
+
+	return DecodeRawBlock(raw)
+}
+
+// DecodeRawBlock decodes a serialized block and fills the chain context from getblockheader
+func DecodeRawBlock(raw []byte) (error, *Block) {
+	msgBlock, err := wire.DeserializeBlock(raw)
+	if nil != err {
+		log.Log.Error(err, " DecodeRawBlock deserialize block fail")
+		return err, nil
+	}
+	hash := msgBlock.Header.BlockHash()
+
+	result, err := jsonrpc.Call(1, "getblockheader", []interface{}{hash, true})
+	if nil != err {
+		log.Log.Error(err, " DecodeRawBlock jsonrpc call getblockheader fail, block hash: ", hash)
+		return err, nil
+	}
+	newBlock := Block{}
+	if err := json.Unmarshal(result, &newBlock); nil != err {
+		log.Log.Error(err, " DecodeRawBlock Unmarshal result to block struct fail")
+		return err, nil
+	}
+	if newBlock.Hash != hash {
+		return fmt.Errorf("block header hash %s does not match block %s", newBlock.Hash, hash), nil
+	}
+
+	newBlock.Size = int32(msgBlock.SerializeSize())
+	newBlock.Weight = msgBlock.Weight()
+	newBlock.NTx = int64(len(msgBlock.Transactions))
+	newBlock.Tx = make([]Transaction, 0, len(msgBlock.Transactions))
+	for _, tx := range msgBlock.Transactions {
+		newBlock.Tx = append(newBlock.Tx, ConvertWireTransaction(tx))
+	}
+
+	return nil, &newBlock
+}
+
+// DecodeRawTransaction decodes a serialized transaction into the verbose transaction model
+func DecodeRawTransaction(raw []byte) (error, *Transaction) {
+	tx, err := wire.DeserializeTx(raw)
+	if nil != err {
+		return err, nil
+	}
+
+	newTransaction := ConvertWireTransaction(tx)
+	return nil, &newTransaction
+}
+
+func ConvertWireTransaction(tx *wire.MsgTx) Transaction {
+	result := Transaction{
+		Txid:     tx.TxHash(),
+		Hash:     tx.WitnessHash(),
+		Version:  tx.Version,
+		Size:     int32(tx.SerializeSize()),
+		Vsize:    tx.VSize(),
+		Weight:   tx.Weight(),
+		Locktime: int64(tx.LockTime),
+		Vin:      make([]Input, 0, len(tx.TxIn)),
+		Vout:     make([]Output, 0, len(tx.TxOut)),
+		Hex:      hex.EncodeToString(tx.Raw()),
+	}
+
+	bCoinbase := tx.IsCoinBase()
+	for _, in := range tx.TxIn {
+		oneInput := Input{Sequence: int64(in.Sequence)}
+		if bCoinbase {
+			oneInput.Coinbase = hex.EncodeToString(in.SignatureScript)
+		} else {
+			oneInput.Txid = in.PreviousOutPoint.HashString()
+			oneInput.Vout = int64(in.PreviousOutPoint.Index)
+			oneInput.ScriptSig = ScriptSig{
+				Asm: txscript.DisasmString(in.SignatureScript, true),
+				Hex: hex.EncodeToString(in.SignatureScript),
+			}
+		}
+		for _, item := range in.Witness {
+			oneInput.Txinwitness = append(oneInput.Txinwitness, hex.EncodeToString(item))
+		}
+		result.Vin = append(result.Vin, oneInput)
+	}
+
+	for index, out := range tx.TxOut {
+		scriptType, reqSigs, addresses := txscript.ExtractPkScriptAddrs(out.PkScript, ChainParams)
+		result.Vout = append(result.Vout, Output{
+			Value: Amount(out.Value),
+			N:     int64(index),
+			ScriptPubKey: ScriptPubKey{
+				Asm:       txscript.DisasmString(out.PkScript, false),
+				Hex:       hex.EncodeToString(out.PkScript),
+				Type:      scriptType,
+				ReqSigs:   reqSigs,
+				Addresses: addresses,
+			},
+		})
+	}
+
+	return result
+}
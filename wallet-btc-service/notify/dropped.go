@@ -0,0 +1,296 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/BlockABC/wallet-btc-service/common/log"
+	"github.com/BlockABC/wallet-btc-service/database"
+	"github.com/BlockABC/wallet-btc-service/jsonrpc"
+	"github.com/BlockABC/wallet-btc-service/omni"
+)
+
+const (
+	REDISDROPPEDTRXKEY = "DroppedTransaction"
+
+	// transaction status, shared with omni
+	UNCONFIRMED = omni.UNCONFIRMED
+	CONFIRMED   = omni.CONFIRMED
+	DROPPED     = omni.DROPPED
+	REPLACED    = omni.REPLACED
+
+	UNCONFIRMEDGRACETIME = omni.UNCONFIRMEDGRACETIME
+	DROPPEDKEEPTIME      = omni.DROPPEDKEEPTIME
+)
+
+type DroppedTransaction struct {
+	Transaction RedisTransaction `json:"transaction"`
+	Status      string           `json:"status"`
+	ReplacedBy  string           `json:"replaced_by"`
+	DroppedTime int64            `json:"droppedtime"`
+}
+
+// RemoveUnconfirmedTransaction drops a transaction evicted from the mempool, releases the outputs
+// it spent and records it as dropped or replaced. replacedBy is searched when it is empty
+func RemoveUnconfirmedTransaction(txid string, replacedBy string) error {
+	err, bExist, oneRedisTransaction := GetRedisUnconfirmedTransactionByTxid(txid)
+	if nil != err {
+		return err
+	}
+	if !bExist {
+		return nil
+	}
+
+	err, allRedis := GetAllRedisUnconfirmedTransaction()
+	if nil != err {
+		return err
+	}
+
+	if 0 == len(replacedBy) {
+		replacedBy = findReplacement(oneRedisTransaction, allRedis)
+	}
+
+	for _, oneInput := range oneRedisTransaction.Vin {
+		// still spent by the replacement or another unconfirmed transaction
+		if 0 != len(findRedisSpender(oneInput.Txid, oneInput.Vout, txid, allRedis)) {
+			continue
+		}
+
+		// parent is unconfirmed too
+		bParent := false
+		for index := range allRedis {
+			if allRedis[index].Txid != oneInput.Txid {
+				continue
+			}
+			bParent = true
+			for outIndex, oneOutput := range allRedis[index].Vout {
+				if oneOutput.N == oneInput.Vout {
+					allRedis[index].Vout[outIndex].IsSpent = false
+				}
+			}
+			SaveOneRedisTransaction(&allRedis[index])
+		}
+		if bParent {
+			continue
+		}
+
+		updateSql := fmt.Sprintf("update t_output_info set state=0 where `hash`='%s' and `n`=%d and state=2 and isfork=0;", oneInput.Txid, oneInput.Vout)
+		if err := database.Db.Exec(updateSql).Error; nil != err {
+			log.Log.Error(err, " exec sql fail: ", updateSql)
+		}
+	}
+
+	if err := DeleteRedisTransactionByHashs([]string{txid}); nil != err {
+		return err
+	}
+
+	status := DROPPED
+	if 0 != len(replacedBy) {
+		status = REPLACED
+	}
+	dropped := DroppedTransaction{*oneRedisTransaction, status, replacedBy, time.Now().Unix()}
+	if err := saveDroppedTransaction(&dropped); nil != err {
+		return err
+	}
+
+	log.Log.Notice("unconfirmed transaction ", status, ", transaction hash: ", txid, ", replaced by: ", replacedBy)
+
+	return omni.DropUnconfirmedOmniTransaction(txid, status, replacedBy)
+}
+
+// findRedisSpender returns the unconfirmed transaction other than exclude spending the output
+func findRedisSpender(hash string, n int64, exclude string, allRedis []RedisTransaction) string {
+	for _, oneRedis := range allRedis {
+		if oneRedis.Txid == exclude {
+			continue
+		}
+		for _, oneInput := range oneRedis.Vin {
+			if oneInput.Txid == hash && oneInput.Vout == n {
+				return oneRedis.Txid
+			}
+		}
+	}
+	return ""
+}
+
+// findReplacement returns the unconfirmed or block transaction spending any input of oneRedisTransaction
+func findReplacement(oneRedisTransaction *RedisTransaction, allRedis []RedisTransaction) string {
+	for _, oneInput := range oneRedisTransaction.Vin {
+		if spender := findRedisSpender(oneInput.Txid, oneInput.Vout, oneRedisTransaction.Txid, allRedis); 0 != len(spender) {
+			return spender
+		}
+	}
+
+	type spender struct {
+		Hash string
+	}
+	for _, oneInput := range oneRedisTransaction.Vin {
+		var result []spender
+		selectSql := fmt.Sprintf("select `hash` from t_input_info where txid='%s' and vout=%d and `hash`!='%s' and isfork=0 limit 1;", oneInput.Txid, oneInput.Vout, oneRedisTransaction.Txid)
+		if err := database.Db.Raw(selectSql).Scan(&result).Error; nil != err {
+			log.Log.Error(err, " exec sql fail: ", selectSql)
+			continue
+		}
+		if 0 != len(result) {
+			return result[0].Hash
+		}
+	}
+
+	return ""
+}
+
+// removeConflictTransaction drops unconfirmed transactions double spent by the block
+func removeConflictTransaction(newBlock *Block) error {
+	spentBy := make(map[string]string)
+	for _, oneTransaction := range newBlock.Tx {
+		for _, oneInput := range oneTransaction.Vin {
+			spentBy[fmt.Sprintf("%s_%d", oneInput.Txid, oneInput.Vout)] = oneTransaction.Txid
+		}
+	}
+
+	err, allRedis := GetAllRedisUnconfirmedTransaction()
+	if nil != err {
+		return err
+	}
+
+	for _, oneRedis := range allRedis {
+		for _, oneInput := range oneRedis.Vin {
+			if replacedBy, ok := spentBy[fmt.Sprintf("%s_%d", oneInput.Txid, oneInput.Vout)]; ok && replacedBy != oneRedis.Txid {
+				if err := RemoveUnconfirmedTransaction(oneRedis.Txid, replacedBy); nil != err {
+					log.Log.Error(err, " remove conflict unconfirmed transaction fail, transaction hash: ", oneRedis.Txid)
+				}
+				break
+			}
+		}
+	}
+
+	return nil
+}
+
+// removeEvictedTransaction drops unconfirmed transactions the node no longer has in its mempool
+func removeEvictedTransaction(allRedis []RedisTransaction, mempool []string, confirmed []string) {
+	exist := make(map[string]bool)
+	for _, oneHash := range mempool {
+		exist[oneHash] = true
+	}
+	for _, oneHash := range confirmed {
+		exist[oneHash] = true
+	}
+
+	now := time.Now().Unix()
+	for _, oneRedis := range allRedis {
+		if exist[oneRedis.Txid] || oneRedis.ReceiveTime > now-UNCONFIRMEDGRACETIME {
+			continue
+		}
+
+		// double check, the mempool snapshot may be older than the redis one
+		if _, err := jsonrpc.Call(1, "getmempoolentry", []interface{}{oneRedis.Txid}); nil == err || !isNotInMempool(err) {
+			continue
+		}
+
+		if err := RemoveUnconfirmedTransaction(oneRedis.Txid, ""); nil != err {
+			log.Log.Error(err, " remove evicted unconfirmed transaction fail, transaction hash: ", oneRedis.Txid)
+		}
+	}
+}
+
+func isNotInMempool(err error) bool {
+	type ResultErr struct {
+		Code    int
+		Message string
+	}
+	type resultRpcErr struct {
+		Result string
+		Error  ResultErr
+		Id     int
+	}
+
+	var resultInfo resultRpcErr
+	if nil == json.Unmarshal([]byte(err.Error()), &resultInfo) {
+		return -5 == resultInfo.Error.Code
+	}
+
+	return false
+}
+
+func saveDroppedTransaction(dropped *DroppedTransaction) error {
+	info, err := json.Marshal(*dropped)
+	if nil != err {
+		log.Log.Error(err, " marshal dropped transaction fail")
+		return err
+	}
+
+	if _, err := database.RedisDb.HSet(REDISDROPPEDTRXKEY, dropped.Transaction.Txid, info).Result(); nil != err {
+		log.Log.Error(err, " save dropped transaction to redis fail, transaction hash:", dropped.Transaction.Txid)
+		return err
+	}
+
+	return nil
+}
+
+// GetDroppedTransaction returns the dropped record, a missing replacement is searched again
+func GetDroppedTransaction(txid string) (error, bool, *DroppedTransaction) {
+	bExist, err := database.RedisDb.HExists(REDISDROPPEDTRXKEY, txid).Result()
+	if nil != err {
+		log.Log.Error(err, " GetDroppedTransaction if dropped transaction exist fail, transaction hash:", txid)
+		return err, false, nil
+	}
+	if !bExist {
+		return nil, false, nil
+	}
+
+	info, err := database.RedisDb.HGet(REDISDROPPEDTRXKEY, txid).Result()
+	if nil != err {
+		log.Log.Error(err, " GetDroppedTransaction get dropped transaction fail, transaction hash:", txid)
+		return err, false, nil
+	}
+
+	dropped := DroppedTransaction{}
+	if err := json.Unmarshal([]byte(info), &dropped); nil != err {
+		log.Log.Error(err, " Unmarshal to dropped transaction fail, transaction hash:", txid)
+		return err, false, nil
+	}
+
+	if 0 == len(dropped.ReplacedBy) {
+		if err, allRedis := GetAllRedisUnconfirmedTransaction(); nil == err {
+			if replacedBy := findReplacement(&dropped.Transaction, allRedis); 0 != len(replacedBy) {
+				dropped.Status = REPLACED
+				dropped.ReplacedBy = replacedBy
+				saveDroppedTransaction(&dropped)
+			}
+		}
+	}
+
+	return nil, true, &dropped
+}
+
+// forgetDroppedTransaction deletes dropped records that are too old or got mined after all
+func forgetDroppedTransaction() error {
+	allInfo, err := database.RedisDb.HGetAll(REDISDROPPEDTRXKEY).Result()
+	if nil != err {
+		log.Log.Error(err, " redis get DroppedTransaction fail")
+		return err
+	}
+
+	type blockTxid struct {
+		Txid string
+	}
+
+	now := time.Now().Unix()
+	for txid, info := range allInfo {
+		dropped := DroppedTransaction{}
+		if err := json.Unmarshal([]byte(info), &dropped); nil != err || dropped.DroppedTime < now-DROPPEDKEEPTIME {
+			database.RedisDb.HDel(REDISDROPPEDTRXKEY, txid)
+			continue
+		}
+
+		var result []blockTxid
+		selectSql := fmt.Sprintf("select txid from t_transaction_info where txid='%s' and isfork=0;", txid)
+		if err := database.Db.Raw(selectSql).Scan(&result).Error; nil == err && 0 != len(result) {
+			database.RedisDb.HDel(REDISDROPPEDTRXKEY, txid)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,167 @@
+package notify
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/BlockABC/wallet-btc-service/common/log"
+	"github.com/BlockABC/wallet-btc-service/database"
+	"github.com/BlockABC/wallet-btc-service/database/tables"
+)
+
+// fee rate of one transaction in sat/vB
+type FeeRate struct {
+	Rate  float64
+	Vsize int64
+}
+
+// SortFeeRate sorts the fee rates from low to high
+func SortFeeRate(allRate []FeeRate) {
+	sort.Slice(allRate, func(i, j int) bool {
+		return allRate[i].Rate < allRate[j].Rate
+	})
+}
+
+// FeeRatePercentile returns the rate below which percent of the virtual size is paid, allRate must be sorted
+// from low to high
+func FeeRatePercentile(allRate []FeeRate, percent float64) float64 {
+	var total int64
+	for _, oneRate := range allRate {
+		total += oneRate.Vsize
+	}
+	if 0 == total {
+		return 0
+	}
+
+	var sum int64
+	for _, oneRate := range allRate {
+		sum += oneRate.Vsize
+		if float64(sum) >= float64(total)*percent/100 {
+			return oneRate.Rate
+		}
+	}
+	return allRate[len(allRate)-1].Rate
+}
+
+// getBlockFeeRate returns the fee rate of the non coinbase transactions of the block, it runs after the
+// input value is updated
+func getBlockFeeRate(blockhash string) (error, []FeeRate) {
+	type trxFee struct {
+		Txid     string
+		Vsize    int64
+		Invalue  int64
+		Unknown  int64
+		Outvalue int64
+	}
+
+	var allFee []trxFee
+	selectSql := fmt.Sprintf("select t1.txid, t1.vsize, t2.invalue, t2.unknown, t3.outvalue from t_transaction_info t1 "+
+		"inner join (select hash, sum(value) as invalue, sum(if(0=value, 1, 0)) as unknown from t_input_info where blockhash='%s' group by hash) t2 on t1.txid=t2.hash "+
+		"inner join (select hash, sum(value) as outvalue from t_output_info where blockhash='%s' group by hash) t3 on t1.txid=t3.hash "+
+		"where t1.blockhash='%s' and t1.iscoinbase=0 and t1.vsize>0;", blockhash, blockhash, blockhash)
+	if err := database.Db.Raw(selectSql).Scan(&allFee).Error; nil != err {
+		log.Log.Error(err, " exec sql fail: ", selectSql)
+		return err, nil
+	}
+
+	result := make([]FeeRate, 0, len(allFee))
+	for _, oneFee := range allFee {
+		// input value not updated yet
+		if 0 != oneFee.Unknown || oneFee.Invalue < oneFee.Outvalue {
+			continue
+		}
+		result = append(result, FeeRate{float64(oneFee.Invalue-oneFee.Outvalue) / float64(oneFee.Vsize), oneFee.Vsize})
+	}
+
+	return nil, result
+}
+
+// SaveBlockFee records the fee rate distribution of the block
+func SaveBlockFee(blockhash string, height int32) error {
+	err, allRate := getBlockFeeRate(blockhash)
+	if nil != err {
+		return err
+	}
+
+	blockFee := tables.TableBlockFeeInfo{Blockhash: blockhash, Height: height, Txcount: int64(len(allRate))}
+	if 0 != len(allRate) {
+		SortFeeRate(allRate)
+		for _, oneRate := range allRate {
+			blockFee.Vsize += oneRate.Vsize
+		}
+		blockFee.Minrate = allRate[0].Rate
+		blockFee.P10 = FeeRatePercentile(allRate, 10)
+		blockFee.P25 = FeeRatePercentile(allRate, 25)
+		blockFee.P50 = FeeRatePercentile(allRate, 50)
+		blockFee.P75 = FeeRatePercentile(allRate, 75)
+		blockFee.P90 = FeeRatePercentile(allRate, 90)
+		blockFee.Maxrate = allRate[len(allRate)-1].Rate
+	}
+
+	insertSql := fmt.Sprintf("insert into t_block_fee_info(blockhash, height, txcount, vsize, minrate, p10, p25, p50, p75, p90, maxrate) "+
+		"values('%s', %d, %d, %d, %f, %f, %f, %f, %f, %f, %f) on duplicate key update height=values(height), txcount=values(txcount), vsize=values(vsize), "+
+		"minrate=values(minrate), p10=values(p10), p25=values(p25), p50=values(p50), p75=values(p75), p90=values(p90), maxrate=values(maxrate);",
+		blockFee.Blockhash, blockFee.Height, blockFee.Txcount, blockFee.Vsize, blockFee.Minrate,
+		blockFee.P10, blockFee.P25, blockFee.P50, blockFee.P75, blockFee.P90, blockFee.Maxrate)
+	if err := database.Db.Exec(insertSql).Error; nil != err {
+		log.Log.Error(err, " exec sql fail: ", insertSql)
+		return err
+	}
+
+	return nil
+}
+
+// GetRecentBlockFee returns the fee rate distribution of the last count main chain blocks, highest first
+func GetRecentBlockFee(count int) (error, []tables.TableBlockFeeInfo) {
+	var result []tables.TableBlockFeeInfo
+	selectSql := fmt.Sprintf("select t1.* from t_block_fee_info t1, t_block_info t2 where t1.blockhash=t2.hash and t2.isfork=0 "+
+		"order by t1.height desc limit %d;", count)
+	if err := database.Db.Raw(selectSql).Scan(&result).Error; nil != err {
+		log.Log.Error(err, " exec sql fail: ", selectSql)
+		return err, nil
+	}
+
+	return nil, result
+}
+
+// GetMempoolFeeRate returns the fee rate of the unconfirmed transactions, transactions whose virtual size or
+// input value is unknown are left out
+func GetMempoolFeeRate() (error, []FeeRate) {
+	err, allTransaction := GetAllRedisUnconfirmedTransaction()
+	if nil != err {
+		return err, nil
+	}
+
+	err, allVsize := GetAllRedisTransactionVsize()
+	if nil != err {
+		return err, nil
+	}
+
+	result := make([]FeeRate, 0, len(allTransaction))
+	for _, oneTransaction := range allTransaction {
+		vsize, ok := allVsize[oneTransaction.Txid]
+		if !ok || vsize <= 0 {
+			continue
+		}
+
+		var inValue, outValue int64
+		known := true
+		for _, oneInput := range oneTransaction.Vin {
+			if 0 == oneInput.Value {
+				known = false
+				break
+			}
+			inValue += oneInput.Value
+		}
+		for _, oneOutput := range oneTransaction.Vout {
+			outValue += oneOutput.Value
+		}
+		if !known || inValue < outValue {
+			continue
+		}
+
+		result = append(result, FeeRate{float64(inValue-outValue) / float64(vsize), vsize})
+	}
+
+	return nil, result
+}
@@ -0,0 +1,161 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/BlockABC/wallet-btc-service/common/config"
+	"github.com/BlockABC/wallet-btc-service/common/log"
+	"github.com/BlockABC/wallet-btc-service/database"
+	"github.com/BlockABC/wallet-btc-service/jsonrpc"
+)
+
+const (
+	FOLLOWERCURSOR = "follower"
+)
+
+// StartFollower polls the node best block and ingests every block in height order from the
+// persisted cursor, once caught up it keeps tailing the chain until ctx is done.
+func StartFollower(ctx context.Context) error {
+	interval := time.Duration(config.Cfg.BtcOpt.PollInterval) * time.Second
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+
+	log.Log.Notice("start block follower, poll interval: ", interval)
+	for {
+		if err := followBestBlock(ctx); nil != err {
+			log.Log.Error(err, " block follower fail, retry after ", interval)
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Log.Notice("block follower stopped")
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+func followBestBlock(ctx context.Context) error {
+	err, height, hash := getFollowerCursor()
+	if nil != err {
+		return err
+	}
+
+	err, bestHash := GetBestBlockHash()
+	if nil != err {
+		return err
+	}
+
+	// live, nothing to do
+	if bestHash == hash {
+		return nil
+	}
+
+	err, bestHeader := GetBlockHeader(bestHash)
+	if nil != err {
+		return err
+	}
+
+	// the best chain is not longer than the cursor, a reorganization happened
+	if bestHeader.Height <= height {
+		return followBlock(bestHash)
+	}
+
+	// catch up in height order
+	for blockHeight := height + 1; blockHeight <= bestHeader.Height; blockHeight++ {
+		select {
+		case <-ctx.Done():
+			return nil
+		default:
+		}
+
+		err, blockHash := GetBlockHashWithHeight(blockHeight)
+		if nil != err {
+			return err
+		}
+
+		if err := followBlock(blockHash); nil != err {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func followBlock(hash string) error {
+	err, newBlock := GetBlock(hash)
+	if nil != err {
+		log.Log.Error(err, " followBlock get block fail, block hash: ", hash)
+		return err
+	}
+
+	// drained on shutdown
+	if err := beginBlock(newBlock.Hash); nil != err {
+		return err
+	}
+	err = processBlock(newBlock)
+	endBlock(newBlock.Hash)
+	if nil != err {
+		log.Log.Error(err, " follower process block fail, block height: ", newBlock.Height, ", block hash: ", newBlock.Hash)
+		return err
+	}
+
+	// advance cursor only after the block is stored
+	if err := database.SaveSyncCursor(FOLLOWERCURSOR, newBlock.Height, newBlock.Hash); nil != err {
+		log.Log.Error(err, " save follower cursor fail, block height: ", newBlock.Height, ", block hash: ", newBlock.Hash)
+		return err
+	}
+
+	log.Log.Info("follower ingest block success, block height: ", newBlock.Height, ", block hash: ", newBlock.Hash)
+	return nil
+}
+
+// getFollowerCursor returns the persisted cursor, without one it starts from the stored main chain tip
+func getFollowerCursor() (error, int32, string) {
+	err, bExist, cursor := database.GetSyncCursor(FOLLOWERCURSOR)
+	if nil != err {
+		log.Log.Error(err, " get follower cursor fail")
+		return err, 0, ""
+	}
+	if bExist {
+		return nil, cursor.Height, cursor.Hash
+	}
+
+	type blockTip struct {
+		Height int32
+		Hash   string
+	}
+
+	var result []blockTip
+	selectSql := "select height, hash from t_block_info where isfork = 0 order by height desc limit 1;"
+	if err := database.Db.Raw(selectSql).Scan(&result).Error; nil != err {
+		log.Log.Error(err, " exec sql fail: ", selectSql)
+		return err, 0, ""
+	}
+
+	// empty database, start from genesis
+	if 0 == len(result) {
+		return nil, -1, ""
+	}
+
+	return nil, result[0].Height, result[0].Hash
+}
+
+func GetBestBlockHash() (error, string) {
+	result, err := jsonrpc.Call(1, "getbestblockhash", []interface{}{})
+	if nil != err {
+		log.Log.Error(err, " GetBestBlockHash jsonrpc call getbestblockhash fail")
+		return err, ""
+	}
+
+	var hash string
+	if err := json.Unmarshal(result, &hash); nil != err {
+		log.Log.Error(err, " GetBestBlockHash Unmarshal result to block hash fail")
+		return err, ""
+	}
+
+	return nil, hash
+}
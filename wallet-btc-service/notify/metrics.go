@@ -0,0 +1,63 @@
+package notify
+
+import (
+	"math"
+
+	"github.com/BlockABC/wallet-btc-service/common/config"
+	"github.com/BlockABC/wallet-btc-service/common/log"
+	"github.com/BlockABC/wallet-btc-service/common/prometheus"
+	"github.com/BlockABC/wallet-btc-service/database"
+	"github.com/BlockABC/wallet-btc-service/repairqueue"
+)
+
+// RegisterMetrics registers the metrics of the client computed on every scrape: ingest and node height,
+// unconfirmed transactions in redis, the repair backlog and the transaction goroutines
+func RegisterMetrics() {
+	prometheus.NewGaugeFunc("wallet_btc_ingest_height", "Height of the last block saved on the main chain", func() float64 {
+		err, height := GetBlockDbMaxHeight()
+		if nil != err {
+			log.Log.Error(err, " metrics select max height from t_block_info fail")
+			return math.NaN()
+		}
+		return float64(height)
+	})
+
+	prometheus.NewGaugeFunc("wallet_btc_node_height", "Height of the best block of the node", func() float64 {
+		err, height := GetBlockHeight()
+		if nil != err {
+			return math.NaN()
+		}
+		return float64(height)
+	})
+
+	prometheus.NewGaugeFunc("wallet_btc_unconfirmed_transactions", "Unconfirmed transactions in redis", func() float64 {
+		count, err := database.RedisDb.HLen(REDISUNFMDTRXKEY).Result()
+		if nil != err {
+			log.Log.Error(err, " metrics redis hlen fail, key: ", REDISUNFMDTRXKEY)
+			return math.NaN()
+		}
+		return float64(count)
+	})
+
+	prometheus.NewGaugeFunc("wallet_btc_repair_blocks_pending", "Block hashes waiting in the repair queue", repairJobs(repairqueue.JOBBLOCK, repairqueue.JOBPENDING))
+	prometheus.NewGaugeFunc("wallet_btc_repair_block_states_pending", "Block heights waiting in the repair queue to rebuild their state", repairJobs(repairqueue.JOBBLOCKSTATE, repairqueue.JOBPENDING))
+	prometheus.NewGaugeFunc("wallet_btc_repair_transactions_pending", "Transactions waiting in the repair queue", repairJobs(repairqueue.JOBTRANSACTION, repairqueue.JOBPENDING))
+	prometheus.NewGaugeFunc("wallet_btc_repair_omni_blocks_pending", "Omni block heights waiting in the repair queue", repairJobs(repairqueue.JOBOMNIBLOCK, repairqueue.JOBPENDING))
+	prometheus.NewGaugeFunc("wallet_btc_repair_omni_transactions_pending", "Omni transactions waiting in the repair queue", repairJobs(repairqueue.JOBOMNITRANSACTION, repairqueue.JOBPENDING))
+	prometheus.NewGaugeFunc("wallet_btc_repair_jobs_dead", "Repair jobs out of attempts, waiting to be retried or purged", repairJobs("", repairqueue.JOBDEAD))
+
+	prometheus.NewGaugeFunc("wallet_btc_transaction_goroutines", "Goroutines saving the transactions of a block, lowered while the process runs too many goroutines", func() float64 {
+		return float64(config.TrxGoroutineRuntime)
+	})
+}
+
+// repairJobs returns the gauge of the repair jobs of a type in a state, all types if jobType is empty
+func repairJobs(jobType string, state int) func() float64 {
+	return func() float64 {
+		err, count := repairqueue.Count(jobType, state)
+		if nil != err {
+			return math.NaN()
+		}
+		return float64(count)
+	}
+}
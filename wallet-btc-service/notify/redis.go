@@ -4,13 +4,17 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strconv"
 
 	"github.com/BlockABC/wallet-btc-service/common/log"
 	"github.com/BlockABC/wallet-btc-service/database"
+	"github.com/go-redis/redis"
 )
 
 const (
-	REDISUNFMDTRXKEY = "UnconfirmedTransaction"
+	REDISUNFMDTRXKEY     = "UnconfirmedTransaction"
+	REDISUNFMDADDRESSKEY = "UnconfirmedAddress_" // set of unconfirmed transaction hashes of an address
+	REDISUNFMDVSIZEKEY   = "UnconfirmedTransactionVsize"
 )
 
 type RedisInput struct {
@@ -99,7 +103,7 @@ func convertUnconfirmedTransactionToRedisTransaction(oneTransaction *Transaction
 
 		inputInfo := []info{}
 		findInputInfo := make([]info, 0)
-		selectSql := fmt.Sprintf("select `hash`, `n`, `to`, `value` from t_output_info where (`hash`) in (%s);", strCondition)
+		selectSql := fmt.Sprintf("select `hash`, `n`, `to`, `value` from t_output_info where (`hash`) in (%s) and isfork=0;", strCondition)
 		if err := database.Db.Raw(selectSql).Scan(&inputInfo).Error; nil != err {
 			log.Log.Error(err, " exec sql fail: ", selectSql)
 			return err, nil
@@ -119,7 +123,7 @@ func convertUnconfirmedTransactionToRedisTransaction(oneTransaction *Transaction
 
 		if 0 != len(findInputInfo) {
 			for _, oneInfo := range findInputInfo {
-				updateSql := fmt.Sprintf("update t_output_info set state=2 where `hash`='%s' and `n`=%d;", oneInfo.Hash, oneInfo.N)
+				updateSql := fmt.Sprintf("update t_output_info set state=2 where `hash`='%s' and `n`=%d and isfork=0;", oneInfo.Hash, oneInfo.N)
 				if err := database.Db.Exec(updateSql).Error; nil != err {
 					log.Log.Error(err, " exec sql fail: ", updateSql)
 					continue
@@ -145,7 +149,7 @@ func convertUnconfirmedTransactionToRedisTransaction(oneTransaction *Transaction
 				if oneCacheInput.Txid == oneTransaction.Txid && oneCacheInput.Vout == oneOutput.N {
 					if nil != oneOutput.ScriptPubKey.Addresses && 0 != len(oneOutput.ScriptPubKey.Addresses) {
 						oneCache.Vin[index].Address = oneOutput.ScriptPubKey.Addresses[0]
-						oneCache.Vin[index].Value = int64(oneOutput.Value * 100000000)
+						oneCache.Vin[index].Value = int64(oneOutput.Value)
 						SaveOneRedisTransaction(&oneCache)
 					}
 					bUsed = true
@@ -154,7 +158,7 @@ func convertUnconfirmedTransactionToRedisTransaction(oneTransaction *Transaction
 			}
 		}
 	find:
-		vout = append(vout, RedisOutput{oneOutput.N, int64(oneOutput.Value * 100000000), oneOutput.ScriptPubKey.Asm, oneOutput.ScriptPubKey.Addresses, oneOutput.ScriptPubKey.Type, bUsed})
+		vout = append(vout, RedisOutput{oneOutput.N, int64(oneOutput.Value), oneOutput.ScriptPubKey.Asm, oneOutput.ScriptPubKey.Addresses, oneOutput.ScriptPubKey.Type, bUsed})
 	}
 
 	result := RedisTransaction{oneTransaction.Txid, oneTransaction.ReceiveTime, vin, vout}
@@ -170,7 +174,10 @@ func SaveUnconfirmedTransactionToRedis(oneTransaction *Transaction) error {
 	saveErr := SaveOneRedisTransaction(oneRedisTransaction)
 
 	if nil == saveErr {
+		SaveRedisTransactionVsize(oneTransaction.Txid, oneTransaction.Vsize)
 		oneTransactionNotify(oneTransaction)
+		webhookTransactionNotify(oneRedisTransaction)
+		streamTransactionNotify(oneRedisTransaction)
 	}
 
 	return saveErr
@@ -188,9 +195,114 @@ func SaveOneRedisTransaction(oneRedisTransaction *RedisTransaction) error {
 		return err
 	}
 
+	// address index
+	for _, oneAddress := range redisTransactionAddress(oneRedisTransaction) {
+		if _, err := database.RedisDb.SAdd(REDISUNFMDADDRESSKEY+oneAddress, oneRedisTransaction.Txid).Result(); nil != err {
+			log.Log.Error(err, " save redis address index fail, address:", oneAddress, ", transaction hash:", oneRedisTransaction.Txid)
+			return err
+		}
+	}
+
 	return nil
 }
 
+// redisTransactionAddress returns the distinct input and output addresses of the transaction
+func redisTransactionAddress(oneRedisTransaction *RedisTransaction) []string {
+	result := make([]string, 0)
+	exist := make(map[string]bool)
+	for _, oneInput := range oneRedisTransaction.Vin {
+		if "" != oneInput.Address && !exist[oneInput.Address] {
+			exist[oneInput.Address] = true
+			result = append(result, oneInput.Address)
+		}
+	}
+	for _, oneOutput := range oneRedisTransaction.Vout {
+		if nil != oneOutput.Addresses && 0 != len(oneOutput.Addresses) && !exist[oneOutput.Addresses[0]] {
+			exist[oneOutput.Addresses[0]] = true
+			result = append(result, oneOutput.Addresses[0])
+		}
+	}
+	return result
+}
+
+// RebuildRedisAddressIndex indexes every unconfirmed transaction by address, transactions saved by an older version are not indexed
+func RebuildRedisAddressIndex() error {
+	err, allTransaction := GetAllRedisUnconfirmedTransaction()
+	if nil != err {
+		return err
+	}
+
+	for _, oneTransaction := range allTransaction {
+		for _, oneAddress := range redisTransactionAddress(&oneTransaction) {
+			if _, err := database.RedisDb.SAdd(REDISUNFMDADDRESSKEY+oneAddress, oneTransaction.Txid).Result(); nil != err {
+				log.Log.Error(err, " save redis address index fail, address:", oneAddress, ", transaction hash:", oneTransaction.Txid)
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// getRedisTransactionByAddress returns the unconfirmed transactions of the addresses by the address index,
+// hashes of transactions no longer in redis are removed from the index
+func getRedisTransactionByAddress(address []string) (error, []RedisTransaction) {
+	result := make([]RedisTransaction, 0)
+	if 0 == len(address) {
+		return nil, result
+	}
+
+	pipe := database.RedisDb.Pipeline()
+	allMembersCmd := make([]*redis.StringSliceCmd, 0, len(address))
+	for _, oneAddress := range address {
+		allMembersCmd = append(allMembersCmd, pipe.SMembers(REDISUNFMDADDRESSKEY+oneAddress))
+	}
+	if _, err := pipe.Exec(); nil != err {
+		log.Log.Error(err, " get redis address index fail, address:", address)
+		return err, nil
+	}
+
+	hashs := make([]string, 0)
+	hashAddress := make(map[string][]string)
+	for index, oneCmd := range allMembersCmd {
+		for _, oneHash := range oneCmd.Val() {
+			if _, ok := hashAddress[oneHash]; !ok {
+				hashs = append(hashs, oneHash)
+			}
+			hashAddress[oneHash] = append(hashAddress[oneHash], address[index])
+		}
+	}
+	if 0 == len(hashs) {
+		return nil, result
+	}
+
+	allInfo, err := database.RedisDb.HMGet(REDISUNFMDTRXKEY, hashs...).Result()
+	if nil != err {
+		log.Log.Error(err, " get transaction from redis by address fail, address:", address)
+		return err, nil
+	}
+
+	for index, oneInfo := range allInfo {
+		value, ok := oneInfo.(string)
+		if !ok {
+			// removed from redis
+			for _, oneAddress := range hashAddress[hashs[index]] {
+				database.RedisDb.SRem(REDISUNFMDADDRESSKEY+oneAddress, hashs[index])
+			}
+			continue
+		}
+
+		oneRedisTransaction := RedisTransaction{}
+		if err := json.Unmarshal([]byte(value), &oneRedisTransaction); nil != err {
+			log.Log.Error(err, " Unmarshal to redis transaction fail, key:", hashs[index])
+			continue
+		}
+		result = append(result, oneRedisTransaction)
+	}
+
+	return nil, result
+}
+
 func DeleteRedisBlockTransaction(newBlock *Block) error {
 	hashs := make([]string, 0)
 	for _, oneTransaction := range newBlock.Tx {
@@ -208,10 +320,18 @@ func DeleteRedisTransactionByHashs(hashs []string) error {
 			continue
 		}
 		if bExist {
+			// address index
+			if err, _, oneRedisTransaction := GetRedisUnconfirmedTransactionByTxid(oneHash); nil == err && nil != oneRedisTransaction {
+				for _, oneAddress := range redisTransactionAddress(oneRedisTransaction) {
+					database.RedisDb.SRem(REDISUNFMDADDRESSKEY+oneAddress, oneHash)
+				}
+			}
+
 			_, err := database.RedisDb.HDel(REDISUNFMDTRXKEY, oneHash).Result()
 			if nil != err {
 				log.Log.Error(err, " DeleteRedisTransactionByHashs delete redis transaction fail, transaction hash:", oneHash)
 			}
+			database.RedisDb.HDel(REDISUNFMDVSIZEKEY, oneHash)
 		}
 	}
 
@@ -219,19 +339,13 @@ func DeleteRedisTransactionByHashs(hashs []string) error {
 }
 
 func GetRedisUsedInfoByAddress(address []string) (error, map[string]bool) {
-	allInfo, err := database.RedisDb.HGetAll(REDISUNFMDTRXKEY).Result()
+	err, allTransaction := getRedisTransactionByAddress(address)
 	if nil != err {
-		log.Log.Error(err, " get transaction from redis by address fail, address:", address)
 		return err, nil
 	}
 
 	result := make(map[string]bool)
-	for key, value := range allInfo {
-		oneRedisTransaction := RedisTransaction{}
-		if err := json.Unmarshal([]byte(value), &oneRedisTransaction); nil != err {
-			log.Log.Error(err, " Unmarshal to redis transaction fail, key:", key)
-			continue
-		}
+	for _, oneRedisTransaction := range allTransaction {
 
 		// input
 		for _, oneInput := range oneRedisTransaction.Vin {
@@ -258,19 +372,13 @@ func GetRedisUsedInfoByAddress(address []string) (error, map[string]bool) {
 }
 
 func GetRedisUnconfirmedTransactionByAddress(address []string) (error, []RedisTransaction) {
-	allInfo, err := database.RedisDb.HGetAll(REDISUNFMDTRXKEY).Result()
+	err, allTransaction := getRedisTransactionByAddress(address)
 	if nil != err {
-		log.Log.Error(err, " get transaction from redis by address fail, address:", address)
 		return err, nil
 	}
 
 	temp := make([]RedisTransaction, 0)
-	for key, value := range allInfo {
-		oneRedisTransaction := RedisTransaction{}
-		if err := json.Unmarshal([]byte(value), &oneRedisTransaction); nil != err {
-			log.Log.Error(err, " Unmarshal to redis transaction fail, key:", key)
-			continue
-		}
+	for _, oneRedisTransaction := range allTransaction {
 
 		// input
 		for _, oneInput := range oneRedisTransaction.Vin {
@@ -349,19 +457,13 @@ func GetRedisUnconfirmedTransactionByTxid(txid string) (error, bool, *RedisTrans
 }
 
 func GetRedisUnconfirmedTransactionBalanceByAddress(address []string) (error, map[string]int64) {
-	allInfo, err := database.RedisDb.HGetAll(REDISUNFMDTRXKEY).Result()
+	err, allTransaction := getRedisTransactionByAddress(address)
 	if nil != err {
-		log.Log.Error(err, " get transaction from redis by address fail, address:", address)
 		return err, nil
 	}
 
 	result := make(map[string]int64)
-	for key, value := range allInfo {
-		oneRedisTransaction := RedisTransaction{}
-		if err := json.Unmarshal([]byte(value), &oneRedisTransaction); nil != err {
-			log.Log.Error(err, " Unmarshal to redis transaction fail, key:", key)
-			continue
-		}
+	for _, oneRedisTransaction := range allTransaction {
 
 		// output
 		for _, oneOutput := range oneRedisTransaction.Vout {
@@ -389,19 +491,13 @@ type UnspentOutput struct {
 }
 
 func GetRedisUnconfirmedTransactionUnspentByAddress(address []string) (error, []UnspentOutput) {
-	allInfo, err := database.RedisDb.HGetAll(REDISUNFMDTRXKEY).Result()
+	err, allTransaction := getRedisTransactionByAddress(address)
 	if nil != err {
-		log.Log.Error(err, " get transaction from redis by address fail, address:", address)
 		return err, nil
 	}
 
 	result := make([]UnspentOutput, 0)
-	for key, value := range allInfo {
-		oneRedisTransaction := RedisTransaction{}
-		if err := json.Unmarshal([]byte(value), &oneRedisTransaction); nil != err {
-			log.Log.Error(err, " Unmarshal to redis transaction fail, key:", key)
-			continue
-		}
+	for _, oneRedisTransaction := range allTransaction {
 
 		// output
 		for _, oneOutput := range oneRedisTransaction.Vout {
@@ -435,3 +531,82 @@ func GetAllRedisUnconfirmedTransaction() (error, []RedisTransaction) {
 
 	return nil, result
 }
+
+// GetRedisUnconfirmedSpentByAddress returns the value of confirmed outputs of the addresses spent by unconfirmed transactions
+func GetRedisUnconfirmedSpentByAddress(address []string) (error, map[string]int64) {
+	err, allTransaction := getRedisTransactionByAddress(address)
+	if nil != err {
+		return err, nil
+	}
+
+	addressMap := make(map[string]bool)
+	for _, oneAddress := range address {
+		addressMap[oneAddress] = true
+	}
+
+	allInput := make([]RedisInput, 0)
+	for _, oneRedisTransaction := range allTransaction {
+		for _, oneInput := range oneRedisTransaction.Vin {
+			if addressMap[oneInput.Address] {
+				allInput = append(allInput, oneInput)
+			}
+		}
+	}
+
+	result := make(map[string]int64)
+	if 0 == len(allInput) {
+		return nil, result
+	}
+
+	// outputs of unconfirmed transactions are not in the confirmed balance
+	pipe := database.RedisDb.Pipeline()
+	allExistCmd := make([]*redis.BoolCmd, 0, len(allInput))
+	for _, oneInput := range allInput {
+		allExistCmd = append(allExistCmd, pipe.HExists(REDISUNFMDTRXKEY, oneInput.Txid))
+	}
+	if _, err := pipe.Exec(); nil != err {
+		log.Log.Error(err, " GetRedisUnconfirmedSpentByAddress if transaction exist fail, address:", address)
+		return err, nil
+	}
+
+	for index, oneInput := range allInput {
+		if !allExistCmd[index].Val() {
+			result[oneInput.Address] += oneInput.Value
+		}
+	}
+
+	return nil, result
+}
+
+// SaveRedisTransactionVsize saves the virtual size of an unconfirmed transaction for fee estimation
+func SaveRedisTransactionVsize(txid string, vsize int64) error {
+	if vsize <= 0 {
+		return nil
+	}
+
+	if _, err := database.RedisDb.HSet(REDISUNFMDVSIZEKEY, txid, vsize).Result(); nil != err {
+		log.Log.Error(err, " save transaction vsize to redis fail, transaction hash:", txid)
+		return err
+	}
+	return nil
+}
+
+// GetAllRedisTransactionVsize returns the virtual size of the unconfirmed transactions by hash
+func GetAllRedisTransactionVsize() (error, map[string]int64) {
+	allInfo, err := database.RedisDb.HGetAll(REDISUNFMDVSIZEKEY).Result()
+	if nil != err {
+		log.Log.Error(err, " get transaction vsize from redis fail")
+		return err, nil
+	}
+
+	result := make(map[string]int64)
+	for key, value := range allInfo {
+		vsize, err := strconv.ParseInt(value, 10, 64)
+		if nil != err {
+			log.Log.Error(err, " parse transaction vsize fail, key:", key)
+			continue
+		}
+		result[key] = vsize
+	}
+	return nil, result
+}
@@ -0,0 +1,577 @@
+package notify
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/BlockABC/wallet-btc-service/common/log"
+	"github.com/BlockABC/wallet-btc-service/database"
+	"github.com/BlockABC/wallet-btc-service/database/tables"
+	"github.com/BlockABC/wallet-btc-service/jsonrpc"
+	"github.com/BlockABC/wallet-btc-service/metrics"
+	"github.com/BlockABC/wallet-btc-service/omni"
+	"github.com/BlockABC/wallet-btc-service/webhook"
+)
+
+const (
+	MAXREORGDEPTH = 100 // the deepest reorganization handled automatically
+)
+
+var (
+	ErrStaleBlock = errors.New("block is not on the node best chain")
+
+	reorgMutex sync.Mutex
+)
+
+type BlockHeader struct {
+	Hash              string `json:"hash"`
+	Height            int32  `json:"height"`
+	Previousblockhash string `json:"previousblockhash"`
+}
+
+func GetBlockHeader(hash string) (error, *BlockHeader) {
+	result, err := jsonrpc.Call(1, "getblockheader", []interface{}{hash, true})
+	if nil != err {
+		log.Log.Error(err, " GetBlockHeader jsonrpc call getblockheader fail, block hash: ", hash)
+		return err, nil
+	}
+
+	header := BlockHeader{}
+	if err := json.Unmarshal(result, &header); nil != err {
+		log.Log.Error(err, " GetBlockHeader Unmarshal result to block header fail")
+		return err, nil
+	}
+
+	return nil, &header
+}
+
+func getMainChainBlock(hash string) (error, bool, *tables.TableBlockInfo) {
+	var result []tables.TableBlockInfo
+	if err := database.Db.Where("hash = ? AND isfork = 0", hash).Find(&result).Error; nil != err {
+		log.Log.Error(err, " select * from t_block_info fail, block hash: ", hash)
+		return err, false, nil
+	}
+
+	if 0 == len(result) {
+		return nil, false, nil
+	}
+
+	return nil, true, &result[0]
+}
+
+func countMainChainBlock(condition string) (error, int) {
+	type blockCount struct {
+		Num int
+	}
+
+	var result blockCount
+	selectSql := fmt.Sprintf("select count(*) as num from t_block_info where isfork = 0 and %s;", condition)
+	if err := database.Db.Raw(selectSql).Scan(&result).Error; nil != err {
+		log.Log.Error(err, " exec sql fail: ", selectSql)
+		return err, 0
+	}
+
+	return nil, result.Num
+}
+
+// HandleChainReorganization must run before newBlock is saved. When newBlock does not extend
+// the stored main chain it walks back to the common ancestor, reverts the orphaned blocks and
+// ingests the blocks of the new branch between the ancestor and newBlock.
+func HandleChainReorganization(newBlock *Block) error {
+	if 0 == len(newBlock.Previousblockhash) {
+		return nil
+	}
+
+	reorgMutex.Lock()
+	defer reorgMutex.Unlock()
+
+	err, bPrevMain, ancestor := getMainChainBlock(newBlock.Previousblockhash)
+	if nil != err {
+		return err
+	}
+
+	branch := make([]string, 0)
+	if bPrevMain {
+		// a competing block at the same height or above
+		err, num := countMainChainBlock(fmt.Sprintf("height >= %d and hash != '%s'", newBlock.Height, newBlock.Hash))
+		if nil != err {
+			return err
+		}
+		if 0 == num {
+			return nil
+		}
+	} else {
+		// parent height not stored yet, lost blocks are filled by repair
+		err, num := countMainChainBlock(fmt.Sprintf("height = %d", newBlock.Height-1))
+		if nil != err {
+			return err
+		}
+		if 0 == num {
+			return nil
+		}
+
+		// walk back to common ancestor
+		hash := newBlock.Previousblockhash
+		for depth := 0; ; depth++ {
+			if depth >= MAXREORGDEPTH {
+				return fmt.Errorf("common ancestor of block %s not found within %d blocks", newBlock.Hash, MAXREORGDEPTH)
+			}
+
+			err, bMain, oneBlock := getMainChainBlock(hash)
+			if nil != err {
+				return err
+			}
+			if bMain {
+				ancestor = oneBlock
+				break
+			}
+
+			err, header := GetBlockHeader(hash)
+			if nil != err {
+				return err
+			}
+			branch = append([]string{hash}, branch...)
+			hash = header.Previousblockhash
+		}
+	}
+
+	// the node may have switched again
+	err, bestHash := GetBlockHashWithHeight(newBlock.Height)
+	if nil != err {
+		return err
+	}
+	if bestHash != newBlock.Hash {
+		return ErrStaleBlock
+	}
+
+	err, orphanBlocks := getOrphanBlocks(ancestor.Height)
+	if nil != err {
+		return err
+	}
+
+	log.Log.Notice("chain reorganization, common ancestor height: ", ancestor.Height, ", hash: ", ancestor.Hash,
+		", orphan blocks: ", len(orphanBlocks), ", new branch blocks: ", len(branch)+1, ", new block hash: ", newBlock.Hash)
+
+	return reorganize(orphanBlocks, branch)
+}
+
+// getOrphanBlocks returns the stored main chain blocks above height which are no longer on the node best chain, highest first
+func getOrphanBlocks(height int32) (error, []tables.TableBlockInfo) {
+	var allBlock []tables.TableBlockInfo
+	if err := database.Db.Where("height > ? AND isfork = 0", height).Order("height desc").Find(&allBlock).Error; nil != err {
+		log.Log.Error(err, " select * from t_block_info fail, height greater than: ", height)
+		return err, nil
+	}
+
+	orphanBlocks := make([]tables.TableBlockInfo, 0)
+	for _, oneBlock := range allBlock {
+		err, hash := GetBlockHashWithHeight(oneBlock.Height)
+		if nil != err {
+			if !isBlockHeightOutOfRange(err) {
+				return err, nil
+			}
+			hash = ""
+		}
+
+		if hash != oneBlock.Hash {
+			orphanBlocks = append(orphanBlocks, oneBlock)
+		}
+	}
+
+	return nil, orphanBlocks
+}
+
+func isBlockHeightOutOfRange(err error) bool {
+	type ResultErr struct {
+		Code    int
+		Message string
+	}
+	type resultRpcErr struct {
+		Result string
+		Error  ResultErr
+		Id     int
+	}
+
+	var resultInfo resultRpcErr
+	if nil == json.Unmarshal([]byte(err.Error()), &resultInfo) {
+		return -8 == resultInfo.Error.Code
+	}
+
+	return false
+}
+
+func reorganize(orphanBlocks []tables.TableBlockInfo, branch []string) error {
+	// revert orphan blocks, highest first
+	requeueTransaction := make([]RedisTransaction, 0)
+	for _, oneBlock := range orphanBlocks {
+		err, allTransaction := revertBlock(&oneBlock)
+		if nil != err {
+			log.Log.Error(err, " revert orphan block fail, block height: ", oneBlock.Height, ", block hash: ", oneBlock.Hash)
+			return err
+		}
+		requeueTransaction = append(requeueTransaction, allTransaction...)
+
+		log.Log.Notice("revert orphan block success, block height: ", oneBlock.Height, ", block hash: ", oneBlock.Hash)
+	}
+
+	// orphan transactions go back to unconfirmed
+	requeueOrphanTransaction(requeueTransaction)
+
+	// ingest new branch, lowest first
+	for _, oneHash := range branch {
+		if err := connectBranchBlock(oneHash); nil != err {
+			log.Log.Error(err, " connect new branch block fail, block hash: ", oneHash)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// restoreSpentOutputSql returns the sql marking the outputs spent by the main chain inputs of a block as
+// unspent, of one transaction of the block if txid is not empty
+func restoreSpentOutputSql(hash string, txid string) string {
+	condition := fmt.Sprintf("t2.blockhash='%s'", hash)
+	if "" != txid {
+		condition += fmt.Sprintf(" and t2.hash='%s'", txid)
+	}
+	return fmt.Sprintf("update t_output_info t1, t_input_info t2 set t1.state=0 where %s and t2.isfork=0 and t1.hash=t2.txid and t1.n=t2.vout and t1.isfork=0;", condition)
+}
+
+// revertBlock marks the block as fork, restores the outputs it spent and returns its non coinbase
+// transactions as unconfirmed transactions
+func revertBlock(oneBlock *tables.TableBlockInfo) (error, []RedisTransaction) {
+	err, allTransaction := getBlockRedisTransaction(oneBlock.Hash)
+	if nil != err {
+		return err, nil
+	}
+
+	allSql := []string{
+		// restore spent output
+		restoreSpentOutputSql(oneBlock.Hash, ""),
+
+		// mark fork
+		fmt.Sprintf("update t_block_info set isfork=1 where hash='%s';", oneBlock.Hash),
+		fmt.Sprintf("update t_transaction_info set isfork=1 where blockhash='%s';", oneBlock.Hash),
+		fmt.Sprintf("update t_input_info set isfork=1, `from`='', `value`=0 where blockhash='%s';", oneBlock.Hash),
+		fmt.Sprintf("update t_output_info set isfork=1 where blockhash='%s';", oneBlock.Hash),
+
+		// address index
+		fmt.Sprintf("delete from t_transaction_input_output_address_info where blockhash='%s';", oneBlock.Hash),
+		fmt.Sprintf("delete from t_output_address_info where blockhash='%s';", oneBlock.Hash),
+
+		// fee rate distribution
+		fmt.Sprintf("delete from t_block_fee_info where blockhash='%s';", oneBlock.Hash),
+	}
+
+	dbTx := database.Db.Begin()
+	if err := dbTx.Error; nil != err {
+		log.Log.Error(err, " revertBlock start database transaction fail")
+		return err, nil
+	}
+
+	for _, oneSql := range allSql {
+		if err := dbTx.Exec(oneSql).Error; nil != err {
+			log.Log.Error(err, " exec sql fail: ", oneSql)
+			dbTx.Rollback()
+			return err, nil
+		}
+	}
+
+	// address balance, the block is fork now so it is only reverted
+	addressBalanceMutex.Lock()
+	err = refreshAddressBalance(dbTx, []string{oneBlock.Hash})
+	addressBalanceMutex.Unlock()
+	if nil != err {
+		dbTx.Rollback()
+		return err, nil
+	}
+
+	if err := dbTx.Commit().Error; nil != err {
+		log.Log.Error(err, " revertBlock commit fail, block hash: ", oneBlock.Hash)
+		dbTx.Rollback()
+		return err, nil
+	}
+
+	// omni transaction
+	if err := omni.DeleteOmniBlockTransaction(oneBlock.Hash); nil != err {
+		log.Log.Error(err, " revertBlock delete omni transaction fail, block hash: ", oneBlock.Hash)
+		return err, nil
+	}
+
+	// watched transactions, their confirmations are tracked again in the new branch
+	if err := RevertConfirmation(oneBlock.Hash); nil != err {
+		log.Log.Error(err, " revertBlock revert confirmation fail, block hash: ", oneBlock.Hash)
+	}
+
+	return nil, allTransaction
+}
+
+// getBlockRedisTransaction rebuilds the non coinbase transactions of a stored block in the redis format
+func getBlockRedisTransaction(blockhash string) (error, []RedisTransaction) {
+	var allTrx []tables.TableTransactionInfo
+	if err := database.Db.Where("blockhash = ? AND iscoinbase = 0", blockhash).Find(&allTrx).Error; nil != err {
+		log.Log.Error(err, " select * from t_transaction_info fail, block hash: ", blockhash)
+		return err, nil
+	}
+
+	var allInput []tables.TableInputInfo
+	if err := database.Db.Where("blockhash = ?", blockhash).Order("id asc").Find(&allInput).Error; nil != err {
+		log.Log.Error(err, " select * from t_input_info fail, block hash: ", blockhash)
+		return err, nil
+	}
+
+	var allOutput []tables.TableOutputInfo
+	if err := database.Db.Where("blockhash = ?", blockhash).Order("n asc").Find(&allOutput).Error; nil != err {
+		log.Log.Error(err, " select * from t_output_info fail, block hash: ", blockhash)
+		return err, nil
+	}
+
+	result := make([]RedisTransaction, 0)
+	receiveTime := time.Now().Unix()
+	for _, oneTrx := range allTrx {
+		vin := make([]RedisInput, 0)
+		for _, oneInput := range allInput {
+			if oneInput.Hash == oneTrx.Txid {
+				vin = append(vin, RedisInput{oneInput.Txid, oneInput.Vout, oneInput.From, oneInput.Value})
+			}
+		}
+
+		vout := make([]RedisOutput, 0)
+		for _, oneOutput := range allOutput {
+			if oneOutput.Hash == oneTrx.Txid {
+				var addresses []string
+				if "" != oneOutput.To {
+					addresses = []string{oneOutput.To}
+				}
+				vout = append(vout, RedisOutput{oneOutput.N, oneOutput.Value, oneOutput.Asm, addresses, oneOutput.Type, false})
+			}
+		}
+
+		result = append(result, RedisTransaction{oneTrx.Txid, receiveTime, vin, vout})
+	}
+
+	return nil, result
+}
+
+func requeueOrphanTransaction(allTransaction []RedisTransaction) {
+	for index, oneTransaction := range allTransaction {
+		for _, oneInput := range oneTransaction.Vin {
+			bParent := false
+			for parentIndex, oneParent := range allTransaction {
+				if oneParent.Txid != oneInput.Txid {
+					continue
+				}
+				bParent = true
+				for outputIndex, oneOutput := range oneParent.Vout {
+					if oneOutput.N == oneInput.Vout {
+						allTransaction[parentIndex].Vout[outputIndex].IsSpent = true
+					}
+				}
+			}
+
+			// spent by unconfirmed transaction
+			if !bParent {
+				updateSql := fmt.Sprintf("update t_output_info set state=2 where `hash`='%s' and `n`=%d and isfork=0;", oneInput.Txid, oneInput.Vout)
+				if err := database.Db.Exec(updateSql).Error; nil != err {
+					log.Log.Error(err, " exec sql fail: ", updateSql)
+				}
+			}
+		}
+		allTransaction[index].ReceiveTime = time.Now().Unix()
+	}
+
+	// virtual size for fee estimation
+	allVsize := make(map[string]int64)
+	if 0 != len(allTransaction) {
+		hashs := make([]string, 0, len(allTransaction))
+		for _, oneTransaction := range allTransaction {
+			hashs = append(hashs, oneTransaction.Txid)
+		}
+		var allTrx []tables.TableTransactionInfo
+		if err := database.Db.Select("txid, vsize").Where("txid IN (?)", hashs).Find(&allTrx).Error; nil != err {
+			log.Log.Error(err, " select txid, vsize from t_transaction_info fail")
+		}
+		for _, oneTrx := range allTrx {
+			allVsize[oneTrx.Txid] = oneTrx.Vsize
+		}
+	}
+
+	for _, oneTransaction := range allTransaction {
+		if err := SaveOneRedisTransaction(&oneTransaction); nil != err {
+			log.Log.Error(err, " requeue orphan transaction fail, transaction hash: ", oneTransaction.Txid)
+			continue
+		}
+		SaveRedisTransactionVsize(oneTransaction.Txid, allVsize[oneTransaction.Txid])
+		log.Log.Info("requeue orphan transaction success, transaction hash: ", oneTransaction.Txid)
+	}
+}
+
+func connectBranchBlock(hash string) error {
+	err, newBlock := GetBlock(hash)
+	if nil != err {
+		log.Log.Error(err, " connectBranchBlock get block fail, block hash: ", hash)
+		return err
+	}
+
+	var forkBlock []tables.TableBlockInfo
+	if err := database.Db.Where("hash = ? AND isfork = 1", hash).Find(&forkBlock).Error; nil != err {
+		log.Log.Error(err, " select * from t_block_info fail, block hash: ", hash)
+		return err
+	}
+
+	if 0 == len(forkBlock) {
+		if err := SaveBlock(newBlock); nil != err {
+			return err
+		}
+	} else {
+		if err := reconnectForkBlock(newBlock); nil != err {
+			return err
+		}
+	}
+
+	begin := time.Now()
+	omni.HandleOmniBlock(newBlock.Height)
+	metrics.ObserveStage(metrics.STAGEOMNI, begin)
+
+	log.Log.Notice("connect new branch block success, block height: ", newBlock.Height, ", block hash: ", newBlock.Hash)
+	return nil
+}
+
+// reconnectForkBlock moves a block reverted by an earlier reorganization back to the main chain
+func reconnectForkBlock(newBlock *Block) error {
+	allSql := []string{
+		fmt.Sprintf("update t_block_info set isfork=0 where hash='%s';", newBlock.Hash),
+		fmt.Sprintf("update t_transaction_info set isfork=0 where blockhash='%s';", newBlock.Hash),
+		fmt.Sprintf("update t_input_info set isfork=0 where blockhash='%s';", newBlock.Hash),
+		fmt.Sprintf("update t_output_info set isfork=0 where blockhash='%s';", newBlock.Hash),
+	}
+
+	dbTx := database.Db.Begin()
+	if err := dbTx.Error; nil != err {
+		log.Log.Error(err, " reconnectForkBlock start database transaction fail")
+		return err
+	}
+
+	for _, oneSql := range allSql {
+		if err := dbTx.Exec(oneSql).Error; nil != err {
+			log.Log.Error(err, " exec sql fail: ", oneSql)
+			dbTx.Rollback()
+			return err
+		}
+	}
+
+	// output address index
+	for index, _ := range newBlock.Tx {
+		newBlock.Tx[index].BlockHash = newBlock.Hash
+		newBlock.Tx[index].BlockTime = newBlock.Time
+		newBlock.Tx[index].Blockheight = newBlock.Height
+		newBlock.Tx[index].Position = int32(index)
+
+		oneTrx := &newBlock.Tx[index]
+		addressObject := make([]interface{}, 0)
+		outputAddressObject := make([]interface{}, 0)
+		for _, oneOutput := range oneTrx.Vout {
+			if 0 != len(oneOutput.ScriptPubKey.Addresses) {
+				bFind := false
+				for _, oneExist := range addressObject {
+					if oneExist.(string) == oneOutput.ScriptPubKey.Addresses[0] {
+						bFind = true
+						break
+					}
+				}
+				if !bFind {
+					addressObject = append(addressObject, oneOutput.ScriptPubKey.Addresses[0])
+				}
+			}
+
+			for _, oneAddress := range oneOutput.ScriptPubKey.Addresses {
+				outputAddressObject = append(outputAddressObject, tables.TableOutputAddressInfo{
+					Blockhash: newBlock.Hash,
+					Hash:      oneTrx.Txid,
+					N:         oneOutput.N,
+					Address:   oneAddress,
+				})
+			}
+		}
+
+		if err := batchExecTransactionDbOperate(dbTx, oneTrx, addressObject); nil != err {
+			dbTx.Rollback()
+			return err
+		}
+		if err := batchExecTransactionDbOperate(dbTx, oneTrx, outputAddressObject); nil != err {
+			dbTx.Rollback()
+			return err
+		}
+	}
+
+	if err := dbTx.Commit().Error; nil != err {
+		log.Log.Error(err, " reconnectForkBlock commit fail, block hash: ", newBlock.Hash)
+		dbTx.Rollback()
+		return err
+	}
+
+	// spent output, input from and input address
+	if err := updateStateAndFrom(newBlock.Tx); nil != err {
+		return err
+	}
+
+	// address balance
+	if err := UpdateAddressBalance([]string{newBlock.Hash}); nil != err {
+		return err
+	}
+
+	// fee rate distribution, only used by the fee estimator
+	SaveBlockFee(newBlock.Hash, newBlock.Height)
+
+	// webhook events of the block, the ones sent before the block was orphaned are not sent again
+	webhook.PublishBlock(newBlock.Hash, newBlock.Height)
+
+	// stream the block to the http servers
+	streamBlockNotify(newBlock)
+
+	if err := DeleteRedisBlockTransaction(newBlock); nil != err {
+		return err
+	}
+
+	// drop unconfirmed transaction double spent by the block
+	return removeConflictTransaction(newBlock)
+}
+
+// repairFork compares the stored chain tip with the node and reverts the blocks the node no longer
+// considers part of its best chain, it heals reorganizations missed by the block notification
+func repairFork() error {
+	err, dbHeight := GetBlockDbMaxHeight()
+	if nil != err {
+		log.Log.Error(err, " repairFork get database max height fail")
+		return err
+	}
+	if 0 == dbHeight {
+		return nil
+	}
+
+	reorgMutex.Lock()
+	defer reorgMutex.Unlock()
+
+	beginHeight := dbHeight - MAXREORGDEPTH
+	if beginHeight < 0 {
+		beginHeight = 0
+	}
+
+	err, orphanBlocks := getOrphanBlocks(beginHeight)
+	if nil != err {
+		return err
+	}
+
+	if 0 == len(orphanBlocks) {
+		return nil
+	}
+
+	log.Log.Notice("repair fork found orphan blocks: ", len(orphanBlocks), ", database max height: ", dbHeight)
+
+	// lost main chain blocks are filled by repair lost block
+	return reorganize(orphanBlocks, []string{})
+}
@@ -46,6 +46,13 @@ func RepairAll() (errInfo error) {
 		}
 	}()
 
+	// revert blocks missed by chain reorganization
+	if err := repairFork(); nil != err {
+		log.Log.Error(err, " repair fork fail when repair all")
+		errInfo = err
+		return
+	}
+
 	// repair lost block
 	if err := repairLostBlock(blockTimerBegin, blockTimerEnd); nil != err {
 		log.Log.Error(err, " repair lost block fail when repair all")
@@ -74,13 +81,20 @@ func RepairAll() (errInfo error) {
 		return
 	}
 
+	// repair t_address_balance_info
+	if err := repairAddressBalance(blockTimerBegin, blockTimerEnd); nil != err {
+		log.Log.Error(err, " repair address balance fail when repair all")
+		errInfo = err
+		return
+	}
+
 	return nil
 }
 
 func repairLostBlock(begin, end int32) error {
 	blockHeights := []tables.TableBlockInfo{}
-	if err := database.Db.Select("height").Where("height >= ? AND height < ?", begin, end).Order("height asc").Find(&blockHeights).Error; nil != err {
-		log.Log.Error(err, fmt.Sprintf(" exec sql fail select height from t_block_info where height >= %d and height<%d ", begin, end))
+	if err := database.Db.Select("height").Where("height >= ? AND height < ? AND isfork = 0", begin, end).Order("height asc").Find(&blockHeights).Error; nil != err {
+		log.Log.Error(err, fmt.Sprintf(" exec sql fail select height from t_block_info where height >= %d and height<%d and isfork=0 ", begin, end))
 		return err
 	}
 
@@ -224,7 +238,7 @@ func GetBlockDbMaxHeight() (errInfo error, blockheight int32) {
 	}
 
 	var result maxHeight
-	selectSql := "select max(height) as end from t_block_info;"
+	selectSql := "select max(height) as end from t_block_info where isfork = 0;"
 	if err := database.Db.Raw(selectSql).Scan(&result).Error; nil != err {
 		errInfo = err
 		return
@@ -275,7 +289,7 @@ func repairLostTransaction(begin, end int32) error {
 	defer database.Db.Exec("DROP TABLE t_temp_transaction_count;")
 
 	// insert transaction count data
-	blockHashSelectSql := fmt.Sprintf("select hash from t_block_info where height >= %d AND height < %d", begin, end)
+	blockHashSelectSql := fmt.Sprintf("select hash from t_block_info where height >= %d AND height < %d AND isfork = 0", begin, end)
 	insertSql := fmt.Sprintf(`insert into t_temp_transaction_count(blockhash, ntx) select blockhash, count(*) from t_transaction_info where blockhash in (%s) group by blockhash;`, blockHashSelectSql)
 	if err := database.Db.Exec(insertSql).Error; nil != err {
 		log.Log.Error(err, " exec sql fail: ", insertSql)
@@ -324,14 +338,9 @@ func repairLostTransaction(begin, end int32) error {
 
 	// insert transaction hash
 	for _, oneBlock := range realBlockHash {
-		result, err := jsonrpc.Call(1, "getblock", []interface{}{oneBlock.Blockhash, 2})
+		err, newBlock := GetBlock(oneBlock.Blockhash)
 		if nil != err {
-			log.Log.Error(err, " repairLostTransaction jsonrpc call getblock fail, hash: ", oneBlock.Blockhash)
-			return err
-		}
-		newBlock := Block{}
-		if err := json.Unmarshal(result, &newBlock); nil != err {
-			log.Log.Error(err, " repairLostTransaction Unmarshal result to block struct fail")
+			log.Log.Error(err, " repairLostTransaction get block fail, hash: ", oneBlock.Blockhash)
 			return err
 		}
 
@@ -376,7 +385,7 @@ func repairLostTransaction(begin, end int32) error {
 	}
 
 	// find lost transaction
-	deleteTrxSql := "delete t1 from t_temp_lost_transaction_hash t1, t_transaction_info t2 where t1.txid = t2.txid;"
+	deleteTrxSql := "delete t1 from t_temp_lost_transaction_hash t1, t_transaction_info t2 where t1.txid = t2.txid and t2.isfork = 0;"
 	if err := database.Db.Exec(deleteTrxSql).Error; nil != err {
 		log.Log.Error(err, " exec sql fail: ", deleteTrxSql)
 		return err
@@ -429,10 +438,10 @@ func repairLostTransaction(begin, end int32) error {
 }
 
 func repairStateAndFrom(begin, end int32) error {
-	subquerySql := fmt.Sprintf("select hash from t_block_info where height >= %d AND height < %d", begin, end)
+	subquerySql := fmt.Sprintf("select hash from t_block_info where height >= %d AND height < %d AND isfork = 0", begin, end)
 
 	// update t_output_info state
-	updateOutputStateSql := fmt.Sprintf("update t_output_info t1, t_input_info t2 set t1.state=1 where t1.hash=t2.txid and t1.n=t2.vout and t1.blockhash in(%s);", subquerySql)
+	updateOutputStateSql := fmt.Sprintf("update t_output_info t1, t_input_info t2 set t1.state=1 where t1.hash=t2.txid and t1.n=t2.vout and t2.isfork=0 and t1.blockhash in(%s);", subquerySql)
 	if err := database.Db.Exec(updateOutputStateSql).Error; nil != err {
 		log.Log.Error(err, " exec sql fail: ", updateOutputStateSql)
 		return err
@@ -440,7 +449,7 @@ func repairStateAndFrom(begin, end int32) error {
 	log.Log.Info("repair state update t_output_info state with t_input_info success, block height begin:", begin, ", block height end:", end)
 
 	// update t_input_info from and value with t_output_info
-	updateInputFromSql := fmt.Sprintf("update t_input_info t1, t_output_info t2 set t1.from=t2.to, t1.value=t2.value where t1.txid=t2.hash and t1.vout=t2.n and t1.blockhash in(%s);", subquerySql)
+	updateInputFromSql := fmt.Sprintf("update t_input_info t1, t_output_info t2 set t1.from=t2.to, t1.value=t2.value where t1.txid=t2.hash and t1.vout=t2.n and t2.isfork=0 and t1.blockhash in(%s);", subquerySql)
 	if err := database.Db.Exec(updateInputFromSql).Error; nil != err {
 		log.Log.Error(err, " exec sql fail: ", updateInputFromSql)
 		return err
@@ -451,14 +460,14 @@ func repairStateAndFrom(begin, end int32) error {
 }
 
 func repairTransactionAddress(begin, end int32) error {
-	insertInputSql := fmt.Sprintf("replace into t_transaction_input_output_address_info (blockhash, `time`, txid, `address`, isfrom) select distinct blockhash, `time`, `hash`, `from`, 1 from t_input_info where `from` != '' and blockhash in (select hash from t_block_info where height >= %d and height < %d);",
+	insertInputSql := fmt.Sprintf("replace into t_transaction_input_output_address_info (blockhash, `time`, height, position, txid, `address`, isfrom) select distinct t1.blockhash, t1.time, t2.blockheight, t2.position, t1.hash, t1.from, 1 from t_input_info t1, t_transaction_info t2 where t1.from != '' and t2.txid=t1.hash and t2.isfork=0 and t1.blockhash in (select hash from t_block_info where height >= %d and height < %d and isfork = 0);",
 		begin, end)
 	if err := database.Db.Exec(insertInputSql).Error; nil != err {
 		log.Log.Error(err, " exec sql fail: ", insertInputSql)
 		return err
 	}
 	log.Log.Info("repairTransactionAddress insert into t_transaction_input_output_address_info input address success, block height begin:", begin, ", end:", end)
-	insertOutputSql := fmt.Sprintf("replace into t_transaction_input_output_address_info (blockhash, `time`, txid, `address`, isfrom) select distinct blockhash, `time`, `hash`, `to`, 0 from t_output_info where `to` != '' and blockhash in (select hash from t_block_info where height >= %d and height < %d);",
+	insertOutputSql := fmt.Sprintf("replace into t_transaction_input_output_address_info (blockhash, `time`, height, position, txid, `address`, isfrom) select distinct t1.blockhash, t1.time, t2.blockheight, t2.position, t1.hash, t1.to, 0 from t_output_info t1, t_transaction_info t2 where t1.to != '' and t2.txid=t1.hash and t2.isfork=0 and t1.blockhash in (select hash from t_block_info where height >= %d and height < %d and isfork = 0);",
 		begin, end)
 	if err := database.Db.Exec(insertOutputSql).Error; nil != err {
 		log.Log.Error(err, " exec sql fail: ", insertOutputSql)
@@ -1,26 +1,25 @@
 package notify
 
 import (
-	"bufio"
-	"encoding/json"
 	"fmt"
-	"io"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 
 	"github.com/BlockABC/wallet-btc-service/common/config"
 	"github.com/BlockABC/wallet-btc-service/common/log"
-	"github.com/BlockABC/wallet-btc-service/common/utility"
 	"github.com/BlockABC/wallet-btc-service/database"
 	"github.com/BlockABC/wallet-btc-service/database/tables"
-	"github.com/BlockABC/wallet-btc-service/jsonrpc"
+	"github.com/BlockABC/wallet-btc-service/repairqueue"
 )
 
+// BlockRepair saves the blocks failed to save, they are block jobs of the repair queue
 type BlockRepair struct {
+	// repair file written before the repair queue, imported once
 	Filename string
-	Rw       sync.RWMutex
 }
 
 func NewBlockRepair() *BlockRepair {
@@ -29,226 +28,75 @@ func NewBlockRepair() *BlockRepair {
 	return &BlockRepair{Filename: baseDir + "/repairBlock"}
 }
 
-func (repair *BlockRepair) StoreFailHash(hash string) error {
-	repair.Rw.Lock()
-	defer repair.Rw.Unlock()
-
-	// open file
-	fs, err := os.OpenFile(repair.Filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
-	if nil != err {
-		log.Log.Error(err, " store fail block hash open file fail, block hash:", hash)
-		return err
-	}
-	defer fs.Close()
+// ImportFile queues the block hashes left in the repair file
+func (repair *BlockRepair) ImportFile() error {
+	return repairqueue.ImportFile(repairqueue.JOBBLOCK, repair.Filename)
+}
 
-	// write block hash
-	buf := bufio.NewWriter(fs)
-	if _, err := fmt.Fprintln(buf, hash); nil != err {
-		log.Log.Error(err, " store fail block hash write file fail, block hash:", hash)
-		return err
-	}
-	result := buf.Flush()
-	if nil == result {
-		log.Log.Info("store fail block hash success, block hash:", hash)
-	} else {
-		log.Log.Error("store fail block hash fail, block hash:", hash)
-	}
-	return result
+func (repair *BlockRepair) StoreFailHash(hash string) error {
+	return repair.BatchStoreFailHash([]string{hash})
 }
 
 func (repair *BlockRepair) BatchStoreFailHash(allHash []string) error {
-	repair.Rw.Lock()
-	defer repair.Rw.Unlock()
-
-	// open file
-	fs, err := os.OpenFile(repair.Filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
-	if nil != err {
-		log.Log.Error(err, "batch store block open file fail, block hashs:", allHash)
+	if err := repairqueue.Enqueue(repairqueue.JOBBLOCK, allHash); nil != err {
+		log.Log.Error(err, " store fail block hash fail, block hashs:", allHash)
 		return err
 	}
-	defer fs.Close()
-
-	// write block hash
-	buf := bufio.NewWriter(fs)
-	for _, oneHash := range allHash {
-		if _, err := fmt.Fprintln(buf, oneHash); nil != err {
-			log.Log.Error(err, " batch store fail block hash write one block hash to file fail, one block hash:", oneHash)
-		}
-	}
-	result := buf.Flush()
-	if nil == result {
-		log.Log.Info("batch store fail block hash success, block hashs:", allHash)
-	} else {
-		log.Log.Error("batch store fail block hash fail, block hashs:", allHash)
-	}
-	return result
+	return nil
 }
 
+// RepairAllItems saves the due blocks of the repair queue, a block saved already is done
 func (repair *BlockRepair) RepairAllItems() error {
-	if !utility.IsFileExist(repair.Filename) {
-		return nil
-	}
-
-	repair.Rw.Lock()
-
-	// open file
-	fs, err := os.Open(repair.Filename)
-	if nil != err {
-		log.Log.Error(err, " RepairAllItems open block file fail")
-		repair.Rw.Unlock()
+	err, allJob := repairqueue.Claim(repairqueue.JOBBLOCK)
+	if nil != err || 0 == len(allJob) {
 		return err
 	}
 
-	// read file
-	allHash := []string{}
-	br := bufio.NewReader(fs)
-	for {
-		hash, _, err := br.ReadLine()
-		if err == io.EOF {
-			break
-		} else if nil != err {
-			log.Log.Error(err, " read repair block file fail")
-			repair.Rw.Unlock()
-			fs.Close()
-			return err
-		}
-
-		bExist := false
-		for _, v := range allHash {
-			if v == string(hash) {
-				bExist = true
-				break
-			}
-		}
-		if !bExist {
-			allHash = append(allHash, string(hash))
-		}
-	}
-	fs.Close()
-
-	// clean file
-	if newFs, err := os.OpenFile(repair.Filename, os.O_WRONLY|os.O_TRUNC, 0666); nil != err {
-		newFs.Close()
-	}
-	repair.Rw.Unlock()
-
-	if 0 == len(allHash) {
-		return nil
+	allHash := make([]string, 0, len(allJob))
+	jobMap := make(map[string]*tables.TableRepairJobInfo)
+	for index := range allJob {
+		allHash = append(allHash, allJob[index].Jobkey)
+		jobMap[allJob[index].Jobkey] = &allJob[index]
 	}
 
 	// get real fail block hash
-	err, realHashs := getRealBlockHashs(allHash)
+	err, realHashs := simpleGetRealBlockHashs(allHash)
 	if nil != err {
-		repair.BatchStoreFailHash(allHash)
+		return err
+	}
+	if err := repairqueue.Done(repairqueue.JOBBLOCK, exclude(allHash, realHashs)); nil != err {
 		return err
 	}
 
-	if nil == realHashs || len(realHashs) == 0 {
+	if 0 == len(realHashs) {
 		return nil
 	}
 	log.Log.Info("repair fail block get real block hash success, real fail block hashs:", realHashs)
 
-	return repair.repairBlocks(realHashs)
-}
-
-type TableTempBlockHash struct {
-	Hash string `json:"hash"     		gorm:"column:hash;type:char(64);unique"`
-}
-
-func (t *TableTempBlockHash) TableName() string {
-	return "t_temp_block_hash"
+	return repair.repairBlocks(realHashs, jobMap)
 }
 
-var TempBlockHashMutex sync.Mutex
-
-func getRealBlockHashs(allHash []string) (error, []string) {
-	// ues in when a few hash
-	if len(allHash) <= database.MAX_WITh_IN {
-		return simpleGetRealBlockHashs(allHash)
+// exclude returns the values not in except
+func exclude(values []string, except []string) []string {
+	exceptMap := make(map[string]bool)
+	for _, oneValue := range except {
+		exceptMap[oneValue] = true
 	}
 
-	//lock temp table
-	TempBlockHashMutex.Lock()
-	defer TempBlockHashMutex.Unlock()
-
-	// create temp table
-	if database.Db.HasTable(&TableTempBlockHash{}) {
-		if err := database.Db.Exec("DROP TABLE t_temp_block_hash;").Error; err != nil {
-			log.Log.Error(err, " drop table t_temp_block_hash fail")
-			return err, nil
+	result := make([]string, 0, len(values))
+	for _, oneValue := range values {
+		if !exceptMap[oneValue] {
+			result = append(result, oneValue)
 		}
 	}
-
-	if err := database.Db.Set("gorm:table_options", "ENGINE=InnoDB DEFAULT CHARSET=utf8").CreateTable(&TableTempBlockHash{}).Error; err != nil {
-		log.Log.Error(err, " create table t_temp_block_hash fail")
-		return err, nil
-	}
-	// drop table
-	defer database.Db.Exec("DROP TABLE t_temp_block_hash;")
-
-	// insert data
-	page := len(allHash) / database.MAX_WITH_INSERT
-	for i := 0; i < page; i++ {
-		begin := i * database.MAX_WITH_INSERT
-		end := (i + 1) * database.MAX_WITH_INSERT
-		pageHash := allHash[begin:end]
-		insertSql := "insert into t_temp_block_hash(hash) values "
-		for index, blockhash := range pageHash {
-			if 0 == index {
-				insertSql += fmt.Sprintf(`('%s')`, blockhash)
-			} else {
-				insertSql += fmt.Sprintf(`,('%s')`, blockhash)
-			}
-		}
-		insertSql += ";"
-		if err := database.Db.Exec(insertSql).Error; nil != err {
-			log.Log.Error(err, " exec sql fail: ", insertSql)
-			return err, nil
-		}
-	}
-
-	if 0 != len(allHash)%database.MAX_WITH_INSERT {
-		begin := page * database.MAX_WITH_INSERT
-		pageHash := allHash[begin:]
-		insertSql := "insert into t_temp_block_hash(hash) values "
-		for index, blockhash := range pageHash {
-			if 0 == index {
-				insertSql += fmt.Sprintf(`('%s')`, blockhash)
-			} else {
-				insertSql += fmt.Sprintf(`,('%s')`, blockhash)
-			}
-		}
-		insertSql += ";"
-		if err := database.Db.Exec(insertSql).Error; nil != err {
-			log.Log.Error(err, " exec sql fail: ", insertSql)
-			return err, nil
-		}
-	}
-
-	// delete repetition data
-	deleteSql := "delete t1 from t_temp_block_hash t1, t_block_info t2 where t1.hash=t2.hash;"
-	if err := database.Db.Exec(deleteSql).Error; nil != err {
-		log.Log.Error(err, " exec sql fail: ", deleteSql)
-		return err, nil
-	}
-
-	// get real block hash
-	var realHash []TableTempBlockHash
-	if err := database.Db.Find(&realHash).Error; nil != err {
-		log.Log.Error(err, " select * from t_temp_block_hash fail")
-		return err, nil
-	}
-
-	var result []string
-	for _, one := range realHash {
-		result = append(result, one.Hash)
-	}
-	return nil, result
+	return result
 }
 
+// simpleGetRealBlockHashs returns the hashes not on the stored main chain, a block stored as a fork may be
+// reconnected
 func simpleGetRealBlockHashs(allHash []string) (error, []string) {
 	var result []tables.TableBlockInfo
-	if err := database.Db.Model(&tables.TableBlockInfo{}).Where("`hash` IN (?)", allHash).Find(&result).Error; nil != err {
+	if err := database.Db.Model(&tables.TableBlockInfo{}).Where("`hash` IN (?) AND isfork = 0", allHash).Find(&result).Error; nil != err {
 		log.Log.Error(err, " select * from t_block_info fail")
 		return err, nil
 	}
@@ -271,25 +119,53 @@ func simpleGetRealBlockHashs(allHash []string) (error, []string) {
 	return nil, realHash
 }
 
-func (repair *BlockRepair) repairBlocks(allHash []string) error {
+// repairBlocks fetches the blocks and handles them from the lowest like a new block, so a reorganization is
+// handled and a fork block is reconnected. A block no longer on the node best chain is dropped.
+func (repair *BlockRepair) repairBlocks(allHash []string, jobMap map[string]*tables.TableRepairJobInfo) error {
 	allBlockCh := make(chan Block, config.Cfg.BtcOpt.BlockGoroutineNum)
-	go repairBlockTask(allHash, allBlockCh)
+	go repairBlockTask(allHash, jobMap, allBlockCh)
 
-	// get success block from channel
+	// get fetched block from channel
 	allBlock := []Block{}
 	for oneBlock := range allBlockCh {
 		allBlock = append(allBlock, oneBlock)
 	}
+	sort.Slice(allBlock, func(i, j int) bool {
+		return allBlock[i].Height < allBlock[j].Height
+	})
+
+	for index := range allBlock {
+		oneBlock := &allBlock[index]
+		err, bestHash := GetBlockHashWithHeight(oneBlock.Height)
+		if nil != err {
+			repairqueue.Fail(jobMap[oneBlock.Hash], err)
+			continue
+		}
+		if bestHash != oneBlock.Hash {
+			log.Log.Info("repair block dropped, not on the node best chain, block height: ", oneBlock.Height, ", block hash: ", oneBlock.Hash)
+			repairqueue.Done(repairqueue.JOBBLOCK, []string{oneBlock.Hash})
+			continue
+		}
 
-	// update state and from
-	allTrx := []Transaction{}
-	for _, oneBlock := range allBlock {
-		allTrx = append(allTrx, oneBlock.Tx...)
+		// drained on shutdown
+		if err := beginBlock(oneBlock.Hash); nil != err {
+			return err
+		}
+		err = processBlock(oneBlock)
+		endBlock(oneBlock.Hash)
+		if nil != err {
+			log.Log.Error(err, " repair block fail, block hash: ", oneBlock.Hash)
+			repairqueue.Fail(jobMap[oneBlock.Hash], err)
+			continue
+		}
+		log.Log.Info("repair block success, block hash: ", oneBlock.Hash)
+		repairqueue.Done(repairqueue.JOBBLOCK, []string{oneBlock.Hash})
 	}
-	return updateStateAndFrom(allTrx)
+	return nil
 }
 
-func repairBlockTask(allHash []string, blockCh chan<- Block) error {
+// repairBlockTask fetches the blocks from the node, a block failed to fetch is retried later
+func repairBlockTask(allHash []string, jobMap map[string]*tables.TableRepairJobInfo, blockCh chan<- Block) error {
 	defer func() {
 		// close channel
 		close(blockCh)
@@ -300,7 +176,7 @@ func repairBlockTask(allHash []string, blockCh chan<- Block) error {
 		}
 	}()
 
-	// save one block
+	// fetch one block
 	wg := sync.WaitGroup{}
 	trxCh := make(chan int, config.Cfg.BtcOpt.BlockGoroutineNum)
 	taskFunc := func(blockIndex int, block string, group *sync.WaitGroup) {
@@ -311,16 +187,17 @@ func repairBlockTask(allHash []string, blockCh chan<- Block) error {
 			// handle panic
 			if err := recover(); err != nil {
 				log.Log.Error(err, " panic occur when repair blocks, block hash: ", block)
-				StoreFailBlockHash(block)
+				repairqueue.Fail(jobMap[block], fmt.Errorf("panic: %v", err))
 			}
 		}()
 
-		if err := GetBlockAndStoreWithChannle(block, blockCh); nil != err {
-			log.Log.Error("repair block fail, block hash:", block)
-			StoreFailBlockHash(block)
-		} else {
-			log.Log.Info("repair block success, block hash:", block)
+		err, newBlock := GetBlock(block)
+		if nil != err {
+			log.Log.Error("repair block get block fail, block hash:", block)
+			repairqueue.Fail(jobMap[block], err)
+			return
 		}
+		blockCh <- *newBlock
 	}
 	for index, oneBlock := range allHash {
 		if index >= config.Cfg.BtcOpt.BlockGoroutineNum {
@@ -336,36 +213,49 @@ func repairBlockTask(allHash []string, blockCh chan<- Block) error {
 }
 
 func GetBlockAndStoreNotUpdateStateAndFrom(hash string) error {
-	result, err := jsonrpc.Call(1, "getblock", []interface{}{hash, 2})
+	err, newBlock := GetBlock(hash)
 	if nil != err {
-		log.Log.Error(err, " GetBlockAndStoreNotUpdateStateAndFrom jsonrpc call getblock fail, block hash: ", hash)
-		return err
-	}
-	newBlock := Block{}
-	if err := json.Unmarshal(result, &newBlock); nil != err {
-		log.Log.Error(err, " GetBlockAndStoreNotUpdateStateAndFrom Unmarshal result to block struct fail")
+		log.Log.Error(err, " GetBlockAndStoreNotUpdateStateAndFrom get block fail, block hash: ", hash)
 		return err
 	}
 
-	return SaveBlockNotUpdateStateAndFrom(&newBlock)
+	return SaveBlockNotUpdateStateAndFrom(newBlock)
 }
 
-func GetBlockAndStoreWithChannle(hash string, blockCh chan<- Block) error {
-	result, err := jsonrpc.Call(1, "getblock", []interface{}{hash, 2})
-	if nil != err {
-		log.Log.Error(err, " GetBlockAndStoreNotUpdateStateAndFrom jsonrpc call getblock fail, block hash: ", hash)
+// StoreFailBlockState queues the height of a saved block whose output state, input from or address balance
+// failed to update
+func StoreFailBlockState(height int32) error {
+	if err := repairqueue.Enqueue(repairqueue.JOBBLOCKSTATE, []string{fmt.Sprintf("%d", height)}); nil != err {
+		log.Log.Error(err, " store fail block state fail, block height:", height)
 		return err
 	}
-	newBlock := Block{}
-	if err := json.Unmarshal(result, &newBlock); nil != err {
-		log.Log.Error(err, " GetBlockAndStoreNotUpdateStateAndFrom Unmarshal result to block struct fail")
+	return nil
+}
+
+// RepairBlockStates rebuilds the output state, input from and address balance of the due heights of the repair
+// queue
+func RepairBlockStates() error {
+	err, allJob := repairqueue.Claim(repairqueue.JOBBLOCKSTATE)
+	if nil != err || 0 == len(allJob) {
 		return err
 	}
 
-	saveErr := SaveBlockNotUpdateStateAndFrom(&newBlock)
-	if nil == saveErr {
-		blockCh <- newBlock
-	}
+	for index := range allJob {
+		oneJob := &allJob[index]
+		height, err := strconv.ParseInt(oneJob.Jobkey, 10, 32)
+		if nil != err {
+			log.Log.Error(err, " convert one height fail, height:", oneJob.Jobkey)
+			repairqueue.Done(repairqueue.JOBBLOCKSTATE, []string{oneJob.Jobkey})
+			continue
+		}
 
-	return saveErr
+		if err := rebuildRange(int32(height), int32(height)+1); nil != err {
+			log.Log.Error(err, " repair block state fail, block height:", height)
+			repairqueue.Fail(oneJob, err)
+			continue
+		}
+		log.Log.Info("repair block state success, block height:", height)
+		repairqueue.Done(repairqueue.JOBBLOCKSTATE, []string{oneJob.Jobkey})
+	}
+	return nil
 }
@@ -1,5 +1,7 @@
 package notify
 
+import "github.com/BlockABC/wallet-btc-service/omni"
+
 var RepairMag RepairManage
 
 type RepairManage struct {
@@ -10,7 +12,15 @@ type RepairManage struct {
 func InitRepairManager() error {
 	RepairMag.Block = NewBlockRepair()
 	RepairMag.Transaction = NewTransactionRepair()
-	return nil
+
+	// repair files written before the repair queue
+	if err := RepairMag.Block.ImportFile(); nil != err {
+		return err
+	}
+	if err := RepairMag.Transaction.ImportFile(); nil != err {
+		return err
+	}
+	return omni.ImportRepairFiles()
 }
 
 func StoreFailBlockHash(hash string) error {
@@ -21,8 +31,12 @@ func BatchStoreBlockHash(allHash []string) error {
 	return RepairMag.Block.BatchStoreFailHash(allHash)
 }
 
+// RepairBlocks saves the blocks failed to save, then rebuilds the heights whose state failed to update
 func RepairBlocks() error {
-	return RepairMag.Block.RepairAllItems()
+	if err := RepairMag.Block.RepairAllItems(); nil != err {
+		return err
+	}
+	return RepairBlockStates()
 }
 
 func StoreFailTransactionHash(height int32, hash string) error {
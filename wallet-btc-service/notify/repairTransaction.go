@@ -1,11 +1,9 @@
 package notify
 
 import (
-	"bufio"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -14,15 +12,17 @@ import (
 
 	"github.com/BlockABC/wallet-btc-service/common/config"
 	"github.com/BlockABC/wallet-btc-service/common/log"
-	"github.com/BlockABC/wallet-btc-service/common/utility"
 	"github.com/BlockABC/wallet-btc-service/database"
 	"github.com/BlockABC/wallet-btc-service/database/tables"
 	"github.com/BlockABC/wallet-btc-service/jsonrpc"
+	"github.com/BlockABC/wallet-btc-service/repairqueue"
 )
 
+// TransactionRepair saves the transactions failed to save, they are transaction jobs of the repair queue keyed
+// by block height and transaction hash
 type TransactionRepair struct {
+	// repair file written before the repair queue, imported once
 	Filename string
-	Rw       sync.RWMutex
 }
 
 func NewTransactionRepair() *TransactionRepair {
@@ -31,6 +31,11 @@ func NewTransactionRepair() *TransactionRepair {
 	return &TransactionRepair{Filename: baseDir + "/repairTransaction"}
 }
 
+// ImportFile queues the transactions left in the repair file
+func (repair *TransactionRepair) ImportFile() error {
+	return repairqueue.ImportFile(repairqueue.JOBTRANSACTION, repair.Filename)
+}
+
 func GenerateRepairTrxInfo(blockheight int32, transactionHash string) string {
 	return fmt.Sprintf("%d_%s", blockheight, transactionHash)
 }
@@ -54,30 +59,7 @@ func GetRepairTrxInfo(info string) (errInfo error, blockheight int32, transactio
 }
 
 func (repair *TransactionRepair) StoreFailHash(blockheight int32, transactionHash string) error {
-	repair.Rw.Lock()
-	defer repair.Rw.Unlock()
-
-	// open file
-	fs, err := os.OpenFile(repair.Filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
-	if nil != err {
-		log.Log.Error(err, " store fail transaction hash open file fail, block height:", blockheight, ", transaction hash:", transactionHash)
-		return err
-	}
-	defer fs.Close()
-
-	// write Transaction hash
-	buf := bufio.NewWriter(fs)
-	if _, err := fmt.Fprintln(buf, GenerateRepairTrxInfo(blockheight, transactionHash)); nil != err {
-		log.Log.Error(err, " store fail transaction hash write file fail, block height:", blockheight, ", transaction hash:", transactionHash)
-		return err
-	}
-	result := buf.Flush()
-	if nil == result {
-		log.Log.Info("store fail transaction hash success, block height:", blockheight, ", transaction hash:", transactionHash)
-	} else {
-		log.Log.Error("store fail transaction hash fail, block height:", blockheight, ", transaction hash:", transactionHash)
-	}
-	return result
+	return repair.BatchStoreFailHash([]int32{blockheight}, []string{transactionHash})
 }
 
 func (repair *TransactionRepair) BatchStoreFailHash(allHeight []int32, allHash []string) error {
@@ -85,106 +67,62 @@ func (repair *TransactionRepair) BatchStoreFailHash(allHeight []int32, allHash [
 		return errors.New("allHeight allHash and don't have the same length")
 	}
 
-	repair.Rw.Lock()
-	defer repair.Rw.Unlock()
-
-	// open file
-	fs, err := os.OpenFile(repair.Filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
-	if nil != err {
-		log.Log.Error(err, "batch store transaction fail hash open file fail")
-		return err
-	}
-	defer fs.Close()
-
-	// write Transaction hash
-	buf := bufio.NewWriter(fs)
+	allKey := make([]string, 0, len(allHash))
 	for i := 0; i < len(allHash); i++ {
-		if _, err := fmt.Fprintln(buf, GenerateRepairTrxInfo(allHeight[i], allHash[i])); nil != err {
-			log.Log.Error(err, "batch store transaction hash one transaction hash write file fail, one block height:", allHeight[i], ", one transaction hash:", allHash[i])
-		}
+		allKey = append(allKey, GenerateRepairTrxInfo(allHeight[i], allHash[i]))
 	}
-	result := buf.Flush()
-	if nil == result {
-		log.Log.Info("repair batch store transaction hash success, transaction hashs:", allHash)
-	} else {
-		log.Log.Error("repair batch store transaction hash fail, transaction hashs:", allHash)
+	if err := repairqueue.Enqueue(repairqueue.JOBTRANSACTION, allKey); nil != err {
+		log.Log.Error(err, " repair batch store transaction hash fail, transaction hashs:", allHash)
+		return err
 	}
-	return result
+	return nil
 }
 
+// RepairAllItems saves the due transactions of the repair queue, a transaction saved already is done
 func (repair *TransactionRepair) RepairAllItems() error {
-	if !utility.IsFileExist(repair.Filename) {
-		return nil
-	}
-
-	repair.Rw.Lock()
-
-	// open file
-	fs, err := os.Open(repair.Filename)
-	if nil != err {
-		log.Log.Error(err, " Repair open transaction file fail")
-		repair.Rw.Unlock()
+	err, allJob := repairqueue.Claim(repairqueue.JOBTRANSACTION)
+	if nil != err || 0 == len(allJob) {
 		return err
 	}
 
-	// read file
-	allHeight := []int32{}
 	allHash := []string{}
-	br := bufio.NewReader(fs)
-	for {
-		oneLine, _, err := br.ReadLine()
-		if err == io.EOF {
-			break
-		} else if nil != err {
-			log.Log.Error(err, " read repair transaction file fail")
-			fs.Close()
-			repair.Rw.Unlock()
-			return err
-		}
-
-		err, height, hash := GetRepairTrxInfo(string(oneLine))
+	mapHashHeight := make(map[string]int32, 0)
+	jobMap := make(map[string]*tables.TableRepairJobInfo)
+	invalidKey := []string{}
+	for index := range allJob {
+		err, height, hash := GetRepairTrxInfo(allJob[index].Jobkey)
 		if nil != err {
+			invalidKey = append(invalidKey, allJob[index].Jobkey)
 			continue
 		}
-
-		bExist := false
-		for _, v := range allHash {
-			if v == hash {
-				bExist = true
-				break
-			}
-		}
-
-		if !bExist {
+		if _, ok := mapHashHeight[hash]; !ok {
 			allHash = append(allHash, hash)
-			allHeight = append(allHeight, height)
 		}
+		mapHashHeight[hash] = height
+		jobMap[hash] = &allJob[index]
 	}
-	fs.Close()
-
-	// clean file
-	if newFs, err := os.OpenFile(repair.Filename, os.O_WRONLY|os.O_TRUNC, 0666); nil != err {
-		newFs.Close()
+	if err := repairqueue.Done(repairqueue.JOBTRANSACTION, invalidKey); nil != err {
+		return err
 	}
-	repair.Rw.Unlock()
 
 	if 0 == len(allHash) {
 		return nil
 	}
 
-	mapHashHeight := make(map[string]int32, 0)
-	for i := 0; i < len(allHash); i++ {
-		mapHashHeight[allHash[i]] = allHeight[i]
-	}
-
-	// get real fail block hash
-	err, realHashs := getRealTrxHashs(allHash)
+	// get real fail transaction hash
+	err, realHashs := simpleGetRealTrxHashs(allHash)
 	if nil != err {
-		repair.BatchStoreFailHash(allHeight, allHash)
+		return err
+	}
+	savedKey := []string{}
+	for _, oneHash := range exclude(allHash, realHashs) {
+		savedKey = append(savedKey, jobMap[oneHash].Jobkey)
+	}
+	if err := repairqueue.Done(repairqueue.JOBTRANSACTION, savedKey); nil != err {
 		return err
 	}
 
-	if nil == realHashs || len(realHashs) == 0 {
+	if 0 == len(realHashs) {
 		return nil
 	}
 	log.Log.Info("repair fail transaction get real transaction hash success, real fail transaction hashs:", realHashs)
@@ -196,107 +134,12 @@ func (repair *TransactionRepair) RepairAllItems() error {
 	for i := 0; i < len(realHashs); i++ {
 		realHashHeight[realHashs[i]] = mapHashHeight[realHashs[i]]
 	}
-	return repair.repairTransactions(realHashHeight)
-}
-
-type TableTempTransactionHash struct {
-	Txid string `json:"txid"     		gorm:"column:txid;type:char(64);unique"`
-}
-
-func (t *TableTempTransactionHash) TableName() string {
-	return "t_temp_transaction_hash"
-}
-
-var TempTransactionHashMutex sync.Mutex
-
-func getRealTrxHashs(allHash []string) (error, []string) {
-	// ues in when a few hash
-	if len(allHash) <= database.MAX_WITh_IN {
-		return simpleGetRealTrxHashs(allHash)
-	}
-
-	//lock temp table
-	TempTransactionHashMutex.Lock()
-	defer TempTransactionHashMutex.Unlock()
-
-	// create temp table
-	if database.Db.HasTable(&TableTempTransactionHash{}) {
-		if err := database.Db.Exec("DROP TABLE t_temp_transaction_hash;").Error; err != nil {
-			log.Log.Error(err, " drop table t_temp_transaction_hash fail")
-			return err, nil
-		}
-	}
-
-	if err := database.Db.Set("gorm:table_options", "ENGINE=InnoDB DEFAULT CHARSET=utf8").CreateTable(&TableTempTransactionHash{}).Error; err != nil {
-		log.Log.Error(err, " create table t_temp_transaction_hash fail")
-		return err, nil
-	}
-	// drop table
-	defer database.Db.Exec("DROP TABLE t_temp_transaction_hash;")
-
-	// insert data
-	page := len(allHash) / database.MAX_WITH_INSERT
-	for i := 0; i < page; i++ {
-		begin := i * database.MAX_WITH_INSERT
-		end := (i + 1) * database.MAX_WITH_INSERT
-		pageHash := allHash[begin:end]
-		insertSql := "insert into t_temp_transaction_hash(txid) values "
-		for index, transactionHash := range pageHash {
-			if 0 == index {
-				insertSql += fmt.Sprintf(`('%s')`, transactionHash)
-			} else {
-				insertSql += fmt.Sprintf(`,('%s')`, transactionHash)
-			}
-		}
-		insertSql += ";"
-		if err := database.Db.Exec(insertSql).Error; nil != err {
-			log.Log.Error(err, " exec sql fail: ", insertSql)
-			return err, nil
-		}
-	}
-
-	if 0 != len(allHash)%database.MAX_WITH_INSERT {
-		begin := page * database.MAX_WITH_INSERT
-		pageHash := allHash[begin:]
-		insertSql := "insert into t_temp_transaction_hash(txid) values "
-		for index, transactionHash := range pageHash {
-			if 0 == index {
-				insertSql += fmt.Sprintf(`('%s')`, transactionHash)
-			} else {
-				insertSql += fmt.Sprintf(`,('%s')`, transactionHash)
-			}
-		}
-		insertSql += ";"
-		if err := database.Db.Exec(insertSql).Error; nil != err {
-			log.Log.Error(err, " exec sql fail: ", insertSql)
-			return err, nil
-		}
-	}
-
-	// delete repetition data
-	deleteSql := "delete t1 from t_temp_transaction_hash t1, t_transaction_info t2 where t1.txid=t2.txid;"
-	if err := database.Db.Exec(deleteSql).Error; nil != err {
-		log.Log.Error(err, " exec sql fail: ", deleteSql)
-		return err, nil
-	}
-
-	// get real transaction hash
-	var realHash []TableTempTransactionHash
-	if err := database.Db.Find(&realHash).Error; nil != err {
-		log.Log.Error(err, " select * from t_temp_transaction_hash fail")
-		return err, nil
-	}
-
-	var result []string
-	for _, one := range realHash {
-		result = append(result, one.Txid)
-	}
-	return nil, result
+	return repair.repairTransactions(realHashHeight, jobMap)
 }
 
 func simpleGetRealTrxHashs(allHash []string) (error, []string) {
 	var result []tables.TableTransactionInfo
-	if err := database.Db.Model(&tables.TableTransactionInfo{}).Where("`Txid` IN (?)", allHash).Find(&result).Error; nil != err {
+	if err := database.Db.Model(&tables.TableTransactionInfo{}).Where("`Txid` IN (?) AND isfork = 0", allHash).Find(&result).Error; nil != err {
 		log.Log.Error(err, " select * from t_transaction_info fail")
 		return err, nil
 	}
@@ -319,9 +162,9 @@ func simpleGetRealTrxHashs(allHash []string) (error, []string) {
 	return nil, realHash
 }
 
-func (repair *TransactionRepair) repairTransactions(realHashHeight map[string]int32) error {
+func (repair *TransactionRepair) repairTransactions(realHashHeight map[string]int32, jobMap map[string]*tables.TableRepairJobInfo) error {
 	allTrxCh := make(chan Transaction, config.TrxGoroutineRuntime)
-	go repairTransactionTask(realHashHeight, allTrxCh)
+	go repairTransactionTask(realHashHeight, jobMap, allTrxCh)
 
 	// get success transaction from channel
 	allTrx := []Transaction{}
@@ -330,10 +173,15 @@ func (repair *TransactionRepair) repairTransactions(realHashHeight map[string]in
 	}
 
 	// update state and from
-	return updateStateAndFrom(allTrx)
+	if err := updateStateAndFrom(allTrx); nil != err {
+		return err
+	}
+
+	// address balance
+	return updateBlockAddressBalance(allTrx)
 }
 
-func repairTransactionTask(realHashHeight map[string]int32, totalTrxCh chan<- Transaction) error {
+func repairTransactionTask(realHashHeight map[string]int32, jobMap map[string]*tables.TableRepairJobInfo, totalTrxCh chan<- Transaction) error {
 	defer func() {
 		// close channel
 		close(totalTrxCh)
@@ -355,15 +203,16 @@ func repairTransactionTask(realHashHeight map[string]int32, totalTrxCh chan<- Tr
 			// handle panic
 			if err := recover(); err != nil {
 				log.Log.Error(err, " panic occur when repair transactions, block height:", height, ", transaction hash:", trx)
-				StoreFailTransactionHash(height, trx)
+				repairqueue.Fail(jobMap[trx], fmt.Errorf("panic: %v", err))
 			}
 		}()
 
 		if err := GetTransactionAndStoreWithChannel(height, trx, totalTrxCh); nil != err {
 			log.Log.Error("repair transaction fail, block height:", height, ", transaction hash:", trx)
-			StoreFailTransactionHash(height, trx)
+			repairqueue.Fail(jobMap[trx], err)
 		} else {
 			log.Log.Info("repair transaction success, block height:", height, ", transaction hash:", trx)
+			repairqueue.Done(repairqueue.JOBTRANSACTION, []string{jobMap[trx].Jobkey})
 		}
 	}
 
@@ -23,10 +23,6 @@ func RepairUnconfirmedTransaction() error {
 		return err
 	}
 	log.Log.Info("repair unconfirmed transaction get memory transaction success, unconfirmed transaction hashs:", allTrxHash)
-	if 0 == len(allTrxHash) {
-		return nil
-	}
-
 	// get all redis transaction
 	err, allRedis := GetAllRedisUnconfirmedTransaction()
 	if nil != err {
@@ -44,31 +40,35 @@ func RepairUnconfirmedTransaction() error {
 		}
 	}
 
+	confirmedHash := make([]string, 0)
 	if 0 != len(strRedisHash) {
 		type blockTxid struct {
 			Txid string
 		}
 
 		existTransactionHash := make([]blockTxid, 0)
-		txSelectSql := fmt.Sprintf("select txid from t_transaction_info where txid in (%s);", strRedisHash)
+		txSelectSql := fmt.Sprintf("select txid from t_transaction_info where txid in (%s) and isfork=0;", strRedisHash)
 		if err := database.Db.Raw(txSelectSql).Scan(&existTransactionHash).Error; nil != err {
 			log.Log.Error(err, " exec sql fail: ", txSelectSql)
 			return err
 		}
 
-		deleteRedisHash := make([]string, 0)
 		for _, oneBlockTxid := range existTransactionHash {
-			deleteRedisHash = append(deleteRedisHash, oneBlockTxid.Txid)
+			confirmedHash = append(confirmedHash, oneBlockTxid.Txid)
 		}
 
-		log.Log.Info("repair unconfirmed transaction get real need delete unconfirmed transaction success, real need delete unconfirmed transaction hashs:", deleteRedisHash)
+		log.Log.Info("repair unconfirmed transaction get real need delete unconfirmed transaction success, real need delete unconfirmed transaction hashs:", confirmedHash)
 
-		if err := DeleteRedisTransactionByHashs(deleteRedisHash); nil != err {
+		if err := DeleteRedisTransactionByHashs(confirmedHash); nil != err {
 			log.Log.Error(err, " repair unconfirmed transaction delete block transaction fail")
 			return err
 		}
 	}
 
+	// drop transaction evicted from mempool or double spent
+	removeEvictedTransaction(allRedis, allTrxHash, confirmedHash)
+	forgetDroppedTransaction()
+
 	// get real lost unconfirmed transaction
 	realHash := make([]string, 0)
 	for _, oneHash := range allTrxHash {
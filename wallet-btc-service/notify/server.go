@@ -2,15 +2,26 @@ package notify
 
 import (
 	"context"
-	"net/http"
+	"time"
 
 	"github.com/BlockABC/wallet-btc-service/common/config"
+	"github.com/BlockABC/wallet-btc-service/common/utility"
+	"github.com/BlockABC/wallet-btc-service/health"
+	"github.com/BlockABC/wallet-btc-service/metrics"
 	"github.com/gin-gonic/gin"
 )
 
 func StartHttpServer(cfg *config.Config, ctx context.Context) (err error) {
 	//get router instance
 	router := gin.Default()
+	router.Use(metrics.Http(router))
+
+	// handle prometheus scrape
+	router.GET("/metrics", metrics.Handler())
+
+	// handle health and readiness checks
+	router.GET(health.HEALTHPATH, health.Healthz)
+	router.GET(health.READYPATH, health.ClientReadyz)
 
 	// handle new block
 	router.POST("/bitcoind/block", bitcoindBlockNotify)
@@ -19,6 +30,5 @@ func StartHttpServer(cfg *config.Config, ctx context.Context) (err error) {
 	router.POST("/bitcoind/transaction", bitcoindTransactionNotify)
 
 	// listen and server
-	http.ListenAndServe(cfg.BtcOpt.ListenAddress, router)
-	return nil
+	return utility.ListenAndServe(ctx, cfg.BtcOpt.ListenAddress, router, time.Duration(cfg.BtcOpt.ShutdownTimeout)*time.Second)
 }
@@ -0,0 +1,93 @@
+package notify
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/BlockABC/wallet-btc-service/common/log"
+	"github.com/BlockABC/wallet-btc-service/filestore"
+	"github.com/BlockABC/wallet-btc-service/omni"
+)
+
+var ErrStopping = errors.New("client is shutting down")
+
+var (
+	stopping int32
+
+	// blocks being saved, by hash
+	inflightMutex sync.Mutex
+	inflightBlock = make(map[string]bool)
+	inflightGroup sync.WaitGroup
+)
+
+// Stop refuses the block and transaction notifications from now on, the blocks being saved are drained
+// with Drain
+func Stop() {
+	atomic.StoreInt32(&stopping, 1)
+	log.Log.Notice("stop accepting block and transaction notifications")
+}
+
+func isStopping() bool {
+	return 1 == atomic.LoadInt32(&stopping)
+}
+
+// beginBlock counts a block being saved, it fails once the client stops
+func beginBlock(hash string) error {
+	inflightMutex.Lock()
+	defer inflightMutex.Unlock()
+	if isStopping() {
+		return ErrStopping
+	}
+	inflightBlock[hash] = true
+	inflightGroup.Add(1)
+	return nil
+}
+
+// endBlock counts a block done
+func endBlock(hash string) {
+	inflightMutex.Lock()
+	delete(inflightBlock, hash)
+	inflightMutex.Unlock()
+	inflightGroup.Done()
+}
+
+// Drain waits up to timeout for the blocks being saved, with their omni transactions, the blocks still
+// not saved after it are stored for repair. It returns whether every block finished.
+func Drain(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		inflightGroup.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		log.Log.Notice("all blocks being saved finished")
+		return true
+	case <-time.After(timeout):
+	}
+
+	inflightMutex.Lock()
+	allHash := make([]string, 0, len(inflightBlock))
+	for hash := range inflightBlock {
+		allHash = append(allHash, hash)
+	}
+	inflightMutex.Unlock()
+
+	log.Log.Error("blocks still saving after ", timeout, ", store them for repair, block hashs: ", allHash)
+	BatchStoreBlockHash(allHash)
+	return false
+}
+
+// FlushRepair saves where the repair of all blocks and all omni blocks has come, so it goes on from there
+// after a restart
+func FlushRepair() {
+	if err := filestore.RepairStoreInstance.SaveBlockBegin(BlockHeightBegin); nil != err {
+		log.Log.Error(err, " save repair block begin fail, block height: ", BlockHeightBegin)
+	}
+	if err := filestore.RepairStoreInstance.SaveOmniBegin(omni.OmniHeightBegin); nil != err {
+		log.Log.Error(err, " save repair omni block begin fail, block height: ", omni.OmniHeightBegin)
+	}
+}
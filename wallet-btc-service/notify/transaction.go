@@ -17,6 +17,8 @@ import (
 	"github.com/BlockABC/wallet-btc-service/jsonrpc"
 	"github.com/BlockABC/wallet-btc-service/omni"
 	"github.com/BlockABC/wallet-btc-service/request"
+	"github.com/BlockABC/wallet-btc-service/stream"
+	"github.com/BlockABC/wallet-btc-service/webhook"
 	"github.com/gin-gonic/gin"
 	"github.com/jinzhu/gorm"
 )
@@ -34,6 +36,7 @@ type Transaction struct {
 	BlockHash   string   `json:"blockhash"`
 	BlockTime   int64    `json:"blocktime"`
 	Blockheight int32    `json:"blockheight"`
+	Position    int32    `json:"position"`
 	Hex         string   `json:"hex"`
 	ReceiveTime int64    `json:"receivetime"`
 }
@@ -60,7 +63,7 @@ type ScriptPubKey struct {
 	Addresses []string `json:"addresses"`
 }
 type Output struct {
-	Value        float64      `json:"value"`
+	Value        Amount       `json:"value"` // satoshi
 	N            int64        `json:"n"`
 	ScriptPubKey ScriptPubKey `json:"scriptPubKey"`
 }
@@ -136,11 +139,11 @@ func generateOperateSql(newTrx *Transaction, pageObject []interface{}) (err erro
 			}
 			if 0 == index {
 				operateSql += fmt.Sprintf(`('%s', %d, '%s', %d, %d, '%s', '%s', '%s', %d, '%s')`,
-					newTrx.BlockHash, newTrx.BlockTime, newTrx.Txid, int64(newOutput.Value*100000000), newOutput.N, newOutput.ScriptPubKey.Hex, newOutput.ScriptPubKey.Asm,
+					newTrx.BlockHash, newTrx.BlockTime, newTrx.Txid, int64(newOutput.Value), newOutput.N, newOutput.ScriptPubKey.Hex, newOutput.ScriptPubKey.Asm,
 					newOutput.ScriptPubKey.Type, newOutput.ScriptPubKey.ReqSigs, toAddress)
 			} else {
 				operateSql += fmt.Sprintf(`,('%s', %d, '%s', %d, %d, '%s', '%s', '%s', %d, '%s')`,
-					newTrx.BlockHash, newTrx.BlockTime, newTrx.Txid, int64(newOutput.Value*100000000), newOutput.N, newOutput.ScriptPubKey.Hex, newOutput.ScriptPubKey.Asm,
+					newTrx.BlockHash, newTrx.BlockTime, newTrx.Txid, int64(newOutput.Value), newOutput.N, newOutput.ScriptPubKey.Hex, newOutput.ScriptPubKey.Asm,
 					newOutput.ScriptPubKey.Type, newOutput.ScriptPubKey.ReqSigs, toAddress)
 			}
 		}
@@ -161,13 +164,13 @@ func generateOperateSql(newTrx *Transaction, pageObject []interface{}) (err erro
 
 	case string:
 		// generate vout address info insert sql
-		operateSql = "insert into t_transaction_input_output_address_info(blockhash, `time`, txid, `address`, isfrom) values "
+		operateSql = "insert into t_transaction_input_output_address_info(blockhash, `time`, height, position, txid, `address`, isfrom) values "
 		for index, oneObject := range pageObject {
 			newAddress := oneObject.(string)
 			if 0 == index {
-				operateSql += fmt.Sprintf(`('%s', %d, '%s', '%s', %d)`, newTrx.BlockHash, newTrx.BlockTime, newTrx.Txid, newAddress, 0)
+				operateSql += fmt.Sprintf(`('%s', %d, %d, %d, '%s', '%s', %d)`, newTrx.BlockHash, newTrx.BlockTime, newTrx.Blockheight, newTrx.Position, newTrx.Txid, newAddress, 0)
 			} else {
-				operateSql += fmt.Sprintf(`,('%s', %d, '%s', '%s', %d)`, newTrx.BlockHash, newTrx.BlockTime, newTrx.Txid, newAddress, 0)
+				operateSql += fmt.Sprintf(`,('%s', %d, %d, %d, '%s', '%s', %d)`, newTrx.BlockHash, newTrx.BlockTime, newTrx.Blockheight, newTrx.Position, newTrx.Txid, newAddress, 0)
 			}
 		}
 
@@ -195,6 +198,7 @@ func SaveTransaction(newTrx *Transaction) error {
 		Time:        newTrx.BlockTime,
 		Blockhash:   newTrx.BlockHash,
 		Blockheight: newTrx.Blockheight,
+		Position:    newTrx.Position,
 		Txid:        newTrx.Txid,
 		Hash:        newTrx.Hash,
 		Size:        newTrx.Size,
@@ -390,7 +394,7 @@ func updateStateAndFrom(blockTrx []Transaction) error {
 	defer updateStateAndFromMutex.Unlock()
 
 	// update output state
-	updateOutputSql := fmt.Sprintf("update t_output_info t1, `%s` t2 set t1.state=1 where t1.hash=t2.txid and t1.n=t2.vout;", tableName)
+	updateOutputSql := fmt.Sprintf("update t_output_info t1, `%s` t2 set t1.state=1 where t1.hash=t2.txid and t1.n=t2.vout and t1.isfork=0;", tableName)
 
 	if err := database.Db.Exec(updateOutputSql).Error; nil != err {
 		log.Log.Error(err, " exec sql fail: ", updateOutputSql)
@@ -398,7 +402,7 @@ func updateStateAndFrom(blockTrx []Transaction) error {
 	}
 
 	// update input from and value
-	updateInputSql := fmt.Sprintf("update t_input_info t1, t_output_info t2, `%s` t3 set t1.from = t2.to, t1.value = t2.value where t1.txid=t2.hash and t1.vout=t2.n and t1.txid=t3.txid and t1.vout=t3.vout;", tableName)
+	updateInputSql := fmt.Sprintf("update t_input_info t1, t_output_info t2, `%s` t3 set t1.from = t2.to, t1.value = t2.value where t1.txid=t2.hash and t1.vout=t2.n and t1.txid=t3.txid and t1.vout=t3.vout and t1.isfork=0 and t2.isfork=0;", tableName)
 
 	if err := database.Db.Exec(updateInputSql).Error; nil != err {
 		log.Log.Error(err, " exec sql fail: ", updateInputSql)
@@ -406,7 +410,7 @@ func updateStateAndFrom(blockTrx []Transaction) error {
 	}
 
 	// insert input address into t_transaction_input_output_address_info
-	insertAddressSql := fmt.Sprintf("replace into t_transaction_input_output_address_info (blockhash, `time`, txid, `address`, isfrom) select distinct blockhash, `time`, `hash`, `from`, 1 from t_input_info where (txid, vout) in (select txid, vout from `%s`) and `from` != '';", tableName)
+	insertAddressSql := fmt.Sprintf("replace into t_transaction_input_output_address_info (blockhash, `time`, height, position, txid, `address`, isfrom) select distinct t1.blockhash, t1.time, t2.blockheight, t2.position, t1.hash, t1.from, 1 from t_input_info t1, t_transaction_info t2 where (t1.txid, t1.vout) in (select txid, vout from `%s`) and t1.from != '' and t1.isfork=0 and t2.txid=t1.hash and t2.isfork=0;", tableName)
 	if err := database.Db.Exec(insertAddressSql).Error; nil != err {
 		log.Log.Error(err, " exec sql fail: ", insertAddressSql)
 		return err
@@ -427,7 +431,10 @@ func updateStateAndFrom(blockTrx []Transaction) error {
 	return nil
 }
 
-var allUnfmdTrx []string
+var (
+	allUnfmdTrx      []string
+	allUnfmdTrxMutex sync.Mutex
+)
 
 const (
 	MAXTRANSACTIONLEN  = 500
@@ -449,40 +456,59 @@ func bitcoindTransactionNotify(c *gin.Context) {
 		}
 	}()
 
+	if err := unconfirmedTransactionCome(&newTransaction); nil != err {
+		status := http.StatusBadRequest
+		if ErrStopping == err {
+			status = http.StatusServiceUnavailable
+		}
+		c.JSON(status, gin.H{"result": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"result": "success"})
+}
+
+func unconfirmedTransactionCome(newTransaction *Transaction) error {
+	if isStopping() {
+		return ErrStopping
+	}
+
 	// handle not arrive unconfirmed omni transaction
 	omni.HandleUnarriveOmniTrx()
 
 	// only handle unconfirmed transaction
 	if 0 != len(newTransaction.BlockHash) || newTransaction.Blockheight > 0 {
-		c.JSON(http.StatusOK, gin.H{"result": "success"})
-		return
+		return nil
 	}
 
 	// exist
+	allUnfmdTrxMutex.Lock()
 	for _, oneHash := range allUnfmdTrx {
 		if oneHash == newTransaction.Txid {
-			c.JSON(http.StatusOK, gin.H{"result": "success"})
-			return
+			allUnfmdTrxMutex.Unlock()
+			return nil
 		}
 	}
+	allUnfmdTrxMutex.Unlock()
 
 	// handle transaction
 	newTransaction.ReceiveTime = time.Now().Unix()
-	if err := SaveUnconfirmedTransactionToRedis(&newTransaction); nil != err {
-		c.JSON(http.StatusBadRequest, gin.H{"result": err.Error()})
-		return
+	if err := SaveUnconfirmedTransactionToRedis(newTransaction); nil != err {
+		return err
 	}
 
 	// apned all unconfirmed transaction
+	allUnfmdTrxMutex.Lock()
 	if len(allUnfmdTrx) >= MAXTRANSACTIONLEN {
 		allUnfmdTrx = allUnfmdTrx[len(allUnfmdTrx)-MAXTRANSACTIONLEN+REVERSETRANSACTION:]
 	}
 	allUnfmdTrx = append(allUnfmdTrx, newTransaction.Txid)
+	allUnfmdTrxMutex.Unlock()
 
 	// handle omni transaction info
 	omni.HandleOmniTransaction(newTransaction.Txid, true)
 
-	c.JSON(http.StatusOK, gin.H{"result": "success"})
+	return nil
 }
 
 func oneTransactionNotify(newTrx *Transaction) error {
@@ -586,6 +612,58 @@ func oneTransactionNotify(newTrx *Transaction) error {
 	return request.NotifyTerminal(info)
 }
 
+// webhookTransactionNotify queues the webhook events of an unconfirmed transaction
+func webhookTransactionNotify(oneRedisTransaction *RedisTransaction) error {
+	received := make(map[string]int64)
+	spent := make(map[string]int64)
+	for _, oneInput := range oneRedisTransaction.Vin {
+		if "" != oneInput.Address {
+			spent[oneInput.Address] += oneInput.Value
+		}
+	}
+	for _, oneOutput := range oneRedisTransaction.Vout {
+		if 1 == len(oneOutput.Addresses) {
+			received[oneOutput.Addresses[0]] += oneOutput.Value
+		}
+	}
+
+	if err := webhook.Publish(webhook.TransferActivity(oneRedisTransaction.Txid, received, spent, "", 0)); nil != err {
+		log.Log.Error(err, " webhookTransactionNotify publish fail, txid: ", oneRedisTransaction.Txid)
+		return err
+	}
+	return nil
+}
+
+// streamTransactionNotify streams an unconfirmed transaction with the value its addresses received and spent
+func streamTransactionNotify(oneRedisTransaction *RedisTransaction) error {
+	received := make(map[string]int64)
+	spent := make(map[string]int64)
+	for _, oneInput := range oneRedisTransaction.Vin {
+		spent[oneInput.Address] += oneInput.Value
+	}
+	for _, oneOutput := range oneRedisTransaction.Vout {
+		if 0 != len(oneOutput.Addresses) {
+			received[oneOutput.Addresses[0]] += oneOutput.Value
+		}
+	}
+
+	allActivity := make([]stream.AddressData, 0)
+	for _, oneAddress := range redisTransactionAddress(oneRedisTransaction) {
+		allActivity = append(allActivity, stream.AddressData{
+			Address:  oneAddress,
+			Txid:     oneRedisTransaction.Txid,
+			Received: received[oneAddress],
+			Spent:    spent[oneAddress],
+		})
+	}
+
+	return stream.PublishTransaction(stream.TransactionData{
+		Txid:        oneRedisTransaction.Txid,
+		Receivetime: oneRedisTransaction.ReceiveTime,
+		Addresses:   allActivity,
+	})
+}
+
 func HandlePushTransaction(trx string) (error, int64) {
 	result, err := jsonrpc.Call(1, "getrawtransaction", []interface{}{trx, true})
 	if nil != err {
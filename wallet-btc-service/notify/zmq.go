@@ -0,0 +1,163 @@
+package notify
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"time"
+
+	"github.com/BlockABC/wallet-btc-service/common/config"
+	"github.com/BlockABC/wallet-btc-service/common/log"
+	"github.com/BlockABC/wallet-btc-service/common/zmq"
+	"github.com/BlockABC/wallet-btc-service/jsonrpc"
+)
+
+const (
+	ZMQRAWBLOCK = "rawblock"
+	ZMQRAWTX    = "rawtx"
+	ZMQSEQUENCE = "sequence"
+
+	ZMQRECONNECT = 5 * time.Second
+)
+
+// StartZmqSubscriber subscribes to the bitcoind rawblock, rawtx and sequence topics,
+// topics published on the same address share one connection
+func StartZmqSubscriber(ctx context.Context) {
+	allTopic := make(map[string][]string)
+	opt := config.Cfg.BtcOpt
+	for topic, address := range map[string]string{ZMQRAWBLOCK: opt.ZmqRawBlock, ZMQRAWTX: opt.ZmqRawTx, ZMQSEQUENCE: opt.ZmqSequence} {
+		if 0 == len(address) {
+			continue
+		}
+		allTopic[address] = append(allTopic[address], topic)
+	}
+
+	for address, topics := range allTopic {
+		go zmqSubscribeLoop(ctx, address, topics)
+	}
+}
+
+func zmqSubscribeLoop(ctx context.Context, address string, topics []string) {
+	for {
+		if err := zmqSubscribe(ctx, address, topics); nil != err {
+			log.Log.Error(err, " zmq subscriber disconnected, address: ", address, ", reconnect after ", ZMQRECONNECT)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(ZMQRECONNECT):
+		}
+	}
+}
+
+func zmqSubscribe(ctx context.Context, address string, topics []string) error {
+	sub, err := zmq.Subscribe(address, topics, ZMQRECONNECT)
+	if nil != err {
+		return err
+	}
+	log.Log.Notice("zmq subscribe success, address: ", address, ", topics: ", topics)
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+		sub.Close()
+	}()
+
+	allSequence := make(map[string]uint32)
+	for {
+		message, err := sub.Receive()
+		if nil != err {
+			if nil != ctx.Err() {
+				return nil
+			}
+			return err
+		}
+
+		// topic, body, sequence
+		if 3 != len(message) || 4 != len(message[2]) {
+			log.Log.Error("zmq receive unknown message, address: ", address, ", frames: ", len(message))
+			continue
+		}
+		topic := string(message[0])
+		sequence := binary.LittleEndian.Uint32(message[2])
+		if last, ok := allSequence[topic]; ok && sequence != last+1 {
+			log.Log.Error("zmq message lost, topic: ", topic, ", last sequence: ", last, ", sequence: ", sequence)
+		}
+		allSequence[topic] = sequence
+
+		handleZmqMessage(topic, message[1])
+	}
+}
+
+func handleZmqMessage(topic string, body []byte) {
+	defer func() {
+		// handle panic
+		if err := recover(); err != nil {
+			log.Log.Error(err, " panic occur when handle zmq message, topic: ", topic)
+		}
+	}()
+
+	switch topic {
+	case ZMQRAWBLOCK:
+		zmqRawBlock(body)
+	case ZMQRAWTX:
+		zmqRawTransaction(body)
+	case ZMQSEQUENCE:
+		zmqSequence(body)
+	}
+}
+
+func zmqRawBlock(body []byte) {
+	err, newBlock := DecodeRawBlock(body)
+	if nil != err {
+		log.Log.Error(err, " zmqRawBlock decode block fail")
+		return
+	}
+
+	log.Log.Info("New block zmq received, block hash:", newBlock.Hash)
+
+	if err := newBlockCome(newBlock); nil != err {
+		log.Log.Info("zmq new block not handled: ", err)
+	}
+}
+
+func zmqRawTransaction(body []byte) {
+	err, newTransaction := DecodeRawTransaction(body)
+	if nil != err {
+		log.Log.Error(err, " zmqRawTransaction decode transaction fail")
+		return
+	}
+
+	// rawtx is published for block transactions too, only mempool transactions are unconfirmed
+	if _, err := jsonrpc.Call(1, "getmempoolentry", []interface{}{newTransaction.Txid}); nil != err {
+		return
+	}
+
+	log.Log.Info("New transaction zmq received, transaction hash:", newTransaction.Txid)
+
+	if err := unconfirmedTransactionCome(newTransaction); nil != err {
+		log.Log.Error(err, " zmq handle unconfirmed transaction fail, transaction hash: ", newTransaction.Txid)
+	}
+}
+
+// sequence body: 32 byte hash, label C(connected) D(disconnected) A(added) R(removed), mempool sequence for A and R
+func zmqSequence(body []byte) {
+	if len(body) < 33 {
+		log.Log.Error("zmq sequence too short, length: ", len(body))
+		return
+	}
+	hash := hex.EncodeToString(body[:32])
+
+	switch body[32] {
+	case 'R':
+		log.Log.Info("transaction removed from mempool, transaction hash:", hash)
+		if err := RemoveUnconfirmedTransaction(hash, ""); nil != err {
+			log.Log.Error(err, " remove unconfirmed transaction fail, transaction hash: ", hash)
+		}
+	}
+}
@@ -1,6 +1,9 @@
 package omni
 
 import (
+	"fmt"
+
+	"github.com/BlockABC/wallet-btc-service/common/log"
 	"github.com/BlockABC/wallet-btc-service/database"
 	"github.com/BlockABC/wallet-btc-service/database/tables"
 )
@@ -34,3 +37,13 @@ func IsOmniTransactionExist(hash string) (errInfo error, bExist bool) {
 
 	return
 }
+
+func DeleteOmniBlockTransaction(blockhash string) error {
+	deleteSql := fmt.Sprintf("delete from t_omni_transaction_info where blockhash='%s';", blockhash)
+	if err := database.Db.Exec(deleteSql).Error; nil != err {
+		log.Log.Error(err, " exec sql fail: ", deleteSql)
+		return err
+	}
+
+	return nil
+}
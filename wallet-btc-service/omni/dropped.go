@@ -0,0 +1,159 @@
+package omni
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/BlockABC/wallet-btc-service/common/log"
+	"github.com/BlockABC/wallet-btc-service/database"
+	"github.com/BlockABC/wallet-btc-service/jsonrpc"
+)
+
+const (
+	REDISDROPPEDOMNITRXKEY = "DroppedOmniTransaction"
+
+	// transaction status
+	UNCONFIRMED = "unconfirmed"
+	CONFIRMED   = "confirmed"
+	DROPPED     = "dropped"
+	REPLACED    = "replaced"
+
+	UNCONFIRMEDGRACETIME = 120              // seconds a new unconfirmed omni transaction is not checked for eviction
+	DROPPEDKEEPTIME      = 7 * 24 * 60 * 60 // seconds a dropped omni transaction is kept
+)
+
+type DroppedOmniTransaction struct {
+	Transaction OmniTransaction `json:"transaction"`
+	Status      string          `json:"status"`
+	ReplacedBy  string          `json:"replaced_by"`
+	DroppedTime int64           `json:"droppedtime"`
+}
+
+// DropUnconfirmedOmniTransaction moves an unconfirmed omni transaction to the dropped records
+func DropUnconfirmedOmniTransaction(txid string, status string, replacedBy string) error {
+	err, bExist, oneOmniTransaction := GetRedisUnconfirmedOmniTransactionByTxid(txid)
+	if nil != err {
+		return err
+	}
+	if !bExist {
+		return nil
+	}
+
+	dropped := DroppedOmniTransaction{*oneOmniTransaction, status, replacedBy, time.Now().Unix()}
+	info, err := json.Marshal(dropped)
+	if nil != err {
+		log.Log.Error(err, " marshal dropped omni transaction fail")
+		return err
+	}
+
+	if _, err := database.RedisDb.HSet(REDISDROPPEDOMNITRXKEY, txid, info).Result(); nil != err {
+		log.Log.Error(err, " save dropped omni transaction to redis fail, omni transaction hash:", txid)
+		return err
+	}
+
+	log.Log.Notice("unconfirmed omni transaction ", status, ", omni transaction hash: ", txid, ", replaced by: ", replacedBy)
+
+	return DeleteRedisUnfmdOmniTransaction([]string{txid})
+}
+
+func GetDroppedOmniTransaction(txid string) (error, bool, *DroppedOmniTransaction) {
+	bExist, err := database.RedisDb.HExists(REDISDROPPEDOMNITRXKEY, txid).Result()
+	if nil != err {
+		log.Log.Error(err, " GetDroppedOmniTransaction if dropped omni transaction exist fail, omni transaction hash:", txid)
+		return err, false, nil
+	}
+	if !bExist {
+		return nil, false, nil
+	}
+
+	info, err := database.RedisDb.HGet(REDISDROPPEDOMNITRXKEY, txid).Result()
+	if nil != err {
+		log.Log.Error(err, " GetDroppedOmniTransaction get dropped omni transaction fail, omni transaction hash:", txid)
+		return err, false, nil
+	}
+
+	dropped := DroppedOmniTransaction{}
+	if err := json.Unmarshal([]byte(info), &dropped); nil != err {
+		log.Log.Error(err, " Unmarshal to dropped omni transaction fail, omni transaction hash:", txid)
+		return err, false, nil
+	}
+
+	return nil, true, &dropped
+}
+
+// removeEvictedOmniTransaction drops unconfirmed omni transactions neither pending nor stored in a block
+func removeEvictedOmniTransaction(allRedis []OmniTransaction, allPending []OmniTransaction, confirmed []string) {
+	exist := make(map[string]bool)
+	for _, onePending := range allPending {
+		exist[onePending.Txid] = true
+	}
+	for _, oneHash := range confirmed {
+		exist[oneHash] = true
+	}
+
+	now := time.Now().Unix()
+	for _, oneRedis := range allRedis {
+		if exist[oneRedis.Txid] || oneRedis.ReceiveTime > now-UNCONFIRMEDGRACETIME {
+			continue
+		}
+
+		// double check with the node mempool
+		if _, err := jsonrpc.OmniCall(1, "getmempoolentry", []interface{}{oneRedis.Txid}); nil == err || !isNotInMempool(err) {
+			continue
+		}
+
+		if err := DropUnconfirmedOmniTransaction(oneRedis.Txid, DROPPED, ""); nil != err {
+			log.Log.Error(err, " remove evicted unconfirmed omni transaction fail, omni transaction hash: ", oneRedis.Txid)
+		}
+	}
+}
+
+func isNotInMempool(err error) bool {
+	type ResultErr struct {
+		Code    int
+		Message string
+	}
+	type resultRpcErr struct {
+		Result string
+		Error  ResultErr
+		Id     int
+	}
+
+	var resultInfo resultRpcErr
+	if nil == json.Unmarshal([]byte(err.Error()), &resultInfo) {
+		return -5 == resultInfo.Error.Code
+	}
+
+	return false
+}
+
+// forgetDroppedOmniTransaction deletes dropped records that are too old or got mined after all
+func forgetDroppedOmniTransaction() error {
+	allInfo, err := database.RedisDb.HGetAll(REDISDROPPEDOMNITRXKEY).Result()
+	if nil != err {
+		log.Log.Error(err, " redis get DroppedOmniTransaction fail")
+		return err
+	}
+
+	type blockTxid struct {
+		Txid string
+	}
+
+	now := time.Now().Unix()
+	for txid, info := range allInfo {
+		dropped := DroppedOmniTransaction{}
+		if err := json.Unmarshal([]byte(info), &dropped); nil != err || dropped.DroppedTime < now-DROPPEDKEEPTIME {
+			database.RedisDb.HDel(REDISDROPPEDOMNITRXKEY, txid)
+			continue
+		}
+
+		var result []blockTxid
+		selectSql := fmt.Sprintf("select txid from t_omni_transaction_info where txid='%s';", txid)
+		if err := database.Db.Raw(selectSql).Scan(&result).Error; nil == err && 0 != len(result) {
+			database.RedisDb.HDel(REDISDROPPEDOMNITRXKEY, txid)
+		}
+	}
+
+	return nil
+}
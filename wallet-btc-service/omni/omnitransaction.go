@@ -6,11 +6,13 @@ import (
 	"sync"
 	"time"
 
+	"github.com/BlockABC/wallet-btc-service/common/config"
 	"github.com/BlockABC/wallet-btc-service/common/log"
 	"github.com/BlockABC/wallet-btc-service/database"
 	"github.com/BlockABC/wallet-btc-service/database/tables"
 	"github.com/BlockABC/wallet-btc-service/jsonrpc"
 	"github.com/BlockABC/wallet-btc-service/request"
+	"github.com/BlockABC/wallet-btc-service/webhook"
 )
 
 type OmniTransaction struct {
@@ -268,6 +270,8 @@ func SaveOmniTransaction(newTransaction *OmniTransaction) error {
 		return err
 	}
 
+	webhookOmniTransactionNotify(newTransaction)
+
 	return nil
 }
 
@@ -543,3 +547,44 @@ func oneOmniTransactionNotify(newTrx *OmniTransaction) error {
 
 	return request.NotifyTerminal(info)
 }
+
+// webhookOmniTransactionNotify queues the webhook events of the sending and reference address of an omni
+// transaction
+func webhookOmniTransactionNotify(newTrx *OmniTransaction) error {
+	// invalid transactions transfer nothing
+	if 0 != len(newTrx.Blockhash) && !newTrx.Valid {
+		return nil
+	}
+
+	token := webhook.TOKENOMNI
+	if newTrx.Propertyid == config.Cfg.OmniOpt.UsdtPropertyId {
+		token = webhook.TOKENUSDT
+	}
+
+	allActivity := make([]webhook.Activity, 0)
+	for _, one := range []struct {
+		address   string
+		direction string
+	}{{newTrx.Sendingaddress, webhook.DIRECTIONOUT}, {newTrx.Referenceaddress, webhook.DIRECTIONIN}} {
+		if 0 == len(one.address) {
+			continue
+		}
+		allActivity = append(allActivity, webhook.Activity{
+			Event:      webhook.EVENTOMNITRANSFER,
+			Txid:       newTrx.Txid,
+			Address:    one.address,
+			Token:      token,
+			Amount:     newTrx.Amount,
+			Propertyid: newTrx.Propertyid,
+			Direction:  one.direction,
+			Blockhash:  newTrx.Blockhash,
+			Height:     newTrx.Block,
+		})
+	}
+
+	if err := webhook.Publish(allActivity); nil != err {
+		log.Log.Error(err, " webhookOmniTransactionNotify publish fail, txid: ", newTrx.Txid)
+		return err
+	}
+	return nil
+}
@@ -24,6 +24,7 @@ func SaveUnconfirmedOmniTransactionToRedis(oneOmniTransaction *OmniTransaction)
 	}
 
 	oneOmniTransactionNotify(oneOmniTransaction)
+	webhookOmniTransactionNotify(oneOmniTransaction)
 
 	return nil
 }
@@ -41,6 +41,7 @@ func RepairUnconfirmedOmniTransaction() error {
 		}
 	}
 
+	confirmedHash := make([]string, 0)
 	if 0 != len(strRedisHash) {
 		type blockTxid struct {
 			Txid string
@@ -53,19 +54,22 @@ func RepairUnconfirmedOmniTransaction() error {
 			return err
 		}
 
-		deleteRedisHash := make([]string, 0)
 		for _, oneBlockTxid := range existTransactionHash {
-			deleteRedisHash = append(deleteRedisHash, oneBlockTxid.Txid)
+			confirmedHash = append(confirmedHash, oneBlockTxid.Txid)
 		}
 
-		log.Log.Info("repair unconfirmed omni transaction get real need delete unconfirmed transaction success, real need delete unconfirmed omni transaction hashs:", deleteRedisHash)
+		log.Log.Info("repair unconfirmed omni transaction get real need delete unconfirmed transaction success, real need delete unconfirmed omni transaction hashs:", confirmedHash)
 
-		if err := DeleteRedisUnfmdOmniTransaction(deleteRedisHash); nil != err {
+		if err := DeleteRedisUnfmdOmniTransaction(confirmedHash); nil != err {
 			log.Log.Error(err, " repair unconfirmed omni transaction delete block transaction fail")
 			return err
 		}
 	}
 
+	// drop transaction evicted from mempool or double spent
+	removeEvictedOmniTransaction(allRedis, allUnconfirmedTransaction, confirmedHash)
+	forgetDroppedOmniTransaction()
+
 	// get real lost omni unconfirmed transaction
 	realLostOmniTransaction := make([]OmniTransaction, 0)
 	for _, oneUnconfirmedTransaction := range allUnconfirmedTransaction {
@@ -0,0 +1,181 @@
+package price
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BlockABC/wallet-btc-service/common/config"
+	"github.com/BlockABC/wallet-btc-service/common/log"
+	"github.com/BlockABC/wallet-btc-service/database"
+	"github.com/BlockABC/wallet-btc-service/database/tables"
+)
+
+const (
+	BITCOIN = "bitcoin"
+	TETHER  = "tether"
+)
+
+var (
+	// coins refreshed in background
+	COINIDS = []string{BITCOIN, TETHER}
+
+	ErrNoPrice = errors.New("no price of the coin yet")
+)
+
+// last known price of a coin
+type Price struct {
+	Usd        float64 `json:"usd"`
+	Provider   string  `json:"provider"`
+	UpdateTime int64   `json:"updatetime"`
+}
+
+// Age returns the seconds since the price was fetched
+func (p *Price) Age() int64 {
+	return time.Now().Unix() - p.UpdateTime
+}
+
+// Stale reports if the price is older than the configured stale age
+func (p *Price) Stale() bool {
+	return p.Age() > int64(config.Cfg.PriceOpt.StaleAge)
+}
+
+var (
+	priceMutex  sync.RWMutex
+	allPrice    = map[string]Price{}
+	allProvider []Provider
+)
+
+// Initialize creates the configured providers, the prices are fetched by Start
+func Initialize() error {
+	allProvider = []Provider{}
+	for _, oneName := range strings.Split(config.Cfg.PriceOpt.Providers, ",") {
+		oneName = strings.TrimSpace(oneName)
+		if "" == oneName {
+			continue
+		}
+		err, oneProvider := NewProvider(oneName, config.Cfg.PriceOpt.File)
+		if nil != err {
+			log.Log.Error(err, " create price provider fail")
+			return err
+		}
+		allProvider = append(allProvider, oneProvider)
+	}
+	if 0 == len(allProvider) {
+		return errors.New("no price provider configured")
+	}
+	return nil
+}
+
+// refreshInterval returns the seconds between refreshes, it is the time bucket of the price history too
+func refreshInterval() int64 {
+	if config.Cfg.PriceOpt.RefreshInterval <= 0 {
+		return 60
+	}
+	return int64(config.Cfg.PriceOpt.RefreshInterval)
+}
+
+// Start refreshes the prices at once, then every refresh interval until ctx is done
+func Start(ctx context.Context) error {
+	interval := time.Duration(refreshInterval()) * time.Second
+
+	log.Log.Notice("start price refresh, interval: ", interval)
+	for {
+		if err := Refresh(COINIDS); nil != err {
+			log.Log.Error(err, " refresh price fail, retry after ", interval)
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Log.Notice("price refresh stopped")
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// saveHistory saves the prices to the price history, one price of a coin per time bucket, so the servers
+// refreshing at the same time save it once
+func saveHistory(allHistory []tables.TablePriceHistory) {
+	for _, oneHistory := range allHistory {
+		insertSql := fmt.Sprintf("insert ignore into t_price_history (coin, price, provider, time, bucket) values ('%s', %v, '%s', %d, %d);",
+			oneHistory.Coin, oneHistory.Price, oneHistory.Provider, oneHistory.Time, oneHistory.Bucket)
+		if err := database.Db.Exec(insertSql).Error; nil != err {
+			log.Log.Error(err, " exec sql fail: ", insertSql)
+		}
+	}
+}
+
+// Refresh fetches the prices from the providers in order, coins a provider misses are asked to the next one,
+// fetched prices are cached and saved to the price history
+func Refresh(ids []string) error {
+	missing := ids
+	var lastErr error
+	for _, oneProvider := range allProvider {
+		if 0 == len(missing) {
+			break
+		}
+
+		err, result := oneProvider.GetPrice(missing)
+		if nil != err {
+			log.Log.Error(err, " get price from ", oneProvider.Name(), " fail")
+			lastErr = err
+			continue
+		}
+
+		now := time.Now().Unix()
+		stillMissing := []string{}
+		allHistory := []tables.TablePriceHistory{}
+		priceMutex.Lock()
+		for _, oneId := range missing {
+			usd, ok := result[oneId]
+			if !ok || usd <= 0 {
+				stillMissing = append(stillMissing, oneId)
+				continue
+			}
+			allPrice[oneId] = Price{usd, oneProvider.Name(), now}
+			allHistory = append(allHistory, tables.TablePriceHistory{Coin: oneId, Price: usd, Provider: oneProvider.Name(), Time: now, Bucket: now / refreshInterval()})
+		}
+		priceMutex.Unlock()
+		missing = stillMissing
+
+		saveHistory(allHistory)
+	}
+
+	if 0 != len(missing) {
+		if nil == lastErr {
+			lastErr = errors.New("no provider has the price of " + strings.Join(missing, ","))
+		}
+		return lastErr
+	}
+	return nil
+}
+
+// GetPrice returns the last known price of the coin
+func GetPrice(id string) (error, Price) {
+	priceMutex.RLock()
+	defer priceMutex.RUnlock()
+
+	onePrice, ok := allPrice[id]
+	if !ok {
+		return ErrNoPrice, Price{}
+	}
+	return nil, onePrice
+}
+
+// GetPriceHistory returns the saved prices of the coin in [begin, end] by time, end 0 is now
+func GetPriceHistory(id string, begin int64, end int64) (error, []tables.TablePriceHistory) {
+	if 0 == end {
+		end = time.Now().Unix()
+	}
+
+	var allHistory []tables.TablePriceHistory
+	if err := database.Db.Where("coin = ? AND time >= ? AND time <= ?", id, begin, end).Order("time asc").Find(&allHistory).Error; nil != err {
+		log.Log.Error(err, " select * from t_price_history fail, coin: ", id)
+		return err, nil
+	}
+	return nil, allHistory
+}
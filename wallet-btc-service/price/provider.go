@@ -0,0 +1,90 @@
+package price
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+
+	"github.com/BlockABC/wallet-btc-service/request"
+)
+
+const (
+	PROVIDERCOINGECKO = "coingecko"
+	PROVIDERCOINCAP   = "coincap"
+	PROVIDERFILE      = "file"
+)
+
+// Provider returns the usd price of coins by coingecko id
+type Provider interface {
+	Name() string
+	GetPrice(ids []string) (error, map[string]float64)
+}
+
+// NewProvider returns the provider of the name, file is the price file of the file provider
+func NewProvider(name string, file string) (error, Provider) {
+	switch name {
+	case PROVIDERCOINGECKO:
+		return nil, &coingeckoProvider{}
+	case PROVIDERCOINCAP:
+		return nil, &coincapProvider{}
+	case PROVIDERFILE:
+		if "" == file {
+			return errors.New("file price provider without price file"), nil
+		}
+		return nil, NewFileProvider(file)
+	}
+	return errors.New("unknown price provider " + name), nil
+}
+
+type coingeckoProvider struct{}
+
+func (p *coingeckoProvider) Name() string {
+	return PROVIDERCOINGECKO
+}
+
+func (p *coingeckoProvider) GetPrice(ids []string) (error, map[string]float64) {
+	return request.GetPrice(ids)
+}
+
+type coincapProvider struct{}
+
+func (p *coincapProvider) Name() string {
+	return PROVIDERCOINCAP
+}
+
+func (p *coincapProvider) GetPrice(ids []string) (error, map[string]float64) {
+	return request.GetCoincapPrice(ids)
+}
+
+// file provider, a json object of coin id to usd price read on every request, for offline use and tests
+type FileProvider struct {
+	file string
+}
+
+func NewFileProvider(file string) *FileProvider {
+	return &FileProvider{file}
+}
+
+func (p *FileProvider) Name() string {
+	return PROVIDERFILE
+}
+
+func (p *FileProvider) GetPrice(ids []string) (error, map[string]float64) {
+	info, err := ioutil.ReadFile(p.file)
+	if nil != err {
+		return err, nil
+	}
+
+	allPrice := map[string]float64{}
+	if err := json.Unmarshal(info, &allPrice); nil != err {
+		return errors.New("price file json unmarshal err:" + err.Error()), nil
+	}
+
+	result := map[string]float64{}
+	for _, oneId := range ids {
+		if price, ok := allPrice[oneId]; ok {
+			result[oneId] = price
+		}
+	}
+	return nil, result
+}
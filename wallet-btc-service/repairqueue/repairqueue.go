@@ -0,0 +1,334 @@
+// Package repairqueue keeps the blocks, transactions and omni heights failed to save as jobs in
+// t_repair_job_info. The repair tasks of notify and omni take the due jobs of their type, a job repaired is
+// deleted and a failed one is retried after a backoff until the max attempts, then it is dead until retried.
+package repairqueue
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/BlockABC/wallet-btc-service/common/config"
+	"github.com/BlockABC/wallet-btc-service/common/log"
+	"github.com/BlockABC/wallet-btc-service/common/utility"
+	"github.com/BlockABC/wallet-btc-service/database"
+	"github.com/BlockABC/wallet-btc-service/database/tables"
+)
+
+// job type and its key
+const (
+	JOBBLOCK           = "block"           // block hash
+	JOBTRANSACTION     = "transaction"     // block height_transaction hash
+	JOBOMNIBLOCK       = "omniblock"       // block height
+	JOBOMNITRANSACTION = "omnitransaction" // transaction hash
+	JOBBLOCKSTATE      = "blockstate"      // block height, its output state, input from and address balance
+)
+
+var ALLJOBTYPE = map[string]bool{JOBBLOCK: true, JOBTRANSACTION: true, JOBOMNIBLOCK: true, JOBOMNITRANSACTION: true, JOBBLOCKSTATE: true}
+
+// state of t_repair_job_info
+const (
+	JOBPENDING = 0
+	JOBDEAD    = 1
+)
+
+const (
+	MAXERRORLEN = 512
+	MAXKEYLEN   = 128
+)
+
+var ErrInvalidJobType = errors.New("invalid repair job type")
+
+// Backoff returns the seconds before the next run after attempts failed ones, it doubles from the base
+// backoff up to the max backoff
+func Backoff(attempts int32) int64 {
+	base := int64(config.Cfg.RepairOpt.BaseBackoff)
+	max := int64(config.Cfg.RepairOpt.MaxBackoff)
+	if base <= 0 {
+		base = 1
+	}
+
+	delay := base
+	for i := int32(1); i < attempts && (max <= 0 || delay < max); i++ {
+		delay *= 2
+	}
+	if max > 0 && delay > max {
+		delay = max
+	}
+	return delay
+}
+
+// Enqueue adds jobs due now, a key already queued is left as it is
+func Enqueue(jobType string, allKey []string) error {
+	if !ALLJOBTYPE[jobType] {
+		return ErrInvalidJobType
+	}
+
+	keyMap := make(map[string]bool)
+	realKey := make([]string, 0, len(allKey))
+	for _, oneKey := range allKey {
+		if oneKey = strings.TrimSpace(oneKey); !isKey(oneKey) || keyMap[oneKey] {
+			continue
+		}
+		keyMap[oneKey] = true
+		realKey = append(realKey, oneKey)
+	}
+
+	now := time.Now().Unix()
+	for begin := 0; begin < len(realKey); begin += database.MAX_WITH_INSERT {
+		end := begin + database.MAX_WITH_INSERT
+		if end > len(realKey) {
+			end = len(realKey)
+		}
+
+		insertSql := "insert ignore into t_repair_job_info(jobtype, jobkey, state, attempts, nextrun, createtime, updatetime) values "
+		for index, oneKey := range realKey[begin:end] {
+			if 0 == index {
+				insertSql += fmt.Sprintf(`('%s','%s',%d,0,%d,%d,%d)`, jobType, oneKey, JOBPENDING, now, now, now)
+			} else {
+				insertSql += fmt.Sprintf(`,('%s','%s',%d,0,%d,%d,%d)`, jobType, oneKey, JOBPENDING, now, now, now)
+			}
+		}
+		insertSql += ";"
+		if err := database.Db.Exec(insertSql).Error; nil != err {
+			log.Log.Error(err, " exec sql fail: ", insertSql)
+			return err
+		}
+	}
+
+	if 0 != len(realKey) {
+		log.Log.Info("enqueue repair jobs success, job type: ", jobType, ", job keys: ", realKey)
+	}
+	return nil
+}
+
+// isKey reports if a key is a hash, a height or a height and a hash joined by "_"
+func isKey(key string) bool {
+	if "" == key || len(key) > MAXKEYLEN {
+		return false
+	}
+	for _, c := range key {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '_' == c) {
+			return false
+		}
+	}
+	return true
+}
+
+// Claim takes the due pending jobs of a type, they are not due again for repair.lease seconds so a run that
+// does not finish is retried. Their attempts count the run.
+func Claim(jobType string) (error, []tables.TableRepairJobInfo) {
+	batchSize := config.Cfg.RepairOpt.BatchSize
+	if batchSize <= 0 || batchSize > database.MAX_WITh_IN {
+		batchSize = database.MAX_WITh_IN
+	}
+	lease := int64(config.Cfg.RepairOpt.Lease)
+	if lease <= 0 {
+		lease = 1800
+	}
+
+	now := time.Now().Unix()
+	var allJob []tables.TableRepairJobInfo
+	if err := database.Db.Where("jobtype = ? AND state = ? AND nextrun <= ?", jobType, JOBPENDING, now).Order("nextrun").Limit(batchSize).Find(&allJob).Error; nil != err {
+		log.Log.Error(err, " select * from t_repair_job_info fail, job type: ", jobType)
+		return err, nil
+	}
+	if 0 == len(allJob) {
+		return nil, nil
+	}
+
+	var strIds string
+	for index := range allJob {
+		allJob[index].Attempts++
+		if 0 == index {
+			strIds += fmt.Sprintf("%d", allJob[index].Id)
+		} else {
+			strIds += fmt.Sprintf(",%d", allJob[index].Id)
+		}
+	}
+	updateSql := fmt.Sprintf("update t_repair_job_info set attempts = attempts + 1, nextrun = %d, updatetime = %d where id in (%s);", now+lease, now, strIds)
+	if err := database.Db.Exec(updateSql).Error; nil != err {
+		log.Log.Error(err, " exec sql fail: ", updateSql)
+		return err, nil
+	}
+	return nil, allJob
+}
+
+// Done deletes the jobs of the keys, they are repaired
+func Done(jobType string, allKey []string) error {
+	for begin := 0; begin < len(allKey); begin += database.MAX_WITh_IN {
+		end := begin + database.MAX_WITh_IN
+		if end > len(allKey) {
+			end = len(allKey)
+		}
+
+		var strKeys string
+		for index, oneKey := range allKey[begin:end] {
+			if 0 == index {
+				strKeys += fmt.Sprintf("'%s'", oneKey)
+			} else {
+				strKeys += fmt.Sprintf(",'%s'", oneKey)
+			}
+		}
+		deleteSql := fmt.Sprintf("delete from t_repair_job_info where jobtype = '%s' and jobkey in (%s);", jobType, strKeys)
+		if err := database.Db.Exec(deleteSql).Error; nil != err {
+			log.Log.Error(err, " exec sql fail: ", deleteSql)
+			return err
+		}
+	}
+	return nil
+}
+
+// Fail records a failed run of a claimed job, it is due again after the backoff or dead after
+// repair.maxattempts runs
+func Fail(job *tables.TableRepairJobInfo, reason error) error {
+	lastError := "unknown error"
+	if nil != reason {
+		lastError = reason.Error()
+	}
+	if len(lastError) > MAXERRORLEN {
+		lastError = lastError[:MAXERRORLEN]
+	}
+	state := JOBPENDING
+	if maxAttempts := config.Cfg.RepairOpt.MaxAttempts; maxAttempts > 0 && int(job.Attempts) >= maxAttempts {
+		state = JOBDEAD
+	}
+	log.Log.Error(reason, " repair job fail, job type: ", job.Jobtype, ", job key: ", job.Jobkey, ", attempts: ", job.Attempts, ", state: ", state)
+
+	now := time.Now().Unix()
+	updateSql := "update t_repair_job_info set state = ?, nextrun = ?, lasterror = ?, updatetime = ? where id = ?;"
+	if err := database.Db.Exec(updateSql, state, now+Backoff(job.Attempts), lastError, now, job.Id).Error; nil != err {
+		log.Log.Error(err, " update t_repair_job_info fail, job id: ", job.Id)
+		return err
+	}
+	return nil
+}
+
+// jobSql returns the condition of the jobs of a type, all types if it is empty
+func jobSql(jobType string) string {
+	if "" == jobType {
+		return "1 = 1"
+	}
+	return fmt.Sprintf("jobtype = '%s'", jobType)
+}
+
+// idSql returns the condition of the job ids
+func idSql(ids []int64) string {
+	var strIds string
+	for index, oneId := range ids {
+		if 0 == index {
+			strIds += fmt.Sprintf("%d", oneId)
+		} else {
+			strIds += fmt.Sprintf(",%d", oneId)
+		}
+	}
+	return "id in (" + strIds + ")"
+}
+
+// List returns a page of the jobs of a type in a state, all types if jobType is empty, the oldest first
+func List(jobType string, state int, page int, size int) (error, []tables.TableRepairJobInfo) {
+	if "" != jobType && !ALLJOBTYPE[jobType] {
+		return ErrInvalidJobType, nil
+	}
+
+	var result []tables.TableRepairJobInfo
+	if err := database.Db.Where(jobSql(jobType)).Where("state = ?", state).Order("id").Offset(page * size).Limit(size).Find(&result).Error; nil != err {
+		log.Log.Error(err, " select * from t_repair_job_info fail, job type: ", jobType)
+		return err, nil
+	}
+	return nil, result
+}
+
+// Count returns the jobs of a type in a state, all types if jobType is empty
+func Count(jobType string, state int) (error, int64) {
+	var count int64
+	if err := database.Db.Model(&tables.TableRepairJobInfo{}).Where(jobSql(jobType)).Where("state = ?", state).Count(&count).Error; nil != err {
+		log.Log.Error(err, " select count(*) from t_repair_job_info fail, job type: ", jobType)
+		return err, 0
+	}
+	return nil, count
+}
+
+// Retry makes dead jobs due now with their attempts reset, the ids or every dead job of the type, it returns
+// how many are queued
+func Retry(jobType string, ids []int64) (error, int64) {
+	if "" != jobType && !ALLJOBTYPE[jobType] {
+		return ErrInvalidJobType, 0
+	}
+
+	now := time.Now().Unix()
+	updateSql := fmt.Sprintf("update t_repair_job_info set state = %d, attempts = 0, nextrun = %d, updatetime = %d where %s and state = %d", JOBPENDING, now, now, jobSql(jobType), JOBDEAD)
+	if 0 != len(ids) {
+		updateSql += " and " + idSql(ids)
+	}
+	updateSql += ";"
+	result := database.Db.Exec(updateSql)
+	if err := result.Error; nil != err {
+		log.Log.Error(err, " exec sql fail: ", updateSql)
+		return err, 0
+	}
+	return nil, result.RowsAffected
+}
+
+// Purge deletes jobs, the ids in any state or every dead job of the type, it returns how many are deleted
+func Purge(jobType string, ids []int64) (error, int64) {
+	if "" != jobType && !ALLJOBTYPE[jobType] {
+		return ErrInvalidJobType, 0
+	}
+
+	deleteSql := fmt.Sprintf("delete from t_repair_job_info where %s", jobSql(jobType))
+	if 0 != len(ids) {
+		deleteSql += " and " + idSql(ids)
+	} else {
+		deleteSql += fmt.Sprintf(" and state = %d", JOBDEAD)
+	}
+	deleteSql += ";"
+	result := database.Db.Exec(deleteSql)
+	if err := result.Error; nil != err {
+		log.Log.Error(err, " exec sql fail: ", deleteSql)
+		return err, 0
+	}
+	return nil, result.RowsAffected
+}
+
+// ImportFile queues the keys of a repair file, one per line, written before the repair queue, and removes it
+func ImportFile(jobType string, filename string) error {
+	if !utility.IsFileExist(filename) {
+		return nil
+	}
+
+	fs, err := os.Open(filename)
+	if nil != err {
+		log.Log.Error(err, " import repair file open file fail, file: ", filename)
+		return err
+	}
+
+	allKey := []string{}
+	br := bufio.NewReader(fs)
+	for {
+		line, _, err := br.ReadLine()
+		if err == io.EOF {
+			break
+		} else if nil != err {
+			log.Log.Error(err, " import repair file read file fail, file: ", filename)
+			fs.Close()
+			return err
+		}
+		allKey = append(allKey, string(line))
+	}
+	fs.Close()
+
+	if err := Enqueue(jobType, allKey); nil != err {
+		return err
+	}
+	if err := os.Remove(filename); nil != err {
+		log.Log.Error(err, " import repair file remove file fail, file: ", filename)
+		return err
+	}
+	log.Log.Notice("import repair file success, file: ", filename, ", job type: ", jobType)
+	return nil
+}
@@ -24,6 +24,11 @@ type NotifyAddress struct {
 }
 
 func GetNotifyAddress() (error, []NotifyAddress) {
+	// push service is optional, webhooks deliver the events too
+	if "" == config.Cfg.BtcOpt.NotifyServerAddress {
+		return nil, []NotifyAddress{}
+	}
+
 	client := &http.Client{}
 	req, err := http.NewRequest("GET", config.Cfg.BtcOpt.NotifyServerAddress+"/v1/cids", nil)
 	if err != nil {
@@ -32,7 +37,7 @@ func GetNotifyAddress() (error, []NotifyAddress) {
 
 	body := url.Values{}
 	body.Add("chain_type", "BTC")
-	body.Add("chain_id", "mainnet")
+	body.Add("chain_id", config.Cfg.Network)
 	req.Header.Set("accept", "application/json")
 	req.URL.RawQuery = body.Encode()
 
@@ -70,6 +75,16 @@ func GetNotifyAddress() (error, []NotifyAddress) {
 	return nil, rpcResult.Data.Address
 }
 
+// msg type of a push, 1 and 2 are sent when a transaction is seen, the others as it confirms or reverts
+const (
+	MSGTYPEINCOMING = 1
+	MSGTYPEOUTGOING = 2
+	MSGTYPECONFIRM1 = 3
+	MSGTYPECONFIRM3 = 4
+	MSGTYPECONFIRM6 = 5
+	MSGTYPEREVERTED = 6
+)
+
 type NotifyInfo struct {
 	Chain_type string `json:"chain_type"`
 	Chain_id   string `json:"chain_id"`
@@ -6,13 +6,29 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/BlockABC/wallet-btc-service/common/config"
 )
 
 const URLPRICE = `https://api.coingecko.com/api/v3/simple/price`
 
+// DEFAULTPRICETIMEOUT is the seconds of a price request if price.timeout is not set
+const DEFAULTPRICETIMEOUT = 10
+
+// newPriceClient returns a client giving up on a price provider after the configured timeout
+func newPriceClient() *http.Client {
+	timeout := time.Duration(config.Cfg.PriceOpt.Timeout) * time.Second
+	if timeout <= 0 {
+		timeout = DEFAULTPRICETIMEOUT * time.Second
+	}
+	return &http.Client{Timeout: timeout}
+}
+
 func GetPrice(ids []string) (errInfo error, priceInfo map[string]float64) {
-	client := &http.Client{}
+	client := newPriceClient()
 	req, err := http.NewRequest("GET", URLPRICE, nil)
 	if err != nil {
 		return errors.New("http new request err:" + err.Error()), nil
@@ -28,6 +44,7 @@ func GetPrice(ids []string) (errInfo error, priceInfo map[string]float64) {
 	if err != nil {
 		return errors.New("client do err:" + err.Error()), nil
 	}
+	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
 		return errors.New("request error:" + resp.Status), nil
 	}
@@ -51,3 +68,56 @@ func GetPrice(ids []string) (errInfo error, priceInfo map[string]float64) {
 	}
 	return nil, result
 }
+
+const URLCOINCAPPRICE = `https://api.coincap.io/v2/assets`
+
+// GetCoincapPrice returns the usd price of the coins from coincap, ids are the same as coingecko ones
+func GetCoincapPrice(ids []string) (errInfo error, priceInfo map[string]float64) {
+	client := newPriceClient()
+	req, err := http.NewRequest("GET", URLCOINCAPPRICE, nil)
+	if err != nil {
+		return errors.New("http new request err:" + err.Error()), nil
+	}
+
+	body := url.Values{}
+	body.Add("ids", strings.Join(ids, ","))
+	req.Header.Set("accept", "application/json")
+	req.URL.RawQuery = body.Encode()
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return errors.New("client do err:" + err.Error()), nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.New("request error:" + resp.Status), nil
+	}
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return errors.New("read body err:" + err.Error()), nil
+	}
+
+	type asset struct {
+		Id       string `json:"id"`
+		PriceUsd string `json:"priceUsd"`
+	}
+
+	type assets struct {
+		Data []asset `json:"data"`
+	}
+
+	var rpcResult = assets{}
+	if err := json.Unmarshal(respBody, &rpcResult); err != nil {
+		return errors.New("coincap assets json unmarshal err:" + err.Error()), nil
+	}
+
+	var result = map[string]float64{}
+	for _, one := range rpcResult.Data {
+		price, err := strconv.ParseFloat(one.PriceUsd, 64)
+		if nil != err {
+			return errors.New("coincap price parse err:" + err.Error()), nil
+		}
+		result[one.Id] = price
+	}
+	return nil, result
+}
@@ -11,11 +11,13 @@ import (
 	"github.com/BlockABC/wallet-btc-service/common/config"
 	"github.com/BlockABC/wallet-btc-service/common/log"
 	"github.com/BlockABC/wallet-btc-service/database"
+	"github.com/BlockABC/wallet-btc-service/price"
+	"github.com/BlockABC/wallet-btc-service/stream"
 )
 
 func main() {
 	log.Log.Notice("start bitcoin server database process...")
-	ctx := context.Background()
+	ctx, cancel := context.WithCancel(context.Background())
 
 	// initialize database
 	dbOpt := config.Cfg.DbOpt
@@ -27,10 +29,30 @@ func main() {
 	if err := database.InitRedis(config.Cfg.RedisOpt.RedisAddress, config.Cfg.RedisOpt.RedisDbNum); nil != err {
 		panic(err)
 	}
+	// price
+	if err := price.Initialize(); nil != err {
+		panic(err)
+	}
+	go price.Start(ctx)
+
+	// stream events from the ingest process
+	go stream.Start(ctx)
+
 	// http server
-	go httpserver.StartHttpServer(config.Cfg, ctx)
+	serverDone := make(chan struct{})
+	go func() {
+		defer close(serverDone)
+		if err := httpserver.StartHttpServer(config.Cfg, ctx); nil != err {
+			log.Log.Error(err, " api http server fail")
+		}
+	}()
 
 	wait()
+
+	// streams are ended and the requests being served finish within btc.shutdowntimeout
+	cancel()
+	<-serverDone
+	log.Log.Notice("btc-wallet-server stopped")
 }
 
 //capture single
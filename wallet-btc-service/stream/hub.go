@@ -0,0 +1,311 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/BlockABC/wallet-btc-service/common/log"
+	"github.com/BlockABC/wallet-btc-service/database"
+)
+
+const (
+	SUBSCRIPTIONBUFFER  = 256  // messages queued for a slow client before it is dropped
+	MAXSUBSCRIBEADDRESS = 1000 // addresses of a subscription
+)
+
+var ErrTooManyAddress = errors.New("too many addresses subscribed")
+
+// message queued for a client, Payload is the json of the event
+type Message struct {
+	Type    string
+	Payload []byte
+}
+
+// Subscription of a client, Done is closed once it is dropped
+type Subscription struct {
+	Messages chan Message
+	Done     chan struct{}
+
+	mutex     sync.Mutex
+	blocks    bool
+	mempool   bool
+	addresses map[string]bool
+	closeOnce sync.Once
+}
+
+var (
+	subscriptionMutex sync.RWMutex
+	allSubscription   = make(map[*Subscription]bool)
+)
+
+// NewSubscription registers a subscription to nothing yet
+func NewSubscription() *Subscription {
+	s := &Subscription{
+		Messages:  make(chan Message, SUBSCRIPTIONBUFFER),
+		Done:      make(chan struct{}),
+		addresses: make(map[string]bool),
+	}
+
+	subscriptionMutex.Lock()
+	allSubscription[s] = true
+	subscriptionMutex.Unlock()
+	return s
+}
+
+// Close unregisters the subscription
+func (s *Subscription) Close() {
+	subscriptionMutex.Lock()
+	delete(allSubscription, s)
+	subscriptionMutex.Unlock()
+
+	s.closeOnce.Do(func() {
+		close(s.Done)
+	})
+}
+
+// CloseAll drops every subscription, their clients are disconnected
+func CloseAll() {
+	subscriptionMutex.RLock()
+	allSub := make([]*Subscription, 0, len(allSubscription))
+	for s := range allSubscription {
+		allSub = append(allSub, s)
+	}
+	subscriptionMutex.RUnlock()
+
+	for _, s := range allSub {
+		s.Close()
+	}
+}
+
+// Subscribe adds new blocks, mempool transactions and the activity of addresses to the subscription
+func (s *Subscription) Subscribe(blocks bool, mempool bool, addresses []string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	count := len(s.addresses)
+	for _, oneAddress := range addresses {
+		if !s.addresses[oneAddress] {
+			count++
+		}
+	}
+	if count > MAXSUBSCRIBEADDRESS {
+		return ErrTooManyAddress
+	}
+
+	s.blocks = s.blocks || blocks
+	s.mempool = s.mempool || mempool
+	for _, oneAddress := range addresses {
+		s.addresses[oneAddress] = true
+	}
+	return nil
+}
+
+// Unsubscribe removes new blocks, mempool transactions and the activity of addresses from the subscription
+func (s *Subscription) Unsubscribe(blocks bool, mempool bool, addresses []string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.blocks = s.blocks && !blocks
+	s.mempool = s.mempool && !mempool
+	for _, oneAddress := range addresses {
+		delete(s.addresses, oneAddress)
+	}
+}
+
+// Topics returns what the subscription receives
+func (s *Subscription) Topics() (bool, bool, []string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	addresses := make([]string, 0, len(s.addresses))
+	for oneAddress := range s.addresses {
+		addresses = append(addresses, oneAddress)
+	}
+	return s.blocks, s.mempool, addresses
+}
+
+// send queues the message without blocking, a client too slow to take it is dropped
+func (s *Subscription) send(message Message) {
+	select {
+	case s.Messages <- message:
+	default:
+		log.Log.Info("stream subscription queue full, drop client")
+		s.Close()
+	}
+}
+
+// Start relays the events published by the ingest process to the subscriptions until ctx is done, then
+// the subscriptions are dropped so the streaming requests end
+func Start(ctx context.Context) error {
+	pubsub := database.RedisDb.Subscribe(REDISSTREAMCHANNEL)
+	defer pubsub.Close()
+	defer CloseAll()
+
+	allMessage := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case oneMessage, ok := <-allMessage:
+			if !ok {
+				return nil
+			}
+			dispatch(oneMessage.Payload)
+		}
+	}
+}
+
+// dispatch sends an event to the subscriptions of its topic, and the activity of the subscribed addresses
+// in it as address events
+func dispatch(payload string) {
+	var event struct {
+		Type string          `json:"type"`
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(payload), &event); nil != err {
+		log.Log.Error(err, " unmarshal stream event fail")
+		return
+	}
+
+	subscriptionMutex.RLock()
+	allSub := make([]*Subscription, 0, len(allSubscription))
+	for s := range allSubscription {
+		allSub = append(allSub, s)
+	}
+	subscriptionMutex.RUnlock()
+
+	message := Message{Type: event.Type, Payload: []byte(payload)}
+	switch event.Type {
+	case EVENTBLOCK:
+		var block BlockData
+		if err := json.Unmarshal(event.Data, &block); nil != err {
+			log.Log.Error(err, " unmarshal stream block fail")
+			return
+		}
+
+		addressMap := make(map[string]bool)
+		addresses := make([]string, 0)
+		for _, s := range allSub {
+			blocks, _, subAddress := s.Topics()
+			if blocks {
+				s.send(message)
+			}
+			for _, oneAddress := range subAddress {
+				if !addressMap[oneAddress] {
+					addressMap[oneAddress] = true
+					addresses = append(addresses, oneAddress)
+				}
+			}
+		}
+		if 0 == len(addresses) {
+			return
+		}
+
+		err, allActivity := blockActivity(block.Hash, block.Height, addresses)
+		if nil != err {
+			return
+		}
+		sendActivity(allSub, allActivity)
+
+	case EVENTTRANSACTION:
+		var transaction TransactionData
+		if err := json.Unmarshal(event.Data, &transaction); nil != err {
+			log.Log.Error(err, " unmarshal stream transaction fail")
+			return
+		}
+
+		for _, s := range allSub {
+			if _, mempool, _ := s.Topics(); mempool {
+				s.send(message)
+			}
+		}
+		sendActivity(allSub, transaction.Addresses)
+	}
+}
+
+// sendActivity sends every activity to the subscriptions of its address
+func sendActivity(allSub []*Subscription, allActivity []AddressData) {
+	for _, oneActivity := range allActivity {
+		var message *Message
+		for _, s := range allSub {
+			s.mutex.Lock()
+			bWatch := s.addresses[oneActivity.Address]
+			s.mutex.Unlock()
+			if !bWatch {
+				continue
+			}
+
+			if nil == message {
+				info, err := json.Marshal(Event{Type: EVENTADDRESS, Data: oneActivity})
+				if nil != err {
+					log.Log.Error(err, " marshal stream address event fail")
+					return
+				}
+				message = &Message{Type: EVENTADDRESS, Payload: info}
+			}
+			s.send(*message)
+		}
+	}
+}
+
+// blockActivity returns the value the addresses received and spent in every transaction of a stored block
+func blockActivity(blockhash string, height int32, addresses []string) (error, []AddressData) {
+	type addressValue struct {
+		Txid    string
+		Address string
+		Value   int64
+	}
+
+	result := make([]AddressData, 0)
+	for begin := 0; begin < len(addresses); begin += database.MAX_WITh_IN {
+		end := begin + database.MAX_WITh_IN
+		if end > len(addresses) {
+			end = len(addresses)
+		}
+		var strAddress string
+		for index, oneAddress := range addresses[begin:end] {
+			if 0 == index {
+				strAddress += fmt.Sprintf("'%s'", oneAddress)
+			} else {
+				strAddress += fmt.Sprintf(",'%s'", oneAddress)
+			}
+		}
+
+		var allOutput []addressValue
+		outputSql := fmt.Sprintf("select hash as txid, `to` as address, sum(value) as value from t_output_info where blockhash = '%s' and isfork = 0 and `to` in (%s) group by hash, `to`;", blockhash, strAddress)
+		if err := database.Db.Raw(outputSql).Scan(&allOutput).Error; nil != err {
+			log.Log.Error(err, " exec sql fail: ", outputSql)
+			return err, nil
+		}
+
+		var allInput []addressValue
+		inputSql := fmt.Sprintf("select hash as txid, `from` as address, sum(value) as value from t_input_info where blockhash = '%s' and isfork = 0 and `from` in (%s) group by hash, `from`;", blockhash, strAddress)
+		if err := database.Db.Raw(inputSql).Scan(&allInput).Error; nil != err {
+			log.Log.Error(err, " exec sql fail: ", inputSql)
+			return err, nil
+		}
+
+		// merge by transaction and address
+		indexMap := make(map[string]int)
+		for _, oneOutput := range allOutput {
+			key := oneOutput.Txid + oneOutput.Address
+			if _, ok := indexMap[key]; !ok {
+				indexMap[key] = len(result)
+				result = append(result, AddressData{Address: oneOutput.Address, Txid: oneOutput.Txid, Blockhash: blockhash, Height: height})
+			}
+			result[indexMap[key]].Received += oneOutput.Value
+		}
+		for _, oneInput := range allInput {
+			key := oneInput.Txid + oneInput.Address
+			if _, ok := indexMap[key]; !ok {
+				indexMap[key] = len(result)
+				result = append(result, AddressData{Address: oneInput.Address, Txid: oneInput.Txid, Blockhash: blockhash, Height: height})
+			}
+			result[indexMap[key]].Spent += oneInput.Value
+		}
+	}
+	return nil, result
+}
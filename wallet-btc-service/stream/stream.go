@@ -0,0 +1,76 @@
+package stream
+
+import (
+	"encoding/json"
+
+	"github.com/BlockABC/wallet-btc-service/common/log"
+	"github.com/BlockABC/wallet-btc-service/database"
+)
+
+// redis channel from the ingest process to the http servers
+const REDISSTREAMCHANNEL = "StreamEvent"
+
+// type of a stream event
+const (
+	EVENTBLOCK       = "block"
+	EVENTTRANSACTION = "transaction"
+	EVENTADDRESS     = "address"
+)
+
+// block stored on the main chain
+type BlockData struct {
+	Hash              string `json:"hash"`
+	Height            int32  `json:"height"`
+	Previousblockhash string `json:"previousblockhash"`
+	Time              int64  `json:"time"`
+	NTx               int64  `json:"nTx"`
+}
+
+// value an address received and spent in a transaction
+type AddressData struct {
+	Address   string `json:"address"`
+	Txid      string `json:"txid"`
+	Received  int64  `json:"received"`
+	Spent     int64  `json:"spent"`
+	Blockhash string `json:"blockhash,omitempty"`
+	Height    int32  `json:"height,omitempty"`
+}
+
+// transaction accepted to the mempool
+type TransactionData struct {
+	Txid        string        `json:"txid"`
+	Receivetime int64         `json:"receivetime"`
+	Addresses   []AddressData `json:"addresses"`
+}
+
+// message sent to the clients
+type Event struct {
+	Type string      `json:"type"`
+	Data interface{} `json:"data"`
+}
+
+// publish sends the event to the http servers, a server not subscribed misses it
+func publish(eventType string, data interface{}) error {
+	info, err := json.Marshal(Event{Type: eventType, Data: data})
+	if nil != err {
+		log.Log.Error(err, " marshal stream event fail, type: ", eventType)
+		return err
+	}
+
+	if err := database.RedisDb.Publish(REDISSTREAMCHANNEL, info).Err(); nil != err {
+		log.Log.Error(err, " publish stream event fail, type: ", eventType)
+		return err
+	}
+	return nil
+}
+
+// PublishBlock streams a block once it is stored, the servers look up the activity of the subscribed
+// addresses in it
+func PublishBlock(block BlockData) error {
+	return publish(EVENTBLOCK, block)
+}
+
+// PublishTransaction streams a transaction once it is saved as unconfirmed
+func PublishTransaction(transaction TransactionData) error {
+	return publish(EVENTTRANSACTION, transaction)
+}
@@ -0,0 +1,56 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/BlockABC/wallet-btc-service/common/address"
+	"github.com/BlockABC/wallet-btc-service/common/chaincfg"
+)
+
+func TestValidateAddress(t *testing.T) {
+	valid := []struct {
+		address string
+		params  *chaincfg.Params
+		typ     string
+	}{
+		{"1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa", &chaincfg.MainNetParams, address.PubKeyHashTy},
+		{"3J98t1WpEZ73CNmQviecrnyiWrnqRhWNLy", &chaincfg.MainNetParams, address.ScriptHashTy},
+		{"BC1QW508D6QEJXTDG4Y5R3ZARVARY0C5XW7KV8F3T4", &chaincfg.MainNetParams, address.WitnessV0PubKeyHashTy},
+		{"bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqzk5jj0", &chaincfg.MainNetParams, address.WitnessV1TaprootTy},
+		{"tb1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3q0sl5k7", &chaincfg.TestNet3Params, address.WitnessV0ScriptHashTy},
+		{"tb1qw508d6qejxtdg4y5r3zarvary0c5xw7kxpjzsx", &chaincfg.SigNetParams, address.WitnessV0PubKeyHashTy},
+		{"mipcBbFg9gMiCh81Kj8tqqdgoZub1ZJRfn", &chaincfg.TestNet3Params, address.PubKeyHashTy},
+	}
+	for _, one := range valid {
+		decoded, err := address.DecodeAddress(one.address, one.params)
+		if nil != err {
+			t.Fatalf("%s: %v", one.address, err)
+		}
+		if one.typ != decoded.Type {
+			t.Fatalf("%s: type %s, expect %s", one.address, decoded.Type, one.typ)
+		}
+	}
+
+	invalid := []struct {
+		address string
+		params  *chaincfg.Params
+	}{
+		{"", &chaincfg.MainNetParams},
+		{"not an address at all 0OIl", &chaincfg.MainNetParams},
+		{"1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNb", &chaincfg.MainNetParams},                             // checksum
+		{"mipcBbFg9gMiCh81Kj8tqqdgoZub1ZJRfn", &chaincfg.MainNetParams},                             // testnet prefix
+		{"tb1qw508d6qejxtdg4y5r3zarvary0c5xw7kxpjzsx", &chaincfg.MainNetParams},                     // testnet hrp
+		{"tb1qw508d6qejxtdg4y5r3zarvary0c5xw7kxpjzsx", &chaincfg.RegressionNetParams},               // regtest hrp
+		{"bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kemeawh", &chaincfg.MainNetParams},                     // v0 with bech32m
+		{"bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqh2y7hd", &chaincfg.MainNetParams}, // v1 with bech32
+		{"tc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vq5zuyut", &chaincfg.MainNetParams}, // unknown hrp
+		{"BC1QR508D6QEJXTDG4Y5R3ZARVARYV98GJ9P", &chaincfg.MainNetParams},                           // v0 program length
+	}
+	for _, one := range invalid {
+		if err := address.ValidateAddress(one.address, one.params); nil == err {
+			t.Fatalf("%s: expect invalid on %s", one.address, one.params.Name)
+		} else {
+			t.Log(one.address, ": ", err)
+		}
+	}
+}
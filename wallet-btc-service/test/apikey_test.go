@@ -0,0 +1,51 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/BlockABC/wallet-btc-service/apikey"
+)
+
+func TestEndpointLimits(t *testing.T) {
+	err, limits := apikey.ParseEndpointLimits("/send_raw_transaction:10, /psbt/broadcast:5,")
+	if nil != err {
+		t.Fatal(err)
+	}
+	if 2 != len(limits) || 10 != limits["/send_raw_transaction"] || 5 != limits["/psbt/broadcast"] {
+		t.Fatal("endpoint limits: ", limits)
+	}
+
+	for _, invalid := range []string{"/send_raw_transaction", "/send_raw_transaction:0", "/address:many"} {
+		if err, _ := apikey.ParseEndpointLimits(invalid); nil == err {
+			t.Fatal("invalid endpoint limit accepted: ", invalid)
+		}
+	}
+}
+
+func TestAllowsOrigin(t *testing.T) {
+	if !apikey.AllowsOrigin("*", "https://wallet.example.com") {
+		t.Fatal("* does not allow any origin")
+	}
+	if !apikey.AllowsOrigin("https://a.example.com, https://Wallet.example.com/", "https://wallet.example.com") {
+		t.Fatal("listed origin not allowed")
+	}
+	if apikey.AllowsOrigin("https://a.example.com", "https://wallet.example.com") || apikey.AllowsOrigin("", "https://wallet.example.com") {
+		t.Fatal("origin not listed is allowed")
+	}
+}
+
+func TestCountAddresses(t *testing.T) {
+	for _, one := range []struct {
+		body  string
+		count int
+	}{
+		{`["a", "b", "c"]`, 3},
+		{`{"addresses": ["a", "b"], "remove_addresses": ["c"], "xpubs": [{"xpub": "x"}]}`, 3},
+		{`{"psbts": ["a", "b"]}`, 0},
+		{`not json`, 0},
+	} {
+		if count := apikey.CountAddresses([]byte(one.body)); one.count != count {
+			t.Fatal("body: ", one.body, ", count: ", count)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/BlockABC/wallet-btc-service/notify"
+)
+
+func TestConfirmationDepths(t *testing.T) {
+	for _, one := range []struct {
+		notified      int32
+		confirmations int32
+		expected      []int32
+	}{
+		{0, 0, []int32{}},
+		{0, 1, []int32{1}},
+		{1, 2, []int32{}},
+		{1, 3, []int32{3}},
+		// blocks missed while the service was down
+		{0, 7, []int32{1, 3, 6}},
+		{3, 6, []int32{6}},
+		{6, 10, []int32{}},
+	} {
+		if result := notify.ConfirmationDepths(one.notified, one.confirmations); !reflect.DeepEqual(one.expected, result) {
+			t.Fatal("notified: ", one.notified, ", confirmations: ", one.confirmations, ", depths: ", result)
+		}
+	}
+}
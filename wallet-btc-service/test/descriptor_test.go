@@ -0,0 +1,121 @@
+package test
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/BlockABC/wallet-btc-service/common/chaincfg"
+	"github.com/BlockABC/wallet-btc-service/common/descriptor"
+	"github.com/BlockABC/wallet-btc-service/common/hdkeychain"
+)
+
+// asXpub re-encodes a ypub or zpub with the xpub version used by descriptors
+func asXpub(t *testing.T, key string) string {
+	extendedKey, err := hdkeychain.ParseExtendedKey(key)
+	if nil != err {
+		t.Fatal(err)
+	}
+	extendedKey.Version = [4]byte{0x04, 0x88, 0xb2, 0x1e}
+	return extendedKey.String()
+}
+
+func TestDescriptorChecksum(t *testing.T) {
+	checksum, err := descriptor.Checksum("raw(deadbeef)")
+	if nil != err {
+		t.Fatal(err)
+	}
+	if "89f8spxm" != checksum {
+		t.Fatalf("checksum %s, expect 89f8spxm", checksum)
+	}
+
+	if _, err := descriptor.Parse("raw(deadbeef)#89f8spxm", &chaincfg.MainNetParams); nil != err {
+		t.Fatal(err)
+	}
+	if _, err := descriptor.Parse("raw(deadbeef)#89f8spxn", &chaincfg.MainNetParams); descriptor.ErrChecksumMismatch != err {
+		t.Fatal("wrong checksum accepted: ", err)
+	}
+}
+
+func TestDescriptorScript(t *testing.T) {
+	allCase := []struct {
+		desc   string
+		script string
+	}{
+		// bip381
+		{"pkh(02c6047f9441ed7d6d3045406e95c07cd85c778e4b8cef3ca7abac09b95c709ee5)", "76a91406afd46bcdfd22ef94ac122aa11f241244a37ecc88ac"},
+		// bip382
+		{"wpkh(02c6047f9441ed7d6d3045406e95c07cd85c778e4b8cef3ca7abac09b95c709ee5)", "001406afd46bcdfd22ef94ac122aa11f241244a37ecc"},
+		// bip383
+		{"multi(1,022f8bde4d1a07209355b4a7250a5c5128e88b84bddc619ab7cba8d569b240efe4,025cbdf0646e5db4eaa398f365f2ea7a0e3d419b7e0330e39ce92bddedcac4f9bc)",
+			"5121022f8bde4d1a07209355b4a7250a5c5128e88b84bddc619ab7cba8d569b240efe421025cbdf0646e5db4eaa398f365f2ea7a0e3d419b7e0330e39ce92bddedcac4f9bc52ae"},
+		{"sortedmulti(1,025cbdf0646e5db4eaa398f365f2ea7a0e3d419b7e0330e39ce92bddedcac4f9bc,022f8bde4d1a07209355b4a7250a5c5128e88b84bddc619ab7cba8d569b240efe4)",
+			"5121022f8bde4d1a07209355b4a7250a5c5128e88b84bddc619ab7cba8d569b240efe421025cbdf0646e5db4eaa398f365f2ea7a0e3d419b7e0330e39ce92bddedcac4f9bc52ae"},
+		// bip386
+		{"tr(a34b99f22c790c4e36b2b3c2c35a36db06226e41c692fc82b8b56ac1c540c5bd)", "512077aab6e066f8a7419c5ab714c12c67d25007ed55a43cadcacb4d7a970a093f11"},
+		{"tr(a34b99f22c790c4e36b2b3c2c35a36db06226e41c692fc82b8b56ac1c540c5bd,pk(669b8afcec803a0d323e9a17f3ea8e68e8abe5a278020a929adbec52421adbd0))", "512017cf18db381d836d8923b1bdb246cfcd818da1a9f0e6e7907f187f0b2f937754"},
+	}
+
+	for _, one := range allCase {
+		desc, err := descriptor.Parse(one.desc, &chaincfg.MainNetParams)
+		if nil != err {
+			t.Fatal(one.desc, ": ", err)
+		}
+		script, err := desc.Script(0, 0)
+		if nil != err {
+			t.Fatal(one.desc, ": ", err)
+		}
+		if one.script != hex.EncodeToString(script) {
+			t.Fatalf("%s: %x, expect %s", one.desc, script, one.script)
+		}
+	}
+}
+
+func TestDescriptorAddress(t *testing.T) {
+	zpub := asXpub(t, "zpub6rFR7y4Q2AijBEqTUquhVz398htDFrtymD9xYYfG1m4wAcvPhXNfE3EfH1r1ADqtfSdVCToUG868RvUUkgDKf31mGDtKsAYz2oz2AGutZYs")
+	ypub := asXpub(t, "ypub6Ww3ibxVfGzLrAH1PNcjyAWenMTbbAosGNB6VvmSEgytSER9azLDWCxoJwW7Ke7icmizBMXrzBx9979FfaHxHcrArf3zbeJJJUZPf663zsP")
+
+	desc, err := descriptor.Parse("wpkh([73c5da0a/84'/0'/0']"+zpub+"/<0;1>/*)", &chaincfg.MainNetParams)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if !desc.IsRange() || 2 != desc.Branches() {
+		t.Fatal("wpkh multipath descriptor should be ranged with 2 branches")
+	}
+	receive, err := desc.Address(0, 0)
+	if nil != err {
+		t.Fatal(err)
+	}
+	change, err := desc.Address(1, 0)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if "bc1qcr8te4kr609gcawutmrza0j4xv80jy8z306fyu" != receive || "bc1q8c6fshw2dlwun7ekn9qwf37cu2rn755upcp6el" != change {
+		t.Fatalf("wpkh receive %s, change %s", receive, change)
+	}
+
+	desc, err = descriptor.Parse("sh(wpkh("+ypub+"/0/*))", &chaincfg.MainNetParams)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if address, err := desc.Address(0, 0); nil != err || "37VucYSaXLCAsxYyAPfbSi9eh4iEcbShgf" != address {
+		t.Fatal("sh(wpkh) address ", address, err)
+	}
+
+	allInvalid := []string{
+		"wsh(wpkh(" + zpub + "/0/*))",
+		"wpkh(" + zpub + "/0h/*)",
+		"wpkh(" + zpub + "/<0;1>/<0;1>/*)",
+		"sh(sh(pkh(02c6047f9441ed7d6d3045406e95c07cd85c778e4b8cef3ca7abac09b95c709ee5)))",
+		"multi_a(1,02c6047f9441ed7d6d3045406e95c07cd85c778e4b8cef3ca7abac09b95c709ee5)",
+		"wpkh(xprv9s21ZrQH143K31xYSDQpPDxsXRTUcvj2iNHm5NUtrGiGG5e2DtALGdso3pGz6ssrdK4PFmM8NSpSBHNqPqm55Qn3LqFtT2emdEXVYsCzC2U/0/*)",
+	}
+	for _, one := range allInvalid {
+		if _, err := descriptor.Parse(one, &chaincfg.MainNetParams); nil == err {
+			t.Fatal("invalid descriptor accepted: ", one)
+		}
+	}
+
+	if _, err := descriptor.Parse("wpkh("+zpub+"/0/*)", &chaincfg.TestNet3Params); nil == err {
+		t.Fatal("mainnet key accepted on testnet")
+	}
+}
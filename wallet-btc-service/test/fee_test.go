@@ -0,0 +1,56 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/BlockABC/wallet-btc-service/database/tables"
+	"github.com/BlockABC/wallet-btc-service/fee"
+	"github.com/BlockABC/wallet-btc-service/notify"
+)
+
+func TestFeeRatePercentile(t *testing.T) {
+	allRate := []notify.FeeRate{{Rate: 20, Vsize: 100}, {Rate: 1, Vsize: 300}, {Rate: 5, Vsize: 600}}
+	notify.SortFeeRate(allRate)
+
+	if rate := notify.FeeRatePercentile(allRate, 25); 1 != rate {
+		t.Fatal("25th percentile: ", rate)
+	}
+	if rate := notify.FeeRatePercentile(allRate, 50); 5 != rate {
+		t.Fatal("50th percentile: ", rate)
+	}
+	if rate := notify.FeeRatePercentile(allRate, 95); 20 != rate {
+		t.Fatal("95th percentile: ", rate)
+	}
+}
+
+func TestProjectFeeRate(t *testing.T) {
+	allRate := []notify.FeeRate{{Rate: 2, Vsize: 900000}, {Rate: 10, Vsize: 600000}, {Rate: 30, Vsize: 600000}}
+	notify.SortFeeRate(allRate)
+
+	if rate := fee.ProjectFeeRate(allRate, 1); 10 != rate {
+		t.Fatal("1 block: ", rate)
+	}
+	if rate := fee.ProjectFeeRate(allRate, 2); 2 != rate {
+		t.Fatal("2 blocks: ", rate)
+	}
+	if rate := fee.ProjectFeeRate(allRate, 3); 0 != rate {
+		t.Fatal("3 blocks: ", rate)
+	}
+}
+
+func TestRecentFeeRate(t *testing.T) {
+	allBlockFee := []tables.TableBlockFeeInfo{
+		{Txcount: 10, P25: 8},
+		{Txcount: 10, P25: 3},
+		{Txcount: 0},
+		{Txcount: 10, P25: 5},
+		{Txcount: 10, P25: 1},
+	}
+
+	if rate := fee.RecentFeeRate(allBlockFee, 1); 8 != rate {
+		t.Fatal("1 block: ", rate)
+	}
+	if rate := fee.RecentFeeRate(allBlockFee, 144); 5 != rate {
+		t.Fatal("144 blocks: ", rate)
+	}
+}
@@ -0,0 +1,59 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/BlockABC/wallet-btc-service/common/chaincfg"
+	"github.com/BlockABC/wallet-btc-service/common/hdkeychain"
+)
+
+func TestExtendedKeyChild(t *testing.T) {
+	// bip32 test vector 2, m -> m/0
+	key, err := hdkeychain.ParseExtendedKey("xpub661MyMwAqRbcFW31YEwpkMuc5THy2PSt5bDMsktWQcFF8syAmRUapSCGu8ED9W6oDMSgv6Zz8idoc4a6mr8BDzTJY47LJhkJ8UB7WEGuduB")
+	if nil != err {
+		t.Fatal(err)
+	}
+	child, err := key.Child(0)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if expect := "xpub69H7F5d8KSRgmmdJg2KhpAK8SR3DjMwAdkxj3ZuxV27CprR9LgpeyGmXUbC6wb7ERfvrnKZjXoUmmDznezpbZb7ap6r1D3tgFxHmwMkQTPH"; expect != child.String() {
+		t.Fatalf("child %s, expect %s", child.String(), expect)
+	}
+
+	if _, err := hdkeychain.ParseExtendedKey("xprv9s21ZrQH143K31xYSDQpPDxsXRTUcvj2iNHm5NUtrGiGG5e2DtALGdso3pGz6ssrdK4PFmM8NSpSBHNqPqm55Qn3LqFtT2emdEXVYsCzC2U"); hdkeychain.ErrPrivateKey != err {
+		t.Fatal("private key accepted: ", err)
+	}
+}
+
+func TestAccountAddress(t *testing.T) {
+	allCase := []struct {
+		key        string
+		derivation string
+		chain      uint32
+		address    string
+	}{
+		{"zpub6rFR7y4Q2AijBEqTUquhVz398htDFrtymD9xYYfG1m4wAcvPhXNfE3EfH1r1ADqtfSdVCToUG868RvUUkgDKf31mGDtKsAYz2oz2AGutZYs", "", hdkeychain.ExternalChain, "bc1qcr8te4kr609gcawutmrza0j4xv80jy8z306fyu"},
+		{"zpub6rFR7y4Q2AijBEqTUquhVz398htDFrtymD9xYYfG1m4wAcvPhXNfE3EfH1r1ADqtfSdVCToUG868RvUUkgDKf31mGDtKsAYz2oz2AGutZYs", "", hdkeychain.InternalChain, "bc1q8c6fshw2dlwun7ekn9qwf37cu2rn755upcp6el"},
+		{"ypub6Ww3ibxVfGzLrAH1PNcjyAWenMTbbAosGNB6VvmSEgytSER9azLDWCxoJwW7Ke7icmizBMXrzBx9979FfaHxHcrArf3zbeJJJUZPf663zsP", "", hdkeychain.ExternalChain, "37VucYSaXLCAsxYyAPfbSi9eh4iEcbShgf"},
+		{"xpub6BgBgsespWvERF3LHQu6CnqdvfEvtMcQjYrcRzx53QJjSxarj2afYWcLteoGVky7D3UKDP9QyrLprQ3VCECoY49yfdDEHGCtMMj92pReUsQ", "bip86", hdkeychain.ExternalChain, "bc1p5cyxnuxmeuwuvkwfem96lqzszd02n6xdcjrs20cac6yqjjwudpxqkedrcr"},
+	}
+
+	for _, one := range allCase {
+		account, err := hdkeychain.NewAccount(one.key, one.derivation, &chaincfg.MainNetParams)
+		if nil != err {
+			t.Fatal(err)
+		}
+		address, err := account.Address(one.chain, 0)
+		if nil != err {
+			t.Fatal(err)
+		}
+		if one.address != address {
+			t.Fatalf("%s %d/0: %s, expect %s", account.Derivation, one.chain, address, one.address)
+		}
+	}
+
+	if _, err := hdkeychain.NewAccount(allCase[0].key, "", &chaincfg.TestNet3Params); hdkeychain.ErrWrongNetwork != err {
+		t.Fatal("mainnet key accepted on testnet: ", err)
+	}
+}
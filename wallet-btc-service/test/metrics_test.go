@@ -0,0 +1,46 @@
+package test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/BlockABC/wallet-btc-service/common/prometheus"
+)
+
+func TestPrometheusExposition(t *testing.T) {
+	counter := prometheus.NewCounter("test_requests_total", "Requests", "method")
+	counter.Inc("get")
+	counter.Add(2, "get")
+	counter.Inc(`po"st`)
+
+	histogram := prometheus.NewHistogram("test_duration_seconds", "Duration", []float64{0.1, 1})
+	histogram.Observe(0.05)
+	histogram.Observe(0.5)
+	histogram.Observe(5)
+
+	prometheus.NewGaugeFunc("test_height", "Height", func() float64 { return 42 })
+
+	buf := bytes.NewBuffer(nil)
+	if err := prometheus.Write(buf); nil != err {
+		t.Fatal(err)
+	}
+	output := buf.String()
+
+	for _, line := range []string{
+		"# TYPE test_requests_total counter",
+		`test_requests_total{method="get"} 3`,
+		`test_requests_total{method="po\"st"} 1`,
+		`test_duration_seconds_bucket{le="0.1"} 1`,
+		`test_duration_seconds_bucket{le="1"} 2`,
+		`test_duration_seconds_bucket{le="+Inf"} 3`,
+		"test_duration_seconds_sum 5.55",
+		"test_duration_seconds_count 3",
+		"# TYPE test_height gauge",
+		"test_height 42",
+	} {
+		if !strings.Contains(output, line+"\n") {
+			t.Fatal("missing line: ", line, "\n", output)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package test
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/BlockABC/wallet-btc-service/price"
+)
+
+func TestFilePriceProvider(t *testing.T) {
+	file, err := ioutil.TempFile("", "price")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	if _, err := file.WriteString(`{"bitcoin": 65000.5, "tether": 1}`); nil != err {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	err, provider := price.NewProvider(price.PROVIDERFILE, file.Name())
+	if nil != err {
+		t.Fatal(err)
+	}
+	err, result := provider.GetPrice([]string{price.BITCOIN, "ethereum"})
+	if nil != err {
+		t.Fatal(err)
+	}
+	if 1 != len(result) || 65000.5 != result[price.BITCOIN] {
+		t.Fatal("file price ", result)
+	}
+
+	if err, _ := price.NewProvider("unknown", ""); nil == err {
+		t.Fatal("unknown provider accepted")
+	}
+}
@@ -0,0 +1,90 @@
+package test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"strings"
+	"testing"
+
+	"github.com/BlockABC/wallet-btc-service/common/crypto"
+	"github.com/BlockABC/wallet-btc-service/common/psbt"
+	"github.com/BlockABC/wallet-btc-service/common/txscript"
+	"github.com/BlockABC/wallet-btc-service/common/wire"
+)
+
+// 2 of 3 p2wsh multisig spending one output
+func testMultisigPacket(t *testing.T) (*psbt.Packet, [][]byte, []byte) {
+	pubKeys := [][]byte{bytes.Repeat([]byte{2}, 33), bytes.Repeat([]byte{3}, 33), bytes.Repeat([]byte{4}, 33)}
+	pubKeys[1][0], pubKeys[2][0] = 2, 3
+	builder := txscript.NewScriptBuilder().AddInt64(2)
+	for _, pubKey := range pubKeys {
+		builder.AddData(pubKey)
+	}
+	witnessScript := builder.AddInt64(3).AddOp(txscript.OP_CHECKMULTISIG).Script()
+	hash := sha256.Sum256(witnessScript)
+	pkScript := append([]byte{txscript.OP_0, txscript.OP_DATA_32}, hash[:]...)
+
+	prevHash, err := crypto.StringToHash(strings.Repeat("1", 64))
+	if nil != err {
+		t.Fatal(err)
+	}
+	tx := &wire.MsgTx{Version: 2}
+	tx.TxIn = append(tx.TxIn, &wire.TxIn{PreviousOutPoint: wire.OutPoint{Hash: prevHash, Index: 0}, Sequence: 0xffffffff})
+	tx.TxOut = append(tx.TxOut, &wire.TxOut{Value: 9000, PkScript: pkScript})
+	unsignedTx, err := wire.DeserializeTx(tx.SerializeNoWitness())
+	if nil != err {
+		t.Fatal(err)
+	}
+	packet, err := psbt.New(unsignedTx)
+	if nil != err {
+		t.Fatal(err)
+	}
+	packet.Inputs[0].WitnessUtxo = &wire.TxOut{Value: 10000, PkScript: pkScript}
+	packet.Inputs[0].WitnessScript = witnessScript
+	return packet, pubKeys, witnessScript
+}
+
+func TestPsbtCombineFinalize(t *testing.T) {
+	first, pubKeys, witnessScript := testMultisigPacket(t)
+	second, _, _ := testMultisigPacket(t)
+	first.Inputs[0].PartialSigs = []*psbt.PartialSig{{PubKey: pubKeys[2], Signature: bytes.Repeat([]byte{0xcc}, 71)}}
+	second.Inputs[0].PartialSigs = []*psbt.PartialSig{{PubKey: pubKeys[0], Signature: bytes.Repeat([]byte{0xaa}, 71)}}
+	pkScript := first.PrevOut(0).PkScript
+
+	// one cosigner is not enough
+	required, signed, missing, err := first.Inputs[0].SignStatus(pkScript)
+	if nil != err || 2 != required || 1 != signed || 2 != len(missing) {
+		t.Fatal("sign status: ", required, signed, len(missing), err)
+	}
+	if err := first.FinalizeInput(0, pkScript); psbt.ErrMissingSignature != err {
+		t.Fatal("finalize without enough signatures: ", err)
+	}
+
+	packet, err := psbt.Combine([]*psbt.Packet{first, second})
+	if nil != err {
+		t.Fatal(err)
+	}
+	if _, signed, _, _ := packet.Inputs[0].SignStatus(pkScript); 2 != signed {
+		t.Fatal("combined signatures: ", signed)
+	}
+	estimated := packet.EstimateVsize([][]byte{pkScript})
+	if err := packet.Finalize(); nil != err || !packet.IsComplete() {
+		t.Fatal("finalize: ", err)
+	}
+
+	// signatures in key order after the empty item
+	tx, err := packet.Extract()
+	if nil != err {
+		t.Fatal(err)
+	}
+	witness := tx.TxIn[0].Witness
+	if 4 != len(witness) || 0 != len(witness[0]) || 0xaa != witness[1][0] || 0xcc != witness[2][0] || !bytes.Equal(witness[3], witnessScript) {
+		t.Fatal("witness: ", witness)
+	}
+	if tx.TxHash() != packet.UnsignedTx.TxHash() {
+		t.Fatal("extracted txid changed")
+	}
+	if estimated < tx.VSize() || estimated > tx.VSize()+1 {
+		t.Fatal("estimated vsize: ", estimated, ", real: ", tx.VSize())
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/BlockABC/wallet-btc-service/common/config"
 	"github.com/BlockABC/wallet-btc-service/database"
 	"github.com/BlockABC/wallet-btc-service/notify"
+	"github.com/BlockABC/wallet-btc-service/repairqueue"
 )
 
 func TestRepairBlocks(t *testing.T) {
@@ -76,4 +77,15 @@ func TestRepairAll(t *testing.T) {
 	for {
 		notify.RepairAll()
 	}
-}
\ No newline at end of file
+}
+
+func TestRepairJobBackoff(t *testing.T) {
+	base := int64(config.Cfg.RepairOpt.BaseBackoff)
+	max := int64(config.Cfg.RepairOpt.MaxBackoff)
+	if base != repairqueue.Backoff(1) || 2*base != repairqueue.Backoff(2) || 4*base != repairqueue.Backoff(3) {
+		t.Fatal("backoff: ", repairqueue.Backoff(1), repairqueue.Backoff(2), repairqueue.Backoff(3))
+	}
+	if max != repairqueue.Backoff(100) {
+		t.Fatal("max backoff: ", repairqueue.Backoff(100))
+	}
+}
@@ -7,7 +7,7 @@ import (
 	"github.com/BlockABC/wallet-btc-service/request"
 )
 
-func TestBlock(t *testing.T) {
+func TestPrice(t *testing.T) {
 	ids := []string{"bitcoin", "tether"}
 	err, result := request.GetPrice(ids)
 	if nil != err {
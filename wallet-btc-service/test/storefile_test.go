@@ -1,5 +1,12 @@
 package test
 
+import (
+	"fmt"
+	"testing"
+
+	"github.com/BlockABC/wallet-btc-service/filestore"
+)
+
 func TestStoreFile(t *testing.T) {
 	// set block repair begin
 	var blockHeight int32 = 0
@@ -0,0 +1,157 @@
+package test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/BlockABC/wallet-btc-service/common/address"
+	"github.com/BlockABC/wallet-btc-service/common/chaincfg"
+	"github.com/BlockABC/wallet-btc-service/common/crypto"
+	"github.com/BlockABC/wallet-btc-service/common/hdkeychain"
+	"github.com/BlockABC/wallet-btc-service/common/psbt"
+	"github.com/BlockABC/wallet-btc-service/common/txscript"
+	"github.com/BlockABC/wallet-btc-service/txbuilder"
+)
+
+func testSegwitAddress(t *testing.T, seed byte) (string, []byte) {
+	params := &chaincfg.RegressionNetParams
+	oneAddress, err := address.EncodeSegwit(0, bytes.Repeat([]byte{seed}, 20), params)
+	if nil != err {
+		t.Fatal(err)
+	}
+	pkScript, err := txscript.PayToAddrScript(oneAddress, params)
+	if nil != err {
+		t.Fatal(err)
+	}
+	return oneAddress, pkScript
+}
+
+func TestBuildExactMatch(t *testing.T) {
+	from, fromScript := testSegwitAddress(t, 1)
+	to, _ := testSegwitAddress(t, 2)
+	change, _ := testSegwitAddress(t, 3)
+
+	err, result := txbuilder.Build(&txbuilder.Request{
+		Utxos: []txbuilder.Utxo{
+			{Txid: strings.Repeat("1", 64), Vout: 0, Value: 50000, Address: from, PkScript: fromScript},
+			{Txid: strings.Repeat("2", 64), Vout: 1, Value: 10118, Address: from, PkScript: fromScript},
+		},
+		Recipients:    []txbuilder.Recipient{{Address: to, Value: 10000}},
+		FeeRate:       1,
+		ChangeAddress: change,
+		Params:        &chaincfg.RegressionNetParams,
+	})
+	if nil != err {
+		t.Fatal(err)
+	}
+	if txbuilder.SELECTBNB != result.Algorithm || 1 != len(result.Selected) || 10118 != result.Selected[0].Value {
+		t.Fatal("selection: ", result.Algorithm, result.Selected)
+	}
+	if -1 != result.ChangeIndex || 118 != result.Fee || 110 != result.Vsize {
+		t.Fatal("change index: ", result.ChangeIndex, ", fee: ", result.Fee, ", vsize: ", result.Vsize)
+	}
+
+	// psbt round trip
+	packet, err := psbt.Parse(result.Packet.Serialize())
+	if nil != err {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(packet.Serialize(), result.Packet.Serialize()) || packet.UnsignedTx.TxHash() != result.Packet.UnsignedTx.TxHash() {
+		t.Fatal("psbt round trip changed the packet")
+	}
+	if nil == packet.Inputs[0].WitnessUtxo || 10118 != packet.Inputs[0].WitnessUtxo.Value {
+		t.Fatal("witness utxo missing")
+	}
+}
+
+func TestBuildWithChange(t *testing.T) {
+	from, fromScript := testSegwitAddress(t, 1)
+	to, _ := testSegwitAddress(t, 2)
+	change, _ := testSegwitAddress(t, 3)
+
+	err, result := txbuilder.Build(&txbuilder.Request{
+		Utxos: []txbuilder.Utxo{
+			{Txid: strings.Repeat("1", 64), Vout: 0, Value: 50000, Address: from, PkScript: fromScript},
+			{Txid: strings.Repeat("2", 64), Vout: 1, Value: 30000, Address: from, PkScript: fromScript},
+		},
+		Recipients:    []txbuilder.Recipient{{Address: to, Value: 10000}},
+		FeeRate:       1,
+		ChangeAddress: change,
+		Rbf:           true,
+		Params:        &chaincfg.RegressionNetParams,
+	})
+	if nil != err {
+		t.Fatal(err)
+	}
+	if txbuilder.SELECTKNAPSACK != result.Algorithm || 1 != len(result.Selected) || 30000 != result.Selected[0].Value {
+		t.Fatal("selection: ", result.Algorithm, result.Selected)
+	}
+	if 1 != result.ChangeIndex || 19859 != result.Change || 141 != result.Fee {
+		t.Fatal("change: ", result.Change, ", fee: ", result.Fee)
+	}
+	if txbuilder.SEQUENCERBF != result.Packet.UnsignedTx.TxIn[0].Sequence {
+		t.Fatal("rbf not signaled")
+	}
+}
+
+func TestBuildRejects(t *testing.T) {
+	from, fromScript := testSegwitAddress(t, 1)
+	to, _ := testSegwitAddress(t, 2)
+	utxos := []txbuilder.Utxo{{Txid: strings.Repeat("1", 64), Value: 5000, Address: from, PkScript: fromScript}}
+
+	err, _ := txbuilder.Build(&txbuilder.Request{Utxos: utxos, Recipients: []txbuilder.Recipient{{Address: to, Value: 293}}, FeeRate: 1, Params: &chaincfg.RegressionNetParams})
+	if nil == err {
+		t.Fatal("dust output accepted")
+	}
+
+	err, _ = txbuilder.Build(&txbuilder.Request{Utxos: utxos, Recipients: []txbuilder.Recipient{{Address: to, Value: 6000}}, FeeRate: 1, Params: &chaincfg.RegressionNetParams})
+	if txbuilder.ErrInsufficientFunds != err {
+		t.Fatal("insufficient funds: ", err)
+	}
+}
+
+func TestBuildP2shRedeemScript(t *testing.T) {
+	params := &chaincfg.MainNetParams
+	account, err := hdkeychain.NewAccount("ypub6Ww3ibxVfGzLrAH1PNcjyAWenMTbbAosGNB6VvmSEgytSER9azLDWCxoJwW7Ke7icmizBMXrzBx9979FfaHxHcrArf3zbeJJJUZPf663zsP", "", params)
+	if nil != err {
+		t.Fatal(err)
+	}
+	from, err := account.Address(hdkeychain.ExternalChain, 0)
+	if nil != err {
+		t.Fatal(err)
+	}
+	change, err := account.Address(hdkeychain.InternalChain, 0)
+	if nil != err {
+		t.Fatal(err)
+	}
+	fromScript, err := txscript.PayToAddrScript(from, params)
+	if nil != err {
+		t.Fatal(err)
+	}
+	redeemScript, err := account.RedeemScript(hdkeychain.ExternalChain, 0)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(crypto.Hash160(redeemScript), fromScript[2:22]) {
+		t.Fatal("redeem script does not match the address: ", from)
+	}
+
+	err, result := txbuilder.Build(&txbuilder.Request{
+		Utxos:         []txbuilder.Utxo{{Txid: strings.Repeat("1", 64), Value: 50000, Address: from, PkScript: fromScript, Path: "0/0", RedeemScript: redeemScript}},
+		Recipients:    []txbuilder.Recipient{{Address: "bc1qcr8te4kr609gcawutmrza0j4xv80jy8z306fyu", Value: 10000}},
+		FeeRate:       1,
+		ChangeAddress: change,
+		Params:        params,
+	})
+	if nil != err {
+		t.Fatal(err)
+	}
+	packet, err := psbt.Parse(result.Packet.Serialize())
+	if nil != err {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(redeemScript, packet.Inputs[0].RedeemScript) {
+		t.Fatal("redeem script missing from the psbt")
+	}
+}
@@ -0,0 +1,98 @@
+package test
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/BlockABC/wallet-btc-service/common/config"
+	"github.com/BlockABC/wallet-btc-service/webhook"
+)
+
+func TestWebhookSign(t *testing.T) {
+	body := []byte(`{"id":"incoming:BTC:txid:address"}`)
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte("1600000000." + string(body)))
+	expected := "t=1600000000,v1=" + hex.EncodeToString(mac.Sum(nil))
+
+	if result := webhook.Sign("secret", 1600000000, body); expected != result {
+		t.Fatal("signature: ", result, ", expected: ", expected)
+	}
+	if webhook.Sign("other", 1600000000, body) == expected {
+		t.Fatal("signature does not depend on the secret")
+	}
+}
+
+func TestTransferActivity(t *testing.T) {
+	// sender pays 7000 to receiver and gets 2500 change back
+	received := map[string]int64{"receiver": 7000, "sender": 2500}
+	spent := map[string]int64{"sender": 10000}
+
+	unconfirmed := webhook.TransferActivity("txid", received, spent, "", 0)
+	if 2 != len(unconfirmed) {
+		t.Fatal("unconfirmed activity: ", unconfirmed)
+	}
+	for _, one := range unconfirmed {
+		switch one.Address {
+		case "receiver":
+			if webhook.EVENTINCOMING != one.Event || 7000 != one.Value {
+				t.Fatal("receiver activity: ", one)
+			}
+		case "sender":
+			if webhook.EVENTOUTGOING != one.Event || 7500 != one.Value {
+				t.Fatal("sender activity: ", one)
+			}
+		}
+	}
+
+	// the same events once confirmed, confirmations are sent by the tracker
+	confirmed := webhook.TransferActivity("txid", received, spent, "blockhash", 100)
+	if 2 != len(confirmed) {
+		t.Fatal("confirmed activity: ", confirmed)
+	}
+	eventIds := make(map[string]bool)
+	for _, one := range unconfirmed {
+		eventIds[one.EventId()] = true
+	}
+	for _, one := range confirmed {
+		if !eventIds[one.EventId()] {
+			t.Fatal("confirmed transaction changed the event id: ", one.EventId())
+		}
+	}
+
+	// every depth of a confirmation is its own event
+	first := webhook.Activity{Event: webhook.EVENTCONFIRMATION, Token: webhook.TOKENBTC, Txid: "txid", Address: "receiver", Blockhash: "blockhash", Confirmations: 1}
+	third := first
+	third.Confirmations = 3
+	if first.EventId() == third.EventId() {
+		t.Fatal("confirmation depth not in the event id: ", first.EventId())
+	}
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	base := int64(config.Cfg.WebhookOpt.BaseBackoff)
+	max := int64(config.Cfg.WebhookOpt.MaxBackoff)
+	if base != webhook.Backoff(1) || 2*base != webhook.Backoff(2) || 4*base != webhook.Backoff(3) {
+		t.Fatal("backoff: ", webhook.Backoff(1), webhook.Backoff(2), webhook.Backoff(3))
+	}
+	if max != webhook.Backoff(100) {
+		t.Fatal("max backoff: ", webhook.Backoff(100))
+	}
+}
+
+func TestWebhookCheckHost(t *testing.T) {
+	if config.Cfg.WebhookOpt.AllowPrivateHost {
+		t.Skip("private hosts allowed")
+	}
+	for _, host := range []string{"127.0.0.1", "10.1.2.3", "172.16.0.1", "192.168.1.1", "169.254.169.254", "0.0.0.0", "::1", "fd00::1", "fe80::1"} {
+		if webhook.ErrForbiddenHost != webhook.CheckHost(host) {
+			t.Fatal("host not refused: ", host)
+		}
+	}
+	for _, host := range []string{"8.8.8.8", "172.32.0.1", "2001:4860:4860::8888"} {
+		if err := webhook.CheckHost(host); nil != err {
+			t.Fatal("host refused: ", host, err)
+		}
+	}
+}
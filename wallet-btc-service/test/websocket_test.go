@@ -0,0 +1,83 @@
+package test
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/BlockABC/wallet-btc-service/common/websocket"
+)
+
+func TestWebsocketAcceptKey(t *testing.T) {
+	// example of RFC 6455 section 1.3
+	if result := websocket.AcceptKey("dGhlIHNhbXBsZSBub25jZQ=="); "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" != result {
+		t.Fatal("accept key: ", result)
+	}
+}
+
+func TestWebsocketEcho(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := websocket.Upgrade(w, r)
+		if nil != err {
+			return
+		}
+		defer conn.Close()
+		for {
+			messageType, message, err := conn.ReadMessage()
+			if nil != err {
+				return
+			}
+			conn.WriteMessage(messageType, message)
+		}
+	}))
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(server.URL, "http://"))
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	handshake := "GET / HTTP/1.1\r\nHost: localhost\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n" +
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n"
+	if _, err := conn.Write([]byte(handshake)); nil != err {
+		t.Fatal(err)
+	}
+	reader := bufio.NewReader(conn)
+	response, err := http.ReadResponse(reader, nil)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if http.StatusSwitchingProtocols != response.StatusCode || "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" != response.Header.Get("Sec-WebSocket-Accept") {
+		t.Fatal("handshake response: ", response.Status, response.Header)
+	}
+
+	// "Hello" in two masked fragments
+	mask := []byte{0x37, 0xfa, 0x21, 0x3d}
+	frames := []byte{0x01, 0x83}
+	frames = append(frames, mask...)
+	for i, b := range []byte("Hel") {
+		frames = append(frames, b^mask[i%4])
+	}
+	frames = append(frames, 0x80, 0x82)
+	frames = append(frames, mask...)
+	for i, b := range []byte("lo") {
+		frames = append(frames, b^mask[i%4])
+	}
+	if _, err := conn.Write(frames); nil != err {
+		t.Fatal(err)
+	}
+
+	reply := make([]byte, 7)
+	if _, err := io.ReadFull(reader, reply); nil != err {
+		t.Fatal(err)
+	}
+	if !bytes.Equal([]byte{0x81, 0x05, 'H', 'e', 'l', 'l', 'o'}, reply) {
+		t.Fatal("echo frame: ", reply)
+	}
+}
@@ -0,0 +1,92 @@
+package test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/BlockABC/wallet-btc-service/common/zmq"
+)
+
+// zmqPublisher is a local stand-in for the bitcoind zmq publisher
+func zmqPublisher(t *testing.T, listener net.Listener, topic string, body []byte) {
+	conn, err := listener.Accept()
+	if nil != err {
+		t.Error(err)
+		return
+	}
+	defer conn.Close()
+
+	greeting := make([]byte, 64)
+	greeting[0] = 0xff
+	greeting[9] = 0x7f
+	greeting[10] = 3
+	copy(greeting[12:], "NULL")
+	conn.Write(greeting)
+
+	peer := make([]byte, 64)
+	if _, err := io.ReadFull(conn, peer); nil != err {
+		t.Error(err)
+		return
+	}
+
+	// READY from subscriber
+	readFrame := func() (byte, []byte) {
+		head := make([]byte, 2)
+		io.ReadFull(conn, head)
+		body := make([]byte, head[1])
+		io.ReadFull(conn, body)
+		return head[0], body
+	}
+	if flag, ready := readFrame(); 0x04 != flag || !bytes.Contains(ready, []byte("SUB")) {
+		t.Error("subscriber READY is wrong:", ready)
+		return
+	}
+
+	ready := bytes.NewBuffer(nil)
+	ready.WriteString("\x05READY\x0bSocket-Type\x00\x00\x00\x03PUB")
+	conn.Write([]byte{0x04, byte(ready.Len())})
+	conn.Write(ready.Bytes())
+
+	// subscription
+	if _, subscribe := readFrame(); 1 != subscribe[0] || topic != string(subscribe[1:]) {
+		t.Error("subscription is wrong:", subscribe)
+		return
+	}
+
+	// topic, long body, sequence
+	conn.Write(append([]byte{0x01, byte(len(topic))}, topic...))
+	size := make([]byte, 8)
+	binary.BigEndian.PutUint64(size, uint64(len(body)))
+	conn.Write(append([]byte{0x03}, size...))
+	conn.Write(body)
+	conn.Write([]byte{0x00, 0x04, 0x07, 0x00, 0x00, 0x00})
+}
+
+func TestZmqSubscribe(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	body := bytes.Repeat([]byte{0xab}, 300)
+	go zmqPublisher(t, listener, "rawtx", body)
+
+	sub, err := zmq.Subscribe("tcp://"+listener.Addr().String(), []string{"rawtx"}, time.Second)
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+
+	message, err := sub.Receive()
+	if nil != err {
+		t.Fatal(err)
+	}
+	if 3 != len(message) || "rawtx" != string(message[0]) || !bytes.Equal(body, message[1]) || 7 != binary.LittleEndian.Uint32(message[2]) {
+		t.Fatal("receive wrong message:", message)
+	}
+}
@@ -1,7 +1,9 @@
 package timer
 
 import (
+	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/BlockABC/wallet-btc-service/common/log"
 )
@@ -11,6 +13,12 @@ const (
 	RUN  int32 = 1
 )
 
+var (
+	stopMutex sync.Mutex
+	stopped   bool
+	running   sync.WaitGroup
+)
+
 type TimerTask struct {
 	Task  func() error
 	State int32
@@ -25,6 +33,16 @@ func NewTask(oneTask func() error) *TimerTask {
 
 func (task *TimerTask) GetTask() func() {
 	return func() {
+		// no task starts once the timer stops
+		stopMutex.Lock()
+		if stopped {
+			stopMutex.Unlock()
+			return
+		}
+		running.Add(1)
+		stopMutex.Unlock()
+		defer running.Done()
+
 		if bEnter := atomic.CompareAndSwapInt32(&task.State, STOP, RUN); bEnter {
 			if err := task.Task(); nil != err {
 				log.Log.Error("run timer task ", task.Task, err)
@@ -37,3 +55,28 @@ func (task *TimerTask) GetTask() func() {
 		}
 	}
 }
+
+func stopTask() {
+	stopMutex.Lock()
+	stopped = true
+	stopMutex.Unlock()
+}
+
+// Wait waits up to timeout for the running tasks, it returns whether they all finished
+func Wait(timeout time.Duration) bool {
+	stopTask()
+
+	done := make(chan struct{})
+	go func() {
+		running.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		log.Log.Error("timer tasks still running after ", timeout)
+		return false
+	}
+}
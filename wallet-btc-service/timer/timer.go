@@ -1,15 +1,18 @@
 package timer
 
 import (
+	"context"
 	"runtime"
 
 	"github.com/BlockABC/wallet-btc-service/common/config"
+	"github.com/BlockABC/wallet-btc-service/common/log"
 	"github.com/BlockABC/wallet-btc-service/notify"
 	"github.com/BlockABC/wallet-btc-service/omni"
 	"github.com/robfig/cron"
 )
 
-func StartTimer() error {
+// StartTimer runs the repair tasks until ctx is done, the tasks still running then are waited for with Wait
+func StartTimer(ctx context.Context) error {
 	task := cron.New()
 
 	// interval repair block
@@ -59,7 +62,11 @@ func StartTimer() error {
 
 	task.Start()
 
-	select {}
+	<-ctx.Done()
+	task.Stop()
+	stopTask()
+	log.Log.Notice("timer stopped")
+	return nil
 }
 
 func IntervalRepairBlock() {
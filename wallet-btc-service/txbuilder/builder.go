@@ -0,0 +1,228 @@
+package txbuilder
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/BlockABC/wallet-btc-service/common/chaincfg"
+	"github.com/BlockABC/wallet-btc-service/common/crypto"
+	"github.com/BlockABC/wallet-btc-service/common/psbt"
+	"github.com/BlockABC/wallet-btc-service/common/txscript"
+	"github.com/BlockABC/wallet-btc-service/common/wire"
+)
+
+const (
+	TXVERSION        = 2
+	SEQUENCEFINAL    = 0xffffffff
+	SEQUENCERBF      = 0xfffffffd // signals replaceability of BIP125
+	MAXRECIPIENTS    = 1000
+	MAXFEERATE       = 10000 // sat/vB, a higher rate is taken as a mistake
+	MAXSTANDARDVSIZE = 100000
+)
+
+var (
+	ErrNoRecipient       = errors.New("no recipient")
+	ErrTooManyRecipients = errors.New("too many recipients")
+	ErrInvalidValue      = errors.New("recipient value must be positive")
+	ErrDustOutput        = errors.New("recipient value is dust")
+	ErrInvalidFeeRate    = errors.New("fee rate out of range")
+	ErrInsufficientFunds = errors.New("insufficient funds")
+	ErrNoChangeAddress   = errors.New("change is needed but no change address")
+	ErrTxTooLarge        = errors.New("transaction is larger than the standard size")
+)
+
+// spendable output
+type Utxo struct {
+	Txid         string
+	Vout         uint32
+	Value        int64
+	Address      string
+	PkScript     []byte
+	Blockhash    string // empty for unconfirmed outputs
+	Path         string // chain/index of an extended public key
+	RedeemScript []byte // redeem script of a p2sh output, put in the psbt for the signer when it is known
+}
+
+type Recipient struct {
+	Address string
+	Value   int64
+}
+
+// build request, FeeRate is in sat/vB
+type Request struct {
+	Utxos         []Utxo
+	Recipients    []Recipient
+	FeeRate       float64
+	ChangeAddress string
+	Rbf           bool
+	Params        *chaincfg.Params
+}
+
+// built transaction, ChangeIndex is -1 when there is no change output
+type Result struct {
+	Packet      *psbt.Packet
+	Selected    []Utxo
+	Fee         int64
+	Vsize       int64
+	Change      int64
+	ChangeIndex int
+	Algorithm   string
+}
+
+// Build selects the coins to pay the recipients at the fee rate and returns the unsigned psbt. Branch and bound
+// looks for a selection without change first, the knapsack solver is the fallback. Change below the dust
+// limit is left to the fee.
+func Build(request *Request) (error, *Result) {
+	if 0 == len(request.Recipients) {
+		return ErrNoRecipient, nil
+	}
+	if len(request.Recipients) > MAXRECIPIENTS {
+		return ErrTooManyRecipients, nil
+	}
+	if request.FeeRate < 1 || request.FeeRate > MAXFEERATE {
+		return ErrInvalidFeeRate, nil
+	}
+
+	// recipients
+	outputScripts := make([][]byte, 0, len(request.Recipients)+1)
+	var payValue int64
+	for _, oneRecipient := range request.Recipients {
+		pkScript, err := txscript.PayToAddrScript(oneRecipient.Address, request.Params)
+		if nil != err {
+			return fmt.Errorf("%v: %s", err, oneRecipient.Address), nil
+		}
+		if oneRecipient.Value <= 0 {
+			return ErrInvalidValue, nil
+		}
+		if oneRecipient.Value < DustLimit(pkScript) {
+			return fmt.Errorf("%v: %s needs at least %d", ErrDustOutput, oneRecipient.Address, DustLimit(pkScript)), nil
+		}
+		outputScripts = append(outputScripts, pkScript)
+		payValue += oneRecipient.Value
+	}
+
+	// change, a p2wpkh output is assumed when there is no change address
+	changeScript := []byte{txscript.OP_0, txscript.OP_DATA_20}
+	changeScript = append(changeScript, make([]byte, 20)...)
+	if "" != request.ChangeAddress {
+		pkScript, err := txscript.PayToAddrScript(request.ChangeAddress, request.Params)
+		if nil != err {
+			return fmt.Errorf("%v: %s", err, request.ChangeAddress), nil
+		}
+		changeScript = pkScript
+	}
+
+	// coins worth spending at the fee rate
+	pool := make([]candidate, 0, len(request.Utxos))
+	witness := false
+	for index, oneUtxo := range request.Utxos {
+		weight := InputWeight(oneUtxo.PkScript)
+		if 0 == weight {
+			continue
+		}
+		effective := oneUtxo.Value - Fee(weight, request.FeeRate)
+		if effective <= 0 {
+			continue
+		}
+		pool = append(pool, candidate{index, effective})
+		witness = witness || IsWitnessInput(oneUtxo.PkScript)
+	}
+
+	// fee of everything but the inputs, the witness flag is counted when any coin has witness
+	fixedWeight := int64(txOverheadWeight)
+	fixedWeight += int64(wire.CompactSizeLen(uint64(len(pool)))+wire.CompactSizeLen(uint64(len(outputScripts)))) * wire.WITNESS_SCALE_FACTOR
+	for _, pkScript := range outputScripts {
+		fixedWeight += OutputWeight(pkScript)
+	}
+	if witness {
+		fixedWeight += witnessFlagWeight
+	}
+	target := payValue + Fee(fixedWeight, request.FeeRate)
+	changeFee := Fee(OutputWeight(changeScript), request.FeeRate)
+	costOfChange := changeFee + Fee(InputWeight(changeScript), request.FeeRate)
+
+	algorithm := SELECTBNB
+	selected := selectBnB(pool, target, costOfChange)
+	if nil == selected {
+		algorithm = SELECTKNAPSACK
+		selected = selectKnapsack(pool, target, target+changeFee+DustLimit(changeScript))
+	}
+	if 0 == len(selected) {
+		return ErrInsufficientFunds, nil
+	}
+
+	result := &Result{ChangeIndex: -1, Algorithm: algorithm}
+	inputScripts := make([][]byte, 0, len(selected))
+	var inputValue int64
+	for _, one := range selected {
+		oneUtxo := request.Utxos[one.Index]
+		result.Selected = append(result.Selected, oneUtxo)
+		inputScripts = append(inputScripts, oneUtxo.PkScript)
+		inputValue += oneUtxo.Value
+	}
+
+	// fee of the real sizes
+	noChangeWeight := TxWeight(inputScripts, outputScripts)
+	changeWeight := TxWeight(inputScripts, append(outputScripts, changeScript))
+	change := inputValue - payValue - Fee(changeWeight, request.FeeRate)
+	if change >= DustLimit(changeScript) {
+		if "" == request.ChangeAddress {
+			return ErrNoChangeAddress, nil
+		}
+		result.Change = change
+		result.ChangeIndex = len(outputScripts)
+		result.Vsize = Vsize(changeWeight)
+		outputScripts = append(outputScripts, changeScript)
+	} else {
+		result.Vsize = Vsize(noChangeWeight)
+	}
+	result.Fee = inputValue - payValue - result.Change
+	if result.Fee < Fee(noChangeWeight, request.FeeRate) {
+		return ErrInsufficientFunds, nil
+	}
+	if result.Vsize > MAXSTANDARDVSIZE {
+		return ErrTxTooLarge, nil
+	}
+
+	// unsigned transaction
+	sequence := uint32(SEQUENCEFINAL)
+	if request.Rbf {
+		sequence = SEQUENCERBF
+	}
+	tx := &wire.MsgTx{Version: TXVERSION}
+	for _, oneUtxo := range result.Selected {
+		hash, err := crypto.StringToHash(oneUtxo.Txid)
+		if nil != err || 32 != len(hash) {
+			return fmt.Errorf("invalid utxo txid: %s", oneUtxo.Txid), nil
+		}
+		tx.TxIn = append(tx.TxIn, &wire.TxIn{PreviousOutPoint: wire.OutPoint{Hash: hash, Index: oneUtxo.Vout}, Sequence: sequence})
+	}
+	for index, pkScript := range outputScripts {
+		value := result.Change
+		if index < len(request.Recipients) {
+			value = request.Recipients[index].Value
+		}
+		tx.TxOut = append(tx.TxOut, &wire.TxOut{Value: value, PkScript: pkScript})
+	}
+
+	// decode again so the hashes are computed
+	unsignedTx, err := wire.DeserializeTx(tx.SerializeNoWitness())
+	if nil != err {
+		return err, nil
+	}
+	packet, err := psbt.New(unsignedTx)
+	if nil != err {
+		return err, nil
+	}
+	for index, oneUtxo := range result.Selected {
+		if IsWitnessInput(oneUtxo.PkScript) {
+			packet.Inputs[index].WitnessUtxo = &wire.TxOut{Value: oneUtxo.Value, PkScript: oneUtxo.PkScript}
+		}
+		if txscript.IsPayToScriptHash(oneUtxo.PkScript) && nil != oneUtxo.RedeemScript {
+			packet.Inputs[index].RedeemScript = oneUtxo.RedeemScript
+		}
+	}
+	result.Packet = packet
+
+	return nil, result
+}
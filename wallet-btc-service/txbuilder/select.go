@@ -0,0 +1,184 @@
+package txbuilder
+
+import (
+	"math/rand"
+	"sort"
+	"time"
+)
+
+const (
+	BNBMAXTRIES       = 100000 // branch and bound search steps, same as bitcoind
+	KNAPSACKITERATION = 1000   // random subsets tried by the knapsack solver
+)
+
+// coin selection algorithm
+const (
+	SELECTBNB      = "bnb"
+	SELECTKNAPSACK = "knapsack"
+)
+
+// coin to select from, Effective is the value minus the fee of spending it
+type candidate struct {
+	Index     int
+	Effective int64
+}
+
+// selectBnB searches the coins whose effective value is in [target, target+costOfChange] so no change is
+// needed, it returns the selection with the least excess or nil
+func selectBnB(pool []candidate, target int64, costOfChange int64) []candidate {
+	sorted := append([]candidate{}, pool...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Effective > sorted[j].Effective
+	})
+
+	var available int64
+	for _, one := range sorted {
+		available += one.Effective
+	}
+	if available < target {
+		return nil
+	}
+
+	var current int64
+	selection := make([]int, 0)
+	var best []int
+	bestExcess := int64(-1)
+	index := 0
+	for try := 0; try < BNBMAXTRIES; try, index = try+1, index+1 {
+		backtrack := false
+		if current+available < target || current > target+costOfChange {
+			backtrack = true
+		} else if current >= target {
+			if bestExcess < 0 || current-target <= bestExcess {
+				best = append([]int{}, selection...)
+				bestExcess = current - target
+				if 0 == bestExcess {
+					break
+				}
+			}
+			backtrack = true
+		}
+
+		if backtrack {
+			if 0 == len(selection) {
+				break
+			}
+			// coins left out of the branch become available again, then the last selected coin is left out
+			last := selection[len(selection)-1]
+			for index--; index > last; index-- {
+				available += sorted[index].Effective
+			}
+			current -= sorted[last].Effective
+			selection = selection[:len(selection)-1]
+		} else {
+			available -= sorted[index].Effective
+			// leaving out a coin equal to the one left out before searches the same branch
+			if 0 == len(selection) || index-1 == selection[len(selection)-1] || sorted[index].Effective != sorted[index-1].Effective {
+				selection = append(selection, index)
+				current += sorted[index].Effective
+			}
+		}
+	}
+
+	if nil == best {
+		return nil
+	}
+	result := make([]candidate, 0, len(best))
+	for _, one := range best {
+		result = append(result, sorted[one])
+	}
+	return result
+}
+
+// approximateBestSubset tries random subsets of values, it returns the subset with the smallest sum not
+// below target
+func approximateBestSubset(random *rand.Rand, values []candidate, total int64, target int64) ([]bool, int64) {
+	best := make([]bool, len(values))
+	for index := range best {
+		best[index] = true
+	}
+	bestValue := total
+
+	for repeat := 0; repeat < KNAPSACKITERATION && bestValue != target; repeat++ {
+		included := make([]bool, len(values))
+		var sum int64
+		reached := false
+		for pass := 0; pass < 2 && !reached; pass++ {
+			for index, one := range values {
+				// the first pass picks at random, the second one adds the coins left out
+				pick := !included[index]
+				if 0 == pass {
+					pick = 0 == random.Intn(2)
+				}
+				if !pick {
+					continue
+				}
+
+				sum += one.Effective
+				included[index] = true
+				if sum >= target {
+					reached = true
+					if sum < bestValue {
+						bestValue = sum
+						copy(best, included)
+					}
+					sum -= one.Effective
+					included[index] = false
+				}
+			}
+		}
+	}
+
+	return best, bestValue
+}
+
+// selectKnapsack selects coins paying target exactly or at least changeTarget, so that the change is not
+// dust, it returns nil when the coins are not enough
+func selectKnapsack(pool []candidate, target int64, changeTarget int64) []candidate {
+	var lowestLarger *candidate
+	applicable := make([]candidate, 0)
+	var totalLower int64
+	for index, one := range pool {
+		if one.Effective == target {
+			return []candidate{one}
+		}
+		if one.Effective < changeTarget {
+			applicable = append(applicable, one)
+			totalLower += one.Effective
+		} else if nil == lowestLarger || one.Effective < lowestLarger.Effective {
+			lowestLarger = &pool[index]
+		}
+	}
+
+	if totalLower == target {
+		return applicable
+	}
+	if totalLower < target {
+		if nil == lowestLarger {
+			return nil
+		}
+		return []candidate{*lowestLarger}
+	}
+
+	sort.SliceStable(applicable, func(i, j int) bool {
+		return applicable[i].Effective > applicable[j].Effective
+	})
+	random := rand.New(rand.NewSource(time.Now().UnixNano()))
+	best, bestValue := approximateBestSubset(random, applicable, totalLower, target)
+	if bestValue != target && totalLower >= changeTarget {
+		best, bestValue = approximateBestSubset(random, applicable, totalLower, changeTarget)
+	}
+
+	// a single larger coin is better than a subset leaving dust change or spending more
+	if nil != lowestLarger && ((bestValue != target && bestValue < changeTarget) || lowestLarger.Effective <= bestValue) {
+		return []candidate{*lowestLarger}
+	}
+
+	result := make([]candidate, 0)
+	for index, one := range applicable {
+		if best[index] {
+			result = append(result, one)
+		}
+	}
+	return result
+}
@@ -0,0 +1,97 @@
+package txbuilder
+
+import (
+	"math"
+
+	"github.com/BlockABC/wallet-btc-service/common/txscript"
+	"github.com/BlockABC/wallet-btc-service/common/wire"
+)
+
+const (
+	DUSTRELAYFEE = 3 // sat/vB, dust relay fee of bitcoind
+
+	txOverheadWeight  = (4 + 4) * wire.WITNESS_SCALE_FACTOR // version and locktime
+	witnessFlagWeight = 2                                   // segwit marker and flag
+	outPointSize      = 32 + 4 + 4                          // previous output and sequence
+)
+
+// InputWeight returns the weight of spending pkScript with a single signature, p2sh is taken as p2sh-p2wpkh.
+// It is 0 for scripts whose spending size is unknown, such as p2wsh and bare multisig.
+func InputWeight(pkScript []byte) int64 {
+	if txscript.IsPayToPubKeyHash(pkScript) {
+		// script sig: signature and compressed public key
+		return (outPointSize + 1 + 107) * wire.WITNESS_SCALE_FACTOR
+	}
+	if txscript.IsPayToScriptHash(pkScript) {
+		// script sig: p2wpkh program, witness: signature and compressed public key
+		return (outPointSize+1+23)*wire.WITNESS_SCALE_FACTOR + 108
+	}
+
+	isWitness, version, program := txscript.ExtractWitnessProgram(pkScript)
+	if !isWitness {
+		return 0
+	}
+	switch {
+	case 0 == version && 20 == len(program):
+		return (outPointSize+1)*wire.WITNESS_SCALE_FACTOR + 108
+	case 1 == version && 32 == len(program):
+		// key path schnorr signature
+		return (outPointSize+1)*wire.WITNESS_SCALE_FACTOR + 66
+	}
+	return 0
+}
+
+// IsWitnessInput reports if spending pkScript has witness data
+func IsWitnessInput(pkScript []byte) bool {
+	isWitness, _, _ := txscript.ExtractWitnessProgram(pkScript)
+	return isWitness || txscript.IsPayToScriptHash(pkScript)
+}
+
+// OutputWeight returns the weight of an output paying to pkScript
+func OutputWeight(pkScript []byte) int64 {
+	return int64(8+wire.CompactSizeLen(uint64(len(pkScript)))+len(pkScript)) * wire.WITNESS_SCALE_FACTOR
+}
+
+// TxWeight returns the weight of a transaction spending inputs and paying to outputs, both are scriptPubKeys
+func TxWeight(inputs [][]byte, outputs [][]byte) int64 {
+	weight := int64(txOverheadWeight)
+	weight += int64(wire.CompactSizeLen(uint64(len(inputs)))+wire.CompactSizeLen(uint64(len(outputs)))) * wire.WITNESS_SCALE_FACTOR
+
+	witnessCount := 0
+	for _, pkScript := range inputs {
+		weight += InputWeight(pkScript)
+		if IsWitnessInput(pkScript) {
+			witnessCount++
+		}
+	}
+	for _, pkScript := range outputs {
+		weight += OutputWeight(pkScript)
+	}
+
+	// inputs without witness have an empty witness once any input has one
+	if 0 != witnessCount {
+		weight += witnessFlagWeight + int64(len(inputs)-witnessCount)
+	}
+	return weight
+}
+
+// Vsize returns the virtual size of weight
+func Vsize(weight int64) int64 {
+	return (weight + wire.WITNESS_SCALE_FACTOR - 1) / wire.WITNESS_SCALE_FACTOR
+}
+
+// Fee returns the fee of weight at feeRate sat/vB
+func Fee(weight int64, feeRate float64) int64 {
+	return int64(math.Ceil(feeRate * float64(weight) / wire.WITNESS_SCALE_FACTOR))
+}
+
+// DustLimit returns the smallest output value paying to pkScript that is not dust, same as bitcoind
+func DustLimit(pkScript []byte) int64 {
+	size := int64(8 + wire.CompactSizeLen(uint64(len(pkScript))) + len(pkScript))
+	if isWitness, _, _ := txscript.ExtractWitnessProgram(pkScript); isWitness {
+		size += 32 + 4 + 1 + 107/wire.WITNESS_SCALE_FACTOR + 4
+	} else {
+		size += 32 + 4 + 1 + 107 + 4
+	}
+	return size * DUSTRELAYFEE
+}
@@ -0,0 +1,239 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/BlockABC/wallet-btc-service/common/config"
+	"github.com/BlockABC/wallet-btc-service/common/log"
+	"github.com/BlockABC/wallet-btc-service/database"
+	"github.com/BlockABC/wallet-btc-service/database/tables"
+)
+
+const (
+	MAXERRORLEN    = 512
+	MAXBODYLEN     = 256 // response body kept in the last error
+	DEFAULTTIMEOUT = 10  // seconds of a delivery request if webhook.timeout is not set
+)
+
+// request headers of a delivery
+const (
+	HEADERSIGNATURE = "X-Webhook-Signature"
+	HEADEREVENT     = "X-Webhook-Event"
+	HEADEREVENTID   = "X-Webhook-Event-Id"
+	HEADERDELIVERY  = "X-Webhook-Delivery"
+)
+
+// Backoff returns the seconds before the next attempt after attempts failed ones, it doubles from the base
+// backoff up to the max backoff
+func Backoff(attempts int32) int64 {
+	base := int64(config.Cfg.WebhookOpt.BaseBackoff)
+	max := int64(config.Cfg.WebhookOpt.MaxBackoff)
+	if base <= 0 {
+		base = 1
+	}
+
+	delay := base
+	for i := int32(1); i < attempts && (max <= 0 || delay < max); i++ {
+		delay *= 2
+	}
+	if max > 0 && delay > max {
+		delay = max
+	}
+	return delay
+}
+
+// due delivery with its webhook
+type dueDelivery struct {
+	tables.TableWebhookDeliveryInfo
+	Url    string
+	Secret string
+}
+
+// Start delivers the due webhook events until ctx is done, deliveries are persisted so the pending ones are
+// sent after a restart
+func Start(ctx context.Context) error {
+	interval := time.Duration(config.Cfg.WebhookOpt.Interval) * time.Second
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			DeliverDue()
+		}
+	}
+}
+
+// DeliverDue sends a batch of the pending deliveries whose next attempt is due
+func DeliverDue() error {
+	batchSize := config.Cfg.WebhookOpt.BatchSize
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+	concurrency := config.Cfg.WebhookOpt.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	var allDue []dueDelivery
+	selectSql := fmt.Sprintf("select t1.*, t2.url, t2.secret from t_webhook_delivery_info t1, t_webhook_info t2 where t1.state = %d and t1.nextattempt <= %d and t2.id = t1.webhookid order by t1.nextattempt limit %d;", DELIVERYPENDING, time.Now().Unix(), batchSize)
+	if err := database.Db.Raw(selectSql).Scan(&allDue).Error; nil != err {
+		log.Log.Error(err, " exec sql fail: ", selectSql)
+		return err
+	}
+
+	wg := sync.WaitGroup{}
+	ch := make(chan int, concurrency)
+	for index := range allDue {
+		ch <- index
+		wg.Add(1)
+		go func(oneDue *dueDelivery) {
+			defer func() {
+				<-ch
+				wg.Done()
+
+				// handle panic
+				if err := recover(); err != nil {
+					log.Log.Error(err, " panic occur when deliver webhook, delivery id: ", oneDue.Id)
+				}
+			}()
+			deliver(oneDue)
+		}(&allDue[index])
+	}
+	wg.Wait()
+
+	return nil
+}
+
+// newHttpClient returns the client of the deliveries, it refuses to connect to the hosts refused by Register
+// so a host resolving to a private address after its webhook is registered gets no delivery
+func newHttpClient() *http.Client {
+	timeout := time.Duration(config.Cfg.WebhookOpt.Timeout) * time.Second
+	if timeout <= 0 {
+		timeout = DEFAULTTIMEOUT * time.Second
+	}
+
+	dialer := &net.Dialer{Timeout: timeout}
+	if !config.Cfg.WebhookOpt.AllowPrivateHost {
+		dialer.Control = func(network, address string, c syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if nil != err {
+				return err
+			}
+			if ip := net.ParseIP(host); nil == ip || forbiddenIp(ip) {
+				return ErrForbiddenHost
+			}
+			return nil
+		}
+	}
+	return &http.Client{Timeout: timeout, Transport: &http.Transport{DialContext: dialer.DialContext}}
+}
+
+// post sends the payload signed with the secret, a response other than 2xx is an error
+func post(oneDue *dueDelivery) error {
+	body := []byte(oneDue.Payload)
+	httpRequest, err := http.NewRequest("POST", oneDue.Url, bytes.NewReader(body))
+	if nil != err {
+		return err
+	}
+	httpRequest.Close = true
+	httpRequest.Header.Set("Content-Type", "application/json")
+	httpRequest.Header.Set(HEADERSIGNATURE, Sign(oneDue.Secret, time.Now().Unix(), body))
+	httpRequest.Header.Set(HEADEREVENT, oneDue.Event)
+	httpRequest.Header.Set(HEADEREVENTID, oneDue.Eventid)
+	httpRequest.Header.Set(HEADERDELIVERY, fmt.Sprintf("%d", oneDue.Id))
+
+	httpResponse, err := newHttpClient().Do(httpRequest)
+	if nil != err {
+		return err
+	}
+	respBytes, _ := ioutil.ReadAll(httpResponse.Body)
+	httpResponse.Body.Close()
+
+	if httpResponse.StatusCode < 200 || httpResponse.StatusCode >= 300 {
+		if len(respBytes) > MAXBODYLEN {
+			respBytes = respBytes[:MAXBODYLEN]
+		}
+		return fmt.Errorf("%d %s %s", httpResponse.StatusCode, http.StatusText(httpResponse.StatusCode), strings.TrimSpace(string(respBytes)))
+	}
+	return nil
+}
+
+// deliver sends one delivery and saves the result, a failed delivery is retried after the backoff until the
+// max attempts, then it is dead
+func deliver(oneDue *dueDelivery) {
+	now := time.Now().Unix()
+	attempts := oneDue.Attempts + 1
+	err := post(oneDue)
+	if nil == err {
+		updateSql := fmt.Sprintf("update t_webhook_delivery_info set state = %d, attempts = %d, lasterror = '', updatetime = %d where id = %d;", DELIVERYDELIVERED, attempts, now, oneDue.Id)
+		if err := database.Db.Exec(updateSql).Error; nil != err {
+			log.Log.Error(err, " exec sql fail: ", updateSql)
+		}
+		log.Log.Info("deliver webhook success, delivery id: ", oneDue.Id, ", event id: ", oneDue.Eventid)
+		return
+	}
+
+	lastError := err.Error()
+	if len(lastError) > MAXERRORLEN {
+		lastError = lastError[:MAXERRORLEN]
+	}
+	state := DELIVERYPENDING
+	if maxAttempts := config.Cfg.WebhookOpt.MaxAttempts; maxAttempts > 0 && int(attempts) >= maxAttempts {
+		state = DELIVERYDEAD
+	}
+	log.Log.Error(err, " deliver webhook fail, delivery id: ", oneDue.Id, ", attempts: ", attempts, ", state: ", state)
+
+	updateSql := "update t_webhook_delivery_info set state = ?, attempts = ?, nextattempt = ?, lasterror = ?, updatetime = ? where id = ?;"
+	if err := database.Db.Exec(updateSql, state, attempts, now+Backoff(attempts), lastError, now, oneDue.Id).Error; nil != err {
+		log.Log.Error(err, " update t_webhook_delivery_info fail, delivery id: ", oneDue.Id)
+	}
+}
+
+// GetDeliveries returns a page of the deliveries of a webhook in a state, the latest first
+func GetDeliveries(webhookId int64, state int, page int, size int) (error, []tables.TableWebhookDeliveryInfo) {
+	var result []tables.TableWebhookDeliveryInfo
+	if err := database.Db.Where("webhookid = ? AND state = ?", webhookId, state).Order("id desc").Offset(page * size).Limit(size).Find(&result).Error; nil != err {
+		log.Log.Error(err, " select * from t_webhook_delivery_info fail, webhook id: ", webhookId)
+		return err, nil
+	}
+	return nil, result
+}
+
+// Replay queues dead deliveries of a webhook again with their attempts reset, it returns how many are queued
+func Replay(webhookId int64, ids []int64) (error, int64) {
+	if 0 == len(ids) {
+		return nil, 0
+	}
+
+	var strIds string
+	for index, oneId := range ids {
+		if 0 == index {
+			strIds += fmt.Sprintf("%d", oneId)
+		} else {
+			strIds += fmt.Sprintf(",%d", oneId)
+		}
+	}
+	now := time.Now().Unix()
+	updateSql := fmt.Sprintf("update t_webhook_delivery_info set state = %d, attempts = 0, nextattempt = %d, updatetime = %d where webhookid = %d and state = %d and id in (%s);", DELIVERYPENDING, now, now, webhookId, DELIVERYDEAD, strIds)
+	result := database.Db.Exec(updateSql)
+	if err := result.Error; nil != err {
+		log.Log.Error(err, " exec sql fail: ", updateSql)
+		return err, 0
+	}
+	return nil, result.RowsAffected
+}
@@ -0,0 +1,279 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BlockABC/wallet-btc-service/common/log"
+	"github.com/BlockABC/wallet-btc-service/database"
+	"github.com/BlockABC/wallet-btc-service/database/tables"
+)
+
+const (
+	TOKENBTC  = "BTC"
+	TOKENUSDT = "USDT"
+	TOKENOMNI = "OMNI"
+)
+
+// direction of an omni transfer
+const (
+	DIRECTIONIN  = "in"
+	DIRECTIONOUT = "out"
+)
+
+// activity of an address in a transaction. Value is the satoshi received by an incoming event or a
+// confirmation and spent by an outgoing event, Amount is the amount of an omni transfer.
+type Activity struct {
+	Event         string `json:"event"`
+	Txid          string `json:"txid"`
+	Address       string `json:"address"`
+	Token         string `json:"token"`
+	Value         int64  `json:"value"`
+	Amount        string `json:"amount,omitempty"`
+	Propertyid    uint64 `json:"propertyid,omitempty"`
+	Direction     string `json:"direction,omitempty"`
+	Blockhash     string `json:"blockhash,omitempty"`
+	Height        int32  `json:"height,omitempty"`
+	Confirmations int32  `json:"confirmations,omitempty"`
+}
+
+// EventId identifies the activity, incoming and outgoing events of a transaction are the same before and after
+// it is confirmed, a confirmation is per block and depth and a revert per block
+func (a *Activity) EventId() string {
+	eventId := fmt.Sprintf("%s:%s:%s:%s", a.Event, a.Token, a.Txid, a.Address)
+	switch a.Event {
+	case EVENTCONFIRMATION:
+		eventId += fmt.Sprintf(":%s:%d", a.Blockhash, a.Confirmations)
+	case EVENTREVERTED:
+		eventId += ":" + a.Blockhash
+	}
+	return eventId
+}
+
+// body posted to a webhook
+type Payload struct {
+	Id        string   `json:"id"`
+	Event     string   `json:"event"`
+	Webhookid int64    `json:"webhook_id"`
+	Created   int64    `json:"created"`
+	Data      Activity `json:"data"`
+}
+
+// TransferActivity returns the incoming and outgoing events of a transaction from the value every address
+// received and spent. An address spending is only sent an outgoing event of the value it lost, its change is
+// not incoming.
+func TransferActivity(txid string, received map[string]int64, spent map[string]int64, blockhash string, height int32) []Activity {
+	allAddress := make([]string, 0, len(received)+len(spent))
+	for oneAddress := range received {
+		allAddress = append(allAddress, oneAddress)
+	}
+	for oneAddress := range spent {
+		if _, ok := received[oneAddress]; !ok {
+			allAddress = append(allAddress, oneAddress)
+		}
+	}
+	sort.Strings(allAddress)
+
+	result := make([]Activity, 0)
+	for _, oneAddress := range allAddress {
+		if "" == oneAddress {
+			continue
+		}
+		net := received[oneAddress] - spent[oneAddress]
+		oneActivity := Activity{Txid: txid, Address: oneAddress, Token: TOKENBTC, Blockhash: blockhash, Height: height}
+		if _, ok := spent[oneAddress]; ok {
+			oneActivity.Event = EVENTOUTGOING
+			oneActivity.Value = -net
+		} else {
+			oneActivity.Event = EVENTINCOMING
+			oneActivity.Value = net
+		}
+		result = append(result, oneActivity)
+	}
+	return result
+}
+
+// watching webhook of an address
+type watch struct {
+	Webhookid int64
+	Address   string
+	Xpubid    int64
+	Chain     int32
+	Idx       int32
+	Events    string
+}
+
+// queryWatch returns the webhooks watching the addresses
+func queryWatch(addresses []string) (error, []watch) {
+	result := make([]watch, 0)
+	for begin := 0; begin < len(addresses); begin += database.MAX_WITh_IN {
+		end := begin + database.MAX_WITh_IN
+		if end > len(addresses) {
+			end = len(addresses)
+		}
+
+		var pageWatch []watch
+		selectSql := fmt.Sprintf("select t1.webhookid, t1.address, t1.xpubid, t1.chain, t1.idx, t2.events from t_webhook_address_info t1, t_webhook_info t2 where t1.address in (%s) and t2.id = t1.webhookid;", joinSqlString(addresses[begin:end]))
+		if err := database.Db.Raw(selectSql).Scan(&pageWatch).Error; nil != err {
+			log.Log.Error(err, " exec sql fail: ", selectSql)
+			return err, nil
+		}
+		result = append(result, pageWatch...)
+	}
+	return nil, result
+}
+
+// Publish queues a delivery of every activity to the webhooks watching its address, an event already queued
+// for a webhook is not queued again
+func Publish(allActivity []Activity) error {
+	if 0 == len(allActivity) {
+		return nil
+	}
+
+	addressMap := make(map[string]bool)
+	addresses := make([]string, 0)
+	for _, oneActivity := range allActivity {
+		if !addressMap[oneActivity.Address] {
+			addressMap[oneActivity.Address] = true
+			addresses = append(addresses, oneActivity.Address)
+		}
+	}
+	err, allWatch := queryWatch(addresses)
+	if nil != err {
+		return err
+	}
+	if 0 == len(allWatch) {
+		return nil
+	}
+
+	watchMap := make(map[string][]watch)
+	for _, oneWatch := range allWatch {
+		watchMap[oneWatch.Address] = append(watchMap[oneWatch.Address], oneWatch)
+	}
+
+	now := time.Now().Unix()
+	values := make([]string, 0)
+	args := make([]interface{}, 0)
+	for _, oneActivity := range allActivity {
+		for _, oneWatch := range watchMap[oneActivity.Address] {
+			if !accepts(oneWatch.Events, oneActivity.Event) {
+				continue
+			}
+			payload := Payload{
+				Id:        oneActivity.EventId(),
+				Event:     oneActivity.Event,
+				Webhookid: oneWatch.Webhookid,
+				Created:   now,
+				Data:      oneActivity,
+			}
+			info, err := json.Marshal(payload)
+			if nil != err {
+				log.Log.Error(err, " marshal webhook payload fail, event id: ", payload.Id)
+				return err
+			}
+			values = append(values, fmt.Sprintf("(?, ?, ?, ?, %d, 0, %d, '', %d, %d)", DELIVERYPENDING, now, now, now))
+			args = append(args, oneWatch.Webhookid, payload.Id, payload.Event, string(info))
+		}
+	}
+
+	// deliveries, 4 arguments each
+	for begin := 0; begin < len(values); begin += database.MAX_WITH_INSERT {
+		end := begin + database.MAX_WITH_INSERT
+		if end > len(values) {
+			end = len(values)
+		}
+		insertSql := "insert ignore into t_webhook_delivery_info(webhookid, eventid, event, payload, state, attempts, nextattempt, lasterror, createtime, updatetime) values " + strings.Join(values[begin:end], ",") + ";"
+		if err := database.Db.Exec(insertSql, args[begin*4:end*4]...).Error; nil != err {
+			log.Log.Error(err, " insert into t_webhook_delivery_info fail")
+			return err
+		}
+	}
+
+	extendUsedXpub(allWatch)
+	return nil
+}
+
+// extendUsedXpub derives more addresses of the extended public keys whose addresses near the gap limit are used
+func extendUsedXpub(allWatch []watch) {
+	used := make(map[int64][]int32)
+	for _, oneWatch := range allWatch {
+		if 0 == oneWatch.Xpubid || oneWatch.Chain < 0 || oneWatch.Chain >= XPUBCHAINS {
+			continue
+		}
+		if _, ok := used[oneWatch.Xpubid]; !ok {
+			used[oneWatch.Xpubid] = make([]int32, XPUBCHAINS)
+		}
+		if oneWatch.Idx+1+gapLimit() > used[oneWatch.Xpubid][oneWatch.Chain] {
+			used[oneWatch.Xpubid][oneWatch.Chain] = oneWatch.Idx + 1 + gapLimit()
+		}
+	}
+
+	for xpubId, count := range used {
+		var allXpub []tables.TableWebhookXpubInfo
+		if err := database.Db.Where("id = ?", xpubId).Find(&allXpub).Error; nil != err {
+			log.Log.Error(err, " select * from t_webhook_xpub_info fail, id: ", xpubId)
+			continue
+		}
+		if 0 == len(allXpub) {
+			continue
+		}
+		if count[0] > allXpub[0].Receivecount || count[1] > allXpub[0].Changecount {
+			extendXpub(&allXpub[0], count)
+		}
+	}
+}
+
+// PublishBlock queues the events of the watched addresses in a stored block
+func PublishBlock(blockhash string, height int32) error {
+	type addressValue struct {
+		Txid    string
+		Address string
+		Value   int64
+	}
+
+	var allOutput []addressValue
+	outputSql := fmt.Sprintf("select t1.hash as txid, t1.`to` as address, sum(t1.value) as value from t_output_info t1 where t1.blockhash = '%s' and t1.isfork = 0 and t1.`to` in (select address from t_webhook_address_info) group by t1.hash, t1.`to`;", blockhash)
+	if err := database.Db.Raw(outputSql).Scan(&allOutput).Error; nil != err {
+		log.Log.Error(err, " exec sql fail: ", outputSql)
+		return err
+	}
+
+	var allInput []addressValue
+	inputSql := fmt.Sprintf("select t1.hash as txid, t1.`from` as address, sum(t1.value) as value from t_input_info t1 where t1.blockhash = '%s' and t1.isfork = 0 and t1.`from` in (select address from t_webhook_address_info) group by t1.hash, t1.`from`;", blockhash)
+	if err := database.Db.Raw(inputSql).Scan(&allInput).Error; nil != err {
+		log.Log.Error(err, " exec sql fail: ", inputSql)
+		return err
+	}
+
+	// group by transaction
+	txids := make([]string, 0)
+	received := make(map[string]map[string]int64)
+	spent := make(map[string]map[string]int64)
+	for _, oneOutput := range allOutput {
+		if _, ok := received[oneOutput.Txid]; !ok {
+			received[oneOutput.Txid] = make(map[string]int64)
+			if _, ok := spent[oneOutput.Txid]; !ok {
+				txids = append(txids, oneOutput.Txid)
+			}
+		}
+		received[oneOutput.Txid][oneOutput.Address] += oneOutput.Value
+	}
+	for _, oneInput := range allInput {
+		if _, ok := spent[oneInput.Txid]; !ok {
+			spent[oneInput.Txid] = make(map[string]int64)
+			if _, ok := received[oneInput.Txid]; !ok {
+				txids = append(txids, oneInput.Txid)
+			}
+		}
+		spent[oneInput.Txid][oneInput.Address] += oneInput.Value
+	}
+
+	allActivity := make([]Activity, 0)
+	for _, txid := range txids {
+		allActivity = append(allActivity, TransferActivity(txid, received[txid], spent[txid], blockhash, height)...)
+	}
+	return Publish(allActivity)
+}
@@ -0,0 +1,395 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/BlockABC/wallet-btc-service/common/config"
+	"github.com/BlockABC/wallet-btc-service/common/hdkeychain"
+	"github.com/BlockABC/wallet-btc-service/common/log"
+	"github.com/BlockABC/wallet-btc-service/database"
+	"github.com/BlockABC/wallet-btc-service/database/tables"
+)
+
+// event types
+const (
+	EVENTINCOMING     = "incoming"
+	EVENTOUTGOING     = "outgoing"
+	EVENTCONFIRMATION = "confirmation"
+	EVENTOMNITRANSFER = "omni_transfer"
+	EVENTREVERTED     = "reverted"
+)
+
+var ALLEVENT = []string{EVENTINCOMING, EVENTOUTGOING, EVENTCONFIRMATION, EVENTOMNITRANSFER, EVENTREVERTED}
+
+// state of t_webhook_delivery_info
+const (
+	DELIVERYPENDING   = 0
+	DELIVERYDELIVERED = 1
+	DELIVERYDEAD      = 2
+)
+
+const (
+	SECRETLEN       = 32
+	DEFAULTGAPLIMIT = 20
+	XPUBCHAINS      = 2
+)
+
+var (
+	ErrInvalidUrl     = errors.New("webhook url must be http or https")
+	ErrInvalidEvent   = errors.New("unknown webhook event")
+	ErrWebhookNotFind = errors.New("webhook not find")
+	ErrForbiddenHost  = errors.New("webhook host is loopback, link local or private")
+)
+
+// ParseEvents checks the events and returns them joined by comma, empty means all events
+func ParseEvents(events []string) (error, string) {
+	result := make([]string, 0, len(events))
+	for _, oneEvent := range events {
+		oneEvent = strings.TrimSpace(oneEvent)
+		valid := false
+		for _, known := range ALLEVENT {
+			if known == oneEvent {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return fmt.Errorf("%v: %s", ErrInvalidEvent, oneEvent), ""
+		}
+		result = append(result, oneEvent)
+	}
+	return nil, strings.Join(result, ",")
+}
+
+// accepts reports if a webhook subscribing events gets event
+func accepts(events string, event string) bool {
+	if "" == events {
+		return true
+	}
+	for _, oneEvent := range strings.Split(events, ",") {
+		if oneEvent == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Sign returns the signature header of a delivery, HMAC-SHA256 of "timestamp.body" with the secret of the webhook
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(fmt.Sprintf("%d.", timestamp)))
+	mac.Write(body)
+	return fmt.Sprintf("t=%d,v1=%s", timestamp, hex.EncodeToString(mac.Sum(nil)))
+}
+
+// forbiddenIp reports if ip is a loopback, link local, private or unspecified address
+func forbiddenIp(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() ||
+		ip.IsUnspecified() || isPrivate(ip)
+}
+
+// isPrivate reports if ip is in the private ranges of RFC 1918 and RFC 4193
+func isPrivate(ip net.IP) bool {
+	if ip4 := ip.To4(); nil != ip4 {
+		return 10 == ip4[0] || (172 == ip4[0] && 16 == ip4[1]&0xf0) || (192 == ip4[0] && 168 == ip4[1])
+	}
+	return 0xfc == ip[0]&0xfe
+}
+
+// CheckHost resolves host and refuses it if any of its addresses is loopback, link local or private, it passes
+// every host if private hosts are allowed
+func CheckHost(host string) error {
+	if config.Cfg.WebhookOpt.AllowPrivateHost {
+		return nil
+	}
+	allIp, err := net.LookupIP(host)
+	if nil != err {
+		return err
+	}
+	for _, oneIp := range allIp {
+		if forbiddenIp(oneIp) {
+			return ErrForbiddenHost
+		}
+	}
+	return nil
+}
+
+// Register saves a webhook of the api key, the generated secret is returned only here
+func Register(apiKeyId int64, rawUrl string, events string) (error, *tables.TableWebhookInfo) {
+	parsed, err := url.Parse(rawUrl)
+	if nil != err || ("http" != parsed.Scheme && "https" != parsed.Scheme) || "" == parsed.Hostname() {
+		return ErrInvalidUrl, nil
+	}
+	if err := CheckHost(parsed.Hostname()); nil != err {
+		log.Log.Info("register webhook refused, url: ", rawUrl, ", error: ", err)
+		return ErrForbiddenHost, nil
+	}
+
+	secret := make([]byte, SECRETLEN)
+	if _, err := rand.Read(secret); nil != err {
+		log.Log.Error(err, " generate webhook secret fail")
+		return err, nil
+	}
+
+	oneWebhook := tables.TableWebhookInfo{
+		Url:        rawUrl,
+		Secret:     hex.EncodeToString(secret),
+		Events:     events,
+		Apikeyid:   apiKeyId,
+		Createtime: time.Now().Unix(),
+	}
+	if err := database.Db.Create(&oneWebhook).Error; nil != err {
+		log.Log.Error(err, " insert into t_webhook_info fail, url: ", rawUrl)
+		return err, nil
+	}
+	return nil, &oneWebhook
+}
+
+// GetWebhook returns the webhook of id registered by the api key, ErrWebhookNotFind if there is none
+func GetWebhook(apiKeyId int64, id int64) (error, *tables.TableWebhookInfo) {
+	var result []tables.TableWebhookInfo
+	if err := database.Db.Where("id = ? AND apikeyid = ?", id, apiKeyId).Find(&result).Error; nil != err {
+		log.Log.Error(err, " select * from t_webhook_info fail, id: ", id)
+		return err, nil
+	}
+	if 0 == len(result) {
+		return ErrWebhookNotFind, nil
+	}
+	return nil, &result[0]
+}
+
+// GetAllWebhook returns the webhooks registered by the api key
+func GetAllWebhook(apiKeyId int64) (error, []tables.TableWebhookInfo) {
+	var result []tables.TableWebhookInfo
+	if err := database.Db.Where("apikeyid = ?", apiKeyId).Order("id").Find(&result).Error; nil != err {
+		log.Log.Error(err, " select * from t_webhook_info fail, api key id: ", apiKeyId)
+		return err, nil
+	}
+	return nil, result
+}
+
+// GetWatch returns the addresses and extended public keys watched by a webhook
+func GetWatch(id int64) (error, []tables.TableWebhookAddressInfo, []tables.TableWebhookXpubInfo) {
+	var allAddress []tables.TableWebhookAddressInfo
+	if err := database.Db.Where("webhookid = ?", id).Order("id").Find(&allAddress).Error; nil != err {
+		log.Log.Error(err, " select * from t_webhook_address_info fail, webhook id: ", id)
+		return err, nil, nil
+	}
+	var allXpub []tables.TableWebhookXpubInfo
+	if err := database.Db.Where("webhookid = ?", id).Order("id").Find(&allXpub).Error; nil != err {
+		log.Log.Error(err, " select * from t_webhook_xpub_info fail, webhook id: ", id)
+		return err, nil, nil
+	}
+	return nil, allAddress, allXpub
+}
+
+// Delete removes a webhook with its watch list and deliveries
+func Delete(id int64) error {
+	dbTx := database.Db.Begin()
+	if err := dbTx.Error; nil != err {
+		log.Log.Error(err, " Delete webhook start database transaction fail")
+		return err
+	}
+
+	for _, tableName := range []string{"t_webhook_address_info", "t_webhook_xpub_info", "t_webhook_delivery_info"} {
+		deleteSql := fmt.Sprintf("delete from %s where webhookid = %d;", tableName, id)
+		if err := dbTx.Exec(deleteSql).Error; nil != err {
+			log.Log.Error(err, " exec sql fail: ", deleteSql)
+			dbTx.Rollback()
+			return err
+		}
+	}
+	deleteSql := fmt.Sprintf("delete from t_webhook_info where id = %d;", id)
+	if err := dbTx.Exec(deleteSql).Error; nil != err {
+		log.Log.Error(err, " exec sql fail: ", deleteSql)
+		dbTx.Rollback()
+		return err
+	}
+
+	if err := dbTx.Commit().Error; nil != err {
+		log.Log.Error(err, " Delete webhook commit fail, id: ", id)
+		dbTx.Rollback()
+		return err
+	}
+	return nil
+}
+
+// insertWatch saves watched addresses, an address already watched by the webhook is kept
+func insertWatch(allWatch []tables.TableWebhookAddressInfo) error {
+	for begin := 0; begin < len(allWatch); begin += database.MAX_WITH_INSERT {
+		end := begin + database.MAX_WITH_INSERT
+		if end > len(allWatch) {
+			end = len(allWatch)
+		}
+
+		insertSql := "insert ignore into t_webhook_address_info(webhookid, address, xpubid, chain, idx) values "
+		for index, oneWatch := range allWatch[begin:end] {
+			if 0 != index {
+				insertSql += ","
+			}
+			insertSql += fmt.Sprintf("(%d, '%s', %d, %d, %d)", oneWatch.Webhookid, oneWatch.Address, oneWatch.Xpubid, oneWatch.Chain, oneWatch.Idx)
+		}
+		insertSql += ";"
+		if err := database.Db.Exec(insertSql).Error; nil != err {
+			log.Log.Error(err, " exec sql fail: ", insertSql)
+			return err
+		}
+	}
+	return nil
+}
+
+// WatchAddresses adds valid addresses to the watch list of a webhook
+func WatchAddresses(id int64, addresses []string) error {
+	allWatch := make([]tables.TableWebhookAddressInfo, 0, len(addresses))
+	for _, oneAddress := range addresses {
+		allWatch = append(allWatch, tables.TableWebhookAddressInfo{Webhookid: id, Address: oneAddress})
+	}
+	return insertWatch(allWatch)
+}
+
+// UnwatchAddresses removes addresses from the watch list of a webhook, addresses of an extended public key
+// are removed with the key
+func UnwatchAddresses(id int64, addresses []string) error {
+	if 0 == len(addresses) {
+		return nil
+	}
+	deleteSql := fmt.Sprintf("delete from t_webhook_address_info where webhookid = %d and xpubid = 0 and address in (%s);", id, joinSqlString(addresses))
+	if err := database.Db.Exec(deleteSql).Error; nil != err {
+		log.Log.Error(err, " exec sql fail: ", deleteSql)
+		return err
+	}
+	return nil
+}
+
+// UnwatchXpub removes an extended public key and its addresses from the watch list of a webhook
+func UnwatchXpub(id int64, xpub string) error {
+	var allXpub []tables.TableWebhookXpubInfo
+	if err := database.Db.Where("webhookid = ? AND xpub = ?", id, xpub).Find(&allXpub).Error; nil != err {
+		log.Log.Error(err, " select * from t_webhook_xpub_info fail, webhook id: ", id)
+		return err
+	}
+	for _, oneXpub := range allXpub {
+		deleteSql := fmt.Sprintf("delete from t_webhook_address_info where xpubid = %d;", oneXpub.Id)
+		if err := database.Db.Exec(deleteSql).Error; nil != err {
+			log.Log.Error(err, " exec sql fail: ", deleteSql)
+			return err
+		}
+		deleteSql = fmt.Sprintf("delete from t_webhook_xpub_info where id = %d;", oneXpub.Id)
+		if err := database.Db.Exec(deleteSql).Error; nil != err {
+			log.Log.Error(err, " exec sql fail: ", deleteSql)
+			return err
+		}
+	}
+	return nil
+}
+
+func gapLimit() int32 {
+	if config.Cfg.BtcOpt.XpubGapLimit <= 0 {
+		return DEFAULTGAPLIMIT
+	}
+	return int32(config.Cfg.BtcOpt.XpubGapLimit)
+}
+
+// deriveWatch watches the addresses of chain from index begin to end of an extended public key
+func deriveWatch(oneXpub *tables.TableWebhookXpubInfo, chain int32, begin int32, end int32) error {
+	if end <= begin {
+		return nil
+	}
+	account, err := hdkeychain.NewAccount(oneXpub.Xpub, oneXpub.Type, config.Cfg.ChainParams)
+	if nil != err {
+		return err
+	}
+	addresses, err := account.Addresses(uint32(chain), uint32(begin), uint32(end-begin))
+	if nil != err {
+		return err
+	}
+
+	allWatch := make([]tables.TableWebhookAddressInfo, 0, len(addresses))
+	for offset, oneAddress := range addresses {
+		allWatch = append(allWatch, tables.TableWebhookAddressInfo{
+			Webhookid: oneXpub.Webhookid,
+			Address:   oneAddress,
+			Xpubid:    oneXpub.Id,
+			Chain:     chain,
+			Idx:       begin + int32(offset),
+		})
+	}
+	return insertWatch(allWatch)
+}
+
+// WatchXpub watches an extended public key, next is the first unused index of the receive and change chains,
+// addresses up to the gap limit after it are watched and more are derived as they are used
+func WatchXpub(id int64, xpub string, derivation string, next []uint32) error {
+	if _, err := hdkeychain.NewAccount(xpub, derivation, config.Cfg.ChainParams); nil != err {
+		return err
+	}
+
+	var allXpub []tables.TableWebhookXpubInfo
+	if err := database.Db.Where("webhookid = ? AND xpub = ?", id, xpub).Find(&allXpub).Error; nil != err {
+		log.Log.Error(err, " select * from t_webhook_xpub_info fail, webhook id: ", id)
+		return err
+	}
+	if 0 != len(allXpub) {
+		return nil
+	}
+
+	oneXpub := tables.TableWebhookXpubInfo{Webhookid: id, Xpub: xpub, Type: derivation}
+	if err := database.Db.Create(&oneXpub).Error; nil != err {
+		log.Log.Error(err, " insert into t_webhook_xpub_info fail, webhook id: ", id)
+		return err
+	}
+
+	count := make([]int32, XPUBCHAINS)
+	for chain := range count {
+		if chain < len(next) {
+			count[chain] = int32(next[chain])
+		}
+		count[chain] += gapLimit()
+	}
+	return extendXpub(&oneXpub, count)
+}
+
+// extendXpub derives the addresses of the chains up to count and saves the derived counts
+func extendXpub(oneXpub *tables.TableWebhookXpubInfo, count []int32) error {
+	derived := []int32{oneXpub.Receivecount, oneXpub.Changecount}
+	for chain := range derived {
+		if count[chain] <= derived[chain] {
+			continue
+		}
+		if err := deriveWatch(oneXpub, int32(chain), derived[chain], count[chain]); nil != err {
+			log.Log.Error(err, " derive webhook xpub address fail, xpub id: ", oneXpub.Id)
+			return err
+		}
+		derived[chain] = count[chain]
+	}
+
+	updateSql := fmt.Sprintf("update t_webhook_xpub_info set receivecount = %d, changecount = %d where id = %d;", derived[0], derived[1], oneXpub.Id)
+	if err := database.Db.Exec(updateSql).Error; nil != err {
+		log.Log.Error(err, " exec sql fail: ", updateSql)
+		return err
+	}
+	oneXpub.Receivecount, oneXpub.Changecount = derived[0], derived[1]
+	return nil
+}
+
+// joinSqlString returns the strings as a sql in list
+func joinSqlString(values []string) string {
+	var result string
+	for index, oneValue := range values {
+		if 0 == index {
+			result += `'` + oneValue + `'`
+		} else {
+			result += `,'` + oneValue + `'`
+		}
+	}
+	return result
+}